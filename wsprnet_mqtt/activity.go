@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default and largest time ranges, in hours, for the recent activity views.
+// Window history and the spot logs only go back 24 hours.
+const (
+	defaultActivityHours = 1
+	maxActivityHours     = 24
+)
+
+// ActivitySummary is the submission activity over a recent time range,
+// computed from the window history
+type ActivitySummary struct {
+	Hours         int            `json:"hours"`
+	Since         time.Time      `json:"since"`
+	Windows       int            `json:"windows"`
+	Sent          int            `json:"sent"`
+	Duplicates    int            `json:"duplicates"`
+	Failed        int            `json:"failed"`
+	Imported      int            `json:"imported"` // Spots backfilled from WSPRNet, not included in Sent
+	BandBreakdown map[string]int `json:"band_breakdown"`
+}
+
+// GetActivity totals the windows from the last hours hours
+func (st *StatisticsTracker) GetActivity(hours int) ActivitySummary {
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	summary := ActivitySummary{
+		Hours:         hours,
+		Since:         since,
+		BandBreakdown: make(map[string]int),
+	}
+
+	st.recentWindowsMu.RLock()
+	defer st.recentWindowsMu.RUnlock()
+
+	for _, window := range st.recentWindows {
+		if window.WindowTime.Before(since) {
+			continue
+		}
+		summary.Windows++
+		for band, count := range window.BandBreakdown {
+			summary.BandBreakdown[band] += count
+		}
+		if window.Imported {
+			summary.Imported += window.TotalSpots
+			continue
+		}
+		summary.Sent += window.TotalSpots
+		summary.Duplicates += window.DuplicateCount
+		summary.Failed += window.FailedCount
+	}
+	return summary
+}
+
+// parseActivityHours reads the optional hours query parameter (1-24)
+func parseActivityHours(r *http.Request, fallback int) (int, error) {
+	value := r.URL.Query().Get("hours")
+	if value == "" {
+		return fallback, nil
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours < 1 || hours > maxActivityHours {
+		return 0, fmt.Errorf("hours must be a whole number from 1 to %d", maxActivityHours)
+	}
+	return hours, nil
+}
+
+// countryStatsFromSpots builds the /api/countries view from deduplicated
+// spots, for time ranges shorter than the 24 hours the country statistics cover
+func countryStatsFromSpots(spots []StoredSpot) map[string][]map[string]interface{} {
+	type countryTotals struct {
+		country, band string
+		callsigns     map[string]bool
+		minSNR        int
+		maxSNR        int
+		totalSNR      int
+		count         int
+	}
+
+	// Key: band_country
+	totals := make(map[string]*countryTotals)
+	for _, spot := range spots {
+		if spot.Country == "" {
+			continue
+		}
+		key := spot.Band + "_" + spot.Country
+		t, ok := totals[key]
+		if !ok {
+			t = &countryTotals{
+				country:   spot.Country,
+				band:      spot.Band,
+				callsigns: make(map[string]bool),
+				minSNR:    spot.SNR,
+				maxSNR:    spot.SNR,
+			}
+			totals[key] = t
+		}
+		t.callsigns[spot.Callsign] = true
+		t.minSNR = min(t.minSNR, spot.SNR)
+		t.maxSNR = max(t.maxSNR, spot.SNR)
+		t.totalSNR += spot.SNR
+		t.count++
+	}
+
+	// Group by band, in the same shape as GetCountryStats
+	result := make(map[string][]map[string]interface{})
+	for _, t := range totals {
+		result[t.band] = append(result[t.band], map[string]interface{}{
+			"country":          t.country,
+			"unique_callsigns": len(t.callsigns),
+			"min_snr":          t.minSNR,
+			"max_snr":          t.maxSNR,
+			"avg_snr":          float64(t.totalSNR) / float64(t.count),
+			"total_spots":      t.count,
+		})
+	}
+	return result
+}
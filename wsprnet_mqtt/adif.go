@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adifFlushRecords is how many ADIF records are written between flushes to the client
+const adifFlushRecords = 500
+
+// adifBandNames maps frequencyToBand names that differ from the ADIF band
+// enumeration; every other band name is already the same
+var adifBandNames = map[string]string{
+	"2200m": "2190m",
+}
+
+// adifBand returns the ADIF band for a frequency in Hz, or "" if the frequency
+// is outside the bands frequencyToBand knows
+func adifBand(freq uint64) string {
+	band := frequencyToBand(freq)
+	if strings.HasSuffix(band, "MHz") {
+		return ""
+	}
+	if name, ok := adifBandNames[band]; ok {
+		return name
+	}
+	return band
+}
+
+// writeADIFField writes one <NAME:length>value field. Empty values are skipped.
+func writeADIFField(w *bufio.Writer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(w, "<%s:%d>%s", name, len(value), value)
+}
+
+// handleADIFExport streams the spots WSPRNet accepted as an ADIF 3 log, oldest
+// first, optionally only those since a time given in RFC3339
+func (ws *WebServer) handleADIFExport(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	since, err := parseOptionalTime(r.URL.Query().Get("since"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid since: %v", err))
+		return
+	}
+
+	submitted := true
+	spots := ws.spotWriter.GetDedupedSpots("", since, time.Time{}, &submitted)
+	sort.SliceStable(spots, func(i, j int) bool {
+		return spots[i].Timestamp.Before(spots[j].Timestamp)
+	})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"wspr_submitted_%s.adi\"", time.Now().UTC().Format("20060102_1504")))
+
+	// Records are written straight to the response and flushed in batches
+	// rather than building the whole log in memory
+	flusher, _ := w.(http.Flusher)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "WSPR spots submitted to WSPRNet by wsprnet_mqtt, generated %s\n", time.Now().UTC().Format(time.RFC3339))
+	writeADIFField(bw, "ADIF_VER", "3.1.4")
+	writeADIFField(bw, "CREATED_TIMESTAMP", time.Now().UTC().Format("20060102 150405"))
+	writeADIFField(bw, "PROGRAMID", "wsprnet_mqtt")
+	writeADIFField(bw, "PROGRAMVERSION", Version)
+	bw.WriteString("<EOH>\n")
+
+	for i, spot := range spots {
+		t := spot.Timestamp.UTC()
+		writeADIFField(bw, "CALL", spot.Callsign)
+		writeADIFField(bw, "GRIDSQUARE", spot.Locator)
+		writeADIFField(bw, "BAND", adifBand(spot.Frequency))
+		writeADIFField(bw, "FREQ", strconv.FormatFloat(float64(spot.Frequency)/1e6, 'f', 6, 64))
+		writeADIFField(bw, "MODE", "WSPR")
+		writeADIFField(bw, "QSO_DATE", t.Format("20060102"))
+		writeADIFField(bw, "TIME_ON", t.Format("150405"))
+		writeADIFField(bw, "APP_WSPR_SNR", strconv.Itoa(spot.SNR))
+		bw.WriteString("<EOR>\n")
+
+		if (i+1)%adifFlushRecords == 0 {
+			if err := bw.Flush(); err != nil {
+				return // Client went away
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		log.Printf("Warning: ADIF export ended early: %v", err)
+	}
+}
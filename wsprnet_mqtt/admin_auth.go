@@ -1,29 +1,62 @@
 package main
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
 	"sync"
 	"time"
 )
 
+// DefaultAdminSessionHours is how long an admin login lasts unless
+// admin_session_hours is set
+const DefaultAdminSessionHours = 24
+
+// sessionSweepInterval is how often expired sessions are removed
+const sessionSweepInterval = 10 * time.Minute
+
 // SessionManager handles admin session management
 type SessionManager struct {
-	sessions map[string]*Session
+	sessions map[string]*Session // By token hash
 	mu       sync.RWMutex
+
+	// File the sessions are saved to after every change (empty = memory only)
+	path string
+
+	// admin_password the sessions were created under
+	password string
 }
 
-// Session represents an admin session
+// Session represents an admin session. Only a hash of the token is kept, so
+// the sessions file can't be used to log in.
 type Session struct {
-	Token     string
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	TokenHash   string    `json:"token_hash"`
+	PasswordTag string    `json:"password_tag"` // Ties the session to the admin password it was created under
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
 }
 
-// NewSessionManager creates a new session manager
-func NewSessionManager() *SessionManager {
+// NewSessionManager creates a new session manager for logins with password.
+// If path is set, sessions still valid in it are loaded, so a restart doesn't
+// log the admin out; those created under a different password are dropped.
+func NewSessionManager(path, password string) *SessionManager {
 	sm := &SessionManager{
 		sessions: make(map[string]*Session),
+		path:     path,
+		password: password,
+	}
+
+	if path != "" {
+		if err := sm.load(); err != nil {
+			log.Printf("Admin: Failed to load sessions from %s: %v", path, err)
+		} else if len(sm.sessions) > 0 {
+			log.Printf("Admin: Restored %d session(s) from %s", len(sm.sessions), path)
+		}
 	}
 
 	// Start cleanup goroutine
@@ -32,34 +65,40 @@ func NewSessionManager() *SessionManager {
 	return sm
 }
 
-// CreateSession creates a new session and returns the token
-func (sm *SessionManager) CreateSession() string {
+// CreateSession creates a new session lasting ttl and returns the token
+func (sm *SessionManager) CreateSession(ttl time.Duration) string {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	token := generateToken()
+	now := time.Now()
+	hash := hashToken(token)
 	session := &Session{
-		Token:     token,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour), // 24 hour session
+		TokenHash:   hash,
+		PasswordTag: passwordTag(sm.password, hash),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
 	}
 
-	sm.sessions[token] = session
+	sm.sessions[session.TokenHash] = session
+	sm.save()
 	return token
 }
 
-// ValidateSession checks if a session token is valid
+// ValidateSession checks if a session token is valid. Expired sessions are
+// rejected whether or not the sweep has removed them yet, as are sessions
+// from before a password change.
 func (sm *SessionManager) ValidateSession(token string) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	session, exists := sm.sessions[token]
-	if !exists {
+	session, exists := sm.sessions[hashToken(token)]
+	if !exists || !sm.matchesPassword(session) {
 		return false
 	}
 
 	// Check if session has expired
-	if time.Now().After(session.ExpiresAt) {
+	if !time.Now().Before(session.ExpiresAt) {
 		return false
 	}
 
@@ -71,24 +110,136 @@ func (sm *SessionManager) DeleteSession(token string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	delete(sm.sessions, token)
+	hash := hashToken(token)
+	if _, exists := sm.sessions[hash]; !exists {
+		return
+	}
+	delete(sm.sessions, hash)
+	sm.save()
+}
+
+// SetPassword ends every session if password differs from the one they were
+// created under, so a leaked session cookie doesn't outlive a password change
+func (sm *SessionManager) SetPassword(password string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if password == sm.password {
+		return
+	}
+	sm.password = password
+	if len(sm.sessions) > 0 {
+		log.Printf("Admin: Password changed, ending %d session(s)", len(sm.sessions))
+		sm.sessions = make(map[string]*Session)
+		sm.save()
+	}
+}
+
+// matchesPassword reports whether session was created under the current
+// password. Caller must hold mu.
+func (sm *SessionManager) matchesPassword(session *Session) bool {
+	return hmac.Equal([]byte(session.PasswordTag), []byte(passwordTag(sm.password, session.TokenHash)))
 }
 
 // cleanupExpiredSessions periodically removes expired sessions
 func (sm *SessionManager) cleanupExpiredSessions() {
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := time.NewTicker(sessionSweepInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		sm.mu.Lock()
-		now := time.Now()
-		for token, session := range sm.sessions {
-			if now.After(session.ExpiresAt) {
-				delete(sm.sessions, token)
-			}
+		sm.sweep()
+	}
+}
+
+// sweep removes expired sessions, saving the file if any were removed
+func (sm *SessionManager) sweep() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.removeExpired() > 0 {
+		sm.save()
+	}
+}
+
+// removeExpired drops expired sessions and returns how many there were.
+// Caller must hold mu.
+func (sm *SessionManager) removeExpired() int {
+	removed := 0
+	now := time.Now()
+	for hash, session := range sm.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(sm.sessions, hash)
+			removed++
+		}
+	}
+	return removed
+}
+
+// load reads the sessions file, if it exists, keeping the sessions that
+// haven't expired
+func (sm *SessionManager) load() error {
+	data, err := os.ReadFile(sm.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return fmt.Errorf("failed to decode sessions file: %w", err)
+	}
+	for _, session := range sessions {
+		if session != nil && session.TokenHash != "" && sm.matchesPassword(session) {
+			sm.sessions[session.TokenHash] = session
 		}
-		sm.mu.Unlock()
 	}
+	sm.removeExpired()
+	return nil
+}
+
+// save writes the sessions to the sessions file, if there is one, replacing
+// it atomically. Failures are logged; the sessions stay valid in memory.
+// Caller must hold mu.
+func (sm *SessionManager) save() {
+	if sm.path == "" {
+		return
+	}
+
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		sessions = append(sessions, session)
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		log.Printf("Admin: Failed to encode sessions: %v", err)
+		return
+	}
+
+	tmpPath := sm.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		log.Printf("Admin: Failed to save sessions: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, sm.path); err != nil {
+		log.Printf("Admin: Failed to save sessions: %v", err)
+	}
+}
+
+// hashToken returns the key a session is stored under for token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// passwordTag returns the tag tying the session with tokenHash to password.
+// It is keyed on the password, so a tag can only be checked, not reversed,
+// without guessing the password.
+func passwordTag(password, tokenHash string) string {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(tokenHash))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // generateToken generates a random session token
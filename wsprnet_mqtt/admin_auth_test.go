@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	sm := NewSessionManager("", "hunter2")
+	token := sm.CreateSession(time.Hour)
+	if !sm.ValidateSession(token) {
+		t.Fatal("new session rejected")
+	}
+	if sm.ValidateSession("forged") {
+		t.Error("unknown token accepted")
+	}
+
+	// Expired but not yet swept, the session is still rejected
+	sm.mu.Lock()
+	sm.sessions[hashToken(token)].ExpiresAt = time.Now().Add(-time.Second)
+	sm.mu.Unlock()
+	if sm.ValidateSession(token) {
+		t.Error("expired session accepted before the sweep")
+	}
+	sm.sweep()
+	sm.mu.RLock()
+	remaining := len(sm.sessions)
+	sm.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("%d sessions left after the sweep, want 0", remaining)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	sm := NewSessionManager("", "hunter2")
+	token := sm.CreateSession(time.Hour)
+	other := sm.CreateSession(time.Hour)
+
+	sm.DeleteSession(token)
+	if sm.ValidateSession(token) {
+		t.Error("deleted session accepted")
+	}
+	if !sm.ValidateSession(other) {
+		t.Error("deleting one session ended another")
+	}
+	sm.DeleteSession(token) // Already gone: no-op
+}
+
+func TestSessionPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin_sessions.json")
+
+	sm := NewSessionManager(path, "hunter2")
+	kept := sm.CreateSession(time.Hour)
+	expiring := sm.CreateSession(time.Hour)
+	deleted := sm.CreateSession(time.Hour)
+	sm.DeleteSession(deleted)
+	sm.mu.Lock()
+	sm.sessions[hashToken(expiring)].ExpiresAt = time.Now().Add(-time.Second)
+	sm.save()
+	sm.mu.Unlock()
+
+	// After a restart, live sessions are still logged in
+	restarted := NewSessionManager(path, "hunter2")
+	if !restarted.ValidateSession(kept) {
+		t.Error("session lost across a restart")
+	}
+	if restarted.ValidateSession(expiring) {
+		t.Error("expired session restored")
+	}
+	if restarted.ValidateSession(deleted) {
+		t.Error("deleted session restored")
+	}
+
+	// A restart under a new password drops them
+	if changed := NewSessionManager(path, "correct horse"); changed.ValidateSession(kept) {
+		t.Error("session restored under a different password")
+	}
+}
+
+func TestSessionPasswordChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin_sessions.json")
+
+	sm := NewSessionManager(path, "hunter2")
+	token := sm.CreateSession(time.Hour)
+
+	sm.SetPassword("hunter2")
+	if !sm.ValidateSession(token) {
+		t.Fatal("setting the same password ended the session")
+	}
+
+	sm.SetPassword("correct horse")
+	if sm.ValidateSession(token) {
+		t.Error("session accepted after a password change")
+	}
+	if restarted := NewSessionManager(path, "hunter2"); restarted.ValidateSession(token) {
+		t.Error("session ended by a password change came back after a restart")
+	}
+
+	// New logins work under the new password
+	if !sm.ValidateSession(sm.CreateSession(time.Hour)) {
+		t.Error("session created after the password change rejected")
+	}
+}
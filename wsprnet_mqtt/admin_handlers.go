@@ -7,6 +7,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -14,23 +17,30 @@ import (
 
 // AdminHandler handles admin-related HTTP requests
 type AdminHandler struct {
-	config         *Config
+	config         *SharedConfig
 	configFile     string
 	sessionManager *SessionManager
+
+	// Serializes config changes, so two saves can't both start from the same old config
+	saveMu sync.Mutex
+
+	// Applies saved config changes in place when restart_on_save is false (nil = always restart)
+	reloader *ConfigReloader
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(config *Config, configFile string) *AdminHandler {
+func NewAdminHandler(config *SharedConfig, configFile string) *AdminHandler {
+	current := config.Load()
 	return &AdminHandler{
 		config:         config,
 		configFile:     configFile,
-		sessionManager: NewSessionManager(),
+		sessionManager: NewSessionManager(current.AdminSessionsFile, current.AdminPassword),
 	}
 }
 
 // IsAdminEnabled checks if admin access is enabled
 func (ah *AdminHandler) IsAdminEnabled() bool {
-	return ah.config.AdminPassword != ""
+	return ah.config.Load().AdminPassword != ""
 }
 
 // AuthMiddleware checks if the user is authenticated
@@ -67,7 +77,7 @@ func (ah *AdminHandler) HandleAdminLogin(w http.ResponseWriter, r *http.Request)
 	}
 
 	if r.Method == "GET" {
-		ah.serveLoginPage(w)
+		ah.serveLoginPage(w, http.StatusOK)
 		return
 	}
 
@@ -78,16 +88,18 @@ func (ah *AdminHandler) HandleAdminLogin(w http.ResponseWriter, r *http.Request)
 		}
 
 		password := r.FormValue("password")
-		if password == ah.config.AdminPassword {
+		config := ah.config.Load()
+		if password == config.AdminPassword {
 			// Create session
-			token := ah.sessionManager.CreateSession()
+			ttl := time.Duration(config.AdminSessionHours) * time.Hour
+			token := ah.sessionManager.CreateSession(ttl)
 
 			// Set cookie
 			http.SetCookie(w, &http.Cookie{
 				Name:     "admin_session",
 				Value:    token,
 				Path:     "/",
-				MaxAge:   86400, // 24 hours
+				MaxAge:   int(ttl.Seconds()),
 				HttpOnly: true,
 				SameSite: http.SameSiteStrictMode,
 			})
@@ -97,7 +109,7 @@ func (ah *AdminHandler) HandleAdminLogin(w http.ResponseWriter, r *http.Request)
 		}
 
 		// Invalid password
-		ah.serveLoginPage(w)
+		ah.serveLoginPage(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -127,15 +139,17 @@ func (ah *AdminHandler) HandleAdminLogout(w http.ResponseWriter, r *http.Request
 
 // HandleAdminDashboard serves the admin dashboard
 func (ah *AdminHandler) HandleAdminDashboard(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
 	html := ah.getAdminDashboardHTML()
-	w.Write([]byte(html))
+	if _, err := w.Write([]byte(html)); err != nil {
+		log.Printf("Error writing admin dashboard: %v", err)
+	}
 }
 
 // HandleGetConfig returns the current configuration
 func (ah *AdminHandler) HandleGetConfig(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ah.config)
+	writeJSON(w, http.StatusOK, ah.config.Load())
 }
 
 // HandleUpdateConfig updates the configuration
@@ -145,11 +159,16 @@ func (ah *AdminHandler) HandleUpdateConfig(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ah.saveMu.Lock()
+	defer ah.saveMu.Unlock()
+
 	var newConfig Config
 	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to parse config: %v", err), http.StatusBadRequest)
 		return
 	}
+	// Not in the JSON; keep the hook from the config file
+	newConfig.WindowHook = ah.config.Load().WindowHook
 
 	// Validate new config
 	if err := newConfig.Validate(); err != nil {
@@ -169,21 +188,57 @@ func (ah *AdminHandler) HandleUpdateConfig(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Update in-memory config
-	*ah.config = newConfig
-
-	log.Println("Configuration updated via admin interface - triggering application restart")
+	log.Println("Configuration updated via admin interface")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	if !ah.applyConfigChange(&newConfig, "update", "config update") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":  "success",
+			"message": "Configuration saved and applied without a restart.",
+			"restart": false,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
 		"message": "Configuration saved successfully. Application will restart in 2 seconds...",
+		"restart": true,
 	})
+}
 
-	// Trigger application exit after a short delay to allow response to be sent
+// applyConfigChange puts a config that has been saved in place of the one in
+// use and makes it take effect. With restart_on_save false, changes the
+// running components can take are applied in place and it returns false.
+// Otherwise, or if a changed setting needs a restart, it schedules a restart
+// and returns true. Caller must hold saveMu.
+func (ah *AdminHandler) applyConfigChange(newConfig *Config, source, what string) bool {
+	old := ah.config.Load()
+	if ah.reloader != nil {
+		ah.reloader.Prepare(newConfig)
+	}
+	ah.config.Store(newConfig)
+	ah.sessionManager.SetPassword(newConfig.AdminPassword)
+
+	if ah.reloader != nil && !newConfig.RestartsOnSave() {
+		reasons := ah.reloader.RestartReasons(old, newConfig)
+		if len(reasons) == 0 {
+			ah.reloader.Apply(old, newConfig)
+			log.Printf("Applied %s without restarting", what)
+			return false
+		}
+		log.Printf("Restart needed to apply %s: changed %s", what, strings.Join(reasons, ", "))
+	}
+	ah.restartAfterConfigChange(source, what)
+	return true
+}
+
+// restartAfterConfigChange marks the config as changed for the restart guard and
+// exits after a short delay to allow the response to be sent. A supervisor is
+// expected to restart the application.
+func (ah *AdminHandler) restartAfterConfigChange(source, what string) {
+	markConfigChanged(ah.configFile, source)
 	go func() {
 		time.Sleep(2 * time.Second)
-		log.Println("Exiting application for restart after config update")
+		log.Printf("Exiting application for restart after %s", what)
 		os.Exit(0)
 	}()
 }
@@ -241,6 +296,9 @@ func (ah *AdminHandler) HandleImportConfig(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ah.saveMu.Lock()
+	defer ah.saveMu.Unlock()
+
 	// Parse and validate the configuration
 	var newConfig Config
 	if err := yaml.Unmarshal(data, &newConfig); err != nil {
@@ -254,31 +312,33 @@ func (ah *AdminHandler) HandleImportConfig(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// The window hook runs host commands, so the admin page can't change it
+	if !reflect.DeepEqual(newConfig.WindowHook, ah.config.Load().WindowHook) {
+		http.Error(w, "Invalid configuration: window_hook can only be changed by editing the config file", http.StatusBadRequest)
+		return
+	}
+
 	// Save to file
 	if err := os.WriteFile(ah.configFile, data, 0644); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to write config file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Update in-memory config
-	*ah.config = newConfig
+	log.Println("Configuration imported via admin interface")
 
-	log.Println("Configuration imported via admin interface - triggering application restart")
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{
+	if !ah.applyConfigChange(&newConfig, "import", "config import") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":  "success",
+			"message": "Configuration imported and applied without a restart.",
+			"restart": false,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
 		"message": "Configuration imported successfully. Application will restart in 2 seconds...",
-	}); err != nil {
-		log.Printf("Error encoding import response: %v", err)
-	}
-
-	// Trigger application exit after a short delay to allow response to be sent
-	go func() {
-		time.Sleep(2 * time.Second)
-		log.Println("Exiting application for restart after config import")
-		os.Exit(0)
-	}()
+		"restart": true,
+	})
 }
 
 // HandleSyncKiwis previews or applies sync of MQTT instances from kiwi_wspr config
@@ -301,9 +361,7 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 	kiwiConfig, err := LoadKiwiWSPRConfig("/app/kiwi_wspr_data/config.yaml")
 	if err != nil {
 		// Return a user-friendly error message
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"status":  "error",
 			"message": "Unable to access kiwi_wspr configuration",
 			"details": "Make sure the kiwi-wspr container is running and has created its config file. You may need to restart both containers with 'docker-compose restart'.",
@@ -312,11 +370,18 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	ah.saveMu.Lock()
+	defer ah.saveMu.Unlock()
+
+	// Work on a copy of the config, put in place once saved
+	newConfig := *ah.config.Load()
+	newConfig.MQTT.Instances = append([]InstanceConfig(nil), newConfig.MQTT.Instances...)
+
 	// Build a map of existing instances by name and topic_prefix for quick lookup
 	existingByName := make(map[string]*InstanceConfig)
 	existingByTopic := make(map[string]*InstanceConfig)
-	for i := range ah.config.MQTT.Instances {
-		inst := &ah.config.MQTT.Instances[i]
+	for i := range newConfig.MQTT.Instances {
+		inst := &newConfig.MQTT.Instances[i]
 		existingByName[inst.Name] = inst
 		existingByTopic[inst.TopicPrefix] = inst
 	}
@@ -371,8 +436,7 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 
 	// If no changes, return early
 	if len(changes) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"status":  "success",
 			"message": "No changes needed - all instances are already in sync",
 			"changes": []Change{},
@@ -382,8 +446,7 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 
 	// If this is just a preview, return the changes
 	if !request.Apply {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"status":  "preview",
 			"message": fmt.Sprintf("Found %d change(s) to apply", len(changes)),
 			"changes": changes,
@@ -391,21 +454,33 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Refuse to grow past the instance limit
+	adding := 0
+	for _, change := range changes {
+		if change.Type == "add" {
+			adding++
+		}
+	}
+	if total := len(newConfig.MQTT.Instances) + adding; total > newConfig.MQTT.MaxInstances {
+		http.Error(w, fmt.Sprintf("Applying these changes would configure %d instances, more than mqtt.max_instances (%d)", total, newConfig.MQTT.MaxInstances), http.StatusBadRequest)
+		return
+	}
+
 	// Apply the changes
 	addedCount := 0
 	updatedCount := 0
 
 	for _, change := range changes {
 		if change.Type == "add" {
-			ah.config.MQTT.Instances = append(ah.config.MQTT.Instances, InstanceConfig{
+			newConfig.MQTT.Instances = append(newConfig.MQTT.Instances, InstanceConfig{
 				Name:        change.Name,
 				TopicPrefix: change.TopicPrefix,
 			})
 			addedCount++
 		} else if change.Type == "update" {
 			// Find and update the instance
-			for i := range ah.config.MQTT.Instances {
-				inst := &ah.config.MQTT.Instances[i]
+			for i := range newConfig.MQTT.Instances {
+				inst := &newConfig.MQTT.Instances[i]
 				if inst.Name == change.OldName || inst.TopicPrefix == change.OldTopic {
 					inst.Name = change.Name
 					inst.TopicPrefix = change.TopicPrefix
@@ -417,7 +492,7 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Save updated config to file
-	data, err := yaml.Marshal(ah.config)
+	data, err := yaml.Marshal(&newConfig)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to marshal config: %v", err), http.StatusInternalServerError)
 		return
@@ -430,25 +505,24 @@ func (ah *AdminHandler) HandleSyncKiwis(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("Synced kiwi instances: %d added, %d updated", addedCount, updatedCount)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	restart := ah.applyConfigChange(&newConfig, "kiwi_sync", "kiwi sync")
+	message := "Configuration saved successfully. Application will restart in 2 seconds..."
+	if !restart {
+		message = "Configuration saved and applied without a restart."
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
-		"message": fmt.Sprintf("Configuration saved successfully. Application will restart in 2 seconds..."),
+		"message": message,
 		"added":   addedCount,
 		"updated": updatedCount,
+		"restart": restart,
 	})
-
-	// Trigger application exit after a short delay to allow response to be sent
-	go func() {
-		time.Sleep(2 * time.Second)
-		log.Println("Exiting application for restart after kiwi sync")
-		os.Exit(0)
-	}()
 }
 
-// serveLoginPage serves the login HTML page
-func (ah *AdminHandler) serveLoginPage(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/html")
+// serveLoginPage serves the login HTML page with the given status code
+func (ah *AdminHandler) serveLoginPage(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
 	html := `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -558,7 +632,9 @@ func (ah *AdminHandler) serveLoginPage(w http.ResponseWriter) {
     </div>
 </body>
 </html>`
-	w.Write([]byte(html))
+	if _, err := w.Write([]byte(html)); err != nil {
+		log.Printf("Error writing login page: %v", err)
+	}
 }
 
 // getAdminDashboardHTML returns the admin dashboard HTML
@@ -748,6 +824,7 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
     </div>
 
     <div id="message" class="message"></div>
+    <div id="safeModeBanner" class="message error"></div>
 
     <div class="container">
         <h2 class="section-title">Receiver Configuration</h2>
@@ -776,7 +853,7 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
         </h2>
         <div class="form-group">
             <label for="broker">Broker URL</label>
-            <input type="text" id="broker" placeholder="e.g., tcp://localhost:1883">
+            <input type="text" id="broker" placeholder="e.g., tcp://localhost:1883 or mqtts://broker:8883">
         </div>
         <div class="grid-2col">
             <div class="form-group">
@@ -850,6 +927,23 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
 
         // Load configuration on page load
         window.addEventListener('DOMContentLoaded', loadConfig);
+        window.addEventListener('DOMContentLoaded', checkSafeMode);
+
+        // Show a banner when the application started in safe mode after a bad config change
+        async function checkSafeMode() {
+            try {
+                const response = await fetch('/api/health');
+                const health = await response.json();
+                if (health.safe_mode) {
+                    const banner = document.getElementById('safeModeBanner');
+                    banner.textContent = '⚠️ Safe mode: ' + health.safe_mode_reason +
+                        '. MQTT and submissions are disabled until the configuration is saved again.';
+                    banner.style.display = 'block';
+                }
+            } catch (error) {
+                // Health is informational here; ignore failures
+            }
+        }
 
         async function loadConfig() {
             try {
@@ -901,7 +995,8 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
                     
                     div.innerHTML = ` + "`" + `
                         <div class="instance-info">
-                            <div class="instance-name">${instance.name}</div>
+                            <div class="instance-name">${instance.display_name || instance.name}</div>
+                            ${instance.display_name ? ` + "`" + `<div class="instance-prefix">Name: ${instance.name}</div>` + "`" + ` : ''}
                             <div class="instance-prefix">Topic Prefix: ${instance.topic_prefix}</div>
                             <div class="instance-prefix" style="color: #60a5fa; margin-top: 5px;">
                                 Messages: <span id="msg-count-${index}">${msgCount}</span>
@@ -933,14 +1028,21 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
             const topicPrefix = prompt('Topic prefix:');
             if (!topicPrefix) return;
             
+            const displayName = prompt('Display name (optional, leave blank to use the instance name):', '');
+            if (displayName === null) return;
+            
             if (!config.mqtt.instances) {
                 config.mqtt.instances = [];
             }
             
-            config.mqtt.instances.push({
+            const instance = {
                 name: name,
                 topic_prefix: topicPrefix
-            });
+            };
+            if (displayName.trim()) {
+                instance.display_name = displayName.trim();
+            }
+            config.mqtt.instances.push(instance);
             
             renderInstances(true);
         }
@@ -954,10 +1056,19 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
             const topicPrefix = prompt('Topic prefix:', instance.topic_prefix);
             if (topicPrefix === null) return;
             
+            const displayName = prompt('Display name (optional, leave blank to use the instance name):', instance.display_name || '');
+            if (displayName === null) return;
+            
             config.mqtt.instances[index] = {
+                ...instance,
                 name: name,
                 topic_prefix: topicPrefix
             };
+            if (displayName.trim()) {
+                config.mqtt.instances[index].display_name = displayName.trim();
+            } else {
+                delete config.mqtt.instances[index].display_name;
+            }
             
             renderInstances(true);
         }
@@ -971,29 +1082,29 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
 
         async function saveConfig() {
             // Show confirmation dialog
-            if (!confirm('⚠️ Warning: Saving the configuration will restart the application.\n\nDo you want to continue?')) {
+            if (!confirm('⚠️ Warning: Saving the configuration may restart the application.\n\nDo you want to continue?')) {
                 return;
             }
 
-            // Build config object from form
-            const newConfig = {
-                receiver: {
-                    callsign: document.getElementById('callsign').value,
-                    locator: document.getElementById('locator').value,
-                    antenna: document.getElementById('antenna').value
-                },
-                mqtt: {
-                    broker: document.getElementById('broker').value,
-                    username: document.getElementById('username').value,
-                    password: document.getElementById('password').value,
-                    qos: parseInt(document.getElementById('qos').value),
-                    instances: config.mqtt.instances || []
-                },
-                web_port: parseInt(document.getElementById('webPort').value),
-                dry_run: document.getElementById('dryRun').checked,
-                persistence_file: document.getElementById('persistenceFile').value,
-                admin_password: document.getElementById('adminPassword').value
-            };
+            // Start from the loaded config so settings without a form field are preserved,
+            // then overlay the values from the form
+            const newConfig = JSON.parse(JSON.stringify(config));
+            newConfig.receiver = Object.assign(newConfig.receiver || {}, {
+                callsign: document.getElementById('callsign').value,
+                locator: document.getElementById('locator').value,
+                antenna: document.getElementById('antenna').value
+            });
+            newConfig.mqtt = Object.assign(newConfig.mqtt || {}, {
+                broker: document.getElementById('broker').value,
+                username: document.getElementById('username').value,
+                password: document.getElementById('password').value,
+                qos: parseInt(document.getElementById('qos').value),
+                instances: config.mqtt.instances || []
+            });
+            newConfig.web_port = parseInt(document.getElementById('webPort').value);
+            newConfig.dry_run = document.getElementById('dryRun').checked;
+            newConfig.persistence_file = document.getElementById('persistenceFile').value;
+            newConfig.admin_password = document.getElementById('adminPassword').value;
             
             try {
                 const response = await fetch('/admin/api/config', {
@@ -1011,6 +1122,12 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
                 
                 const result = await response.json();
                 
+                if (result.restart === false) {
+                    showMessage('✅ ' + result.message, 'success');
+                    loadConfig();
+                    return;
+                }
+
                 // Show countdown overlay
                 showRestartCountdown();
             } catch (error) {
@@ -1090,7 +1207,10 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
                 broker: document.getElementById('broker').value,
                 username: document.getElementById('username').value,
                 password: document.getElementById('password').value,
-                qos: parseInt(document.getElementById('qos').value)
+                qos: parseInt(document.getElementById('qos').value),
+                tls: config && config.mqtt ? config.mqtt.tls : undefined,
+                client_cert: config && config.mqtt ? config.mqtt.client_cert : undefined,
+                client_key: config && config.mqtt ? config.mqtt.client_key : undefined
             };
 
             // Validate required fields
@@ -1231,7 +1351,7 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
                 if (!file) return;
 
                 // Show confirmation dialog
-                if (!confirm('⚠️ Warning: Importing a configuration will replace your current settings and restart the application.\\n\\nDo you want to continue?')) {
+                if (!confirm('⚠️ Warning: Importing a configuration will replace your current settings and may restart the application.\\n\\nDo you want to continue?')) {
                     return;
                 }
 
@@ -1251,6 +1371,12 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
 
                     const result = await response.json();
 
+                    if (result.restart === false) {
+                        showMessage('✅ ' + result.message, 'success');
+                        loadConfig();
+                        return;
+                    }
+
                     // Show countdown overlay
                     showRestartCountdown();
                 } catch (error) {
@@ -1398,7 +1524,7 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
                 // Show warning
                 const warning = document.createElement('div');
                 warning.style.cssText = 'background: rgba(239, 68, 68, 0.1); border: 1px solid #ef4444; padding: 15px; border-radius: 8px; margin-bottom: 20px;';
-                warning.innerHTML = '<div style="color: #ef4444; font-weight: 600; margin-bottom: 5px;">⚠️ Warning</div><div style="color: #fca5a5;">Saving these changes will restart the application.</div>';
+                warning.innerHTML = '<div style="color: #ef4444; font-weight: 600; margin-bottom: 5px;">⚠️ Warning</div><div style="color: #fca5a5;">Saving these changes may restart the application.</div>';
                 modal.appendChild(changesList);
                 modal.appendChild(warning);
             }
@@ -1457,6 +1583,12 @@ func (ah *AdminHandler) getAdminDashboardHTML() string {
 
                 const result = await response.json();
 
+                if (result.restart === false) {
+                    showMessage('✅ ' + result.message, 'success');
+                    loadConfig();
+                    return;
+                }
+
                 // Show countdown overlay
                 showRestartCountdown();
             } catch (error) {
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +18,7 @@ type SpotAggregator struct {
 	stats           *StatisticsTracker
 	persistenceFile string
 	spotWriter      *SpotWriter
+	influx          *InfluxWriter // nil unless influxdb is configured
 
 	// Map of 2-minute windows to spots
 	// Key: timestamp rounded to 2-minute boundary
@@ -23,6 +26,43 @@ type SpotAggregator struct {
 	windows   map[int64]map[string]*WSPRReportWithSource
 	windowsMu sync.Mutex
 
+	// Latest WSPR cycle (window key) each instance sent any decode for, kept
+	// or not, so a band that decoded nothing doesn't hold a window up
+	// (protected by windowsMu)
+	lastActive map[string]int64
+
+	// Windows are submitted once all expected instances have reported, or
+	// once dedupWindow has passed since the start of the WSPR cycle. Reports
+	// for the same spot are only deduplicated within this time.
+	expectedInstances []string
+	dedupWindow       time.Duration
+
+	// How often statistics are saved between window flushes
+	checkpointInterval time.Duration
+
+	// Per-instance dedup preferences (instance name -> preference)
+	preferences map[string]InstancePreference
+
+	// Transmitter callsigns whose reports are kept per instance rather than
+	// deduplicated (upper case)
+	dedupExempt map[string]bool
+
+	// Whether reports of one callsign on one band and cycle are told apart by
+	// transmit frequency (dedup_key: frequency)
+	dedupByFrequency bool
+
+	// Cross-instance grid consistency check (disabled when gridTolerance is 0)
+	gridTolerance float64 // km
+	gridAction    string
+
+	// Spots scoring below this confidence are not submitted to WSPRNet (0 = submit all)
+	minConfidence int
+
+	// Receiver position for grayline annotation (disabled unless graylineEnabled)
+	graylineEnabled bool
+	receiverLat     float64
+	receiverLon     float64
+
 	// Track duplicates for reporting
 	// Key: window timestamp
 	// Value: map of callsign to list of duplicate reports
@@ -33,8 +73,20 @@ type SpotAggregator struct {
 	// Key: callsign_band_windowKey (e.g., "GM0PXV_20m_1737187200")
 	// Value: window timestamp (for cleanup)
 	submittedSpots   map[string]int64
+	lateDuplicates   int // Late arrivals for spots already submitted in an earlier flush
+	gridHeld         int // Spots not submitted because instances disagreed on the grid
+	gridFlagged      int // Spots submitted despite instances disagreeing on the grid
+	confidenceHeld   int // Spots not submitted to WSPRNet because of a low confidence score
 	submittedSpotsMu sync.Mutex
 
+	// When each report reached the aggregator, for the last few windows
+	// Key: window timestamp
+	arrivals   map[int64][]SpotArrival
+	arrivalsMu sync.Mutex
+
+	// Rolling DT and report delay per instance, for spotting clock drift
+	clockSkew *ClockSkewTracker
+
 	// Channel for incoming spots
 	spotChan chan *WSPRReportWithSource
 
@@ -50,24 +102,207 @@ type WSPRReportWithSource struct {
 	*WSPRReport
 	InstanceName string
 	Country      string
+	ReceivedAt   time.Time // When the aggregator received the report
+
+	// Distinct locators reported by every instance that heard this spot in
+	// its window (protected by windowsMu)
+	locators []string
+
+	// Every instance's report of this spot in its window (protected by
+	// windowsMu), and the confidence score computed from them when submitted
+	receptions []spotReception
+	confidence int
+	grayline   *bool // Both ends on the grayline at spot time; nil if not computed
+
+	// Other instances whose reports tied with this one for the best SNR
+	// (protected by windowsMu). Ties are recorded when the window is flushed,
+	// once the full set of tied instances is known.
+	tiedWith []string
 }
 
-// NewSpotAggregator creates a new spot aggregator
-func NewSpotAggregator(wsprNet *WSPRNet, pskReporter *PSKReporter, stats *StatisticsTracker, persistenceFile string, spotWriter *SpotWriter) *SpotAggregator {
+// NewSpotAggregator creates a new spot aggregator. dedupWindow is the longest a
+// window is held open for late reports, from the start of its cycle.
+func NewSpotAggregator(wsprNet *WSPRNet, pskReporter *PSKReporter, stats *StatisticsTracker, persistenceFile string, spotWriter *SpotWriter, dedupWindow time.Duration) *SpotAggregator {
 	return &SpotAggregator{
-		wsprNet:         wsprNet,
-		pskReporter:     pskReporter,
-		stats:           stats,
-		persistenceFile: persistenceFile,
-		spotWriter:      spotWriter,
-		windows:         make(map[int64]map[string]*WSPRReportWithSource),
-		duplicates:      make(map[int64]map[string][]*WSPRReportWithSource),
-		submittedSpots:  make(map[string]int64),
-		spotChan:        make(chan *WSPRReportWithSource, 1000),
-		stopChan:        make(chan struct{}),
+		wsprNet:            wsprNet,
+		pskReporter:        pskReporter,
+		stats:              stats,
+		persistenceFile:    persistenceFile,
+		spotWriter:         spotWriter,
+		windows:            make(map[int64]map[string]*WSPRReportWithSource),
+		lastActive:         make(map[string]int64),
+		dedupWindow:        dedupWindow,
+		checkpointInterval: DefaultCheckpointInterval * time.Second,
+		duplicates:         make(map[int64]map[string][]*WSPRReportWithSource),
+		submittedSpots:     make(map[string]int64),
+		arrivals:           make(map[int64][]SpotArrival),
+		clockSkew:          NewClockSkewTracker(DefaultClockSkewDTWarn, DefaultClockSkewDelayWarn),
+		spotChan:           make(chan *WSPRReportWithSource, 1000),
+		stopChan:           make(chan struct{}),
 	}
 }
 
+// InstancePreference biases duplicate selection towards a trusted instance
+type InstancePreference struct {
+	Priority    int // Tie-breaker after SNR (higher wins)
+	SNRHandicap int // dB added to the instance's SNR when comparing
+}
+
+// SetPreferences sets per-instance dedup preferences. Must be called before Start.
+func (sa *SpotAggregator) SetPreferences(preferences map[string]InstancePreference) {
+	sa.preferences = preferences
+}
+
+// compareReports decides which of two duplicate reports to keep. It returns 1 if
+// a should be kept, -1 for b and 0 for a tie. Each instance's SNR handicap is
+// added before comparing SNRs, and priority breaks any remaining tie.
+func (sa *SpotAggregator) compareReports(a, b *WSPRReportWithSource) int {
+	prefA := sa.preferences[a.InstanceName]
+	prefB := sa.preferences[b.InstanceName]
+
+	cmp := compareSNR(a.WSPRReport, b.WSPRReport)
+	if a.HasSNR && b.HasSNR {
+		effA := a.SNR + prefA.SNRHandicap
+		effB := b.SNR + prefB.SNRHandicap
+		switch {
+		case effA > effB:
+			cmp = 1
+		case effA < effB:
+			cmp = -1
+		default:
+			cmp = 0
+		}
+	}
+	if cmp == 0 {
+		switch {
+		case prefA.Priority > prefB.Priority:
+			cmp = 1
+		case prefA.Priority < prefB.Priority:
+			cmp = -1
+		}
+	}
+
+	return cmp
+}
+
+// SetGridConsistency enables the cross-instance grid check. A spot whose instances
+// reported grids more than toleranceKm apart is held back or flagged, depending on
+// action. Must be called before Start.
+func (sa *SpotAggregator) SetGridConsistency(toleranceKm float64, action string) {
+	sa.gridTolerance = toleranceKm
+	sa.gridAction = action
+}
+
+// SetMinConfidence sets the confidence score (1-100) a spot needs to be
+// submitted to WSPRNet; 0 submits every spot. Must be called before Start.
+func (sa *SpotAggregator) SetMinConfidence(score int) {
+	sa.minConfidence = score
+}
+
+// SetInfluxWriter exports every deduplicated spot that is passed on for
+// submission to InfluxDB. Must be called before Start.
+func (sa *SpotAggregator) SetInfluxWriter(influx *InfluxWriter) {
+	sa.influx = influx
+}
+
+// SetGrayline enables tagging deduped spots with whether both ends of the path
+// were on the grayline, using the receiver's locator. Must be called before Start.
+func (sa *SpotAggregator) SetGrayline(receiverLocator string) {
+	lat, lon, ok := maidenheadToLatLon(receiverLocator)
+	if !ok {
+		log.Printf("Warning: Grayline tagging needs a valid receiver locator, not %q", receiverLocator)
+		return
+	}
+	sa.graylineEnabled = true
+	sa.receiverLat, sa.receiverLon = lat, lon
+}
+
+// pathOnGrayline reports whether the receiver and the spot's transmitter were
+// both on the grayline at spot time, or nil if the spot has no usable grid
+func (sa *SpotAggregator) pathOnGrayline(report *WSPRReportWithSource) *bool {
+	if !sa.graylineEnabled || !isValidGridLocator(report.Locator) {
+		return nil
+	}
+	// Use the middle of the two-minute transmission
+	t := report.EpochTime.Add(time.Minute)
+	lat, lon, _ := maidenheadToLatLon(report.Locator)
+	grayline := onGrayline(sa.receiverLat, sa.receiverLon, t) && onGrayline(lat, lon, t)
+	return &grayline
+}
+
+// SetDedupExempt sets the transmitter callsigns that are not deduplicated: each
+// instance's report of them is kept and submitted separately. Must be called before Start.
+func (sa *SpotAggregator) SetDedupExempt(callsigns []string) {
+	sa.dedupExempt = make(map[string]bool, len(callsigns))
+	for _, callsign := range callsigns {
+		sa.dedupExempt[strings.ToUpper(callsign)] = true
+	}
+}
+
+// SetDedupKey sets what tells spots apart within a cycle, DedupKeyBand or
+// DedupKeyFrequency. Must be called before Start.
+func (sa *SpotAggregator) SetDedupKey(key string) {
+	sa.dedupByFrequency = key == DedupKeyFrequency
+}
+
+// frequencyKey extends key with a transmit frequency. If has reports a key
+// for a frequency within dedupFrequencyToleranceHz of freq, that key is
+// returned, so reports of the same signal that differ by a few Hz between
+// receivers still meet.
+func frequencyKey(key string, freq uint64, has func(string) bool) string {
+	for d := uint64(0); d <= dedupFrequencyToleranceHz; d++ {
+		if d <= freq && has(fmt.Sprintf("%s_%d", key, freq-d)) {
+			return fmt.Sprintf("%s_%d", key, freq-d)
+		}
+		if has(fmt.Sprintf("%s_%d", key, freq+d)) {
+			return fmt.Sprintf("%s_%d", key, freq+d)
+		}
+	}
+	return fmt.Sprintf("%s_%d", key, freq)
+}
+
+// SetCheckpointInterval sets how often statistics are saved between window
+// flushes. Must be called before Start.
+func (sa *SpotAggregator) SetCheckpointInterval(interval time.Duration) {
+	sa.checkpointInterval = interval
+}
+
+// SetClockSkewThresholds sets when the clock skew health check warns. Must be
+// called before Start.
+func (sa *SpotAggregator) SetClockSkewThresholds(dtWarn, delayWarn float64) {
+	sa.clockSkew = NewClockSkewTracker(dtWarn, delayWarn)
+}
+
+// GetClockSkew returns the rolling DT and report delay per instance
+func (sa *SpotAggregator) GetClockSkew() ClockSkewHealth {
+	return sa.clockSkew.Health()
+}
+
+// DefaultDedupWindow is how long (seconds) from the start of a WSPR cycle its
+// window may stay open: the cycle itself plus two minutes for late reports
+const DefaultDedupWindow = 240
+
+// SetExpectedInstances sets the instances each window waits for before it is
+// submitted ahead of its deduplication window. Must be called before Start.
+func (sa *SpotAggregator) SetExpectedInstances(expectedInstances []string) {
+	sa.expectedInstances = expectedInstances
+}
+
+// SubmissionDeadline returns how long after its WSPR cycle ends a window is
+// submitted at the latest: the deduplication window less the cycle itself
+func (sa *SpotAggregator) SubmissionDeadline() time.Duration {
+	return sa.dedupWindow - 2*time.Minute
+}
+
+// UpdateInstances replaces the instances each window waits for and the dedup
+// preferences while running, after mqtt.instances is changed by a config reload
+func (sa *SpotAggregator) UpdateInstances(expectedInstances []string, preferences map[string]InstancePreference) {
+	sa.windowsMu.Lock()
+	defer sa.windowsMu.Unlock()
+	sa.expectedInstances = expectedInstances
+	sa.preferences = preferences
+}
+
 // Start starts the aggregator
 func (sa *SpotAggregator) Start() {
 	sa.running = true
@@ -110,6 +345,7 @@ func (sa *SpotAggregator) AddSpot(report *WSPRReport, instanceName, country stri
 		WSPRReport:   report,
 		InstanceName: instanceName,
 		Country:      country,
+		ReceivedAt:   time.Now(),
 	}
 
 	select {
@@ -119,14 +355,22 @@ func (sa *SpotAggregator) AddSpot(report *WSPRReport, instanceName, country stri
 	}
 }
 
-// processSpots processes incoming spots
+// processSpots processes incoming spots. On Stop the spots already queued are
+// added before it returns, so the final flush includes them.
 func (sa *SpotAggregator) processSpots() {
 	defer sa.wg.Done()
 
 	for {
 		select {
 		case <-sa.stopChan:
-			return
+			for {
+				select {
+				case report := <-sa.spotChan:
+					sa.addToWindow(report)
+				default:
+					return
+				}
+			}
 		case report := <-sa.spotChan:
 			sa.addToWindow(report)
 		}
@@ -135,10 +379,11 @@ func (sa *SpotAggregator) processSpots() {
 
 // addToWindow adds a report to the appropriate 2-minute window
 func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
-	// Check message age to filter out retained messages
+	// Check message age to filter out retained messages. Anything older than
+	// its deduplication window plus a minute (5 minutes by default) is too late
+	// for its window and likely a retained message.
 	messageAge := time.Since(report.EpochTime)
-	if messageAge > 5*time.Minute {
-		// Message is too old (> 5 minutes) - likely a retained message
+	if messageAge > sa.dedupWindow+time.Minute {
 		log.Printf("Aggregator: Rejecting old spot for %s (age: %.1f minutes)", report.Callsign, messageAge.Minutes())
 		return
 	}
@@ -154,7 +399,13 @@ func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
 	// Create deduplication key: callsign + mode + window + band
 	// This ensures we only keep one spot per callsign per 2-minute window per band
 	// Using band instead of exact frequency handles slight frequency variations
+	// (dedup_key: frequency adds the transmit frequency, with a tolerance, below)
 	dedupKey := fmt.Sprintf("%s_%s_%d_%s", report.Callsign, report.Mode, windowKey, band)
+	if sa.dedupExempt[strings.ToUpper(report.Callsign)] {
+		// Exempt callsigns keep one spot per instance, so reports from
+		// different instances never meet as duplicates
+		dedupKey += "_" + report.InstanceName
+	}
 
 	// Write raw spot to file
 	if sa.spotWriter != nil {
@@ -163,8 +414,14 @@ func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
 		}
 	}
 
+	sa.recordArrival(report, band, windowKey)
+	if !report.ReceivedAt.IsZero() {
+		delay := report.ReceivedAt.Sub(time.Unix(windowKey+120, 0)).Seconds()
+		sa.clockSkew.Record(report.InstanceName, float64(report.DT), delay)
+	}
+
 	// Record spot in statistics
-	sa.stats.RecordSpot(report.InstanceName, band, report.Callsign, report.Country, report.Locator, report.SNR)
+	sa.stats.RecordSpot(time.Unix(windowKey, 0).UTC(), report.InstanceName, band, report.Callsign, report.Country, report.Locator, report.SNR, report.HasSNR)
 
 	sa.windowsMu.Lock()
 	defer sa.windowsMu.Unlock()
@@ -173,11 +430,21 @@ func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
 	if sa.windows[windowKey] == nil {
 		sa.windows[windowKey] = make(map[string]*WSPRReportWithSource)
 	}
+	sa.markActive(report.InstanceName, windowKey)
+
+	if sa.dedupByFrequency {
+		window := sa.windows[windowKey]
+		dedupKey = frequencyKey(dedupKey, report.Frequency, func(k string) bool {
+			_, ok := window[k]
+			return ok
+		})
+	}
 
 	// Check if we already have this spot
 	if existing, exists := sa.windows[windowKey][dedupKey]; exists {
-		// Keep the spot with better SNR
-		if report.SNR > existing.SNR {
+		// Keep the spot with better SNR (adjusted by any instance preferences)
+		cmp := sa.compareReports(report, existing)
+		if cmp > 0 {
 			// New report is better - track the old one as rejected
 			sa.trackDuplicate(windowKey, existing)
 			sa.windows[windowKey][dedupKey] = report
@@ -186,22 +453,17 @@ func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
 			// Record duplicate relationship (both directions)
 			sa.stats.RecordDuplicate(report.InstanceName, band, existing.InstanceName)
 			sa.stats.RecordDuplicate(existing.InstanceName, band, report.InstanceName)
-			if DebugMode {
-				log.Printf("Aggregator: Updated spot for %s (better SNR: %d > %d)",
-					report.Callsign, report.SNR, existing.SNR)
-			}
-		} else if report.SNR == existing.SNR {
-			// Tied SNR - track both instances as having tied with each other
+			logDebugf("Aggregator: Updated spot for %s (better SNR: %d > %d)",
+				report.Callsign, report.SNR, existing.SNR)
+		} else if cmp == 0 {
+			// Tied SNR - add this instance to the kept report's tie group
 			sa.trackDuplicate(windowKey, report)
-			sa.stats.RecordTiedSNR(report.InstanceName, band, existing.InstanceName)
-			sa.stats.RecordTiedSNR(existing.InstanceName, band, report.InstanceName)
+			existing.addTie(report.InstanceName)
 			// Also record as general duplicate relationship
 			sa.stats.RecordDuplicate(report.InstanceName, band, existing.InstanceName)
 			sa.stats.RecordDuplicate(existing.InstanceName, band, report.InstanceName)
-			if DebugMode {
-				log.Printf("Aggregator: Tied spot for %s (SNR: %d = %d) - [%s] vs [%s]",
-					report.Callsign, report.SNR, existing.SNR, existing.InstanceName, report.InstanceName)
-			}
+			logDebugf("Aggregator: Tied spot for %s (SNR: %d = %d) - [%s] vs [%s]",
+				report.Callsign, report.SNR, existing.SNR, existing.InstanceName, report.InstanceName)
 		} else {
 			// Existing is better - track the new one as rejected
 			sa.trackDuplicate(windowKey, report)
@@ -209,19 +471,142 @@ func (sa *SpotAggregator) addToWindow(report *WSPRReportWithSource) {
 			// Record duplicate relationship (both directions)
 			sa.stats.RecordDuplicate(report.InstanceName, band, existing.InstanceName)
 			sa.stats.RecordDuplicate(existing.InstanceName, band, report.InstanceName)
-			if DebugMode {
-				log.Printf("Aggregator: Duplicate spot for %s (keeping existing SNR: %d > %d)",
-					report.Callsign, existing.SNR, report.SNR)
-			}
+			logDebugf("Aggregator: Duplicate spot for %s (keeping existing SNR: %d > %d)",
+				report.Callsign, existing.SNR, report.SNR)
 		}
+
+		// Whichever report is kept carries every grid and report for the spot
+		kept := sa.windows[windowKey][dedupKey]
+		kept.locators = addLocator(existing.locators, report.Locator)
+		kept.receptions = append(existing.receptions, receptionOf(report))
 	} else {
 		// New spot for this window
+		report.locators = addLocator(nil, report.Locator)
+		report.receptions = []spotReception{receptionOf(report)}
 		sa.windows[windowKey][dedupKey] = report
-		if DebugMode {
-			log.Printf("Aggregator: Added spot for %s to window %d",
-				report.Callsign, windowKey)
+		logDebugf("Aggregator: Added spot for %s to window %d",
+			report.Callsign, windowKey)
+	}
+}
+
+// addTie adds an instance to the set that tied with this report for the best SNR
+func (r *WSPRReportWithSource) addTie(instanceName string) {
+	if instanceName == r.InstanceName || r.tiedWithInstance(instanceName) {
+		return
+	}
+	r.tiedWith = append(r.tiedWith, instanceName)
+}
+
+// tiedWithInstance reports whether an instance is in this report's tie group
+func (r *WSPRReportWithSource) tiedWithInstance(instanceName string) bool {
+	for _, name := range r.tiedWith {
+		if name == instanceName {
+			return true
 		}
 	}
+	return false
+}
+
+// recordOutcome records how the kept report of a spot won deduplication: its
+// ties, and a priority win if the instance preferences decided it
+func (sa *SpotAggregator) recordOutcome(report *WSPRReportWithSource, band string) {
+	sa.recordTies(report, band)
+	if keptByPreference(report) {
+		sa.stats.RecordPriorityWin(report.InstanceName, band)
+	}
+}
+
+// keptByPreference reports whether the instance preferences decided which
+// report of a spot was kept: another instance heard it with a better raw SNR,
+// or with the same SNR without the two tying
+func keptByPreference(kept *WSPRReportWithSource) bool {
+	for _, r := range kept.receptions {
+		if r.instance == kept.InstanceName || kept.tiedWithInstance(r.instance) {
+			continue
+		}
+		if compareSNR(&WSPRReport{SNR: r.snr, HasSNR: r.hasSNR}, kept.WSPRReport) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTies credits every instance in the report's tie group with one tie
+// against each of the others, so an n-way tie counts once per instance and
+// every pair in it is linked
+func (sa *SpotAggregator) recordTies(report *WSPRReportWithSource, band string) {
+	if len(report.tiedWith) == 0 {
+		return
+	}
+	group := append([]string{report.InstanceName}, report.tiedWith...)
+	for i, instance := range group {
+		others := make([]string, 0, len(group)-1)
+		others = append(others, group[:i]...)
+		others = append(others, group[i+1:]...)
+		sa.stats.RecordTiedSNR(instance, band, others)
+	}
+}
+
+// addLocator adds a locator to a spot's list of reported grids if it is not
+// already there. Locators are stored as "IO86ha" so case differences compare equal.
+func addLocator(locators []string, locator string) []string {
+	locator = strings.TrimSpace(locator)
+	if len(locator) < 4 {
+		return locators
+	}
+	locator = strings.ToUpper(locator[:4]) + strings.ToLower(locator[4:])
+	for _, l := range locators {
+		if l == locator {
+			return locators
+		}
+	}
+	return append(locators, locator)
+}
+
+// gridSpreadKm returns the largest distance between any two valid locators in
+// the list. A 4-character grid and a 6-character subsquare inside it are treated
+// as agreeing. It returns false if fewer than two valid locators were reported.
+func gridSpreadKm(locators []string) (float64, bool) {
+	valid := make([]string, 0, len(locators))
+	for _, l := range locators {
+		if isValidGridLocator(l) {
+			valid = append(valid, l)
+		}
+	}
+	if len(valid) < 2 {
+		return 0, false
+	}
+
+	spread := 0.0
+	for i := 0; i < len(valid); i++ {
+		for j := i + 1; j < len(valid); j++ {
+			a, b := valid[i], valid[j]
+			if len(a) != len(b) && a[:4] == b[:4] {
+				continue
+			}
+			// Both passed isValidGridLocator
+			lat1, lon1, _ := maidenheadToLatLon(a)
+			lat2, lon2, _ := maidenheadToLatLon(b)
+			spread = math.Max(spread, haversineDistance(lat1, lon1, lat2, lon2))
+		}
+	}
+	return spread, true
+}
+
+// compareSNR returns 1 if a has the better SNR, -1 if b does, and 0 for a tie.
+// A report without an SNR always loses to one that has it.
+func compareSNR(a, b *WSPRReport) int {
+	switch {
+	case a.HasSNR && !b.HasSNR:
+		return 1
+	case !a.HasSNR && b.HasSNR:
+		return -1
+	case a.SNR > b.SNR:
+		return 1
+	case a.SNR < b.SNR:
+		return -1
+	}
+	return 0
 }
 
 // flushWindows periodically flushes old windows
@@ -259,58 +644,125 @@ func (sa *SpotAggregator) flushWindows() {
 	secondsUntilNext += randomOffset
 
 	log.Printf("Aggregator: Synchronizing to WSPR cycles with %d second offset, next flush in %d seconds", randomOffset, secondsUntilNext)
-
-	// Wait until the next 2-minute boundary + offset
-	time.Sleep(time.Duration(secondsUntilNext) * time.Second)
-
-	// Now create a ticker that fires every 2 minutes (120 seconds)
-	ticker := time.NewTicker(120 * time.Second)
-	defer ticker.Stop()
-
-	// Flush immediately at the first boundary
-	sa.flushOldWindows()
+	log.Printf("Aggregator: Windows are held for up to %s from the start of each cycle (%s after it ends)",
+		sa.dedupWindow, sa.SubmissionDeadline())
+
+	// Wait until the next 2-minute boundary + offset, then flush every 2 minutes.
+	// Meanwhile check every few seconds for windows that have hit their deadline.
+	firstFlush := time.NewTimer(time.Duration(secondsUntilNext) * time.Second)
+	defer firstFlush.Stop()
+	deadlineTicker := time.NewTicker(5 * time.Second)
+	defer deadlineTicker.Stop()
+	checkpointTicker := time.NewTicker(sa.checkpointInterval)
+	defer checkpointTicker.Stop()
+
+	var ticker *time.Ticker
+	var tickerC <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
 
 	for {
 		select {
 		case <-sa.stopChan:
 			return
-		case <-ticker.C:
+		case <-firstFlush.C:
+			// Now create a ticker that fires every 2 minutes (120 seconds)
+			ticker = time.NewTicker(120 * time.Second)
+			tickerC = ticker.C
+			sa.flushOldWindows()
+		case <-tickerC:
 			sa.flushOldWindows()
+		case <-deadlineTicker.C:
+			sa.flushExpiredWindows()
+		case <-checkpointTicker.C:
+			sa.saveStatistics()
 		}
 	}
 }
 
-// flushOldWindows flushes windows that are older than 60 seconds
-// This gives time for all instances to report their spots for a given window
-// Retained messages are filtered by age check in addToWindow()
+// flushOldWindows runs at the regular flush point and submits every window whose
+// WSPR cycle has ended and for which all expected instances have reported.
+// Incomplete windows are held until their deduplication window ends.
 func (sa *SpotAggregator) flushOldWindows() {
+	sa.flushDueWindows(true)
+}
+
+// flushExpiredWindows submits windows whose deduplication window has ended
+func (sa *SpotAggregator) flushExpiredWindows() {
+	sa.flushDueWindows(false)
+}
+
+// flushDueWindows flushes windows that are complete (when regular is true) or
+// whose deduplication window has ended. A window's cycle ends 120 seconds after
+// its key, and it is forced out dedupWindow after its key.
+func (sa *SpotAggregator) flushDueWindows(regular bool) {
 	now := time.Now().Unix()
-	// Flush windows that are 2-4 minutes old (120-240 seconds)
-	// This ensures we only flush one window per cycle
-	flushThreshold := now - 120  // 2 minutes ago
-	tooOldThreshold := now - 240 // 4 minutes ago
+	dedupWindow := int64(sa.dedupWindow / time.Second)
 
 	sa.windowsMu.Lock()
 
 	windowsToFlush := make(map[int64]map[string]*WSPRReportWithSource)
 	for windowKey, spots := range sa.windows {
-		age := now - windowKey
-		// Flush windows that are 2-4 minutes old
-		if windowKey < flushThreshold && windowKey >= tooOldThreshold {
-			windowsToFlush[windowKey] = spots
-			delete(sa.windows, windowKey)
-		} else if windowKey < tooOldThreshold {
-			// Window is too old (>4 minutes), flush it anyway but log warning
-			log.Printf("WARNING: Window %d is %d seconds old, flushing late", windowKey, age)
-			windowsToFlush[windowKey] = spots
-			delete(sa.windows, windowKey)
+		cycleEnd := windowKey + 120
+		if now < cycleEnd {
+			continue // Still in progress
+		}
+
+		missing := sa.missingInstances(windowKey)
+		switch {
+		case now >= windowKey+dedupWindow:
+			if len(missing) > 0 {
+				log.Printf("Aggregator: Window %s forced out after %ds, no reports from: %v",
+					time.Unix(windowKey, 0).UTC().Format("15:04"), dedupWindow, missing)
+			}
+		case regular && len(missing) == 0:
+			// Complete - submit at the regular flush point
+		default:
+			continue
 		}
+
+		windowsToFlush[windowKey] = spots
+		delete(sa.windows, windowKey)
 	}
 	sa.windowsMu.Unlock()
 
-	// Flush each window
-	for windowKey, spots := range windowsToFlush {
-		sa.flushWindow(windowKey, spots)
+	// Flush each window, oldest first
+	for _, windowKey := range sortedWindowKeys(windowsToFlush) {
+		sa.flushWindow(windowKey, windowsToFlush[windowKey])
+	}
+}
+
+// missingInstances returns the expected instances that have sent nothing for
+// a window's WSPR cycle, or any later one, on any band. Caller must hold
+// windowsMu.
+func (sa *SpotAggregator) missingInstances(windowKey int64) []string {
+	var missing []string
+	for _, name := range sa.expectedInstances {
+		if sa.lastActive[name] < windowKey {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// RecordActivity notes that an instance sent a decode for the WSPR cycle at t.
+// It is called for every decode, including those dropped before they reach
+// the aggregator, so an instance counts as reporting into a window even when
+// none of its decodes for it are kept.
+func (sa *SpotAggregator) RecordActivity(instanceName string, t time.Time) {
+	sa.windowsMu.Lock()
+	defer sa.windowsMu.Unlock()
+	sa.markActive(instanceName, (t.Unix()/120)*120)
+}
+
+// markActive records activity by an instance in a window. Caller must hold
+// windowsMu.
+func (sa *SpotAggregator) markActive(instanceName string, windowKey int64) {
+	if windowKey > sa.lastActive[instanceName] {
+		sa.lastActive[instanceName] = windowKey
 	}
 }
 
@@ -324,13 +776,44 @@ func (sa *SpotAggregator) flushAllWindows() {
 	sa.windows = make(map[int64]map[string]*WSPRReportWithSource)
 	sa.windowsMu.Unlock()
 
-	for windowKey, spots := range windowsToFlush {
+	for _, windowKey := range sortedWindowKeys(windowsToFlush) {
+		spots := windowsToFlush[windowKey]
 		log.Printf("Aggregator: Flushing remaining window %d with %d unique spots",
 			windowKey, len(spots))
 		sa.flushWindow(windowKey, spots)
 	}
 }
 
+// sortedWindowKeys returns the window keys in chronological order
+func sortedWindowKeys(windows map[int64]map[string]*WSPRReportWithSource) []int64 {
+	keys := make([]int64, 0, len(windows))
+	for windowKey := range windows {
+		keys = append(keys, windowKey)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// sortBands orders bands by frequency (2200m first). Frequencies outside
+// every band are placed last in alphabetical order.
+func sortBands(bands []string) {
+	sort.Slice(bands, func(i, j int) bool { return bandLess(bands[i], bands[j]) })
+}
+
+// bandLess orders bands by frequency, with unknown bands last in name order
+func bandLess(a, b string) bool {
+	ia, ib := bandIndex(a), bandIndex(b)
+	okA, okB := ia >= 0, ib >= 0
+	switch {
+	case okA && okB:
+		return ia < ib
+	case okA != okB:
+		return okA
+	default:
+		return a < b
+	}
+}
+
 // flushWindow flushes a single window with detailed reporting
 func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRReportWithSource) {
 	if len(spots) == 0 {
@@ -351,6 +834,8 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 		band := frequencyToBand(report.ReceiverFreq)
 		bandSpots[band] = append(bandSpots[band], report)
 		bandBreakdown[band]++
+		sa.stats.RecordTxFrequency(band, report.Frequency)
+		sa.recordOutcome(report, band)
 	}
 
 	// Get duplicates for this window
@@ -415,12 +900,12 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 		}
 	}
 
-	// Sort bands for consistent output
+	// Sort bands so submissions and the deduped file are in a reproducible order
 	bands := make([]string, 0, len(bandSpots))
 	for band := range bandSpots {
 		bands = append(bands, band)
 	}
-	sort.Strings(bands)
+	sortBands(bands)
 
 	// Submit all spots to WSPRNet and PSKReporter
 	log.Printf("WSPR Window %s: Submitting %d unique spots to WSPRNet", windowTime.Format("15:04 UTC"), len(spots))
@@ -434,13 +919,53 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 		})
 
 		for _, report := range reports {
+			report.confidence = spotConfidence(report.WSPRReport, report.receptions)
+			report.grayline = sa.pathOnGrayline(report)
+
+			// Hold or flag spots whose instances disagree on the transmitter's grid
+			if sa.gridTolerance > 0 {
+				if spread, ok := gridSpreadKm(report.locators); ok && spread > sa.gridTolerance {
+					held := sa.gridAction == GridConsistencyHold
+					sa.submittedSpotsMu.Lock()
+					if held {
+						sa.gridHeld++
+					} else {
+						sa.gridFlagged++
+					}
+					sa.submittedSpotsMu.Unlock()
+
+					log.Printf("WARNING: Grid mismatch for %s on %s (window %s): %v are %.0f km apart (%s)",
+						report.Callsign, band, windowTime.Format("15:04 UTC"), report.locators, spread, sa.gridAction)
+					if held {
+						if sa.spotWriter != nil {
+							msg := fmt.Sprintf("held: instances reported grids %.0f km apart", spread)
+							if writeErr := sa.spotWriter.WriteDeduped(report, false, false, msg); writeErr != nil {
+								log.Printf("Warning: Failed to write deduped spot for %s: %v", report.Callsign, writeErr)
+							}
+						}
+						continue
+					}
+				}
+			}
+
 			// Create submission key: callsign_band_windowKey
 			submissionKey := fmt.Sprintf("%s_%s_%d", report.Callsign, band, windowKey)
+			if sa.dedupExempt[strings.ToUpper(report.Callsign)] {
+				submissionKey += "_" + report.InstanceName
+			}
 
 			// Check if we've already submitted this spot
 			sa.submittedSpotsMu.Lock()
+			if sa.dedupByFrequency {
+				submissionKey = frequencyKey(submissionKey, report.Frequency, func(k string) bool {
+					_, ok := sa.submittedSpots[k]
+					return ok
+				})
+			}
 			_, alreadySubmitted := sa.submittedSpots[submissionKey]
 			if alreadySubmitted {
+				// Arrived after its window was already submitted - count as a cross-window duplicate
+				sa.lateDuplicates++
 				sa.submittedSpotsMu.Unlock()
 				log.Printf("WARNING: Skipping duplicate submission for %s on %s (window %s) - already submitted",
 					report.Callsign, band, windowTime.Format("15:04 UTC"))
@@ -450,13 +975,41 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 			sa.submittedSpots[submissionKey] = windowKey
 			sa.submittedSpotsMu.Unlock()
 
-			// Submit to WSPRNet
-			err := sa.wsprNet.Submit(report.WSPRReport)
-			submitted := (err == nil)
-			errorMsg := ""
-			if err != nil {
-				errorMsg = err.Error()
-				log.Printf("ERROR: Failed to queue %s for WSPRNet: %v", report.Callsign, err)
+			if sa.influx != nil {
+				path, ok := sa.stats.DistanceTo(report.Locator)
+				sa.influx.Write(report, band, path, ok)
+			}
+
+			// Withhold low-confidence spots from WSPRNet. They are still
+			// recorded and sent to PSKReporter.
+			if report.confidence < sa.minConfidence {
+				sa.submittedSpotsMu.Lock()
+				sa.confidenceHeld++
+				sa.submittedSpotsMu.Unlock()
+
+				logDebugf("Aggregator: Withholding %s on %s from WSPRNet (confidence %d)", report.Callsign, band, report.confidence)
+				if sa.spotWriter != nil {
+					msg := fmt.Sprintf("withheld: confidence %d is below min_confidence %d", report.confidence, sa.minConfidence)
+					if writeErr := sa.spotWriter.WriteDeduped(report, false, false, msg); writeErr != nil {
+						log.Printf("Warning: Failed to write deduped spot for %s: %v", report.Callsign, writeErr)
+					}
+				}
+			} else {
+				// Write the deduped spot as pending before queueing so that the
+				// WSPRNet result callback always finds it
+				if sa.spotWriter != nil {
+					if writeErr := sa.spotWriter.WriteDeduped(report, false, true, ""); writeErr != nil {
+						log.Printf("Warning: Failed to write deduped spot for %s: %v", report.Callsign, writeErr)
+					}
+				}
+
+				// Submit to WSPRNet; the final outcome arrives through the result callback
+				if err := sa.wsprNet.Submit(report.WSPRReport); err != nil {
+					log.Printf("ERROR: Failed to queue %s for WSPRNet: %v", report.Callsign, err)
+					if sa.spotWriter != nil {
+						sa.spotWriter.UpdateSubmission([]WSPRReport{*report.WSPRReport}, false, err.Error())
+					}
+				}
 			}
 
 			// Submit to PSKReporter if enabled
@@ -465,13 +1018,6 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 					log.Printf("ERROR: Failed to queue %s for PSKReporter: %v", report.Callsign, pskErr)
 				}
 			}
-
-			// Write deduped spot with submission status
-			if sa.spotWriter != nil {
-				if writeErr := sa.spotWriter.WriteDeduped(report, submitted, errorMsg); writeErr != nil {
-					log.Printf("Warning: Failed to write deduped spot for %s: %v", report.Callsign, writeErr)
-				}
-			}
 		}
 	}
 
@@ -481,17 +1027,28 @@ func (sa *SpotAggregator) flushWindow(windowKey int64, spots map[string]*WSPRRep
 	// Finish statistics window (pass 0 for failed count since failures are tracked separately by WSPRNet)
 	sa.stats.FinishWindow(len(spots), totalDuplicates, 0, bandBreakdown)
 
-	// Save statistics to disk if persistence is enabled
-	if sa.persistenceFile != "" {
-		// Get WSPRNet and PSKReporter stats and save them
-		wsprnetStats := sa.wsprNet.GetStats()
-		var pskReporterStats map[string]interface{}
-		if sa.pskReporter != nil {
-			pskReporterStats = sa.pskReporter.GetStats()
-		}
-		if err := sa.stats.SaveToFileWithReporters(sa.persistenceFile, wsprnetStats, pskReporterStats); err != nil {
-			log.Printf("Warning: Failed to save statistics: %v", err)
-		}
+	sa.saveStatistics()
+}
+
+// DefaultCheckpointInterval is how often statistics are saved between window
+// flushes (persistence_interval_seconds), so a restart or crash mid-window
+// keeps the partial window's data
+const DefaultCheckpointInterval = 30
+
+// saveStatistics saves statistics to disk if persistence is enabled
+func (sa *SpotAggregator) saveStatistics() {
+	if sa.persistenceFile == "" {
+		return
+	}
+
+	// Get WSPRNet and PSKReporter stats and save them
+	wsprnetStats := sa.wsprNet.GetStats()
+	var pskReporterStats map[string]interface{}
+	if sa.pskReporter != nil {
+		pskReporterStats = sa.pskReporter.GetStats()
+	}
+	if err := sa.stats.SaveToFileWithReporters(sa.persistenceFile, wsprnetStats, pskReporterStats); err != nil {
+		log.Printf("Warning: Failed to save statistics: %v", err)
 	}
 }
 
@@ -532,42 +1089,8 @@ func (sa *SpotAggregator) cleanupSubmittedSpots(currentWindowKey int64) {
 		delete(sa.submittedSpots, key)
 	}
 
-	if len(keysToDelete) > 0 && DebugMode {
-		log.Printf("Aggregator: Cleaned up %d old submitted spot entries", len(keysToDelete))
-	}
-}
-
-// frequencyToBand converts a frequency in Hz to a band name
-func frequencyToBand(freq uint64) string {
-	freqMHz := float64(freq) / 1000000.0
-
-	switch {
-	case freqMHz >= 0.1357 && freqMHz < 0.1378:
-		return "2200m"
-	case freqMHz >= 0.472 && freqMHz < 0.479:
-		return "630m"
-	case freqMHz >= 1.8 && freqMHz < 2.0:
-		return "160m"
-	case freqMHz >= 3.5 && freqMHz < 4.0:
-		return "80m"
-	case freqMHz >= 5.25 && freqMHz < 5.45:
-		return "60m"
-	case freqMHz >= 7.0 && freqMHz < 7.3:
-		return "40m"
-	case freqMHz >= 10.1 && freqMHz < 10.15:
-		return "30m"
-	case freqMHz >= 14.0 && freqMHz < 14.35:
-		return "20m"
-	case freqMHz >= 18.068 && freqMHz < 18.168:
-		return "17m"
-	case freqMHz >= 21.0 && freqMHz < 21.45:
-		return "15m"
-	case freqMHz >= 24.89 && freqMHz < 24.99:
-		return "12m"
-	case freqMHz >= 28.0 && freqMHz < 29.7:
-		return "10m"
-	default:
-		return fmt.Sprintf("%.3fMHz", freqMHz)
+	if len(keysToDelete) > 0 {
+		logDebugf("Aggregator: Cleaned up %d old submitted spot entries", len(keysToDelete))
 	}
 }
 
@@ -581,11 +1104,30 @@ func (sa *SpotAggregator) GetStats() map[string]interface{} {
 		totalSpots += len(spots)
 	}
 
-	return map[string]interface{}{
-		"active_windows": len(sa.windows),
-		"pending_spots":  totalSpots,
+	sa.submittedSpotsMu.Lock()
+	lateDuplicates := sa.lateDuplicates
+	gridHeld := sa.gridHeld
+	gridFlagged := sa.gridFlagged
+	confidenceHeld := sa.confidenceHeld
+	sa.submittedSpotsMu.Unlock()
+
+	stats := map[string]interface{}{
+		"active_windows":      len(sa.windows),
+		"pending_spots":       totalSpots,
+		"late_duplicates":     lateDuplicates,
+		"submission_deadline": int(sa.SubmissionDeadline() / time.Second),
+		"dedup_window":        int(sa.dedupWindow / time.Second),
+		"grid_check_enabled":  sa.gridTolerance > 0,
+		"grid_held":           gridHeld,
+		"grid_flagged":        gridFlagged,
+		"min_confidence":      sa.minConfidence,
+		"confidence_held":     confidenceHeld,
+	}
+	if sa.influx != nil {
+		stats["influxdb"] = sa.influx.GetStats()
 	}
+	return stats
 }
 
-// DebugMode can be set to enable debug logging
+// DebugMode is set with log_level debug, for code that checks before logging
 var DebugMode = false
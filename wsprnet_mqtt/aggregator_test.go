@@ -0,0 +1,353 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// permutations returns every ordering of names
+func permutations(names []string) [][]string {
+	if len(names) <= 1 {
+		return [][]string{append([]string(nil), names...)}
+	}
+	var result [][]string
+	for i, name := range names {
+		rest := make([]string, 0, len(names)-1)
+		rest = append(rest, names[:i]...)
+		rest = append(rest, names[i+1:]...)
+		for _, p := range permutations(rest) {
+			result = append(result, append([]string{name}, p...))
+		}
+	}
+	return result
+}
+
+// testReport returns a 20m report of callsign at locator heard by instance in
+// the current WSPR cycle
+func testReport(instance, callsign, locator string, snr int, txFreq uint64) *WSPRReportWithSource {
+	return &WSPRReportWithSource{
+		WSPRReport: &WSPRReport{
+			Callsign:     callsign,
+			Locator:      locator,
+			SNR:          snr,
+			HasSNR:       true,
+			Frequency:    txFreq,
+			ReceiverFreq: 14095600,
+			DBm:          37,
+			EpochTime:    time.Now().Truncate(2 * time.Minute),
+			Mode:         "WSPR",
+		},
+		InstanceName: instance,
+	}
+}
+
+// keptReports returns the reports kept in every open window
+func keptReports(sa *SpotAggregator) []*WSPRReportWithSource {
+	var kept []*WSPRReportWithSource
+	for _, window := range sa.windows {
+		for _, report := range window {
+			kept = append(kept, report)
+		}
+	}
+	return kept
+}
+
+// dedupThreeWay has three instances report the same spot at the same SNR in
+// the given order and returns the report kept for it, with the statistics
+// after the window's outcome is recorded
+func dedupThreeWay(t *testing.T, order []string, preferences map[string]InstancePreference) (*WSPRReportWithSource, map[string]*InstanceStats) {
+	t.Helper()
+
+	stats := NewStatisticsTracker()
+	defer stats.Close()
+	sa := NewSpotAggregator(nil, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+	sa.SetPreferences(preferences)
+
+	for _, instance := range order {
+		sa.addToWindow(testReport(instance, "K1ABC", "FN31", -12, 14097100))
+	}
+
+	kept := keptReports(sa)
+	if len(kept) != 1 {
+		t.Fatalf("order %v: %d spots kept, want 1", order, len(kept))
+	}
+	sa.recordOutcome(kept[0], "20m")
+	return kept[0], stats.GetInstanceStats()
+}
+
+func TestThreeWayTie(t *testing.T) {
+	instances := []string{"kiwi1", "kiwi2", "kiwi3"}
+
+	for _, order := range permutations(instances) {
+		kept, stats := dedupThreeWay(t, order, nil)
+
+		// The first report is kept and the other two join its tie group
+		if kept.InstanceName != order[0] {
+			t.Errorf("order %v: kept %s, want the first report, %s", order, kept.InstanceName, order[0])
+		}
+		group := append([]string{kept.InstanceName}, kept.tiedWith...)
+		sort.Strings(group)
+		if len(group) != 3 || group[0] != "kiwi1" || group[1] != "kiwi2" || group[2] != "kiwi3" {
+			t.Errorf("order %v: tie group %v, want all three instances", order, group)
+		}
+
+		// Each instance counts the tie once, and against each of the others once
+		for _, instance := range instances {
+			inst := stats[instance]
+			if inst.TiedSNR != 1 {
+				t.Errorf("order %v: %s TiedSNR = %d, want 1", order, instance, inst.TiedSNR)
+			}
+			band := inst.BandStats["20m"]
+			for _, other := range instances {
+				want := 1
+				if other == instance {
+					want = 0
+				}
+				if got := band.TiedWith[other]; got != want {
+					t.Errorf("order %v: %s TiedWith[%s] = %d, want %d", order, instance, other, got, want)
+				}
+			}
+			if inst.BestSNRWins != 0 {
+				t.Errorf("order %v: %s BestSNRWins = %d, want 0 for a tie", order, instance, inst.BestSNRWins)
+			}
+		}
+	}
+}
+
+func TestThreeWayTieBrokenByPreferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences map[string]InstancePreference
+		winner      string
+	}{
+		{
+			name:        "priority",
+			preferences: map[string]InstancePreference{"kiwi2": {Priority: 1}},
+			winner:      "kiwi2",
+		},
+		{
+			name:        "snr handicap",
+			preferences: map[string]InstancePreference{"kiwi3": {SNRHandicap: 2}},
+			winner:      "kiwi3",
+		},
+		{
+			name: "handicap before priority",
+			preferences: map[string]InstancePreference{
+				"kiwi1": {Priority: 5},
+				"kiwi3": {SNRHandicap: 1},
+			},
+			winner: "kiwi3",
+		},
+		{
+			name: "highest priority of three",
+			preferences: map[string]InstancePreference{
+				"kiwi1": {Priority: 1},
+				"kiwi2": {Priority: 3},
+				"kiwi3": {Priority: 2},
+			},
+			winner: "kiwi2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every arrival order, several times over, picks the same winner
+			for run := 0; run < 5; run++ {
+				for _, order := range permutations([]string{"kiwi1", "kiwi2", "kiwi3"}) {
+					kept, stats := dedupThreeWay(t, order, tt.preferences)
+					if kept.InstanceName != tt.winner {
+						t.Fatalf("order %v: kept %s, want %s", order, kept.InstanceName, tt.winner)
+					}
+					if len(kept.tiedWith) != 0 {
+						t.Errorf("order %v: winner tied with %v, want no ties", order, kept.tiedWith)
+					}
+					if wins := stats[tt.winner].PriorityWins; wins != 1 {
+						t.Errorf("order %v: %s PriorityWins = %d, want the preference credited once", order, tt.winner, wins)
+					}
+					if ties := stats[tt.winner].TiedSNR; ties != 0 {
+						t.Errorf("order %v: %s TiedSNR = %d, want 0", order, tt.winner, ties)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPriorityWinRecordedOnce(t *testing.T) {
+	snrs := map[string]int{"kiwi1": -15, "kiwi2": -12, "kiwi3": -10}
+	tests := []struct {
+		name        string
+		preferences map[string]InstancePreference
+		winner      string
+		priorityWin bool
+	}{
+		{"best snr", nil, "kiwi3", false},
+		{"best snr despite a handicap", map[string]InstancePreference{"kiwi2": {SNRHandicap: 1}}, "kiwi3", false},
+		{"handicap", map[string]InstancePreference{"kiwi1": {SNRHandicap: 10}}, "kiwi1", true},
+		{"priority on equal snr", map[string]InstancePreference{"kiwi2": {SNRHandicap: 2, Priority: 1}}, "kiwi2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, order := range permutations([]string{"kiwi1", "kiwi2", "kiwi3"}) {
+				stats := NewStatisticsTracker()
+				sa := NewSpotAggregator(nil, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+				sa.SetPreferences(tt.preferences)
+				for _, instance := range order {
+					sa.addToWindow(testReport(instance, "K1ABC", "FN31", snrs[instance], 14097100))
+				}
+				kept := keptReports(sa)
+				if len(kept) != 1 || kept[0].InstanceName != tt.winner {
+					t.Fatalf("order %v: kept %v, want %s's report", order, kept, tt.winner)
+				}
+				sa.recordOutcome(kept[0], "20m")
+
+				want := 0
+				if tt.priorityWin {
+					want = 1
+				}
+				for instance, inst := range stats.GetInstanceStats() {
+					got := inst.PriorityWins
+					if instance != tt.winner && got != 0 {
+						t.Errorf("order %v: %s PriorityWins = %d, want 0", order, instance, got)
+					} else if instance == tt.winner && got != want {
+						t.Errorf("order %v: %s PriorityWins = %d, want %d", order, instance, got, want)
+					}
+					if band := inst.BandStats["20m"]; band != nil && band.PriorityWins != got {
+						t.Errorf("order %v: %s 20m PriorityWins = %d, want %d", order, instance, band.PriorityWins, got)
+					}
+				}
+				stats.Close()
+			}
+		})
+	}
+}
+
+func TestMissingInstances(t *testing.T) {
+	stats := NewStatisticsTracker()
+	defer stats.Close()
+	sa := NewSpotAggregator(nil, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+	sa.SetExpectedInstances([]string{"kiwi1", "kiwi2", "kiwi3"})
+
+	report := testReport("kiwi1", "K1ABC", "FN31", -12, 14097100)
+	sa.addToWindow(report)
+	cycle := report.EpochTime
+	windowKey := cycle.Unix()
+
+	missing := func() []string {
+		sa.windowsMu.Lock()
+		defer sa.windowsMu.Unlock()
+		return sa.missingInstances(windowKey)
+	}
+	if got := missing(); len(got) != 2 || got[0] != "kiwi2" || got[1] != "kiwi3" {
+		t.Fatalf("missing = %v, want kiwi2 and kiwi3", got)
+	}
+
+	// kiwi2 decoded on another band, or its decode was filtered out: it has
+	// still reported for the cycle
+	sa.RecordActivity("kiwi2", cycle.Add(30*time.Second))
+	if got := missing(); len(got) != 1 || got[0] != "kiwi3" {
+		t.Fatalf("missing after kiwi2's decode = %v, want kiwi3", got)
+	}
+
+	// An older decode doesn't count for this cycle; a later one does
+	sa.RecordActivity("kiwi3", cycle.Add(-2*time.Minute))
+	if got := missing(); len(got) != 1 || got[0] != "kiwi3" {
+		t.Fatalf("missing after kiwi3's old decode = %v, want kiwi3", got)
+	}
+	sa.RecordActivity("kiwi3", cycle.Add(2*time.Minute))
+	if got := missing(); len(got) != 0 {
+		t.Errorf("missing after kiwi3's next cycle = %v, want none", got)
+	}
+}
+
+func TestSameLocatorCallsignsKeptApart(t *testing.T) {
+	for _, key := range []string{DedupKeyBand, DedupKeyFrequency} {
+		t.Run(key, func(t *testing.T) {
+			stats := NewStatisticsTracker()
+			defer stats.Close()
+			sa := NewSpotAggregator(nil, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+			sa.SetDedupKey(key)
+
+			// Two stations in the same subsquare, each heard by both instances
+			sa.addToWindow(testReport("kiwi1", "K1ABC", "FN31pr", -10, 14097100))
+			sa.addToWindow(testReport("kiwi1", "K1XYZ", "FN31pr", -20, 14097030))
+			sa.addToWindow(testReport("kiwi2", "K1ABC", "FN31pr", -8, 14097100))
+			sa.addToWindow(testReport("kiwi2", "K1XYZ", "FN31pr", -25, 14097030))
+
+			best := make(map[string]*WSPRReportWithSource)
+			for _, report := range keptReports(sa) {
+				if best[report.Callsign] != nil {
+					t.Fatalf("%s kept twice", report.Callsign)
+				}
+				best[report.Callsign] = report
+			}
+			if len(best) != 2 {
+				t.Fatalf("kept %d spots, want one for each callsign", len(best))
+			}
+			if r := best["K1ABC"]; r == nil || r.InstanceName != "kiwi2" || r.SNR != -8 {
+				t.Errorf("K1ABC kept %+v, want kiwi2 at -8 dB", r)
+			}
+			if r := best["K1XYZ"]; r == nil || r.InstanceName != "kiwi1" || r.SNR != -20 {
+				t.Errorf("K1XYZ kept %+v, want kiwi1 at -20 dB", r)
+			}
+
+			// Each callsign has its own map entry with its own SNR
+			spots := make(map[string]*SpotLocation)
+			for _, spot := range stats.GetCurrentSpots() {
+				spots[spot.Callsign] = spot
+			}
+			if len(spots) != 2 {
+				t.Fatalf("%d map spots, want 2", len(spots))
+			}
+			for callsign, snr := range map[string]int{"K1ABC": -8, "K1XYZ": -20} {
+				spot := spots[callsign]
+				if spot == nil {
+					t.Errorf("no map spot for %s", callsign)
+					continue
+				}
+				if spot.Locator != "FN31pr" || len(spot.SNR) != 1 || spot.SNR[0] != snr {
+					t.Errorf("%s map spot %s %v, want FN31pr [%d]", callsign, spot.Locator, spot.SNR, snr)
+				}
+				if len(spot.HeardBy) != 2 {
+					t.Errorf("%s heard by %v, want both instances", callsign, spot.HeardBy)
+				}
+			}
+
+			// And each is counted as a spot of each instance
+			for name, inst := range stats.GetInstanceStats() {
+				if inst.TotalSpots != 2 || inst.BandStats["20m"].TotalSpots != 2 {
+					t.Errorf("%s counted %d spots (%d on 20m), want 2", name, inst.TotalSpots, inst.BandStats["20m"].TotalSpots)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupKeyFrequency(t *testing.T) {
+	tests := []struct {
+		key    string
+		second uint64 // Transmit frequency of the second report; the first is 14097100
+		kept   int
+	}{
+		{DedupKeyBand, 14097100, 1},
+		{DedupKeyBand, 14097180, 1},
+		{DedupKeyFrequency, 14097100, 1},
+		{DedupKeyFrequency, 14097100 + dedupFrequencyToleranceHz, 1},
+		{DedupKeyFrequency, 14097100 - dedupFrequencyToleranceHz, 1},
+		{DedupKeyFrequency, 14097100 + dedupFrequencyToleranceHz + 1, 2},
+		{DedupKeyFrequency, 14097180, 2},
+	}
+	for _, tt := range tests {
+		stats := NewStatisticsTracker()
+		sa := NewSpotAggregator(nil, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+		sa.SetDedupKey(tt.key)
+
+		sa.addToWindow(testReport("kiwi1", "K1ABC", "FN31pr", -10, 14097100))
+		sa.addToWindow(testReport("kiwi2", "K1ABC", "FN31pr", -12, tt.second))
+		if kept := len(keptReports(sa)); kept != tt.kept {
+			t.Errorf("dedup_key %s, %d Hz and %d Hz: kept %d spots, want %d", tt.key, 14097100, tt.second, kept, tt.kept)
+		}
+		stats.Close()
+	}
+}
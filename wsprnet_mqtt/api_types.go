@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the current JSON schema version of the /api endpoints.
+// Version 2 switched instance and window statistics to snake_case field names.
+const APIVersion = 2
+
+// minAPIVersion is the oldest schema a client can still request with Accept-Version
+const minAPIVersion = 1
+
+// apiVersionKey is the request context key holding the negotiated API version
+type apiVersionKey struct{}
+
+// withAPIVersion negotiates the schema version for an /api endpoint. Clients may
+// send "Accept-Version: 1" (or "v1") to get an older shape; without the header
+// they get the current version. The version served is always returned in
+// X-API-Version, and unsupported versions are rejected with 406.
+func withAPIVersion(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Version")
+
+		version := APIVersion
+		if requested := strings.TrimSpace(r.Header.Get("Accept-Version")); requested != "" {
+			v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(requested), "v"))
+			if err != nil || v < minAPIVersion || v > APIVersion {
+				w.Header().Set("X-API-Version", strconv.Itoa(APIVersion))
+				writeJSONError(w, http.StatusNotAcceptable, fmt.Sprintf("Unsupported Accept-Version %q (supported: %d to %d)", requested, minAPIVersion, APIVersion))
+				return
+			}
+			version = v
+		}
+
+		w.Header().Set("X-API-Version", strconv.Itoa(version))
+		next(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	}
+}
+
+// requestAPIVersion returns the API version negotiated for a request
+func requestAPIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return APIVersion
+}
+
+// InstanceStatsResponse is the API representation of InstanceStats
+type InstanceStatsResponse struct {
+	Name            string                                `json:"name"`
+	DisplayName     string                                `json:"display_name,omitempty"`
+	TotalSpots      int                                   `json:"total_spots"`
+	UniqueSpots     int                                   `json:"unique_spots"`
+	BestSNRWins     int                                   `json:"best_snr_wins"`
+	TiedSNR         int                                   `json:"tied_snr"`
+	PriorityWins    int                                   `json:"priority_wins"`
+	BandStats       map[string]*BandInstanceStatsResponse `json:"band_stats"`
+	LastReportTime  time.Time                             `json:"last_report_time"`
+	LastWindowTime  time.Time                             `json:"last_window_time"`
+	RecentCallsigns []string                              `json:"recent_callsigns"`
+	Online          bool                                  `json:"online"`
+	OnlineFraction  *float64                              `json:"online_fraction,omitempty"`
+	Software        string                                `json:"software,omitempty"`
+	SoftwareVersion string                                `json:"software_version,omitempty"`
+}
+
+// BandInstanceStatsResponse is the API representation of BandInstanceStats
+type BandInstanceStatsResponse struct {
+	TotalSpots      int            `json:"total_spots"`
+	UniqueSpots     int            `json:"unique_spots"`
+	BestSNRWins     int            `json:"best_snr_wins"`
+	TiedSNR         int            `json:"tied_snr"`
+	PriorityWins    int            `json:"priority_wins"`
+	TiedWith        map[string]int `json:"tied_with"`
+	DuplicatesWith  map[string]int `json:"duplicates_with"`
+	AverageSNR      float64        `json:"average_snr"`
+	TotalSNR        int            `json:"total_snr"`
+	SNRCount        int            `json:"snr_count"`
+	MinDistance     float64        `json:"min_distance"`
+	MaxDistance     float64        `json:"max_distance"`
+	TotalDistance   float64        `json:"total_distance"`
+	DistanceCount   int            `json:"distance_count"`
+	AverageDistance float64        `json:"average_distance"`
+}
+
+// WindowStatsResponse is the API representation of WindowStats
+type WindowStatsResponse struct {
+	WindowTime        time.Time           `json:"window_time"`
+	TotalSpots        int                 `json:"total_spots"`
+	DuplicateCount    int                 `json:"duplicate_count"`
+	FailedCount       int                 `json:"failed_count"`
+	UniqueByInstance  map[string][]string `json:"unique_by_instance"`
+	BestSNRByInstance map[string]int      `json:"best_snr_by_instance"`
+	TiedSNRByInstance map[string]int      `json:"tied_snr_by_instance"`
+	BandBreakdown     map[string]int      `json:"band_breakdown"`
+	SubmittedAt       time.Time           `json:"submitted_at"`
+	Imported          bool                `json:"imported,omitempty"` // Backfilled from WSPRNet
+}
+
+// newInstanceStatsResponse converts instance statistics for the API.
+// The input must be a copy (as returned by GetInstanceStats).
+func newInstanceStatsResponse(inst *InstanceStats) *InstanceStatsResponse {
+	resp := &InstanceStatsResponse{
+		Name:            inst.Name,
+		DisplayName:     inst.DisplayName,
+		TotalSpots:      inst.TotalSpots,
+		UniqueSpots:     inst.UniqueSpots,
+		BestSNRWins:     inst.BestSNRWins,
+		TiedSNR:         inst.TiedSNR,
+		PriorityWins:    inst.PriorityWins,
+		BandStats:       make(map[string]*BandInstanceStatsResponse, len(inst.BandStats)),
+		LastReportTime:  inst.LastReportTime,
+		LastWindowTime:  inst.LastWindowTime,
+		RecentCallsigns: inst.RecentCallsigns,
+		Online:          inst.Online,
+		OnlineFraction:  inst.OnlineFraction,
+		Software:        inst.Software,
+		SoftwareVersion: inst.SoftwareVersion,
+	}
+	for band, stats := range inst.BandStats {
+		resp.BandStats[band] = &BandInstanceStatsResponse{
+			TotalSpots:      stats.TotalSpots,
+			UniqueSpots:     stats.UniqueSpots,
+			BestSNRWins:     stats.BestSNRWins,
+			TiedSNR:         stats.TiedSNR,
+			PriorityWins:    stats.PriorityWins,
+			TiedWith:        stats.TiedWith,
+			DuplicatesWith:  stats.DuplicatesWith,
+			AverageSNR:      stats.AverageSNR,
+			TotalSNR:        stats.TotalSNR,
+			SNRCount:        stats.SNRCount,
+			MinDistance:     stats.MinDistance,
+			MaxDistance:     stats.MaxDistance,
+			TotalDistance:   stats.TotalDistance,
+			DistanceCount:   stats.DistanceCount,
+			AverageDistance: stats.AverageDistance,
+		}
+	}
+	return resp
+}
+
+// newWindowStatsResponse converts window statistics for the API
+func newWindowStatsResponse(window *WindowStats) *WindowStatsResponse {
+	return &WindowStatsResponse{
+		WindowTime:        window.WindowTime,
+		TotalSpots:        window.TotalSpots,
+		DuplicateCount:    window.DuplicateCount,
+		FailedCount:       window.FailedCount,
+		UniqueByInstance:  window.UniqueByInstance,
+		BestSNRByInstance: window.BestSNRByInstance,
+		TiedSNRByInstance: window.TiedSNRByInstance,
+		BandBreakdown:     window.BandBreakdown,
+		SubmittedAt:       window.SubmittedAt,
+		Imported:          window.Imported,
+	}
+}
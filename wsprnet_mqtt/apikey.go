@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// withAPIKey requires api_key on /api requests when it is set, as an
+// "Authorization: Bearer" header or a key query parameter (for downloads and
+// event streams, which can't set headers). A logged-in admin session also
+// passes, so the admin page's own /api calls keep working. With no api_key
+// the API stays open.
+func (ws *WebServer) withAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := ws.config.Load().APIKey
+		if key == "" || !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		supplied := r.URL.Query().Get("key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			supplied = strings.TrimSpace(bearer)
+		}
+		if subtle.ConstantTimeCompare([]byte(supplied), []byte(key)) == 1 || ws.adminHandler.hasSession(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wsprnet_mqtt"`)
+		writeJSONError(w, http.StatusUnauthorized, "API key required: send Authorization: Bearer <key> or add ?key=<key>")
+	})
+}
+
+// hasSession reports whether the request carries a valid admin session
+func (ah *AdminHandler) hasSession(r *http.Request) bool {
+	if !ah.IsAdminEnabled() {
+		return false
+	}
+	cookie, err := r.Cookie("admin_session")
+	return err == nil && ah.sessionManager.ValidateSession(cookie.Value)
+}
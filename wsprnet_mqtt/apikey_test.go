@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// apiKeyTestServer returns a web server with apiKey and an admin password set,
+// a valid admin session token, and its API key check wrapped around a handler
+// that answers 200 to whatever gets through
+func apiKeyTestServer(t *testing.T, apiKey string) (http.Handler, string) {
+	t.Helper()
+
+	ws := newTestWebServer(t)
+	config := *ws.config.Load()
+	config.APIKey = apiKey
+	config.AdminPassword = "hunter2"
+	ws.config.Store(&config)
+	ws.adminHandler.sessionManager.SetPassword(config.AdminPassword)
+	session := ws.adminHandler.sessionManager.CreateSession(time.Hour)
+
+	return ws.withAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})), session
+}
+
+func TestWithAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		method  string
+		target  string
+		bearer  string
+		session bool
+		status  int
+	}{
+		{"no api_key", "", http.MethodGet, "/api/summary", "", false, http.StatusOK},
+		{"no api_key stream", "", http.MethodGet, "/api/stream/stats", "", false, http.StatusOK},
+		{"missing key", "s3cret", http.MethodGet, "/api/summary", "", false, http.StatusUnauthorized},
+		{"bearer", "s3cret", http.MethodGet, "/api/summary", "s3cret", false, http.StatusOK},
+		{"wrong bearer", "s3cret", http.MethodGet, "/api/summary", "guess", false, http.StatusUnauthorized},
+		{"bearer overrides query", "s3cret", http.MethodGet, "/api/summary?key=s3cret", "guess", false, http.StatusUnauthorized},
+		{"query", "s3cret", http.MethodGet, "/api/spots/export.csv?key=s3cret", "", false, http.StatusOK},
+		{"wrong query", "s3cret", http.MethodGet, "/api/spots/export.csv?key=guess", "", false, http.StatusUnauthorized},
+		{"stream without key", "s3cret", http.MethodGet, "/api/stream/stats", "", false, http.StatusUnauthorized},
+		{"stream query", "s3cret", http.MethodGet, "/api/stream/stats?key=s3cret", "", false, http.StatusOK},
+		{"admin session", "s3cret", http.MethodGet, "/api/summary", "", true, http.StatusOK},
+		{"preflight", "s3cret", http.MethodOptions, "/api/summary", "", false, http.StatusOK},
+		{"admin api", "s3cret", http.MethodGet, "/admin/api/config", "", false, http.StatusOK},
+		{"admin login", "s3cret", http.MethodPost, "/admin/login", "", false, http.StatusOK},
+		{"dashboard", "s3cret", http.MethodGet, "/", "", false, http.StatusOK},
+		{"health check", "s3cret", http.MethodGet, "/health", "", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, session := apiKeyTestServer(t, tt.apiKey)
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.session {
+				req.AddCookie(&http.Cookie{Name: "admin_session", Value: session})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusUnauthorized {
+				if auth := rec.Header().Get("WWW-Authenticate"); auth == "" {
+					t.Error("WWW-Authenticate not set on a 401")
+				}
+				decodeJSONError(t, rec)
+			}
+		})
+	}
+}
+
+func TestHasSession(t *testing.T) {
+	ws := newTestWebServer(t)
+	config := *ws.config.Load()
+	config.AdminPassword = "hunter2"
+	ws.config.Store(&config)
+	ws.adminHandler.sessionManager.SetPassword(config.AdminPassword)
+	session := ws.adminHandler.sessionManager.CreateSession(time.Hour)
+
+	withCookie := func(value string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: value})
+		return req
+	}
+	if !ws.adminHandler.hasSession(withCookie(session)) {
+		t.Error("hasSession rejected a valid session")
+	}
+	if ws.adminHandler.hasSession(withCookie("forged")) {
+		t.Error("hasSession accepted an unknown token")
+	}
+	if ws.adminHandler.hasSession(httptest.NewRequest(http.MethodGet, "/api/summary", nil)) {
+		t.Error("hasSession accepted a request without a cookie")
+	}
+
+	// With admin disabled, no session counts
+	disabled := config
+	disabled.AdminPassword = ""
+	ws.config.Store(&disabled)
+	if ws.adminHandler.hasSession(withCookie(session)) {
+		t.Error("hasSession accepted a session with admin disabled")
+	}
+}
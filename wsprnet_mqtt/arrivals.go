@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Limits on the arrival times kept for the window timeline
+const (
+	arrivalWindowsKept   = 5    // Most recent windows kept
+	maxArrivalsPerWindow = 5000 // Reports recorded per window; later ones are not shown
+)
+
+// SpotArrival records when one instance's report of a spot reached the aggregator
+type SpotArrival struct {
+	Instance  string    `json:"instance"`
+	Callsign  string    `json:"callsign"`
+	Band      string    `json:"band"`
+	ArrivedAt time.Time `json:"arrived_at"`
+	// Seconds after the end of the WSPR cycle; negative if the report arrived
+	// before the cycle ended (a sign the instance's clock or timestamps are off)
+	OffsetSeconds float64 `json:"offset_seconds"`
+}
+
+// ArrivalSpread summarises one instance's report arrivals in a window
+type ArrivalSpread struct {
+	Count         int     `json:"count"`
+	FirstOffset   float64 `json:"first_offset_seconds"`
+	MedianOffset  float64 `json:"median_offset_seconds"`
+	LastOffset    float64 `json:"last_offset_seconds"`
+	SpreadSeconds float64 `json:"spread_seconds"` // Last minus first
+}
+
+// WindowArrivals is the arrival timeline of one window
+type WindowArrivals struct {
+	WindowTime time.Time                `json:"window_time"`
+	CycleEnd   time.Time                `json:"cycle_end"`
+	Open       bool                     `json:"open"` // Still waiting to be submitted
+	Arrivals   []SpotArrival            `json:"arrivals"`
+	Instances  map[string]ArrivalSpread `json:"instances"`
+}
+
+// recordArrival notes when a report for a window arrived, and forgets windows
+// older than the last arrivalWindowsKept
+func (sa *SpotAggregator) recordArrival(report *WSPRReportWithSource, band string, windowKey int64) {
+	arrivedAt := report.ReceivedAt
+	if arrivedAt.IsZero() {
+		arrivedAt = time.Now()
+	}
+
+	sa.arrivalsMu.Lock()
+	defer sa.arrivalsMu.Unlock()
+
+	if len(sa.arrivals[windowKey]) >= maxArrivalsPerWindow {
+		return
+	}
+	sa.arrivals[windowKey] = append(sa.arrivals[windowKey], SpotArrival{
+		Instance:      report.InstanceName,
+		Callsign:      report.Callsign,
+		Band:          band,
+		ArrivedAt:     arrivedAt,
+		OffsetSeconds: arrivedAt.Sub(time.Unix(windowKey+120, 0)).Seconds(),
+	})
+
+	if len(sa.arrivals) > arrivalWindowsKept {
+		keys := make([]int64, 0, len(sa.arrivals))
+		for k := range sa.arrivals {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] > keys[j] })
+		for _, k := range keys[arrivalWindowsKept:] {
+			delete(sa.arrivals, k)
+		}
+	}
+}
+
+// GetWindowArrivals returns the arrival timelines of the most recent windows,
+// newest first
+func (sa *SpotAggregator) GetWindowArrivals() []WindowArrivals {
+	sa.arrivalsMu.Lock()
+	result := make([]WindowArrivals, 0, len(sa.arrivals))
+	for windowKey, arrivals := range sa.arrivals {
+		sorted := make([]SpotArrival, len(arrivals))
+		copy(sorted, arrivals)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].ArrivedAt.Before(sorted[j].ArrivedAt) })
+
+		result = append(result, WindowArrivals{
+			WindowTime: time.Unix(windowKey, 0).UTC(),
+			CycleEnd:   time.Unix(windowKey+120, 0).UTC(),
+			Arrivals:   sorted,
+			Instances:  arrivalSpreads(sorted),
+		})
+	}
+	sa.arrivalsMu.Unlock()
+
+	sa.windowsMu.Lock()
+	for i := range result {
+		_, result[i].Open = sa.windows[result[i].WindowTime.Unix()]
+	}
+	sa.windowsMu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].WindowTime.After(result[j].WindowTime) })
+	return result
+}
+
+// arrivalSpreads summarises arrivals (sorted by time) per instance
+func arrivalSpreads(arrivals []SpotArrival) map[string]ArrivalSpread {
+	offsets := make(map[string][]float64)
+	for _, a := range arrivals {
+		offsets[a.Instance] = append(offsets[a.Instance], a.OffsetSeconds)
+	}
+
+	spreads := make(map[string]ArrivalSpread, len(offsets))
+	for instance, o := range offsets {
+		first, last := o[0], o[len(o)-1]
+		spreads[instance] = ArrivalSpread{
+			Count:         len(o),
+			FirstOffset:   first,
+			MedianOffset:  o[len(o)/2],
+			LastOffset:    last,
+			SpreadSeconds: last - first,
+		}
+	}
+	return spreads
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backfillLiveMargin is the most recent period left to live reception. Windows
+// this close to now may still be submitted locally, so they are never imported.
+const backfillLiveMargin = 6 * time.Minute
+
+// errBackfillEmptyRange is returned when nothing is left to import after the
+// requested range is limited to the importable period
+var errBackfillEmptyRange = errors.New("nothing to import in this range (only the last 24 hours, up to a few minutes ago, can be imported)")
+
+// ImportedSpot is a spot recorded on WSPRNet for this receiver, used to fill
+// gaps in the statistics. It was not received or submitted by this aggregator.
+type ImportedSpot struct {
+	Callsign string
+	Locator  string
+	Band     string
+	SNR      int
+}
+
+// BackfillResult describes one backfill run
+type BackfillResult struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Fetched         int       `json:"fetched"`          // Spots returned by WSPRNet for the period
+	ImportedWindows int       `json:"imported_windows"` // Windows added to the statistics
+	ImportedSpots   int       `json:"imported_spots"`   // Spots in the added windows
+	SkippedWindows  int       `json:"skipped_windows"`  // Windows already in the history, left untouched
+}
+
+// Backfiller imports this receiver's spots from a WSPRNet mirror into the
+// statistics to fill gaps in the dashboard history after an outage
+type Backfiller struct {
+	url       string
+	callsign  string
+	stats     *StatisticsTracker
+	client    *http.Client
+	normalize bool // normalize_callsigns, so imported spots match live ones
+
+	mu sync.Mutex // Serialises runs
+}
+
+// NewBackfiller creates a backfiller for the given receiver callsign
+func NewBackfiller(url, callsign string, stats *StatisticsTracker) *Backfiller {
+	return &Backfiller{
+		url:      url,
+		callsign: strings.ToUpper(callsign),
+		stats:    stats,
+		client:   &http.Client{Timeout: 60 * time.Second, Transport: outboundTransport()},
+	}
+}
+
+// SetNormalizeCallsigns makes imported transmitter callsigns go through
+// normalizeCallsign, as live decodes do with normalize_callsigns
+func (b *Backfiller) SetNormalizeCallsigns(normalize bool) {
+	b.normalize = normalize
+}
+
+// Run imports spots between from and to. The range is limited to the 24 hours
+// of history the statistics keep, and stops short of the live windows. Windows
+// that already exist in the history are skipped, so running it twice is harmless.
+func (b *Backfiller) Run(from, to time.Time) (*BackfillResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().UTC()
+	if earliest := now.Add(-24 * time.Hour); from.Before(earliest) {
+		from = earliest
+	}
+	if latest := now.Add(-backfillLiveMargin); to.After(latest) {
+		to = latest
+	}
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return nil, errBackfillEmptyRange
+	}
+
+	if !reconcileCallsignPattern.MatchString(b.callsign) {
+		return nil, fmt.Errorf("receiver callsign %q cannot be used in a query", b.callsign)
+	}
+
+	query := fmt.Sprintf("SELECT time, tx_sign, tx_loc, frequency, snr FROM wspr.rx WHERE rx_sign = '%s' AND time >= '%s' AND time < '%s' FORMAT JSONEachRow",
+		b.callsign, from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"))
+
+	result := &BackfillResult{From: from, To: to}
+	windows := make(map[int64][]ImportedSpot)
+	err := queryWSPRLive(b.client, b.url, query, func(line []byte) error {
+		var row struct {
+			Time      string      `json:"time"`
+			TxSign    string      `json:"tx_sign"`
+			TxLoc     string      `json:"tx_loc"`
+			Frequency json.Number `json:"frequency"`
+			SNR       json.Number `json:"snr"`
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return fmt.Errorf("failed to parse row: %w", err)
+		}
+
+		spotTime, err := time.Parse("2006-01-02 15:04:05", row.Time)
+		if err != nil {
+			return fmt.Errorf("failed to parse time %q: %w", row.Time, err)
+		}
+		freq, err := strconv.ParseUint(row.Frequency.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse frequency %q: %w", row.Frequency, err)
+		}
+		snr, err := strconv.Atoi(row.SNR.String())
+		if err != nil {
+			return fmt.Errorf("failed to parse snr %q: %w", row.SNR, err)
+		}
+
+		callsign := strings.ToUpper(row.TxSign)
+		if b.normalize {
+			callsign = normalizeCallsign(callsign)
+		}
+
+		windowKey := (spotTime.Unix() / 120) * 120
+		windows[windowKey] = append(windows[windowKey], ImportedSpot{
+			Callsign: callsign,
+			Locator:  row.TxLoc,
+			Band:     frequencyToBand(freq),
+			SNR:      snr,
+		})
+		result.Fetched++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for windowKey, spots := range windows {
+		if b.stats.ImportWindow(time.Unix(windowKey, 0).UTC(), spots) {
+			result.ImportedWindows++
+			result.ImportedSpots += len(spots)
+		} else {
+			result.SkippedWindows++
+		}
+	}
+
+	log.Printf("Backfill: Imported %d spots in %d windows from %s to %s (%d windows already present)",
+		result.ImportedSpots, result.ImportedWindows, from.Format("15:04"), to.Format("15:04 UTC"), result.SkippedWindows)
+	return result, nil
+}
+
+// RunSinceLastWindow fills the gap between the newest window in the history
+// (typically loaded from the persistence file) and now. It does nothing if
+// there is no history yet.
+func (b *Backfiller) RunSinceLastWindow() {
+	windows := b.stats.GetRecentWindows(1)
+	if len(windows) == 0 {
+		log.Println("Backfill: No saved history, nothing to fill")
+		return
+	}
+
+	from := windows[0].WindowTime.Add(2 * time.Minute)
+	if time.Since(from) <= backfillLiveMargin {
+		return
+	}
+	if _, err := b.Run(from, time.Now()); err != nil {
+		log.Printf("Backfill: Failed to import spots since %s: %v", from.Format(time.RFC3339), err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BandRange maps a range of frequencies to a band name
+type BandRange struct {
+	Band   string `yaml:"band" json:"band"`
+	MinHz  uint64 `yaml:"min_hz" json:"min_hz"`                       // Lowest frequency in the band
+	MaxHz  uint64 `yaml:"max_hz" json:"max_hz"`                       // First frequency above the band
+	DialHz uint64 `yaml:"dial_hz,omitempty" json:"dial_hz,omitempty"` // Nominal WSPR USB dial; the passband is 1400-1600 Hz above it
+}
+
+// bandTable is a list of band ranges in frequency order, none overlapping
+type bandTable []BandRange
+
+// defaultBandTable holds the amateur bands WSPR is used on. band_table entries
+// replace these by name or add to them.
+var defaultBandTable = bandTable{
+	{Band: "2200m", MinHz: 135700, MaxHz: 137800, DialHz: 136000},
+	{Band: "630m", MinHz: 472000, MaxHz: 479000, DialHz: 474200},
+	{Band: "160m", MinHz: 1800000, MaxHz: 2000000, DialHz: 1836600},
+	{Band: "80m", MinHz: 3500000, MaxHz: 4000000, DialHz: 3568600},
+	{Band: "60m", MinHz: 5250000, MaxHz: 5450000, DialHz: 5287200},
+	{Band: "40m", MinHz: 7000000, MaxHz: 7300000, DialHz: 7038600},
+	{Band: "30m", MinHz: 10100000, MaxHz: 10150000, DialHz: 10138700},
+	{Band: "20m", MinHz: 14000000, MaxHz: 14350000, DialHz: 14095600},
+	{Band: "17m", MinHz: 18068000, MaxHz: 18168000, DialHz: 18104600},
+	{Band: "15m", MinHz: 21000000, MaxHz: 21450000, DialHz: 21094600},
+	{Band: "12m", MinHz: 24890000, MaxHz: 24990000, DialHz: 24924600},
+	{Band: "10m", MinHz: 28000000, MaxHz: 29700000, DialHz: 28124600},
+	{Band: "6m", MinHz: 50000000, MaxHz: 54000000, DialHz: 50293000},
+	{Band: "4m", MinHz: 70000000, MaxHz: 70500000, DialHz: 70091000},
+	{Band: "2m", MinHz: 144000000, MaxHz: 148000000, DialHz: 144489000},
+}
+
+// activeBandTable is the table in use, set once at startup by setBandTable
+var activeBandTable = defaultBandTable
+
+// buildBandTable merges band_table entries into the default table: an entry
+// with the name of a default band replaces it, any other is added
+func buildBandTable(entries []BandRange) (bandTable, error) {
+	byName := make(map[string]BandRange, len(defaultBandTable)+len(entries))
+	for _, r := range defaultBandTable {
+		byName[r.Band] = r
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, r := range entries {
+		r.Band = strings.TrimSpace(r.Band)
+		switch {
+		case r.Band == "":
+			return nil, fmt.Errorf("band_table: every entry needs a band name")
+		case strings.HasSuffix(r.Band, "MHz"):
+			return nil, fmt.Errorf("band_table: band %q must not end in MHz, which is kept for unknown frequencies", r.Band)
+		case seen[r.Band]:
+			return nil, fmt.Errorf("band_table: band %q is listed twice", r.Band)
+		case r.MinHz == 0 || r.MaxHz <= r.MinHz:
+			return nil, fmt.Errorf("band_table: band %q needs 0 < min_hz < max_hz", r.Band)
+		case r.DialHz != 0 && (r.DialHz < r.MinHz || r.DialHz >= r.MaxHz):
+			return nil, fmt.Errorf("band_table: band %q dial_hz must be within min_hz and max_hz", r.Band)
+		}
+		seen[r.Band] = true
+		byName[r.Band] = r
+	}
+
+	table := make(bandTable, 0, len(byName))
+	for _, r := range byName {
+		table = append(table, r)
+	}
+	sort.Slice(table, func(i, j int) bool { return table[i].MinHz < table[j].MinHz })
+	for i := 1; i < len(table); i++ {
+		if table[i].MinHz < table[i-1].MaxHz {
+			return nil, fmt.Errorf("band_table: %s overlaps %s", table[i].Band, table[i-1].Band)
+		}
+	}
+	return table, nil
+}
+
+// setBandTable makes table the one frequencyToBand uses. Must be called before
+// any spots are processed.
+func setBandTable(table bandTable) {
+	activeBandTable = table
+}
+
+// band returns the band containing freq, if any
+func (t bandTable) band(freq uint64) (string, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].MaxHz > freq })
+	if i < len(t) && freq >= t[i].MinHz {
+		return t[i].Band, true
+	}
+	return "", false
+}
+
+// index returns the position of band in frequency order, or -1 if it is not
+// in the table
+func (t bandTable) index(band string) int {
+	for i, r := range t {
+		if r.Band == band {
+			return i
+		}
+	}
+	return -1
+}
+
+// has reports whether band is in the table
+func (t bandTable) has(band string) bool {
+	return t.index(band) >= 0
+}
+
+// names returns the band names in frequency order
+func (t bandTable) names() []string {
+	names := make([]string, len(t))
+	for i, r := range t {
+		names[i] = r.Band
+	}
+	return names
+}
+
+// frequencyToBand converts a frequency to a band name. freq must be in Hz
+// (use normalizeFrequencyHz on decoded values first); frequencies outside every
+// band are returned as "<MHz>MHz", to the nearest kHz.
+func frequencyToBand(freq uint64) string {
+	if band, ok := activeBandTable.band(freq); ok {
+		return band
+	}
+	return fmt.Sprintf("%.3fMHz", float64(freq)/1000000.0)
+}
+
+// normalizeFrequencyHz converts a decoded frequency to Hz. Publishers send Hz,
+// kHz or MHz, so the unit is the first of those that puts the value in a known
+// band. A value in no band in any unit is told apart by magnitude, as amateur
+// WSPR bands run from 136 kHz to 148 MHz: values below 100 are MHz, 100 to
+// 100,000 are kHz, and 100 kHz to 1 GHz are Hz. It returns the frequency in Hz,
+// whether it had to be scaled, and false if the value is not plausible in any unit.
+func normalizeFrequencyHz(freq float64) (uint64, bool, bool) {
+	if freq <= 0 || freq >= 1e9 {
+		return 0, false, false
+	}
+	for _, scale := range []float64{1, 1e3, 1e6} {
+		hz := math.Round(freq * scale)
+		if hz >= 1e9 {
+			break
+		}
+		if _, ok := activeBandTable.band(uint64(hz)); ok {
+			return uint64(hz), scale != 1, true
+		}
+	}
+
+	switch {
+	case freq >= 100000:
+		return uint64(math.Round(freq)), false, true
+	case freq >= 100:
+		return uint64(math.Round(freq * 1e3)), true, true
+	default:
+		return uint64(math.Round(freq * 1e6)), true, true
+	}
+}
+
+// bandDialFrequency returns the nominal WSPR dial frequency (Hz) of band, if
+// the band is known and has one
+func bandDialFrequency(band string) (uint64, bool) {
+	if i := activeBandTable.index(band); i >= 0 && activeBandTable[i].DialHz != 0 {
+		return activeBandTable[i].DialHz, true
+	}
+	return 0, false
+}
+
+// bandIndex returns the position of band in frequency order, or -1 for a
+// frequency outside every band
+func bandIndex(band string) int {
+	return activeBandTable.index(band)
+}
+
+// isKnownBand reports whether band is one frequencyToBand recognises, rather
+// than the raw MHz value it returns for anything else
+func isKnownBand(band string) bool {
+	return activeBandTable.has(band)
+}
+
+// bandInfo is one band as returned by /api/bands
+type bandInfo struct {
+	BandRange
+	Enabled bool `json:"enabled"` // Decodes accepted under bands/disabled_bands
+}
+
+// handleBands returns the band table in frequency order, the same list the
+// dashboard uses for its band filters, colors and ordering
+func (ws *WebServer) handleBands(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	bands := make([]bandInfo, 0, len(activeBandTable))
+	for _, br := range activeBandTable {
+		bands = append(bands, bandInfo{BandRange: br, Enabled: ws.config.Load().BandEnabled(br.Band)})
+	}
+	writeJSON(w, http.StatusOK, bands)
+}
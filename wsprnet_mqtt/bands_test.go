@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBandTableBoundaries(t *testing.T) {
+	tests := []struct {
+		freq uint64
+		band string // Empty for a frequency outside every band
+	}{
+		{135700, "2200m"}, // MinHz
+		{137799, "2200m"}, // MaxHz-1
+		{137800, ""},      // MaxHz is the first frequency above the band
+		{135699, ""},      // Just below MinHz
+		{5250000, "60m"},  // MinHz
+		{5287200, "60m"},  // WSPR dial
+		{5366500, "60m"},  // Channelised 60m allocation
+		{5449999, "60m"},  // MaxHz-1
+		{5450000, ""},     // MaxHz
+		{9999999, ""},     // Gap below 30m
+		{10100000, "30m"}, // MinHz
+		{10149999, "30m"}, // MaxHz-1
+		{10150000, ""},    // MaxHz, in the gap above 30m
+		{13999999, ""},    // Gap below 20m
+		{14000000, "20m"}, // MinHz
+		{14097100, "20m"}, // WSPR passband
+		{14349999, "20m"}, // MaxHz-1
+		{14350000, ""},    // MaxHz
+		{50000000, "6m"},  // MinHz
+		{53999999, "6m"},  // MaxHz-1
+		{54000000, ""},    // MaxHz
+		{70000000, "4m"},  // MinHz
+		{70499999, "4m"},  // MaxHz-1
+		{144000000, "2m"}, // MinHz
+		{147999999, "2m"}, // MaxHz-1
+		{148000000, ""},   // MaxHz, above every band
+		{0, ""},           // Below every band
+		{1<<64 - 1, ""},   // Largest frequency
+	}
+	for _, tt := range tests {
+		band, ok := defaultBandTable.band(tt.freq)
+		if band != tt.band || ok != (tt.band != "") {
+			t.Errorf("band(%d) = %q, %v, want %q, %v", tt.freq, band, ok, tt.band, tt.band != "")
+		}
+	}
+}
+
+func TestFrequencyToBandUnknown(t *testing.T) {
+	tests := []struct {
+		freq uint64
+		want string
+	}{
+		{10150000, "10.150MHz"},
+		{14350000, "14.350MHz"},
+		{27555000, "27.555MHz"},
+		{40680000, "40.680MHz"},
+	}
+	for _, tt := range tests {
+		// The same label every time, so unknown spots group together
+		for i := 0; i < 2; i++ {
+			if got := frequencyToBand(tt.freq); got != tt.want {
+				t.Errorf("frequencyToBand(%d) = %q, want %q", tt.freq, got, tt.want)
+			}
+		}
+		if isKnownBand(tt.want) {
+			t.Errorf("isKnownBand(%q) = true for an unknown frequency", tt.want)
+		}
+	}
+}
+
+func TestNormalizeFrequencyHz(t *testing.T) {
+	tests := []struct {
+		freq   float64
+		hz     uint64
+		scaled bool
+		ok     bool
+	}{
+		{14097100, 14097100, false, true}, // Hz
+		{14097.1, 14097100, true, true},   // kHz
+		{14.0971, 14097100, true, true},   // MHz
+		{136000, 136000, false, true},     // 2200m in Hz
+		{136, 136000, true, true},         // 2200m in kHz
+		{0.1375, 137500, true, true},      // 2200m in MHz
+		{474200, 474200, false, true},     // 630m in Hz
+		{474.2, 474200, true, true},       // 630m in kHz
+		{144489000, 144489000, false, true},
+		{144489, 144489000, true, true},   // 2m in kHz, not Hz
+		{144.489, 144489000, true, true},  // 2m in MHz, not kHz
+		{70091, 70091000, true, true},     // 4m in kHz
+		{27555000, 27555000, false, true}, // Outside every band: by magnitude
+		{27555, 27555000, true, true},
+		{27.555, 27555000, true, true},
+		{0, 0, false, false},
+		{-14.0971, 0, false, false},
+		{2.4e9, 0, false, false},
+	}
+	for _, tt := range tests {
+		hz, scaled, ok := normalizeFrequencyHz(tt.freq)
+		if hz != tt.hz || scaled != tt.scaled || ok != tt.ok {
+			t.Errorf("normalizeFrequencyHz(%v) = %d, %v, %v, want %d, %v, %v", tt.freq, hz, scaled, ok, tt.hz, tt.scaled, tt.ok)
+		}
+	}
+}
+
+func TestBuildBandTable(t *testing.T) {
+	// No entries gives the default table
+	table, err := buildBandTable(nil)
+	if err != nil {
+		t.Fatalf("buildBandTable(nil): %v", err)
+	}
+	if got, want := strings.Join(table.names(), " "), strings.Join(defaultBandTable.names(), " "); got != want {
+		t.Errorf("default bands = %s, want %s", got, want)
+	}
+
+	// Entries replace default bands by name and add others in frequency order
+	table, err = buildBandTable([]BandRange{
+		{Band: "60m", MinHz: 5351500, MaxHz: 5366500, DialHz: 5364700},
+		{Band: " 8m ", MinHz: 40660000, MaxHz: 40700000},
+	})
+	if err != nil {
+		t.Fatalf("buildBandTable: %v", err)
+	}
+	if i, j := table.index("8m"), table.index("6m"); i < 0 || i != j-1 {
+		t.Errorf("8m at %d, want just before 6m at %d", i, j)
+	}
+	tests := []struct {
+		freq uint64
+		band string
+	}{
+		{5287200, ""}, // In the default 60m range but not the replacement
+		{5351500, "60m"},
+		{5366499, "60m"},
+		{5366500, ""},
+		{40660000, "8m"},
+		{40699999, "8m"},
+		{40700000, ""},
+		{14097100, "20m"},
+	}
+	for _, tt := range tests {
+		if band, _ := table.band(tt.freq); band != tt.band {
+			t.Errorf("band(%d) = %q, want %q", tt.freq, band, tt.band)
+		}
+	}
+}
+
+func TestBuildBandTableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []BandRange
+		error   string // Substring of the error
+	}{
+		{"no name", []BandRange{{Band: " ", MinHz: 1, MaxHz: 2}}, "needs a band name"},
+		{"MHz name", []BandRange{{Band: "40.680MHz", MinHz: 40660000, MaxHz: 40700000}}, "must not end in MHz"},
+		{"listed twice", []BandRange{
+			{Band: "8m", MinHz: 40660000, MaxHz: 40700000},
+			{Band: "8m", MinHz: 40660000, MaxHz: 40700000},
+		}, `"8m" is listed twice`},
+		{"no min", []BandRange{{Band: "8m", MaxHz: 40700000}}, "needs 0 < min_hz < max_hz"},
+		{"empty range", []BandRange{{Band: "8m", MinHz: 40700000, MaxHz: 40700000}}, "needs 0 < min_hz < max_hz"},
+		{"dial below", []BandRange{{Band: "8m", MinHz: 40660000, MaxHz: 40700000, DialHz: 40659999}}, "dial_hz must be within"},
+		{"dial at max", []BandRange{{Band: "8m", MinHz: 40660000, MaxHz: 40700000, DialHz: 40700000}}, "dial_hz must be within"},
+		{"overlaps a default band", []BandRange{{Band: "20m wide", MinHz: 14300000, MaxHz: 14400000}}, "20m wide overlaps 20m"},
+		{"overlaps by one hertz", []BandRange{{Band: "30m low", MinHz: 10000000, MaxHz: 10100001}}, "30m overlaps 30m low"},
+		{"replacement overlaps", []BandRange{{Band: "30m", MinHz: 10100000, MaxHz: 14000001}}, "20m overlaps 30m"},
+		{"new bands overlap", []BandRange{
+			{Band: "8m", MinHz: 40660000, MaxHz: 40700000},
+			{Band: "8m fm", MinHz: 40690000, MaxHz: 40800000},
+		}, "8m fm overlaps 8m"},
+	}
+	for _, tt := range tests {
+		table, err := buildBandTable(tt.entries)
+		if err == nil {
+			t.Errorf("%s: buildBandTable = %v, want an error", tt.name, table.names())
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: error = %q, want it to contain %q", tt.name, err, tt.error)
+		}
+	}
+
+	// Touching ranges don't overlap: MaxHz is exclusive
+	if _, err := buildBandTable([]BandRange{{Band: "30m low", MinHz: 10000000, MaxHz: 10100000}}); err != nil {
+		t.Errorf("range ending at the next band's MinHz: %v", err)
+	}
+}
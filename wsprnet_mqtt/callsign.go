@@ -0,0 +1,42 @@
+package main
+
+import "strings"
+
+// portableSuffixes are the parts after a "/" that mark how or where a station
+// is operating rather than who it is (normalize_callsigns). Single digits
+// (call area, e.g. W1ABC/4) are stripped as well.
+var portableSuffixes = map[string]bool{
+	"P":   true, // Portable
+	"M":   true, // Mobile
+	"MM":  true, // Maritime mobile
+	"AM":  true, // Aeronautical mobile
+	"QRP": true, // Low power
+	"A":   true, // Alternative location
+}
+
+// normalizeCallsign returns the base callsign of a compound one: portable
+// suffixes are dropped (W1ABC/P, W1ABC/QRP), and of what is left the longest
+// part is kept, which drops a country prefix or suffix (DL/W1ABC, W1ABC/VE3).
+// Plain callsigns and hashed ones ("<...>") are returned upper-cased.
+func normalizeCallsign(callsign string) string {
+	callsign = strings.ToUpper(strings.TrimSpace(callsign))
+	if !strings.Contains(callsign, "/") || strings.HasPrefix(callsign, "<") {
+		return callsign
+	}
+
+	parts := strings.Split(callsign, "/")
+	base := ""
+	for _, part := range parts {
+		if portableSuffixes[part] || (len(part) == 1 && part[0] >= '0' && part[0] <= '9') {
+			continue
+		}
+		if len(part) > len(base) {
+			base = part
+		}
+	}
+	if base == "" {
+		// Nothing but indicators; leave it for the usual validation to judge
+		return callsign
+	}
+	return base
+}
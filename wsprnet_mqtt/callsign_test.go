@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNormalizeCallsign(t *testing.T) {
+	tests := []struct {
+		callsign string
+		want     string
+	}{
+		// Plain callsigns are only upper-cased and trimmed
+		{"W1ABC", "W1ABC"},
+		{"w1abc", "W1ABC"},
+		{" W1ABC ", "W1ABC"},
+		// Portable and power suffixes
+		{"W1ABC/P", "W1ABC"},
+		{"W1ABC/M", "W1ABC"},
+		{"W1ABC/MM", "W1ABC"},
+		{"W1ABC/AM", "W1ABC"},
+		{"W1ABC/QRP", "W1ABC"},
+		{"W1ABC/A", "W1ABC"},
+		{"w1abc/qrp", "W1ABC"},
+		// Call area suffix
+		{"W1ABC/4", "W1ABC"},
+		// Country prefix or suffix: the longer part is the callsign
+		{"DL/W1ABC", "W1ABC"},
+		{"W1ABC/VE3", "W1ABC"},
+		{"EA8/G4XYZ", "G4XYZ"},
+		// Prefix and suffix together
+		{"DL/W1ABC/P", "W1ABC"},
+		{"DL/W1ABC/QRP", "W1ABC"},
+		{"W1ABC/4/P", "W1ABC"},
+		// Hashed callsigns are left as they are
+		{"<...>", "<...>"},
+		{"<W1ABC/P>", "<W1ABC/P>"},
+		// Nothing but indicators is left for validation to reject
+		{"P/QRP", "P/QRP"},
+		{"/P", "/P"},
+		{"4/P", "4/P"},
+		{"/", "/"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeCallsign(tt.callsign); got != tt.want {
+			t.Errorf("normalizeCallsign(%q) = %q, want %q", tt.callsign, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Defaults for the clock skew warnings
+const (
+	DefaultClockSkewDTWarn    = 1.0 // Seconds of average |DT|
+	DefaultClockSkewDelayWarn = 90  // Seconds after the cycle end
+)
+
+// clockSkewSamples is how many recent reports per instance are averaged
+const clockSkewSamples = 200
+
+// clockSkewMinSamples is how many reports an instance needs before it is warned about
+const clockSkewMinSamples = 20
+
+// ClockSkewConfig sets when the clock skew health check warns
+type ClockSkewConfig struct {
+	DTWarnSeconds    float64 `yaml:"dt_warn_seconds" json:"dt_warn_seconds"`       // Warn when the average |DT| reaches this (default 1.0)
+	DelayWarnSeconds float64 `yaml:"delay_warn_seconds" json:"delay_warn_seconds"` // Warn when reports arrive this long after the cycle end on average (default 90)
+}
+
+// ClockSkewStats is the rolling clock health of one instance, or of all of them
+type ClockSkewStats struct {
+	Samples int `json:"samples"`
+	// Average DT reported by the decoder, in seconds. A consistent offset from
+	// zero means the receiver's clock is off.
+	AverageDT float64 `json:"average_dt"`
+	// Average time between the end of the WSPR cycle and the report reaching the
+	// aggregator, in seconds. This is mostly decoding time; a negative value
+	// means decode timestamps are ahead of this machine's clock.
+	AverageDelay float64 `json:"average_delay_seconds"`
+}
+
+// ClockSkewHealth summarises recent DT and report delay with any warnings
+type ClockSkewHealth struct {
+	Overall          ClockSkewStats            `json:"overall"`
+	Instances        map[string]ClockSkewStats `json:"instances"`
+	DTWarnSeconds    float64                   `json:"dt_warn_seconds"`
+	DelayWarnSeconds float64                   `json:"delay_warn_seconds"`
+	Warnings         []string                  `json:"warnings"`
+}
+
+// clockSkewRing holds an instance's most recent DT and delay samples
+type clockSkewRing struct {
+	dt    [clockSkewSamples]float64
+	delay [clockSkewSamples]float64
+	next  int
+	count int
+}
+
+// ClockSkewTracker keeps rolling averages of DT and report delay per instance
+type ClockSkewTracker struct {
+	dtWarn    float64
+	delayWarn float64
+
+	mu        sync.Mutex
+	instances map[string]*clockSkewRing
+}
+
+// NewClockSkewTracker creates a tracker with the given warning thresholds
+func NewClockSkewTracker(dtWarn, delayWarn float64) *ClockSkewTracker {
+	return &ClockSkewTracker{
+		dtWarn:    dtWarn,
+		delayWarn: delayWarn,
+		instances: make(map[string]*clockSkewRing),
+	}
+}
+
+// Record adds one report's DT and its delay after the cycle end (seconds)
+func (ct *ClockSkewTracker) Record(instance string, dt, delay float64) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ring := ct.instances[instance]
+	if ring == nil {
+		ring = &clockSkewRing{}
+		ct.instances[instance] = ring
+	}
+	ring.dt[ring.next] = dt
+	ring.delay[ring.next] = delay
+	ring.next = (ring.next + 1) % clockSkewSamples
+	if ring.count < clockSkewSamples {
+		ring.count++
+	}
+}
+
+// Health returns the rolling averages and a warning for each instance whose
+// average DT or delay is past its threshold
+func (ct *ClockSkewTracker) Health() ClockSkewHealth {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	health := ClockSkewHealth{
+		Instances:        make(map[string]ClockSkewStats, len(ct.instances)),
+		DTWarnSeconds:    ct.dtWarn,
+		DelayWarnSeconds: ct.delayWarn,
+		Warnings:         []string{},
+	}
+
+	var totalDT, totalDelay float64
+	names := make([]string, 0, len(ct.instances))
+	for name, ring := range ct.instances {
+		var dt, delay float64
+		for i := 0; i < ring.count; i++ {
+			dt += ring.dt[i]
+			delay += ring.delay[i]
+		}
+		totalDT += dt
+		totalDelay += delay
+		health.Overall.Samples += ring.count
+
+		health.Instances[name] = ClockSkewStats{
+			Samples:      ring.count,
+			AverageDT:    dt / float64(ring.count),
+			AverageDelay: delay / float64(ring.count),
+		}
+		names = append(names, name)
+	}
+	if health.Overall.Samples > 0 {
+		health.Overall.AverageDT = totalDT / float64(health.Overall.Samples)
+		health.Overall.AverageDelay = totalDelay / float64(health.Overall.Samples)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		s := health.Instances[name]
+		if s.Samples < clockSkewMinSamples {
+			continue
+		}
+		if math.Abs(s.AverageDT) >= ct.dtWarn {
+			health.Warnings = append(health.Warnings, fmt.Sprintf(
+				"%s: average DT is %+.1f s, its receiver clock may be off", name, s.AverageDT))
+		}
+		if s.AverageDelay < 0 {
+			health.Warnings = append(health.Warnings, fmt.Sprintf(
+				"%s: reports arrive %.0f s before the cycle ends on average, its clock may be ahead", name, -s.AverageDelay))
+		} else if s.AverageDelay >= ct.delayWarn {
+			health.Warnings = append(health.Warnings, fmt.Sprintf(
+				"%s: reports arrive %.0f s after the cycle ends on average, its clock may be behind or decoding is slow", name, s.AverageDelay))
+		}
+	}
+	return health
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+)
+
+// spotReception is one instance's report of a spot, collected on the report
+// deduplication keeps so the spot's confidence can be scored at submission
+type spotReception struct {
+	instance string
+	snr      int
+	hasSNR   bool
+	dt       float32
+	drift    int
+}
+
+// receptionOf returns the parts of a report used for scoring, and its instance
+func receptionOf(report *WSPRReportWithSource) spotReception {
+	return spotReception{instance: report.InstanceName, snr: report.SNR, hasSNR: report.HasSNR, dt: report.DT, drift: report.Drift}
+}
+
+// spotConfidence scores a deduplicated spot from 1 to 100 from how many
+// instances heard it and whether their reports look like a real decode. The
+// score is 100 times the product of three factors:
+//
+//   - corroboration: 0.6 for one instance, 0.85 for two, 1.0 for three or more,
+//     times 0.9 if the instances' SNRs are more than 15 dB apart
+//   - signal: 1.0 at -24 dB or better, falling linearly to 0.6 at -30 dB
+//     (0.8 when no SNR was reported)
+//   - plausibility: 1.0, times 0.7 if the kept report's |DT| is over 2.5 s,
+//     0.7 if its |drift| is over 3 Hz, 0.85 if the instances' DTs are more than
+//     1.5 s apart and 0.85 if their drifts are more than 2 Hz apart
+func spotConfidence(kept *WSPRReport, receptions []spotReception) int {
+	corroboration := 1.0
+	switch len(receptions) {
+	case 0, 1:
+		corroboration = 0.6
+	case 2:
+		corroboration = 0.85
+	}
+
+	signal := 0.8
+	if kept.HasSNR {
+		signal = 1.0 - math.Min(math.Max(float64(-24-kept.SNR), 0), 6)/6*0.4
+	}
+
+	plausibility := 1.0
+	if math.Abs(float64(kept.DT)) > 2.5 {
+		plausibility *= 0.7
+	}
+	if kept.Drift > 3 || kept.Drift < -3 {
+		plausibility *= 0.7
+	}
+
+	if len(receptions) > 1 {
+		first := receptions[0]
+		minDT, maxDT := first.dt, first.dt
+		minDrift, maxDrift := first.drift, first.drift
+		minSNR, maxSNR, haveSNR := 0, 0, false
+		for _, r := range receptions {
+			minDT, maxDT = min(minDT, r.dt), max(maxDT, r.dt)
+			minDrift, maxDrift = min(minDrift, r.drift), max(maxDrift, r.drift)
+			if r.hasSNR {
+				if !haveSNR {
+					minSNR, maxSNR, haveSNR = r.snr, r.snr, true
+				}
+				minSNR, maxSNR = min(minSNR, r.snr), max(maxSNR, r.snr)
+			}
+		}
+		if maxSNR-minSNR > 15 {
+			corroboration *= 0.9
+		}
+		if maxDT-minDT > 1.5 {
+			plausibility *= 0.85
+		}
+		if maxDrift-minDrift > 2 {
+			plausibility *= 0.85
+		}
+	}
+
+	score := int(math.Round(100 * corroboration * signal * plausibility))
+	if score < 1 {
+		score = 1
+	}
+	return score
+}
@@ -2,19 +2,351 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Receiver        ReceiverConfig `yaml:"receiver" json:"receiver"`
-	MQTT            MQTTConfig     `yaml:"mqtt" json:"mqtt"`
-	WebPort         int            `yaml:"web_port" json:"web_port"`
-	DryRun          bool           `yaml:"dry_run" json:"dry_run"`
-	PersistenceFile string         `yaml:"persistence_file" json:"persistence_file"`
-	AdminPassword   string         `yaml:"admin_password" json:"admin_password"`
+	Receiver          ReceiverConfig  `yaml:"receiver" json:"receiver"`
+	MQTT              MQTTConfig      `yaml:"mqtt" json:"mqtt"`
+	WebPort           int             `yaml:"web_port" json:"web_port"`
+	DryRun            bool            `yaml:"dry_run" json:"dry_run"`
+	PersistenceFile   string          `yaml:"persistence_file" json:"persistence_file"`
+	PersistenceFormat string          `yaml:"persistence_format,omitempty" json:"persistence_format,omitempty"` // "json" (default) or "gob"
+	AdminPassword     string          `yaml:"admin_password" json:"admin_password"`
+	Dashboard         DashboardConfig `yaml:"dashboard" json:"dashboard"`
+	WSPRNet           WSPRNetConfig   `yaml:"wsprnet" json:"wsprnet"`
+
+	// Sites whose pages may read the /api endpoints: "*" (default) for any, or
+	// origins such as https://example.com
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty" json:"allowed_origins,omitempty"`
+
+	// Key /api requests must carry, as "Authorization: Bearer <key>" or
+	// ?key=<key>. Empty (default) leaves the API open.
+	APIKey string `yaml:"api_key,omitempty" json:"api_key,omitempty"`
+
+	// Hours an admin login lasts (default 24)
+	AdminSessionHours int `yaml:"admin_session_hours,omitempty" json:"admin_session_hours,omitempty"`
+
+	// File admin sessions are kept in, so a restart (such as after saving the
+	// config) doesn't log the admin out. Empty (default) keeps them in memory only.
+	AdminSessionsFile string `yaml:"admin_sessions_file,omitempty" json:"admin_sessions_file,omitempty"`
+
+	PSKReporter PSKReporterConfig `yaml:"pskreporter" json:"pskreporter"`
+
+	// Exit after the admin page saves the config, for a supervisor to restart
+	// the process (default true). When false, changes are applied in place
+	// and the process only exits for changes that can't be.
+	RestartOnSave *bool `yaml:"restart_on_save,omitempty" json:"restart_on_save,omitempty"`
+
+	// Seconds between saves of the persistence file while running (default 30).
+	// It is also saved after every window and at shutdown.
+	PersistenceIntervalSeconds int `yaml:"persistence_interval_seconds,omitempty" json:"persistence_interval_seconds,omitempty"`
+
+	// Hours of window and SNR history kept in memory and in the persistence file
+	RetentionHours int `yaml:"retention_hours" json:"retention_hours"`
+
+	// Longest a window is held for instances that have not reported yet, in
+	// seconds from the start of its WSPR cycle (default 240). Reports are only
+	// deduplicated, and SNR history only gathered, within this window.
+	DedupWindowSeconds int `yaml:"dedup_window_seconds,omitempty" json:"dedup_window_seconds,omitempty"`
+
+	// The same limit counted from the end of the WSPR cycle instead of its
+	// start: dedup_window_seconds minus 120. Set one or the other.
+	SubmissionDeadlineSeconds int `yaml:"submission_deadline_seconds,omitempty" json:"submission_deadline_seconds,omitempty"`
+
+	// Minutes without a report before an instance is shown as offline and its
+	// spots are hidden from the live map
+	InstanceOfflineMinutes int `yaml:"instance_offline_minutes" json:"instance_offline_minutes"`
+
+	// Minutes an instance may go without a spot before the gap counts as
+	// downtime in its online fraction, used to weight the value analysis
+	OnlineGraceMinutes int `yaml:"online_grace_minutes,omitempty" json:"online_grace_minutes,omitempty"`
+
+	// Number of spot files read in parallel when loading the last 24 hours at startup
+	SpotLoadWorkers int `yaml:"spot_load_workers" json:"spot_load_workers"`
+
+	// How the spot logs are stored: "jsonl" (default), one file per instance
+	// plus deduped.jsonl, or "sqlite", indexed tables in spots.db
+	SpotStorage string `yaml:"spot_storage" json:"spot_storage"`
+
+	// Days of spots spots.db keeps for queries with spot_storage "sqlite"; the
+	// in-memory cache and JSONL files keep 24 hours
+	SpotRetentionDays int `yaml:"spot_retention_days" json:"spot_retention_days"`
+
+	// Number of recently heard callsigns kept and shown per instance
+	RecentCallsigns int `yaml:"recent_callsigns" json:"recent_callsigns"`
+
+	// Locator precision used for distances and bearings: "auto" (default) uses the
+	// 6-character subsquare when a decode has one, "square" always uses 4 characters
+	GridPrecision string `yaml:"grid_precision" json:"grid_precision"`
+
+	// Unit for distances in /api/instances, /api/snr-history and the dashboard:
+	// "km" (default) or "mi". Statistics are stored in km either way.
+	DistanceUnit string `yaml:"distance_unit" json:"distance_unit"`
+
+	// Tag deduplicated spots with whether both ends of the path were in the
+	// grayline (sun within 6 degrees of the horizon) at the time of the spot
+	Grayline bool `yaml:"grayline,omitempty" json:"grayline,omitempty"`
+
+	SNRAlerts SNRAlertConfig `yaml:"snr_alerts" json:"snr_alerts"`
+
+	// What to do with decodes whose callsign is the unresolved hash "<...>":
+	// "drop" (default), "count" or "submit"
+	HashedCallsigns string `yaml:"hashed_callsigns" json:"hashed_callsigns"`
+
+	// What to do with decodes on a frequency outside every known band:
+	// "submit" (default), "drop" or "quarantine"
+	UnknownBands string `yaml:"unknown_bands" json:"unknown_bands"`
+
+	// Bands to accept decodes on (default all), or bands to drop decodes on.
+	// At most one of the two may be set.
+	Bands         []string `yaml:"bands,omitempty" json:"bands,omitempty"`
+	DisabledBands []string `yaml:"disabled_bands,omitempty" json:"disabled_bands,omitempty"`
+
+	// Frequency ranges to add to the built-in band table, or to replace a
+	// built-in band's range by using its name
+	BandTable []BandRange `yaml:"band_table,omitempty" json:"band_table,omitempty"`
+
+	// Decodes with an SNR below this (dB) are dropped at ingestion. Unset
+	// (nil) disables the filter; 0 is a real threshold.
+	MinSNR *int `yaml:"min_snr,omitempty" json:"min_snr,omitempty"`
+
+	GridConsistency GridConsistencyConfig `yaml:"grid_consistency" json:"grid_consistency"`
+
+	// Thresholds for the clock skew warnings in /api/health
+	ClockSkew ClockSkewConfig `yaml:"clock_skew" json:"clock_skew"`
+
+	// Optional command run after each window is finalized, with its summary on
+	// stdin. Left out of the admin page's JSON: it runs host commands, so it is
+	// only set in the config file.
+	WindowHook WindowHookConfig `yaml:"window_hook" json:"-"`
+
+	// Optional proxy for outbound HTTP (WSPRNet uploads, wspr.live queries,
+	// InfluxDB and webhooks): http://, https://, socks5:// or socks5h://
+	ProxyURL string `yaml:"proxy_url,omitempty" json:"proxy_url,omitempty"`
+
+	// Export deduplicated spots to InfluxDB; enabled when url is set
+	InfluxDB InfluxDBConfig `yaml:"influxdb,omitempty" json:"influxdb,omitempty"`
+
+	// Prefix for the metric names served at /metrics (default "wspr")
+	MetricsPrefix string `yaml:"metrics_prefix,omitempty" json:"metrics_prefix,omitempty"`
+
+	// Synthetic station mix used when started with --demo
+	Demo DemoConfig `yaml:"demo,omitempty" json:"demo,omitempty"`
+
+	// Transmitter callsigns exempt from deduplication: every instance's report
+	// of these is submitted, e.g. to compare antennas on a known beacon
+	DedupExemptCallsigns []string `yaml:"dedup_exempt_callsigns,omitempty" json:"dedup_exempt_callsigns,omitempty"`
+
+	// What makes two reports in a cycle the same spot: "band" (default), or
+	// "frequency" to also keep signals of one callsign on different transmit
+	// frequencies in the same band apart
+	DedupKey string `yaml:"dedup_key,omitempty" json:"dedup_key,omitempty"`
+
+	// Strip portable and country indicators (W1ABC/P, DL/W1ABC) from transmitter
+	// callsigns for deduplication and statistics. Reports are still uploaded
+	// with the callsign as decoded.
+	NormalizeCallsigns bool `yaml:"normalize_callsigns,omitempty" json:"normalize_callsigns,omitempty"`
+
+	// Optional import of this receiver's spots from WSPRNet to fill gaps in the history
+	Backfill BackfillConfig `yaml:"backfill" json:"backfill"`
+
+	// Optional log file. When set, logs go to this file instead of stderr and the
+	// file is rotated when it reaches log_max_size_mb or log_max_age_days.
+	LogFile       string `yaml:"log_file,omitempty" json:"log_file,omitempty"`
+	LogMaxSizeMB  int    `yaml:"log_max_size_mb,omitempty" json:"log_max_size_mb,omitempty"`   // Default 10
+	LogMaxAgeDays int    `yaml:"log_max_age_days,omitempty" json:"log_max_age_days,omitempty"` // Default 7
+	LogMaxBackups int    `yaml:"log_max_backups,omitempty" json:"log_max_backups,omitempty"`   // Rotated files kept (default 5)
+
+	// "text" (default) or "json": one JSON object per line with ts, level, msg
+	// and fields such as instance, band and callsign, for log collectors
+	LogFormat string `yaml:"log_format,omitempty" json:"log_format,omitempty"`
+	LogLevel  string `yaml:"log_level,omitempty" json:"log_level,omitempty"` // debug, info (default), warn or error
+
+	// Seconds the first start after an admin config change must stay up. If it
+	// doesn't, the next start is in safe mode (web and admin only).
+	RestartGuardSeconds int `yaml:"restart_guard_seconds,omitempty" json:"restart_guard_seconds,omitempty"`
+}
+
+// BackfillConfig controls importing spots recorded on WSPRNet into the statistics.
+// Imported spots are marked as such and are never submitted.
+type BackfillConfig struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled"`
+	URL       string `yaml:"url,omitempty" json:"url,omitempty"` // ClickHouse query endpoint mirroring WSPRNet (default: wspr.live)
+	OnStartup bool   `yaml:"on_startup" json:"on_startup"`       // Fill the gap since the last saved window when starting
+}
+
+// Handling modes for unresolved hashed callsigns ("<...>")
+const (
+	HashedCallsignsDrop   = "drop"   // Discard silently
+	HashedCallsignsCount  = "count"  // Count per band, then discard
+	HashedCallsignsSubmit = "submit" // Count per band and pass on for submission to WSPRNet
+)
+
+// Handling modes for decodes on a frequency outside every known band
+const (
+	UnknownBandsSubmit     = "submit"     // Count, then process like any other spot
+	UnknownBandsDrop       = "drop"       // Count and discard
+	UnknownBandsQuarantine = "quarantine" // Count and write to the quarantine file instead of processing
+)
+
+// Deduplication keys: callsign, mode, cycle and band, plus transmit frequency
+// for DedupKeyFrequency
+const (
+	DedupKeyBand      = "band"
+	DedupKeyFrequency = "frequency"
+)
+
+// dedupFrequencyToleranceHz is how far apart two receivers' transmit
+// frequencies for the same signal may be with dedup_key: frequency. A WSPR
+// signal is about 6 Hz wide, so separate signals are further apart.
+const dedupFrequencyToleranceHz = 5
+
+// GridConsistencyConfig holds the optional check that instances hearing the same
+// spot agree on the transmitter's grid
+type GridConsistencyConfig struct {
+	Enabled     bool    `yaml:"enabled" json:"enabled"`
+	ToleranceKm float64 `yaml:"tolerance_km" json:"tolerance_km"` // Largest allowed distance between reported grids (default 200)
+	Action      string  `yaml:"action" json:"action"`             // "hold" (default) or "flag"
+}
+
+// Actions for spots whose instances disagree on the grid
+const (
+	GridConsistencyHold = "hold" // Do not submit the spot
+	GridConsistencyFlag = "flag" // Submit the spot but log and count it
+)
+
+// DashboardConfig contains optional branding for the web dashboard
+type DashboardConfig struct {
+	Title       string `yaml:"title,omitempty" json:"title,omitempty"`               // Page title and header text
+	Subtitle    string `yaml:"subtitle,omitempty" json:"subtitle,omitempty"`         // Text shown under the header
+	FaviconPath string `yaml:"favicon_path,omitempty" json:"favicon_path,omitempty"` // Optional favicon file served at /favicon.ico
+	LogoPath    string `yaml:"logo_path,omitempty" json:"logo_path,omitempty"`       // Optional logo image shown in the header
+
+	MapTiles MapTilesConfig `yaml:"map_tiles" json:"map_tiles"`
+}
+
+// MapTilesConfig selects the tile server behind the dashboard map
+type MapTilesConfig struct {
+	URL         string `yaml:"url,omitempty" json:"url,omitempty"`                 // Leaflet URL template with {z}, {x} and {y} (default OpenStreetMap)
+	Attribution string `yaml:"attribution,omitempty" json:"attribution,omitempty"` // Credit shown on the map (HTML); most tile providers require one
+	MaxZoom     int    `yaml:"max_zoom,omitempty" json:"max_zoom,omitempty"`       // Highest zoom level the tile server provides (default 18)
+	Dir         string `yaml:"dir,omitempty" json:"dir,omitempty"`                 // Optional directory of {z}/{x}/{y}.png tiles served at /map-tiles/
+}
+
+// Default map tiles: the OpenStreetMap standard layer, whose usage policy
+// requires this attribution
+const (
+	DefaultMapTilesURL         = "https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png"
+	DefaultMapTilesAttribution = `&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors`
+	LocalMapTilesURL           = "/map-tiles/{z}/{x}/{y}.png"
+)
+
+// WSPRNetConfig contains WSPRNet submission settings
+type WSPRNetConfig struct {
+	// Base URL spots are uploaded to (default http://wsprnet.org), e.g. a mock
+	// server for testing or an internal mirror of the upload endpoint
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+
+	// Scheduled windows during which uploads are held and sent once the window ends
+	QuietHours []QuietHoursWindow `yaml:"quiet_hours,omitempty" json:"quiet_hours,omitempty"`
+
+	// Optional comparison of submitted spots with what WSPRNet actually recorded
+	Reconcile WSPRNetReconcileConfig `yaml:"reconcile" json:"reconcile"`
+
+	// File recording spots WSPRNet has accepted, so that spots decoded again after
+	// a crash or restart are not uploaded twice (default wsprnet_submitted.jsonl)
+	SubmittedKeysFile string `yaml:"submitted_keys_file,omitempty" json:"submitted_keys_file,omitempty"`
+	// Hours an accepted spot is remembered (default 24)
+	SubmittedKeysHours int `yaml:"submitted_keys_hours,omitempty" json:"submitted_keys_hours,omitempty"`
+
+	// File spots still waiting to be uploaded at shutdown (held for quiet
+	// hours, waiting to retry, or queued) are saved to and uploaded from at
+	// the next start (default wsprnet_pending.json)
+	PendingFile string `yaml:"pending_file,omitempty" json:"pending_file,omitempty"`
+
+	// How spots are uploaded: "mept" (bulk upload, default), "post" or "get"
+	// (the older one-spot-per-request interface), or "auto" to use the first
+	// that works
+	SubmitMethod string `yaml:"submit_method,omitempty" json:"submit_method,omitempty"`
+
+	// Spots with a confidence score (1-100) below this are recorded but not
+	// submitted to WSPRNet (default 0, submit everything)
+	MinConfidence int `yaml:"min_confidence,omitempty" json:"min_confidence,omitempty"`
+
+	// Address included in the User-Agent of uploads so WSPRNet's operators
+	// can contact you about problems with your station's spots
+	ContactEmail string `yaml:"contact_email,omitempty" json:"contact_email,omitempty"`
+
+	// Retry policy for failed uploads. Retry n waits initial_backoff_seconds *
+	// backoff_multiplier^(n-1), give or take 20%, up to 30 minutes. Defaults:
+	// 3 retries, 60 seconds, multiplier 2.
+	MaxRetries            *int    `yaml:"max_retries,omitempty" json:"max_retries,omitempty"`
+	InitialBackoffSeconds int     `yaml:"initial_backoff_seconds,omitempty" json:"initial_backoff_seconds,omitempty"`
+	BackoffMultiplier     float64 `yaml:"backoff_multiplier,omitempty" json:"backoff_multiplier,omitempty"`
+
+	// Most upload requests sent a minute: a MEPT batch, or one spot with the
+	// post and get methods. Uploads over the limit wait. 0 (default) is no limit.
+	MaxSubmissionsPerMinute int `yaml:"max_submissions_per_minute,omitempty" json:"max_submissions_per_minute,omitempty"`
+}
+
+// RetryPolicy returns the upload retry settings, with defaults filled in by Validate
+func (c WSPRNetConfig) RetryPolicy() WSPRRetryPolicy {
+	policy := WSPRRetryPolicy{
+		MaxRetries:        WSPRMaxRetries,
+		InitialBackoff:    time.Duration(c.InitialBackoffSeconds) * time.Second,
+		BackoffMultiplier: c.BackoffMultiplier,
+	}
+	if c.MaxRetries != nil {
+		policy.MaxRetries = *c.MaxRetries
+	}
+	return policy
+}
+
+// WSPRNetReconcileConfig controls periodic reconciliation against WSPRNet's records
+type WSPRNetReconcileConfig struct {
+	Enabled         bool   `yaml:"enabled" json:"enabled"`
+	URL             string `yaml:"url,omitempty" json:"url,omitempty"`       // ClickHouse query endpoint mirroring WSPRNet (default: wspr.live)
+	IntervalMinutes int    `yaml:"interval_minutes" json:"interval_minutes"` // How often to reconcile (default 30)
+	LookbackHours   int    `yaml:"lookback_hours" json:"lookback_hours"`     // How far back to compare, up to 24 (default 2)
+}
+
+// SNRAlertConfig controls alerts for sudden changes in per-band average SNR
+type SNRAlertConfig struct {
+	Enabled         bool    `yaml:"enabled" json:"enabled"`
+	WebhookURL      string  `yaml:"webhook_url,omitempty" json:"webhook_url,omitempty"` // Optional URL that receives each alert as a JSON POST
+	ThresholdDB     float64 `yaml:"threshold_db" json:"threshold_db"`                   // Deviation from baseline that raises an alert (default 6)
+	BaselineWindows int     `yaml:"baseline_windows" json:"baseline_windows"`           // Trailing windows averaged for the baseline (default 30)
+	MinSpots        int     `yaml:"min_spots" json:"min_spots"`                         // Spots with SNR needed in a window before it is checked (default 3)
+	CooldownMinutes int     `yaml:"cooldown_minutes" json:"cooldown_minutes"`           // Minimum time between alerts for the same band and instance (default 30)
+}
+
+// QuietHoursWindow is a daily UTC time range in "HH:MM" format.
+// A window whose end is before its start wraps past midnight.
+type QuietHoursWindow struct {
+	Start string `yaml:"start" json:"start"`
+	End   string `yaml:"end" json:"end"`
+}
+
+// minutes returns the window start and end as minutes after midnight UTC
+func (q QuietHoursWindow) minutes() (int, int, error) {
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start %q (expected HH:MM)", q.Start)
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end %q (expected HH:MM)", q.End)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
 }
 
 // ReceiverConfig contains receiver station information
@@ -24,6 +356,35 @@ type ReceiverConfig struct {
 	Antenna  string `yaml:"antenna" json:"antenna"` // Optional antenna description for PSKReporter
 }
 
+// maxRetainedGraceSeconds caps mqtt.retained_grace_seconds at one WSPR cycle
+// beyond the dedup window, so a restart can't resubmit much that was already sent
+const maxRetainedGraceSeconds = 600
+
+// RestartsOnSave reports whether saving the config from the admin page always
+// restarts the process (default true)
+func (c *Config) RestartsOnSave() bool {
+	return c.RestartOnSave == nil || *c.RestartOnSave
+}
+
+// DedupWindow returns how long a window is held from the start of its WSPR
+// cycle, from dedup_window_seconds or submission_deadline_seconds (default 240
+// seconds)
+func (c *Config) DedupWindow() time.Duration {
+	switch {
+	case c.DedupWindowSeconds != 0:
+		return time.Duration(c.DedupWindowSeconds) * time.Second
+	case c.SubmissionDeadlineSeconds != 0:
+		return time.Duration(c.SubmissionDeadlineSeconds+120) * time.Second
+	}
+	return DefaultDedupWindow * time.Second
+}
+
+// IgnoresRetained reports whether decodes from before startup are dropped as
+// retained messages (default true)
+func (c MQTTConfig) IgnoresRetained() bool {
+	return c.IgnoreRetained == nil || *c.IgnoreRetained
+}
+
 // MQTTConfig contains MQTT broker configuration
 type MQTTConfig struct {
 	Broker    string           `yaml:"broker" json:"broker"`
@@ -31,15 +392,76 @@ type MQTTConfig struct {
 	Password  string           `yaml:"password" json:"password"`
 	Instances []InstanceConfig `yaml:"instances" json:"instances"`
 	QoS       int              `yaml:"qos" json:"qos"`
+	Workers   int              `yaml:"workers" json:"workers"`       // Goroutines processing received messages (default 4)
+	QueueSize int              `yaml:"queue_size" json:"queue_size"` // Messages buffered for the workers; excess is dropped and counted (default 1000)
+
+	// TLS settings for ssl:// and mqtts:// brokers
+	TLS MQTTTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+
+	// PEM client certificate and private key, for brokers that authenticate
+	// clients by certificate (mTLS). Both or neither must be set.
+	ClientCert string `yaml:"client_cert,omitempty" json:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty" json:"client_key,omitempty"`
+
+	// Retained-message filter. For the first few seconds after startup, decodes
+	// timestamped before startup minus RetainedGraceSeconds are dropped as
+	// retained messages; IgnoreRetained false turns the filter off (default true).
+	IgnoreRetained       *bool `yaml:"ignore_retained,omitempty" json:"ignore_retained,omitempty"`
+	RetainedGraceSeconds int   `yaml:"retained_grace_seconds,omitempty" json:"retained_grace_seconds,omitempty"`
+
+	// Upper limit on len(Instances), to catch runaway configs before they swamp
+	// memory and the dashboard (default 32)
+	MaxInstances int `yaml:"max_instances,omitempty" json:"max_instances,omitempty"`
 
 	// Deprecated: Use Instances instead
 	TopicPrefixes []string `yaml:"topic_prefixes,omitempty" json:"topic_prefixes,omitempty"`
 }
 
+// DefaultMaxInstances is the default limit on configured MQTT instances
+const DefaultMaxInstances = 32
+
 // InstanceConfig represents a single UberSDR instance
 type InstanceConfig struct {
 	Name        string `yaml:"name" json:"name"`
 	TopicPrefix string `yaml:"topic_prefix" json:"topic_prefix"`
+	DisplayName string `yaml:"display_name,omitempty" json:"display_name,omitempty"` // Optional friendly label; stats stay keyed on Name
+
+	// Topic layout for this instance's decodes, with {prefix} for topic_prefix
+	// and {band} for the band level (default "{prefix}/digital_modes/WSPR/{band}")
+	TopicPattern string `yaml:"topic_pattern,omitempty" json:"topic_pattern,omitempty"`
+
+	// Optional dedup preference. Both default to 0, which keeps selection purely SNR-based.
+	Priority    int `yaml:"priority,omitempty" json:"priority,omitempty"`         // Higher wins when SNRs tie
+	SNRHandicap int `yaml:"snr_handicap,omitempty" json:"snr_handicap,omitempty"` // dB added to this instance's SNR when comparing duplicates (0-5)
+}
+
+// InstanceDisplayName returns the display name for an instance, falling back to its name
+func (c *Config) InstanceDisplayName(name string) string {
+	for _, inst := range c.MQTT.Instances {
+		if inst.Name == name && inst.DisplayName != "" {
+			return inst.DisplayName
+		}
+	}
+	return name
+}
+
+// BandEnabled reports whether decodes on band are accepted under the bands
+// and disabled_bands settings
+func (c *Config) BandEnabled(band string) bool {
+	if len(c.Bands) > 0 {
+		for _, b := range c.Bands {
+			if b == band {
+				return true
+			}
+		}
+		return false
+	}
+	for _, b := range c.DisabledBands {
+		if b == band {
+			return false
+		}
+	}
+	return true
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -75,6 +497,22 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("MQTT broker is required")
 	}
 
+	// Check the TLS files load, so a typo is reported before connecting
+	if c.MQTT.ClientCert != "" && c.MQTT.ClientKey == "" {
+		return fmt.Errorf("mqtt client_cert is set but client_key is missing")
+	}
+	if c.MQTT.ClientKey != "" && c.MQTT.ClientCert == "" {
+		return fmt.Errorf("mqtt client_key is set but client_cert is missing")
+	}
+	if c.MQTT.TLS != (MQTTTLSConfig{}) || c.MQTT.ClientCert != "" {
+		if !isTLSBroker(c.MQTT.Broker) {
+			return fmt.Errorf("mqtt tls or client_cert is set but the broker URL is not ssl://, mqtts:// or another TLS scheme")
+		}
+		if _, err := c.MQTT.BuildTLS(); err != nil {
+			return fmt.Errorf("mqtt tls: %w", err)
+		}
+	}
+
 	// Support both old and new config formats
 	if len(c.MQTT.Instances) == 0 && len(c.MQTT.TopicPrefixes) == 0 {
 		return fmt.Errorf("at least one MQTT instance is required")
@@ -91,6 +529,17 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Set default instance limit if not specified
+	if c.MQTT.MaxInstances == 0 {
+		c.MQTT.MaxInstances = DefaultMaxInstances
+	}
+	if c.MQTT.MaxInstances < 1 || c.MQTT.MaxInstances > 1000 {
+		return fmt.Errorf("mqtt.max_instances must be between 1 and 1000")
+	}
+	if len(c.MQTT.Instances) > c.MQTT.MaxInstances {
+		return fmt.Errorf("%d MQTT instances configured, more than mqtt.max_instances (%d); raise max_instances if this is intended", len(c.MQTT.Instances), c.MQTT.MaxInstances)
+	}
+
 	// Validate instances
 	for i, inst := range c.MQTT.Instances {
 		if inst.TopicPrefix == "" {
@@ -100,6 +549,32 @@ func (c *Config) Validate() error {
 			// Default to topic prefix if name not provided
 			c.MQTT.Instances[i].Name = inst.TopicPrefix
 		}
+		if inst.TopicPattern != "" {
+			if err := validateTopicPattern(inst.TopicPattern); err != nil {
+				return fmt.Errorf("instance %d: topic_pattern %w", i, err)
+			}
+		}
+		if inst.SNRHandicap < 0 || inst.SNRHandicap > 5 {
+			return fmt.Errorf("instance %d: snr_handicap must be between 0 and 5 dB", i)
+		}
+	}
+
+	// Set default MQTT worker pool size if not specified
+	if c.MQTT.Workers == 0 {
+		c.MQTT.Workers = DefaultMQTTWorkers
+	}
+	if c.MQTT.Workers < 1 || c.MQTT.Workers > 64 {
+		return fmt.Errorf("mqtt workers must be between 1 and 64")
+	}
+	if c.MQTT.QueueSize == 0 {
+		c.MQTT.QueueSize = DefaultMQTTQueueSize
+	}
+	if c.MQTT.QueueSize < 1 {
+		return fmt.Errorf("mqtt queue_size must be at least 1")
+	}
+
+	if c.MQTT.RetainedGraceSeconds < 0 || c.MQTT.RetainedGraceSeconds > maxRetainedGraceSeconds {
+		return fmt.Errorf("mqtt retained_grace_seconds must be between 0 and %d", maxRetainedGraceSeconds)
 	}
 
 	if c.MQTT.QoS < 0 || c.MQTT.QoS > 2 {
@@ -111,10 +586,498 @@ func (c *Config) Validate() error {
 		c.WebPort = 9009
 	}
 
+	// Allow any origin unless restricted
+	if len(c.AllowedOrigins) == 0 {
+		c.AllowedOrigins = []string{allowAllOrigins}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			return err
+		}
+	}
+
+	// Set default admin session lifetime if not specified
+	if c.AdminSessionHours == 0 {
+		c.AdminSessionHours = DefaultAdminSessionHours
+	}
+	if c.AdminSessionHours < 1 || c.AdminSessionHours > 720 {
+		return fmt.Errorf("admin_session_hours must be between 1 and 720")
+	}
+
+	// Set default retention if not specified. The dashboard's 24-hour views
+	// need at least that much history.
+	if c.RetentionHours == 0 {
+		c.RetentionHours = DefaultRetentionHours
+	}
+	if c.RetentionHours < 24 || c.RetentionHours > 168 {
+		return fmt.Errorf("retention_hours must be between 24 and 168")
+	}
+
+	// The deduplication window and the submission deadline are one limit, so
+	// both are left unset when not given and DedupWindow works out the default
+	if c.DedupWindowSeconds != 0 && (c.DedupWindowSeconds < 120 || c.DedupWindowSeconds > 600) {
+		return fmt.Errorf("dedup_window_seconds must be between 120 and 600")
+	}
+	if c.SubmissionDeadlineSeconds != 0 && (c.SubmissionDeadlineSeconds < 5 || c.SubmissionDeadlineSeconds > 480) {
+		return fmt.Errorf("submission_deadline_seconds must be between 5 and 480")
+	}
+	if c.DedupWindowSeconds != 0 && c.SubmissionDeadlineSeconds != 0 && c.DedupWindowSeconds != c.SubmissionDeadlineSeconds+120 {
+		return fmt.Errorf("dedup_window_seconds %d and submission_deadline_seconds %d disagree: the deadline counts from the end of the cycle, so it would be %d; set only one of them",
+			c.DedupWindowSeconds, c.SubmissionDeadlineSeconds, c.DedupWindowSeconds-120)
+	}
+
+	// Set default instance offline timeout if not specified
+	if c.InstanceOfflineMinutes == 0 {
+		c.InstanceOfflineMinutes = int(DefaultInstanceOfflineTimeout / time.Minute)
+	}
+	if c.InstanceOfflineMinutes < 1 {
+		return fmt.Errorf("instance_offline_minutes must be at least 1")
+	}
+
+	// Set default online grace if not specified
+	if c.OnlineGraceMinutes == 0 {
+		c.OnlineGraceMinutes = int(DefaultOnlineGrace / time.Minute)
+	}
+	if c.OnlineGraceMinutes < 5 || c.OnlineGraceMinutes > 720 {
+		return fmt.Errorf("online_grace_minutes must be between 5 and 720")
+	}
+
+	// Set default spot load parallelism if not specified
+	if c.SpotLoadWorkers == 0 {
+		c.SpotLoadWorkers = DefaultSpotLoadWorkers
+	}
+	if c.SpotLoadWorkers < 1 || c.SpotLoadWorkers > 64 {
+		return fmt.Errorf("spot_load_workers must be between 1 and 64")
+	}
+
+	// Set default spot storage if not specified
+	if c.SpotStorage == "" {
+		c.SpotStorage = SpotStorageJSONL
+	}
+	if c.SpotStorage != SpotStorageJSONL && c.SpotStorage != SpotStorageSQLite {
+		return fmt.Errorf("spot_storage must be %q or %q", SpotStorageJSONL, SpotStorageSQLite)
+	}
+
+	// Set default spot database retention if not specified
+	if c.SpotRetentionDays == 0 {
+		c.SpotRetentionDays = DefaultSpotRetentionDays
+	}
+	if c.SpotRetentionDays < 1 || c.SpotRetentionDays > 3650 {
+		return fmt.Errorf("spot_retention_days must be between 1 and 3650")
+	}
+
+	// Set default recent callsign list size if not specified
+	if c.RecentCallsigns == 0 {
+		c.RecentCallsigns = DefaultRecentCallsigns
+	}
+	if c.RecentCallsigns < 1 || c.RecentCallsigns > 500 {
+		return fmt.Errorf("recent_callsigns must be between 1 and 500")
+	}
+
+	// Set default grid precision if not specified
+	if c.GridPrecision == "" {
+		c.GridPrecision = GridPrecisionAuto
+	}
+	if c.GridPrecision != GridPrecisionAuto && c.GridPrecision != GridPrecisionSquare {
+		return fmt.Errorf("grid_precision must be %q or %q", GridPrecisionAuto, GridPrecisionSquare)
+	}
+
+	// Set default distance unit if not specified
+	if c.DistanceUnit == "" {
+		c.DistanceUnit = DistanceUnitKm
+	}
+	if c.DistanceUnit != DistanceUnitKm && c.DistanceUnit != DistanceUnitMi {
+		return fmt.Errorf("distance_unit must be %q or %q", DistanceUnitKm, DistanceUnitMi)
+	}
+
+	// Set log rotation defaults if logging to a file
+	if c.LogFile != "" {
+		if c.LogMaxSizeMB == 0 {
+			c.LogMaxSizeMB = DefaultLogMaxSizeMB
+		}
+		if c.LogMaxAgeDays == 0 {
+			c.LogMaxAgeDays = DefaultLogMaxAgeDays
+		}
+		if c.LogMaxBackups == 0 {
+			c.LogMaxBackups = DefaultLogMaxBackups
+		}
+		if c.LogMaxSizeMB < 1 || c.LogMaxSizeMB > 1024 {
+			return fmt.Errorf("log_max_size_mb must be between 1 and 1024")
+		}
+		if c.LogMaxAgeDays < 1 || c.LogMaxAgeDays > 365 {
+			return fmt.Errorf("log_max_age_days must be between 1 and 365")
+		}
+		if c.LogMaxBackups < 1 || c.LogMaxBackups > 100 {
+			return fmt.Errorf("log_max_backups must be between 1 and 100")
+		}
+	}
+
+	if c.LogFormat == "" {
+		c.LogFormat = LogFormatText
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("log_format must be %q or %q", LogFormatText, LogFormatJSON)
+	}
+	if c.LogLevel == "" {
+		c.LogLevel = DefaultLogLevel
+	}
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return fmt.Errorf("log_level must be debug, info, warn or error")
+	}
+
 	// Set default persistence file if not specified
 	if c.PersistenceFile == "" {
 		c.PersistenceFile = "wsprnet_stats.jsonl"
 	}
 
+	// Set default persistence format if not specified
+	if c.PersistenceFormat == "" {
+		c.PersistenceFormat = PersistenceFormatJSON
+	}
+	if c.PersistenceFormat != PersistenceFormatJSON && c.PersistenceFormat != PersistenceFormatGob {
+		return fmt.Errorf("persistence_format must be %q or %q", PersistenceFormatJSON, PersistenceFormatGob)
+	}
+	if c.PersistenceIntervalSeconds == 0 {
+		c.PersistenceIntervalSeconds = DefaultCheckpointInterval
+	}
+	if c.PersistenceIntervalSeconds < 10 || c.PersistenceIntervalSeconds > 3600 {
+		return fmt.Errorf("persistence_interval_seconds must be between 10 and 3600")
+	}
+
+	// Set default dashboard branding
+	if c.Dashboard.Title == "" {
+		c.Dashboard.Title = "WSPR MQTT Aggregator"
+	}
+	if c.Dashboard.Subtitle == "" {
+		c.Dashboard.Subtitle = "Real-time monitoring and statistics"
+	}
+	// A missing branding file only costs the dashboard its look, so the
+	// default is shown until the file is there
+	if c.Dashboard.FaviconPath != "" {
+		if _, err := os.Stat(c.Dashboard.FaviconPath); err != nil {
+			log.Printf("Warning: dashboard favicon_path: %v - using the default", err)
+		}
+	}
+	if c.Dashboard.LogoPath != "" {
+		if _, err := os.Stat(c.Dashboard.LogoPath); err != nil {
+			log.Printf("Warning: dashboard logo_path: %v - using the default", err)
+		}
+	}
+
+	// Set map tile defaults. Tiles from a local directory are served by the
+	// dashboard itself unless another URL is given.
+	tiles := &c.Dashboard.MapTiles
+	if tiles.Dir != "" {
+		if info, err := os.Stat(tiles.Dir); err != nil {
+			return fmt.Errorf("dashboard map_tiles dir: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("dashboard map_tiles dir %s is not a directory", tiles.Dir)
+		}
+		if tiles.URL == "" {
+			tiles.URL = LocalMapTilesURL
+		}
+	}
+	if tiles.URL == "" {
+		tiles.URL = DefaultMapTilesURL
+		if tiles.Attribution == "" {
+			tiles.Attribution = DefaultMapTilesAttribution
+		}
+	}
+	for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(tiles.URL, placeholder) {
+			return fmt.Errorf("dashboard map_tiles url must contain %s", placeholder)
+		}
+	}
+	if tiles.MaxZoom == 0 {
+		tiles.MaxZoom = 18
+	}
+	if tiles.MaxZoom < 1 || tiles.MaxZoom > 22 {
+		return fmt.Errorf("dashboard map_tiles max_zoom must be between 1 and 22")
+	}
+
+	// Validate WSPRNet quiet hours
+	for i, q := range c.WSPRNet.QuietHours {
+		start, end, err := q.minutes()
+		if err != nil {
+			return fmt.Errorf("wsprnet quiet_hours %d: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("wsprnet quiet_hours %d: start and end must differ", i)
+		}
+	}
+
+	// Set WSPRNet reconciliation defaults
+	// Set defaults for the record of accepted spots
+	if c.WSPRNet.SubmittedKeysFile == "" {
+		c.WSPRNet.SubmittedKeysFile = DefaultSubmittedKeysFile
+	}
+	if c.WSPRNet.PendingFile == "" {
+		c.WSPRNet.PendingFile = DefaultPendingFile
+	}
+	if c.WSPRNet.SubmittedKeysHours == 0 {
+		c.WSPRNet.SubmittedKeysHours = DefaultSubmittedKeysHours
+	}
+	if c.WSPRNet.SubmittedKeysHours < 1 || c.WSPRNet.SubmittedKeysHours > 168 {
+		return fmt.Errorf("wsprnet.submitted_keys_hours must be between 1 and 168")
+	}
+
+	// Set default upload URL
+	if c.WSPRNet.URL == "" {
+		c.WSPRNet.URL = WSPRServerURL
+	}
+	if u, err := url.Parse(c.WSPRNet.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		return fmt.Errorf("wsprnet.url must be an http:// or https:// URL without a query")
+	}
+
+	// Set default submission method
+	if c.WSPRNet.SubmitMethod == "" {
+		c.WSPRNet.SubmitMethod = SubmitMethodMEPT
+	}
+	switch c.WSPRNet.SubmitMethod {
+	case SubmitMethodMEPT, SubmitMethodPost, SubmitMethodGet, SubmitMethodAuto:
+	default:
+		return fmt.Errorf("wsprnet.submit_method must be %q, %q, %q or %q",
+			SubmitMethodMEPT, SubmitMethodPost, SubmitMethodGet, SubmitMethodAuto)
+	}
+
+	if c.WSPRNet.MinConfidence < 0 || c.WSPRNet.MinConfidence > 100 {
+		return fmt.Errorf("wsprnet.min_confidence must be between 0 and 100")
+	}
+
+	if c.WSPRNet.MaxRetries != nil && (*c.WSPRNet.MaxRetries < 0 || *c.WSPRNet.MaxRetries > 10) {
+		return fmt.Errorf("wsprnet.max_retries must be between 0 and 10")
+	}
+	if c.WSPRNet.InitialBackoffSeconds == 0 {
+		c.WSPRNet.InitialBackoffSeconds = int(WSPRInitialBackoff / time.Second)
+	}
+	if c.WSPRNet.InitialBackoffSeconds < 10 || c.WSPRNet.InitialBackoffSeconds > 3600 {
+		return fmt.Errorf("wsprnet.initial_backoff_seconds must be between 10 and 3600")
+	}
+	if c.WSPRNet.BackoffMultiplier == 0 {
+		c.WSPRNet.BackoffMultiplier = WSPRBackoffMultiplier
+	}
+	if c.WSPRNet.BackoffMultiplier < 1 || c.WSPRNet.BackoffMultiplier > 10 {
+		return fmt.Errorf("wsprnet.backoff_multiplier must be between 1 and 10")
+	}
+	if c.WSPRNet.MaxSubmissionsPerMinute < 0 {
+		return fmt.Errorf("wsprnet.max_submissions_per_minute must not be negative")
+	}
+
+	if c.WSPRNet.ContactEmail != "" {
+		c.WSPRNet.ContactEmail = strings.TrimSpace(c.WSPRNet.ContactEmail)
+		if addr, err := mail.ParseAddress(c.WSPRNet.ContactEmail); err != nil || addr.Address != c.WSPRNet.ContactEmail {
+			return fmt.Errorf("wsprnet.contact_email %q is not a plain email address", c.WSPRNet.ContactEmail)
+		}
+	}
+
+	if c.WSPRNet.Reconcile.Enabled {
+		if c.WSPRNet.Reconcile.URL == "" {
+			c.WSPRNet.Reconcile.URL = DefaultReconcileURL
+		}
+		if c.WSPRNet.Reconcile.IntervalMinutes == 0 {
+			c.WSPRNet.Reconcile.IntervalMinutes = 30
+		}
+		if c.WSPRNet.Reconcile.LookbackHours == 0 {
+			c.WSPRNet.Reconcile.LookbackHours = 2
+		}
+		if c.WSPRNet.Reconcile.IntervalMinutes < 5 {
+			return fmt.Errorf("wsprnet reconcile interval_minutes must be at least 5")
+		}
+		if c.WSPRNet.Reconcile.LookbackHours < 1 || c.WSPRNet.Reconcile.LookbackHours > 24 {
+			return fmt.Errorf("wsprnet reconcile lookback_hours must be between 1 and 24")
+		}
+	}
+
+	// Set default hashed callsign handling if not specified
+	if c.HashedCallsigns == "" {
+		c.HashedCallsigns = HashedCallsignsDrop
+	}
+	switch c.HashedCallsigns {
+	case HashedCallsignsDrop, HashedCallsignsCount, HashedCallsignsSubmit:
+	default:
+		return fmt.Errorf("hashed_callsigns must be %q, %q or %q", HashedCallsignsDrop, HashedCallsignsCount, HashedCallsignsSubmit)
+	}
+
+	// Set default unknown band handling if not specified
+	if c.UnknownBands == "" {
+		c.UnknownBands = UnknownBandsSubmit
+	}
+	switch c.UnknownBands {
+	case UnknownBandsSubmit, UnknownBandsDrop, UnknownBandsQuarantine:
+	default:
+		return fmt.Errorf("unknown_bands must be %q, %q or %q", UnknownBandsSubmit, UnknownBandsDrop, UnknownBandsQuarantine)
+	}
+
+	if c.MinSNR != nil && (*c.MinSNR < -50 || *c.MinSNR > 50) {
+		return fmt.Errorf("min_snr must be between -50 and 50 dB")
+	}
+
+	// Validate the band table and band filters
+	bands, err := buildBandTable(c.BandTable)
+	if err != nil {
+		return err
+	}
+	if len(c.Bands) > 0 && len(c.DisabledBands) > 0 {
+		return fmt.Errorf("set either bands or disabled_bands, not both")
+	}
+	for _, band := range c.Bands {
+		if !bands.has(band) {
+			return fmt.Errorf("bands: unknown band %q", band)
+		}
+	}
+	for _, band := range c.DisabledBands {
+		if !bands.has(band) {
+			return fmt.Errorf("disabled_bands: unknown band %q", band)
+		}
+	}
+
+	// Set backfill defaults
+	if c.Backfill.Enabled && c.Backfill.URL == "" {
+		c.Backfill.URL = DefaultReconcileURL
+	}
+
+	// Set grid consistency defaults
+	if c.GridConsistency.Enabled {
+		if c.GridConsistency.ToleranceKm == 0 {
+			c.GridConsistency.ToleranceKm = 200
+		}
+		if c.GridConsistency.Action == "" {
+			c.GridConsistency.Action = GridConsistencyHold
+		}
+		if c.GridConsistency.ToleranceKm < 0 {
+			return fmt.Errorf("grid_consistency tolerance_km must not be negative")
+		}
+		if c.GridConsistency.Action != GridConsistencyHold && c.GridConsistency.Action != GridConsistencyFlag {
+			return fmt.Errorf("grid_consistency action must be %q or %q", GridConsistencyHold, GridConsistencyFlag)
+		}
+	}
+
+	// Set restart guard default
+	if c.RestartGuardSeconds == 0 {
+		c.RestartGuardSeconds = DefaultRestartGuardSeconds
+	}
+	if c.RestartGuardSeconds < 10 || c.RestartGuardSeconds > 3600 {
+		return fmt.Errorf("restart_guard_seconds must be between 10 and 3600")
+	}
+
+	// Set clock skew defaults
+	if c.ClockSkew.DTWarnSeconds == 0 {
+		c.ClockSkew.DTWarnSeconds = DefaultClockSkewDTWarn
+	}
+	if c.ClockSkew.DelayWarnSeconds == 0 {
+		c.ClockSkew.DelayWarnSeconds = DefaultClockSkewDelayWarn
+	}
+	if c.ClockSkew.DTWarnSeconds < 0 || c.ClockSkew.DelayWarnSeconds < 0 {
+		return fmt.Errorf("clock_skew thresholds must not be negative")
+	}
+
+	// Set window hook defaults
+	if c.WindowHook.Command != "" {
+		if c.WindowHook.TimeoutSeconds == 0 {
+			c.WindowHook.TimeoutSeconds = DefaultWindowHookTimeout
+		}
+		if c.WindowHook.TimeoutSeconds < 1 || c.WindowHook.TimeoutSeconds > 600 {
+			return fmt.Errorf("window_hook timeout_seconds must be between 1 and 600")
+		}
+	}
+
+	// Validate PSKReporter overrides; unset values come from the receiver
+	if c.PSKReporter.Locator != "" && !isValidGridLocator(c.PSKReporter.Locator) {
+		return fmt.Errorf("pskreporter locator must be a 4 or 6 character locator (e.g. IO86 or IO86ha)")
+	}
+
+	if c.ProxyURL != "" {
+		if _, err := parseProxyURL(c.ProxyURL); err != nil {
+			return err
+		}
+	}
+
+	// Validate InfluxDB export
+	if c.InfluxDB.URL != "" {
+		u, err := url.Parse(c.InfluxDB.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("influxdb url must be an http:// or https:// URL")
+		}
+		if c.InfluxDB.Org == "" || c.InfluxDB.Bucket == "" {
+			return fmt.Errorf("influxdb org and bucket are required")
+		}
+	}
+
+	// Set metrics prefix default
+	if c.MetricsPrefix == "" {
+		c.MetricsPrefix = DefaultMetricsPrefix
+	}
+	if !metricsPrefixPattern.MatchString(c.MetricsPrefix) {
+		return fmt.Errorf("metrics_prefix must start with a letter or underscore and contain only letters, digits and underscores")
+	}
+
+	// Set demo mode defaults
+	if c.Demo.Stations == 0 {
+		c.Demo.Stations = DefaultDemoStations
+	}
+	if c.Demo.Stations < 1 || c.Demo.Stations > 5000 {
+		return fmt.Errorf("demo stations must be between 1 and 5000")
+	}
+	if c.Demo.SpotsPerCycle == 0 {
+		c.Demo.SpotsPerCycle = DefaultDemoSpotsPerCycle
+	}
+	if c.Demo.SpotsPerCycle < 1 || c.Demo.SpotsPerCycle > 1000 {
+		return fmt.Errorf("demo spots_per_cycle must be between 1 and 1000")
+	}
+	if len(c.Demo.Bands) == 0 {
+		c.Demo.Bands = DefaultDemoBands
+	}
+	for _, band := range c.Demo.Bands {
+		if i := bands.index(band); i < 0 || bands[i].DialHz == 0 {
+			return fmt.Errorf("demo bands: unknown band %q, or one without a dial_hz", band)
+		}
+	}
+
+	// Normalise dedup-exempt callsigns
+	exempt := make([]string, 0, len(c.DedupExemptCallsigns))
+	for _, callsign := range c.DedupExemptCallsigns {
+		callsign = strings.ToUpper(strings.TrimSpace(callsign))
+		if callsign == "" {
+			return fmt.Errorf("dedup_exempt_callsigns must not contain empty callsigns")
+		}
+		exempt = append(exempt, callsign)
+	}
+	c.DedupExemptCallsigns = exempt
+
+	if c.DedupKey == "" {
+		c.DedupKey = DedupKeyBand
+	}
+	if c.DedupKey != DedupKeyBand && c.DedupKey != DedupKeyFrequency {
+		return fmt.Errorf("dedup_key must be %q or %q", DedupKeyBand, DedupKeyFrequency)
+	}
+
+	// Set SNR alert defaults and validate ranges
+	if c.SNRAlerts.Enabled {
+		if c.SNRAlerts.ThresholdDB == 0 {
+			c.SNRAlerts.ThresholdDB = 6
+		}
+		if c.SNRAlerts.BaselineWindows == 0 {
+			c.SNRAlerts.BaselineWindows = 30
+		}
+		if c.SNRAlerts.MinSpots == 0 {
+			c.SNRAlerts.MinSpots = 3
+		}
+		if c.SNRAlerts.CooldownMinutes == 0 {
+			c.SNRAlerts.CooldownMinutes = 30
+		}
+		if c.SNRAlerts.ThresholdDB < 0 {
+			return fmt.Errorf("snr_alerts threshold_db must be positive")
+		}
+		if c.SNRAlerts.BaselineWindows < snrAlertMinBaseline || c.SNRAlerts.BaselineWindows > 720 {
+			return fmt.Errorf("snr_alerts baseline_windows must be between %d and 720", snrAlertMinBaseline)
+		}
+		if c.SNRAlerts.MinSpots < 1 {
+			return fmt.Errorf("snr_alerts min_spots must be at least 1")
+		}
+		if c.SNRAlerts.CooldownMinutes < 0 {
+			return fmt.Errorf("snr_alerts cooldown_minutes must not be negative")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// allowAllOrigins in allowed_origins lets any site read the API (the default)
+const allowAllOrigins = "*"
+
+// validateOrigin checks an allowed_origins entry: "*" or a bare origin such as
+// https://example.com or http://localhost:8080
+func validateOrigin(origin string) error {
+	if origin == allowAllOrigins {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("allowed_origins: %q must be %q or an origin like https://example.com", origin, allowAllOrigins)
+	}
+	return nil
+}
+
+// AllowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin: "*" if every origin is allowed, origin itself if it is listed,
+// or "" if it is not allowed
+func (c *Config) AllowedOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == allowAllOrigins {
+			return allowAllOrigins
+		}
+		if origin != "" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withCORS sets the CORS headers on /api responses according to
+// allowed_origins and answers preflight requests, so handlers don't set them
+func (ws *WebServer) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allow := ws.config.Load().AllowedOrigin(r.Header.Get("Origin"))
+		h := w.Header()
+		if allow != allowAllOrigins {
+			// The response depends on the origin, so caches must keep them apart
+			h.Add("Vary", "Origin")
+		}
+		if allow != "" {
+			h.Set("Access-Control-Allow-Origin", allow)
+			h.Set("Access-Control-Expose-Headers", "X-API-Version")
+		}
+
+		// Let browsers preflight cross-origin requests that send Accept-Version
+		// or an API key
+		if r.Method == http.MethodOptions {
+			if allow == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Accept-Version, Authorization")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
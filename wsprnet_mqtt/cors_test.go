@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    string
+	}{
+		{[]string{allowAllOrigins}, "https://example.com", allowAllOrigins},
+		{[]string{allowAllOrigins}, "", allowAllOrigins},
+		{[]string{"https://example.com"}, "https://example.com", "https://example.com"},
+		{[]string{"https://example.com/"}, "https://example.com", "https://example.com"},
+		{[]string{"https://example.com"}, "HTTPS://Example.com", "HTTPS://Example.com"},
+		{[]string{"https://example.com", "http://localhost:8080"}, "http://localhost:8080", "http://localhost:8080"},
+		{[]string{"https://example.com"}, "https://evil.example", ""},
+		{[]string{"https://example.com"}, "http://example.com", ""},
+		{[]string{"https://example.com"}, "", ""},
+		{nil, "https://example.com", ""},
+	}
+	for _, tt := range tests {
+		config := &Config{AllowedOrigins: tt.allowed}
+		if got := config.AllowedOrigin(tt.origin); got != tt.want {
+			t.Errorf("AllowedOrigins %v: AllowedOrigin(%q) = %q, want %q", tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWithCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		method  string
+		target  string
+		origin  string
+		status  int
+		allow   string // Access-Control-Allow-Origin
+		vary    bool   // Vary: Origin
+	}{
+		{"any origin", []string{allowAllOrigins}, http.MethodGet, "/api/summary", "https://example.com", http.StatusOK, allowAllOrigins, false},
+		{"any origin preflight", []string{allowAllOrigins}, http.MethodOptions, "/api/summary", "https://example.com", http.StatusNoContent, allowAllOrigins, false},
+		{"listed origin", []string{"https://example.com"}, http.MethodGet, "/api/summary", "https://example.com", http.StatusOK, "https://example.com", true},
+		{"listed origin preflight", []string{"https://example.com"}, http.MethodOptions, "/api/summary", "https://example.com", http.StatusNoContent, "https://example.com", true},
+		{"other origin", []string{"https://example.com"}, http.MethodGet, "/api/summary", "https://evil.example", http.StatusOK, "", true},
+		{"other origin preflight", []string{"https://example.com"}, http.MethodOptions, "/api/summary", "https://evil.example", http.StatusForbidden, "", true},
+		{"same origin", []string{"https://example.com"}, http.MethodGet, "/api/summary", "", http.StatusOK, "", true},
+		{"not the api", []string{"https://example.com"}, http.MethodGet, "/", "https://evil.example", http.StatusOK, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWebServer(t)
+			config := *ws.config.Load()
+			config.AllowedOrigins = tt.allowed
+			ws.config.Store(&config)
+			handler := ws.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+			if vary := rec.Header().Get("Vary") == "Origin"; vary != tt.vary {
+				t.Errorf("Vary = %q, want Origin: %v", rec.Header().Get("Vary"), tt.vary)
+			}
+			if allowed := rec.Header().Get("Access-Control-Allow-Methods") != ""; allowed != (tt.status == http.StatusNoContent) {
+				t.Errorf("Access-Control-Allow-Methods = %q on a %d", rec.Header().Get("Access-Control-Allow-Methods"), rec.Code)
+			}
+		})
+	}
+}
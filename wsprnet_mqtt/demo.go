@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Demo mode defaults
+const (
+	DefaultDemoStations      = 150
+	DefaultDemoSpotsPerCycle = 30
+)
+
+// DefaultDemoBands are the bands synthetic stations transmit on unless demo.bands is set
+var DefaultDemoBands = []string{"80m", "40m", "30m", "20m", "17m", "15m", "10m"}
+
+// DemoConfig sets the mix of synthetic stations generated with --demo
+type DemoConfig struct {
+	Stations      int      `yaml:"stations,omitempty" json:"stations,omitempty"`               // Synthetic transmitters to pick from (default 150)
+	SpotsPerCycle int      `yaml:"spots_per_cycle,omitempty" json:"spots_per_cycle,omitempty"` // Average decodes per 2-minute cycle (default 30)
+	Bands         []string `yaml:"bands,omitempty" json:"bands,omitempty"`                     // Bands to spread the stations over
+}
+
+// demoRegion is a place synthetic stations are put, with a callsign prefix
+// and the country name a decoder would report for it
+type demoRegion struct {
+	prefix   string
+	country  string
+	lat, lon float64
+	spread   float64 // Degrees either side of the centre
+}
+
+var demoRegions = []demoRegion{
+	{"G", "England", 52.5, -1.5, 2},
+	{"GM", "Scotland", 56.5, -4.0, 1.5},
+	{"EI", "Ireland", 53.2, -8.0, 1.5},
+	{"F", "France", 46.5, 2.5, 3},
+	{"DL", "Fed. Rep. of Germany", 51.0, 10.0, 3},
+	{"PA", "Netherlands", 52.2, 5.5, 1},
+	{"ON", "Belgium", 50.7, 4.5, 1},
+	{"EA", "Spain", 40.2, -3.7, 3},
+	{"I", "Italy", 43.0, 12.0, 3},
+	{"OZ", "Denmark", 56.0, 10.0, 1},
+	{"SM", "Sweden", 59.5, 16.0, 3},
+	{"OH", "Finland", 62.0, 25.0, 3},
+	{"SP", "Poland", 52.0, 19.0, 2},
+	{"OK", "Czech Republic", 49.8, 15.5, 1},
+	{"HB9", "Switzerland", 46.8, 8.2, 0.8},
+	{"K", "United States", 39.0, -77.0, 4},
+	{"W", "United States", 34.0, -100.0, 8},
+	{"N", "United States", 41.0, -120.0, 5},
+	{"VE", "Canada", 45.5, -75.0, 4},
+	{"VK", "Australia", -33.0, 148.0, 5},
+	{"ZL", "New Zealand", -41.0, 174.0, 2},
+	{"JA", "Japan", 36.0, 138.0, 3},
+	{"ZS", "South Africa", -29.0, 25.0, 4},
+	{"PY", "Brazil", -23.0, -46.0, 4},
+	{"LU", "Argentina", -34.5, -60.0, 4},
+	{"VU", "India", 20.0, 77.0, 5},
+	{"4X", "Israel", 31.5, 35.0, 0.5},
+	{"UA", "European Russia", 55.7, 37.6, 4},
+}
+
+// demoStation is one synthetic transmitter
+type demoStation struct {
+	callsign string
+	country  string
+	locator  string
+	lat, lon float64
+	band     string
+	dbm      int
+	offset   uint64 // Hz above the dial frequency
+	drift    int
+}
+
+// demoMessage carries a synthetic decode through the MQTT message pipeline
+type demoMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m *demoMessage) Duplicate() bool   { return false }
+func (m *demoMessage) Qos() byte         { return 0 }
+func (m *demoMessage) Retained() bool    { return false }
+func (m *demoMessage) Topic() string     { return m.topic }
+func (m *demoMessage) MessageID() uint16 { return 0 }
+func (m *demoMessage) Payload() []byte   { return m.payload }
+func (m *demoMessage) Ack()              {}
+
+// DemoGenerator publishes plausible synthetic WSPR decodes for every configured
+// instance at the end of each 2-minute cycle, as if they had arrived over MQTT
+type DemoGenerator struct {
+	config      DemoConfig
+	mqttClient  *MQTTClient
+	instances   []InstanceConfig
+	receiverLat float64
+	receiverLon float64
+	stations    []demoStation
+	rng         *rand.Rand
+	stopChan    chan struct{}
+}
+
+// NewDemoGenerator creates a generator feeding the given MQTT client
+func NewDemoGenerator(config DemoConfig, mqttClient *MQTTClient, instances []InstanceConfig, receiverLocator string) *DemoGenerator {
+	g := &DemoGenerator{
+		config:     config,
+		mqttClient: mqttClient,
+		instances:  instances,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		stopChan:   make(chan struct{}),
+	}
+	g.receiverLat, g.receiverLon, _ = maidenheadToLatLon(receiverLocator)
+	g.stations = g.makeStations()
+	return g
+}
+
+// makeStations creates the pool of synthetic transmitters
+func (g *DemoGenerator) makeStations() []demoStation {
+	powers := []int{20, 23, 27, 30, 33, 37}
+	seen := make(map[string]bool)
+	stations := make([]demoStation, 0, g.config.Stations)
+	for len(stations) < g.config.Stations {
+		region := demoRegions[g.rng.Intn(len(demoRegions))]
+		callsign := fmt.Sprintf("%s%d%c%c%c", region.prefix, g.rng.Intn(10),
+			'A'+g.rng.Intn(26), 'A'+g.rng.Intn(26), 'A'+g.rng.Intn(26))
+		if seen[callsign] {
+			continue
+		}
+		seen[callsign] = true
+
+		lat := region.lat + (g.rng.Float64()*2-1)*region.spread
+		lon := region.lon + (g.rng.Float64()*2-1)*region.spread
+		stations = append(stations, demoStation{
+			callsign: callsign,
+			country:  region.country,
+			locator:  latLonToMaidenhead(lat, lon),
+			lat:      lat,
+			lon:      lon,
+			band:     g.config.Bands[g.rng.Intn(len(g.config.Bands))],
+			dbm:      powers[g.rng.Intn(len(powers))],
+			offset:   1400 + uint64(g.rng.Intn(200)),
+			drift:    g.rng.Intn(3) - 1,
+		})
+	}
+	return stations
+}
+
+// Start begins generating decodes
+func (g *DemoGenerator) Start() {
+	log.Printf("Demo: Generating about %d decodes per cycle from %d synthetic stations on %v",
+		g.config.SpotsPerCycle, len(g.stations), g.config.Bands)
+	go g.run()
+}
+
+// Stop stops generating decodes
+func (g *DemoGenerator) Stop() {
+	close(g.stopChan)
+}
+
+// run publishes a cycle's decodes shortly after each even minute, like a
+// decoder that has just finished the cycle
+func (g *DemoGenerator) run() {
+	for {
+		now := time.Now().UTC()
+		next := now.Truncate(2 * time.Minute).Add(2*time.Minute + 5*time.Second)
+		select {
+		case <-g.stopChan:
+			return
+		case <-time.After(next.Sub(now)):
+			g.publishCycle(next.Add(-2*time.Minute - 5*time.Second))
+		}
+	}
+}
+
+// publishCycle sends the decodes for the cycle starting at cycleStart. Each
+// chosen station is heard by a random subset of instances with a few dB of
+// SNR spread between them, so deduplication has something to do.
+func (g *DemoGenerator) publishCycle(cycleStart time.Time) {
+	// Vary the number of spots a little from cycle to cycle
+	count := g.config.SpotsPerCycle/2 + g.rng.Intn(g.config.SpotsPerCycle+1)
+	count = min(count, len(g.stations))
+
+	for _, i := range g.rng.Perm(len(g.stations))[:count] {
+		station := g.stations[i]
+		distance := haversineDistance(g.receiverLat, g.receiverLon, station.lat, station.lon)
+		// Rough path loss: louder nearby and with more power
+		baseSNR := float64(station.dbm-30)/2 - distance/700 - 5 + g.rng.NormFloat64()*4
+
+		for j, inst := range g.instances {
+			// The first instance hears most stations, the others fewer
+			if j > 0 && g.rng.Float64() < 0.4 {
+				continue
+			}
+			snr := int(math.Round(baseSNR + g.rng.NormFloat64()*2))
+			if snr < -30 {
+				continue
+			}
+			g.publish(inst, station, cycleStart, min(snr, 15))
+		}
+	}
+}
+
+// publish hands one synthetic decode to the MQTT client's message handler
+func (g *DemoGenerator) publish(inst InstanceConfig, station demoStation, cycleStart time.Time, snr int) {
+	dial, _ := bandDialFrequency(station.band)
+	decode := WSPRDecode{
+		Mode:        "WSPR",
+		Band:        station.band,
+		Callsign:    station.callsign,
+		Locator:     station.locator,
+		Country:     station.country,
+		SNR:         &snr,
+		Frequency:   float64(dial),
+		Timestamp:   json.RawMessage(fmt.Sprintf("%q", cycleStart.Format(time.RFC3339))),
+		DT:          math.Round((g.rng.NormFloat64()*0.4)*10) / 10,
+		Drift:       station.drift,
+		DBm:         station.dbm,
+		TxFrequency: float64(dial + station.offset),
+		Software:    "demo",
+		Version:     Version,
+	}
+	payload, err := json.Marshal(decode)
+	if err != nil {
+		log.Printf("Demo: Failed to encode decode: %v", err)
+		return
+	}
+	topic := instanceBandTopic(inst, station.band)
+	g.mqttClient.messageHandler(nil, &demoMessage{topic: topic, payload: payload})
+}
+
+// latLonToMaidenhead returns the 6-character locator containing lat, lon
+func latLonToMaidenhead(lat, lon float64) string {
+	lon = math.Min(math.Max(lon+180, 0), 359.9999)
+	lat = math.Min(math.Max(lat+90, 0), 179.9999)
+
+	field := []byte{
+		byte('A' + int(lon/20)),
+		byte('A' + int(lat/10)),
+		byte('0' + int(math.Mod(lon, 20)/2)),
+		byte('0' + int(math.Mod(lat, 10))),
+		byte('a' + int(math.Mod(lon, 2)*12)),
+		byte('a' + int(math.Mod(lat, 1)*24)),
+	}
+	return string(field)
+}
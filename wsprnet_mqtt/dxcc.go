@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// DXCCCountry is one country in the daily tally from /api/dxcc-summary
+type DXCCCountry struct {
+	Country         string   `json:"country"`
+	Bands           []string `json:"bands"`            // In frequency order
+	UniqueCallsigns int      `json:"unique_callsigns"` // Across the bands listed
+	TotalSpots      int      `json:"total_spots"`
+	BestSNR         *int     `json:"best_snr"` // nil if no spot reported an SNR
+}
+
+// DXCCSummary is the country-first view of the country statistics
+type DXCCSummary struct {
+	Band            string        `json:"band,omitempty"` // Set when filtered to one band
+	Countries       int           `json:"countries"`
+	UniqueCallsigns int           `json:"unique_callsigns"` // Across all countries
+	TotalSpots      int           `json:"total_spots"`
+	Entries         []DXCCCountry `json:"entries"` // Alphabetical by country
+}
+
+// GetDXCCSummary pivots the country statistics country-first: for each
+// country heard in the last 24 hours, the bands it was heard on, its unique
+// callsigns and its best SNR. With band set only that band is counted, so the
+// figures match the band's row in the per-band country tables.
+func (st *StatisticsTracker) GetDXCCSummary(band string) DXCCSummary {
+	st.countryStatsMu.RLock()
+	defer st.countryStatsMu.RUnlock()
+
+	type countryTotals struct {
+		bands     []string
+		callsigns map[string]bool
+		spots     int
+		bestSNR   *int
+	}
+	totals := make(map[string]*countryTotals)
+	allCallsigns := make(map[string]bool)
+	summary := DXCCSummary{Band: band}
+	for _, stats := range st.countryStats {
+		if band != "" && stats.Band != band {
+			continue
+		}
+		t := totals[stats.Country]
+		if t == nil {
+			t = &countryTotals{callsigns: make(map[string]bool)}
+			totals[stats.Country] = t
+		}
+		t.bands = append(t.bands, stats.Band)
+		for callsign := range stats.UniqueCallsigns {
+			t.callsigns[callsign] = true
+			allCallsigns[callsign] = true
+		}
+		t.spots += stats.Count
+		if stats.SNRCount > 0 && (t.bestSNR == nil || stats.MaxSNR > *t.bestSNR) {
+			best := stats.MaxSNR
+			t.bestSNR = &best
+		}
+		summary.TotalSpots += stats.Count
+	}
+
+	summary.Entries = make([]DXCCCountry, 0, len(totals))
+	for country, t := range totals {
+		sortBands(t.bands)
+		summary.Entries = append(summary.Entries, DXCCCountry{
+			Country:         country,
+			Bands:           t.bands,
+			UniqueCallsigns: len(t.callsigns),
+			TotalSpots:      t.spots,
+			BestSNR:         t.bestSNR,
+		})
+	}
+	sort.Slice(summary.Entries, func(i, j int) bool {
+		return summary.Entries[i].Country < summary.Entries[j].Country
+	})
+	summary.Countries = len(summary.Entries)
+	summary.UniqueCallsigns = len(allCallsigns)
+	return summary
+}
+
+// handleDXCCSummary returns the daily tally of countries heard, optionally
+// for one band
+func (ws *WebServer) handleDXCCSummary(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ws.stats.GetDXCCSummary(r.URL.Query().Get("band")))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// graylineElevation is how far (degrees) the sun may be above or below the
+// horizon for a location to count as on the grayline
+const graylineElevation = 6.0
+
+// solarElevation returns the sun's elevation above the horizon in degrees at
+// a location and time, using the low-precision solar position from the
+// Astronomical Almanac (good to about 0.01 degrees between 1950 and 2050)
+func solarElevation(lat, lon float64, t time.Time) float64 {
+	const rad = math.Pi / 180
+
+	// Days since J2000.0
+	d := t.UTC().Sub(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)).Hours() / 24
+
+	g := (357.529 + 0.98560028*d) * rad // Mean anomaly
+	q := 280.459 + 0.98564736*d         // Mean longitude
+	eclipticLon := (q + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)) * rad
+	obliquity := (23.439 - 0.00000036*d) * rad
+
+	rightAscension := math.Atan2(math.Cos(obliquity)*math.Sin(eclipticLon), math.Cos(eclipticLon))
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(eclipticLon))
+
+	// Greenwich mean sidereal time, then the local hour angle
+	gmst := math.Mod(18.697374558+24.06570982441908*d, 24) * 15 * rad
+	hourAngle := gmst + lon*rad - rightAscension
+
+	sinElevation := math.Sin(lat*rad)*math.Sin(declination) +
+		math.Cos(lat*rad)*math.Cos(declination)*math.Cos(hourAngle)
+	return math.Asin(sinElevation) / rad
+}
+
+// onGrayline reports whether a location is within graylineElevation of the
+// day/night terminator at time t
+func onGrayline(lat, lon float64, t time.Time) bool {
+	return math.Abs(solarElevation(lat, lon, t)) <= graylineElevation
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InfluxDB export batching and retry settings
+const (
+	influxFlushInterval = 10 * time.Second
+	influxBatchSize     = 500
+	influxQueueSize     = 10000 // Points buffered while a batch is being written or retried
+	influxMaxAttempts   = 3
+	influxRetryDelay    = 5 * time.Second
+	influxWriteTimeout  = 15 * time.Second
+)
+
+// InfluxDBConfig enables exporting deduplicated spots to an InfluxDB 2.x bucket
+type InfluxDBConfig struct {
+	URL    string `yaml:"url" json:"url"`       // Server URL, e.g. http://influxdb:8086
+	Token  string `yaml:"token" json:"token"`   // API token with write access to the bucket
+	Org    string `yaml:"org" json:"org"`       // Organization name or ID
+	Bucket string `yaml:"bucket" json:"bucket"` // Bucket to write to
+}
+
+// influxPoint is one deduplicated spot waiting to be written
+type influxPoint struct {
+	report     WSPRReport
+	band       string
+	instance   string
+	country    string
+	distanceKm float64
+	hasPath    bool
+}
+
+// InfluxWriter batches deduplicated spots and writes them to InfluxDB as line
+// protocol (measurement wspr_spot). Writes happen on their own goroutine so a
+// slow or unreachable server never holds up the aggregator; when the queue is
+// full, new points are dropped and counted.
+type InfluxWriter struct {
+	writeURL string
+	token    string
+	client   *http.Client
+	queue    chan influxPoint
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	written int64
+	dropped int64
+	lastErr string
+}
+
+// NewInfluxWriter creates a writer for the given config
+func NewInfluxWriter(config InfluxDBConfig) *InfluxWriter {
+	query := url.Values{}
+	query.Set("org", config.Org)
+	query.Set("bucket", config.Bucket)
+	query.Set("precision", "s")
+
+	return &InfluxWriter{
+		writeURL: strings.TrimRight(config.URL, "/") + "/api/v2/write?" + query.Encode(),
+		token:    config.Token,
+		client:   &http.Client{Timeout: influxWriteTimeout, Transport: outboundTransport()},
+		queue:    make(chan influxPoint, influxQueueSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins writing queued points
+func (iw *InfluxWriter) Start() {
+	iw.wg.Add(1)
+	go iw.run()
+}
+
+// Stop writes any queued points and stops the writer
+func (iw *InfluxWriter) Stop() {
+	close(iw.stopChan)
+	iw.wg.Wait()
+}
+
+// Write queues a deduplicated spot without blocking. path is the distance
+// from the receiver, if the spot's locator could be resolved.
+func (iw *InfluxWriter) Write(report *WSPRReportWithSource, band string, path SpotPath, hasPath bool) {
+	point := influxPoint{
+		report:     *report.WSPRReport,
+		band:       band,
+		instance:   report.InstanceName,
+		country:    report.Country,
+		distanceKm: path.Km,
+		hasPath:    hasPath,
+	}
+
+	select {
+	case iw.queue <- point:
+	default:
+		iw.mu.Lock()
+		iw.dropped++
+		dropped := iw.dropped
+		iw.mu.Unlock()
+		if dropped == 1 || dropped%1000 == 0 {
+			log.Printf("InfluxDB: Queue full, dropped %d points so far", dropped)
+		}
+	}
+}
+
+// run collects points into batches, writing every influxFlushInterval or
+// whenever influxBatchSize points are waiting
+func (iw *InfluxWriter) run() {
+	defer iw.wg.Done()
+
+	ticker := time.NewTicker(influxFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]influxPoint, 0, influxBatchSize)
+	for {
+		select {
+		case point := <-iw.queue:
+			batch = append(batch, point)
+			if len(batch) >= influxBatchSize {
+				iw.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				iw.flush(batch)
+				batch = batch[:0]
+			}
+		case <-iw.stopChan:
+			// Write what is left, once, without retrying
+			for len(iw.queue) > 0 {
+				batch = append(batch, <-iw.queue)
+			}
+			if len(batch) > 0 {
+				if err := iw.post(encodeInfluxBatch(batch)); err != nil {
+					log.Printf("InfluxDB: Dropped %d points at shutdown: %v", len(batch), err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// flush writes a batch, retrying a few times before dropping it
+func (iw *InfluxWriter) flush(batch []influxPoint) {
+	body := encodeInfluxBatch(batch)
+
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		if err = iw.post(body); err == nil {
+			iw.mu.Lock()
+			iw.written += int64(len(batch))
+			iw.lastErr = ""
+			iw.mu.Unlock()
+			return
+		}
+		// Back off a little longer each time; give up early when stopping
+		if attempts == influxMaxAttempts || !iw.wait(influxRetryDelay*time.Duration(attempts)) {
+			break
+		}
+	}
+
+	iw.mu.Lock()
+	iw.dropped += int64(len(batch))
+	iw.lastErr = err.Error()
+	iw.mu.Unlock()
+	log.Printf("InfluxDB: Dropped batch of %d points after %d attempts: %v", len(batch), attempts, err)
+}
+
+// wait sleeps for d, returning false if the writer is stopped first
+func (iw *InfluxWriter) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-iw.stopChan:
+		return false
+	}
+}
+
+// post sends line protocol to the write endpoint
+func (iw *InfluxWriter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, iw.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if iw.token != "" {
+		req.Header.Set("Authorization", "Token "+iw.token)
+	}
+
+	resp, err := iw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// GetStats returns export counters for /api/aggregator
+func (iw *InfluxWriter) GetStats() map[string]interface{} {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+
+	return map[string]interface{}{
+		"written":    iw.written,
+		"dropped":    iw.dropped,
+		"queued":     len(iw.queue),
+		"last_error": iw.lastErr,
+	}
+}
+
+// encodeInfluxBatch renders points as line protocol, one per line
+func encodeInfluxBatch(batch []influxPoint) []byte {
+	var b bytes.Buffer
+	for _, p := range batch {
+		// Tags in key order, as InfluxDB prefers
+		b.WriteString("wspr_spot,band=")
+		b.WriteString(escapeInfluxTag(p.band))
+		if p.country != "" {
+			b.WriteString(",country=")
+			b.WriteString(escapeInfluxTag(p.country))
+		}
+		if p.instance != "" {
+			b.WriteString(",instance=")
+			b.WriteString(escapeInfluxTag(p.instance))
+		}
+
+		fmt.Fprintf(&b, " dbm=%di,drift=%di,dt=%s,frequency=%di",
+			p.report.DBm, p.report.Drift, strconv.FormatFloat(float64(p.report.DT), 'f', -1, 32), p.report.Frequency)
+		// A decode without an SNR is not the same as 0 dB
+		if p.report.HasSNR {
+			fmt.Fprintf(&b, ",snr=%di", p.report.SNR)
+		}
+		if p.hasPath {
+			fmt.Fprintf(&b, ",distance_km=%s", strconv.FormatFloat(p.distanceKm, 'f', 1, 64))
+		}
+		fmt.Fprintf(&b, " %d\n", p.report.EpochTime.Unix())
+	}
+	return b.Bytes()
+}
+
+// escapeInfluxTag escapes commas, equals signs and spaces in a tag value
+func escapeInfluxTag(v string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `).Replace(v)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// InstanceCountryMatrix is the number of spots each instance reported from each
+// country over the last 24 hours
+type InstanceCountryMatrix struct {
+	From      time.Time                 `json:"from"`
+	To        time.Time                 `json:"to"`
+	Instances []string                  `json:"instances"` // Sorted by name
+	Countries []string                  `json:"countries"` // Most spots first
+	Counts    map[string]map[string]int `json:"counts"`    // Instance -> country -> spots
+	// Countries heard by only one instance -> that instance
+	UniqueTo map[string]string `json:"unique_to"`
+}
+
+// recordInstanceCountry counts a spot towards the instance/country matrix
+func (st *StatisticsTracker) recordInstanceCountry(instanceName, country string, at time.Time) {
+	hour := at.Truncate(time.Hour).Unix()
+
+	st.instanceCountryMu.Lock()
+	defer st.instanceCountryMu.Unlock()
+
+	byInstance := st.instanceCountryHours[hour]
+	if byInstance == nil {
+		byInstance = make(map[string]map[string]int)
+		st.instanceCountryHours[hour] = byInstance
+	}
+	if byInstance[instanceName] == nil {
+		byInstance[instanceName] = make(map[string]int)
+	}
+	byInstance[instanceName][country]++
+}
+
+// pruneInstanceCountries drops hourly buckets that end before cutoff
+func (st *StatisticsTracker) pruneInstanceCountries(cutoff time.Time) {
+	st.instanceCountryMu.Lock()
+	defer st.instanceCountryMu.Unlock()
+
+	for hour := range st.instanceCountryHours {
+		if time.Unix(hour, 0).Add(time.Hour).Before(cutoff) {
+			delete(st.instanceCountryHours, hour)
+		}
+	}
+}
+
+// copyInstanceCountryHours returns a deep copy of the hourly buckets for persistence
+func (st *StatisticsTracker) copyInstanceCountryHours() map[int64]map[string]map[string]int {
+	st.instanceCountryMu.Lock()
+	defer st.instanceCountryMu.Unlock()
+
+	hours := make(map[int64]map[string]map[string]int, len(st.instanceCountryHours))
+	for hour, byInstance := range st.instanceCountryHours {
+		hours[hour] = make(map[string]map[string]int, len(byInstance))
+		for instance, countries := range byInstance {
+			hours[hour][instance] = make(map[string]int, len(countries))
+			for country, count := range countries {
+				hours[hour][instance][country] = count
+			}
+		}
+	}
+	return hours
+}
+
+// GetInstanceCountryMatrix sums the hourly buckets covering the last 24 hours
+func (st *StatisticsTracker) GetInstanceCountryMatrix() InstanceCountryMatrix {
+	now := time.Now().UTC()
+	from := now.Add(-24 * time.Hour)
+	matrix := InstanceCountryMatrix{
+		From:     from,
+		To:       now,
+		Counts:   make(map[string]map[string]int),
+		UniqueTo: make(map[string]string),
+	}
+
+	st.instanceCountryMu.Lock()
+	for hour, byInstance := range st.instanceCountryHours {
+		if time.Unix(hour, 0).Add(time.Hour).Before(from) {
+			continue
+		}
+		for instance, countries := range byInstance {
+			if matrix.Counts[instance] == nil {
+				matrix.Counts[instance] = make(map[string]int)
+			}
+			for country, count := range countries {
+				matrix.Counts[instance][country] += count
+			}
+		}
+	}
+	st.instanceCountryMu.Unlock()
+
+	countryTotals := make(map[string]int)
+	heardBy := make(map[string][]string)
+	for instance, countries := range matrix.Counts {
+		matrix.Instances = append(matrix.Instances, instance)
+		for country, count := range countries {
+			countryTotals[country] += count
+			heardBy[country] = append(heardBy[country], instance)
+		}
+	}
+	sort.Strings(matrix.Instances)
+
+	for country, instances := range heardBy {
+		matrix.Countries = append(matrix.Countries, country)
+		if len(instances) == 1 && len(matrix.Instances) > 1 {
+			matrix.UniqueTo[country] = instances[0]
+		}
+	}
+	sort.Slice(matrix.Countries, func(i, j int) bool {
+		a, b := matrix.Countries[i], matrix.Countries[j]
+		if countryTotals[a] != countryTotals[b] {
+			return countryTotals[a] > countryTotals[b]
+		}
+		return a < b
+	})
+
+	return matrix
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for log file rotation
+const (
+	DefaultLogMaxSizeMB  = 10
+	DefaultLogMaxBackups = 5
+	DefaultLogMaxAgeDays = 7
+	logBackupTimeFormat  = "20060102-150405"
+	logRotateCheckPeriod = time.Minute
+)
+
+// RotatingFile is an io.Writer that appends to a log file and rotates it when
+// it grows past a size limit or has been written to for longer than an age limit.
+// Rotated files are renamed to "<name>.<timestamp>" and the oldest are removed
+// beyond the backup limit.
+type RotatingFile struct {
+	path       string
+	maxSize    int64         // Bytes; 0 disables size rotation
+	maxAge     time.Duration // 0 disables age rotation
+	maxBackups int           // Rotated files kept; 0 keeps them all
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	opened    time.Time // When the current file was started
+	lastCheck time.Time
+}
+
+// NewRotatingFile opens (or creates) the log file at path for appending
+func NewRotatingFile(path string, maxSizeMB, maxBackups, maxAgeDays int) (*RotatingFile, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+	}
+
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxBackups: maxBackups,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the current log file, picking up its size and age if it exists
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	rf.opened = time.Now()
+	if rf.size > 0 {
+		// Best guess at when an existing file was started
+		rf.opened = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p to the log file, rotating first if it is due
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	due := rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize
+	if !due && rf.maxAge > 0 && now.Sub(rf.lastCheck) >= logRotateCheckPeriod {
+		rf.lastCheck = now
+		due = rf.size > 0 && now.Sub(rf.opened) >= rf.maxAge
+	}
+	if due {
+		if err := rf.rotate(); err != nil {
+			// Keep logging to the current file rather than losing output
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+			if rf.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file aside, opens a fresh one and removes
+// backups beyond the configured limits. Caller must hold mu.
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+
+	backup := rf.path + "." + time.Now().Format(logBackupTimeFormat)
+	renameErr := os.Rename(rf.path, backup)
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	rf.pruneBackups()
+	return nil
+}
+
+// pruneBackups removes the oldest rotated files beyond maxBackups
+func (rf *RotatingFile) pruneBackups() {
+	if rf.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimPrefix(m, rf.path+".")
+		if _, err := time.Parse(logBackupTimeFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	if len(backups) <= rf.maxBackups {
+		return
+	}
+
+	// Timestamps sort chronologically, so the oldest come first
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-rf.maxBackups] {
+		os.Remove(backup)
+	}
+}
+
+// Close closes the log file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logLevels maps log_level values to levels
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// DefaultLogLevel is used when log_level is not set
+const DefaultLogLevel = "info"
+
+// minLogLevel is the least severe level logged (log_level)
+var minLogLevel atomic.Int64
+
+// textLogTimestamp is the date and time log.LstdFlags puts before each message
+const textLogTimestamp = "2006/01/02 15:04:05 "
+
+// setLogLevel applies log_level, which Validate has checked. Text log lines
+// below it are dropped by wrapping the log output, so it must be called after
+// the output is chosen and before useJSONLogging.
+func setLogLevel(name string) {
+	level := logLevels[name]
+	minLogLevel.Store(int64(level))
+	DebugMode = level <= slog.LevelDebug
+	if level > slog.LevelInfo {
+		log.SetOutput(levelFilterWriter{log.Writer()})
+	}
+}
+
+// logEnabled reports whether lines at level are logged
+func logEnabled(level slog.Level) bool {
+	return int64(level) >= minLogLevel.Load()
+}
+
+// levelFilterWriter drops text log lines whose message reads as less severe
+// than log_level
+type levelFilterWriter struct {
+	out io.Writer
+}
+
+func (w levelFilterWriter) Write(p []byte) (int, error) {
+	msg := p
+	if len(msg) > len(textLogTimestamp) {
+		msg = msg[len(textLogTimestamp):]
+	}
+	if !logEnabled(messageLevel(string(msg))) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// jsonLogging is set once JSON logging is in use, so logFields knows to pass
+// its fields on rather than leave them in the message only
+var jsonLogging atomic.Bool
+
+// useJSONLogging makes every log line, including those from log.Printf, a
+// JSON object with ts, level and msg written to out
+func useJSONLogging(out io.Writer) {
+	// Unwrap the text level filter; messageLevelHandler filters instead
+	if filter, ok := out.(levelFilterWriter); ok {
+		out = filter.out
+	}
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				a.Key = "ts"
+				a.Value = slog.TimeValue(a.Value.Time().UTC())
+			case slog.LevelKey:
+				a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+			}
+			return a
+		},
+	})
+	// log.Printf lines all arrive at info level; take the level from the message
+	slog.SetDefault(slog.New(&messageLevelHandler{handler}))
+	jsonLogging.Store(true)
+}
+
+// messageLevelHandler raises info records to warn or error when the message
+// reads like one, as the free-text log lines do ("Warning: ...", "Failed to ..."),
+// and drops records below log_level
+type messageLevelHandler struct {
+	slog.Handler
+}
+
+// Enabled lets every info record through to Handle, which may raise its level
+func (h *messageLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level == slog.LevelInfo || logEnabled(level)
+}
+
+func (h *messageLevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelInfo {
+		r.Level = messageLevel(r.Message)
+	}
+	if !logEnabled(r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *messageLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &messageLevelHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *messageLevelHandler) WithGroup(name string) slog.Handler {
+	return &messageLevelHandler{h.Handler.WithGroup(name)}
+}
+
+// messageLevel guesses the level of a free-text log message from how it
+// starts, after any "Component: " prefix
+func messageLevel(msg string) slog.Level {
+	level := prefixLevel(msg)
+	if component, rest, ok := strings.Cut(msg, ": "); level == slog.LevelInfo && ok && !strings.Contains(component, " ") {
+		level = prefixLevel(rest)
+	}
+	return level
+}
+
+// prefixLevel returns the level a message starting with s reads as
+func prefixLevel(s string) slog.Level {
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "warning"):
+		return slog.LevelWarn
+	case strings.HasPrefix(lower, "error"), strings.HasPrefix(lower, "failed"):
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// logFields are the context of a log line, such as the instance, band or
+// callsign it is about. In text format they are only in the message itself;
+// in JSON format they are also separate fields, so logs can be filtered on them.
+type logFields map[string]interface{}
+
+// Printf logs a message like log.Printf, with the fields in JSON format
+func (f logFields) Printf(format string, args ...interface{}) {
+	f.logf(slog.LevelInfo, format, args...)
+}
+
+// Debugf logs a message only at log_level debug
+func (f logFields) Debugf(format string, args ...interface{}) {
+	f.logf(slog.LevelDebug, format, args...)
+}
+
+// logDebugf logs a message without fields only at log_level debug
+func logDebugf(format string, args ...interface{}) {
+	logFields(nil).Debugf(format, args...)
+}
+
+// logf logs a message at level, or at the level the message reads as for info
+func (f logFields) logf(level slog.Level, format string, args ...interface{}) {
+	// Skip formatting debug lines that won't be logged
+	if level < slog.LevelInfo && !logEnabled(level) {
+		return
+	}
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	if level == slog.LevelInfo {
+		level = messageLevel(msg)
+	}
+	if !logEnabled(level) {
+		return
+	}
+	if !jsonLogging.Load() {
+		// The text filter judges the message itself, so debug lines only
+		// get this far when they are wanted
+		log.Print(msg)
+		return
+	}
+
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, f[k]))
+	}
+	slog.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMaidenheadToLatLon(t *testing.T) {
+	tests := []struct {
+		locator  string
+		lat, lon float64
+	}{
+		// 4 characters: centre of the square
+		{"IO91", 51.5, -1.0},
+		{"FN31", 41.5, -73.0},
+		{"AA00", -89.5, -179.0},
+		{"RR99", 89.5, 179.0},
+		// 6 characters: centre of the subsquare
+		{"IO91wm", 51.520833, -0.125},
+		{"FN31pr", 41.729167, -72.708333},
+		{"JO62qm", 52.520833, 13.375},
+		// Lowercase and mixed case
+		{"io91", 51.5, -1.0},
+		{"io91WM", 51.520833, -0.125},
+		{"Fn31Pr", 41.729167, -72.708333},
+		// A 5th character or extended precision beyond the subsquare is ignored
+		{"IO91w", 51.5, -1.0},
+		{"IO91wm12", 51.520833, -0.125},
+	}
+	for _, tt := range tests {
+		lat, lon, ok := maidenheadToLatLon(tt.locator)
+		if !ok {
+			t.Errorf("maidenheadToLatLon(%q) not ok", tt.locator)
+			continue
+		}
+		if math.Abs(lat-tt.lat) > 1e-6 || math.Abs(lon-tt.lon) > 1e-6 {
+			t.Errorf("maidenheadToLatLon(%q) = %f, %f, want %f, %f", tt.locator, lat, lon, tt.lat, tt.lon)
+		}
+	}
+}
+
+func TestMaidenheadToLatLonInvalid(t *testing.T) {
+	for _, locator := range []string{
+		"",
+		"I",
+		"IO9",
+		"SO91",   // Field beyond R
+		"IS91",   // Field beyond R
+		"1O91",   // Digit for a field letter
+		"IOA1",   // Letter for a square digit
+		"IO9A",   // Letter for a square digit
+		"IO91ya", // Subsquare beyond X
+		"IO91ay", // Subsquare beyond X
+		"IO91a1", // Digit for a subsquare letter
+		"<...>",
+	} {
+		if lat, lon, ok := maidenheadToLatLon(locator); ok {
+			t.Errorf("maidenheadToLatLon(%q) = %f, %f, want not ok", locator, lat, lon)
+		}
+	}
+}
+
+func TestHaversineDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		km                     float64
+	}{
+		{"same point", 51.5, -0.12, 51.5, -0.12, 0},
+		{"one degree along the equator", 0, 0, 0, 1, 111.195},
+		{"one degree along a meridian", 10, 20, 11, 20, 111.195},
+		{"pole to pole", 90, 0, -90, 0, 20015.087},
+		{"antipodes on the equator", 0, 0, 0, 180, 20015.087},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.56},
+		{"New York to London", 40.7128, -74.0060, 51.5074, -0.1278, 5570.22},
+		{"Sydney to Auckland", -33.8688, 151.2093, -36.8485, 174.7633, 2155.46},
+	}
+	for _, tt := range tests {
+		got := haversineDistance(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.Abs(got-tt.km) > 0.5 {
+			t.Errorf("%s: haversineDistance = %.2f km, want %.2f km", tt.name, got, tt.km)
+		}
+		// Distance doesn't depend on direction
+		if back := haversineDistance(tt.lat2, tt.lon2, tt.lat1, tt.lon1); math.Abs(back-got) > 1e-9 {
+			t.Errorf("%s: reverse distance %.6f km, want %.6f km", tt.name, back, got)
+		}
+	}
+}
+
+func TestHaversineDistanceBetweenLocators(t *testing.T) {
+	// Square centres one square apart in longitude at the equator: 2 degrees
+	lat1, lon1, _ := maidenheadToLatLon("JJ00")
+	lat2, lon2, _ := maidenheadToLatLon("JJ10")
+	if got := haversineDistance(lat1, lon1, lat2, lon2); math.Abs(got-222.37) > 0.5 {
+		t.Errorf("JJ00 to JJ10 = %.2f km, want about 222.37 km", got)
+	}
+}
+
+// TestMaidenheadNearNullIsland pins locators at and around 0,0, which is a
+// real place and must not be mistaken for a missing position
+func TestMaidenheadNearNullIsland(t *testing.T) {
+	tests := []struct {
+		locator  string
+		lat, lon float64
+	}{
+		{"JJ00", 0.5, 1.0},               // North-east of 0,0
+		{"JJ00aa", 0.020833, 0.041667},   // South-west corner subsquare of JJ00
+		{"II99", -0.5, -1.0},             // South-west of 0,0
+		{"II99xx", -0.020833, -0.041667}, // North-east corner subsquare of II99
+		{"JI09ax", -0.020833, 0.041667},  // Just south of JJ00aa, across the equator
+		{"IJ90xa", 0.020833, -0.041667},  // Just west of JJ00aa, across the meridian
+		{"jj00AA", 0.020833, 0.041667},   // Mixed case
+		{"JJ00aa99", 0.020833, 0.041667}, // Extended precision
+	}
+	for _, tt := range tests {
+		lat, lon, ok := maidenheadToLatLon(tt.locator)
+		if !ok {
+			t.Errorf("maidenheadToLatLon(%q) not ok", tt.locator)
+			continue
+		}
+		if math.Abs(lat-tt.lat) > 1e-6 || math.Abs(lon-tt.lon) > 1e-6 {
+			t.Errorf("maidenheadToLatLon(%q) = %f, %f, want %f, %f", tt.locator, lat, lon, tt.lat, tt.lon)
+		}
+	}
+}
+
+func TestDistanceAcrossEquatorAndMeridian(t *testing.T) {
+	tests := []struct {
+		receiver, spot string
+		km, bearing    float64
+	}{
+		// Across both the equator and the prime meridian
+		{"JJ00aa", "II99xx", 10.36, 243.43},
+		{"II99xx", "JJ00aa", 10.36, 63.43},
+		{"JJ00", "II99", 248.64, 243.44},
+		// Across one of them
+		{"JJ00aa", "JI09ax", 4.63, 180},
+		{"JJ00aa", "IJ90xa", 9.27, 270},
+		// To the square holding 0,0 from its own corner
+		{"JJ00aa", "JJ00", 119.14, 63.4},
+	}
+	for _, tt := range tests {
+		st := NewStatisticsTracker()
+		st.SetReceiverLocation(tt.receiver)
+
+		path, ok := st.DistanceTo(tt.spot)
+		if !ok {
+			t.Errorf("%s to %s: no distance", tt.receiver, tt.spot)
+		} else {
+			if math.Abs(path.Km-tt.km) > 0.05 {
+				t.Errorf("%s to %s = %.2f km, want %.2f km", tt.receiver, tt.spot, path.Km, tt.km)
+			}
+			if math.Abs(path.Bearing-tt.bearing) > 0.1 {
+				t.Errorf("%s to %s bearing = %.2f, want %.2f", tt.receiver, tt.spot, path.Bearing, tt.bearing)
+			}
+		}
+
+		// Spots there are recorded with their distance
+		st.RecordSpot(time.Now(), "kiwi1", "20m", "K1ABC", "", tt.spot, -10, true)
+		spots := st.GetCurrentSpots()
+		if len(spots) != 1 || math.Abs(spots[0].DistanceKm-tt.km) > 0.05 {
+			t.Errorf("%s to %s: map spots %+v, want one at %.2f km", tt.receiver, tt.spot, spots, tt.km)
+		}
+		st.Close()
+	}
+}
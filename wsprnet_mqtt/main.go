@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -21,6 +24,7 @@ var (
 func main() {
 	// Parse command line flags
 	configFile := flag.String("config", "config.yaml", "Path to configuration file")
+	demo := flag.Bool("demo", false, "Generate synthetic decodes instead of connecting to MQTT (implies dry run)")
 	flag.Parse()
 
 	log.Printf("WSPR MQTT Aggregator v%s starting...", Version)
@@ -34,12 +38,64 @@ func main() {
 	if err := config.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	// Validate has checked the band table already
+	bands, _ := buildBandTable(config.BandTable)
+	setBandTable(bands)
+	if len(config.BandTable) > 0 {
+		log.Printf("Band table: %v", bands.names())
+	}
+	if config.ProxyURL != "" {
+		proxy, _ := parseProxyURL(config.ProxyURL)
+		setOutboundProxy(proxy)
+		log.Printf("Outbound HTTP goes through proxy %s", redactedProxy())
+	}
+
+	// Switch to the log file and format, if configured, now that the config is
+	// known good
+	var logOutput io.Writer = os.Stderr
+	if config.LogFile != "" {
+		logFile, err := NewRotatingFile(config.LogFile, config.LogMaxSizeMB, config.LogMaxBackups, config.LogMaxAgeDays)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer logFile.Close()
+		log.Printf("Logging to %s (rotated at %d MB or %d days, %d old files kept)",
+			config.LogFile, config.LogMaxSizeMB, config.LogMaxAgeDays, config.LogMaxBackups)
+		log.SetOutput(logFile)
+		logOutput = logFile
+	}
+	setLogLevel(config.LogLevel)
+	if config.LogFormat == LogFormatJSON {
+		useJSONLogging(logOutput)
+	}
+	if config.LogFile != "" || config.LogFormat == LogFormatJSON {
+		log.Printf("WSPR MQTT Aggregator v%s starting...", Version)
+	}
+
+	// If the first start after a config change from the admin interface did not
+	// stay up, come up in safe mode so the config can be fixed from the browser
+	restartGuard := CheckRestartGuard(*configFile)
+	if restartGuard.SafeMode() {
+		runSafeMode(config, *configFile, restartGuard)
+		return
+	}
+	restartGuard.Watch(time.Duration(config.RestartGuardSeconds) * time.Second)
+
+	// Demo mode never submits and keeps its statistics and spot logs apart
+	// from a real installation's
+	spotsDir := "./spots"
+	if *demo {
+		config.DryRun = true
+		config.PersistenceFile = filepath.Join(filepath.Dir(config.PersistenceFile), "demo_"+filepath.Base(config.PersistenceFile))
+		spotsDir = "./demo_spots"
+		log.Printf("*** DEMO MODE - synthetic decodes, statistics in %s and spots in %s ***", config.PersistenceFile, spotsDir)
+	}
 
 	log.Printf("Receiver: %s (%s)", config.Receiver.Callsign, config.Receiver.Locator)
 	log.Printf("MQTT Broker: %s", config.MQTT.Broker)
 	log.Printf("Subscribing to %d instance(s):", len(config.MQTT.Instances))
 	for _, inst := range config.MQTT.Instances {
-		log.Printf("  - %s: %s/digital_modes/WSPR/+", inst.Name, inst.TopicPrefix)
+		log.Printf("  - %s: %s", inst.Name, instanceTopic(inst))
 	}
 
 	if config.DryRun {
@@ -48,6 +104,7 @@ func main() {
 
 	// Initialize WSPRNet client
 	wsprNet, err := NewWSPRNet(
+		config.WSPRNet.URL,
 		config.Receiver.Callsign,
 		config.Receiver.Locator,
 		"UberSDR",
@@ -58,43 +115,87 @@ func main() {
 		log.Fatalf("Failed to initialize WSPRNet: %v", err)
 	}
 
+	wsprNet.SetQuietHours(config.WSPRNet.QuietHours)
+	wsprNet.SetSubmitHashed(config.HashedCallsigns == HashedCallsignsSubmit)
+	wsprNet.SetSubmitMethod(config.WSPRNet.SubmitMethod)
+	wsprNet.SetContactEmail(config.WSPRNet.ContactEmail)
+	wsprNet.SetRetryPolicy(config.WSPRNet.RetryPolicy())
+	wsprNet.SetRateLimit(config.WSPRNet.MaxSubmissionsPerMinute)
+
+	submittedKeys, err := NewSubmittedKeys(config.WSPRNet.SubmittedKeysFile, time.Duration(config.WSPRNet.SubmittedKeysHours)*time.Hour)
+	if err != nil {
+		log.Fatalf("Failed to open submitted spot keys: %v", err)
+	}
+	defer submittedKeys.Close()
+	wsprNet.SetSubmittedKeys(submittedKeys)
+	wsprNet.SetPendingFile(config.WSPRNet.PendingFile)
+
 	// Connect to WSPRNet
 	if err := wsprNet.Connect(); err != nil {
 		log.Fatalf("Failed to connect to WSPRNet: %v", err)
 	}
-	defer wsprNet.Stop()
+
+	// Check the submission method with a request that carries no spots. In
+	// dry run the request is only built, so nothing is sent.
+	go wsprNet.ProbeSubmitMethod()
 
 	log.Println("WSPRNet client initialized")
 
-	// Initialize PSKReporter client (always enabled, dry_run controls actual sending)
-	log.Printf("PSKReporter: Initializing for %s (%s)", config.Receiver.Callsign, config.Receiver.Locator)
-	if config.Receiver.Antenna != "" {
-		log.Printf("PSKReporter: Antenna: %s", config.Receiver.Antenna)
-	}
+	// Initialize PSKReporter client unless disabled. In dry run it still
+	// runs, keeping its statistics, but nothing is sent.
+	var pskReporter *PSKReporter
+	if !config.PSKReporter.IsEnabled() {
+		log.Println("PSKReporter: Disabled (pskreporter.enabled is false)")
+	} else {
+		callsign := config.PSKReporter.Callsign
+		if callsign == "" {
+			callsign = config.Receiver.Callsign
+		}
+		locator := config.PSKReporter.Locator
+		if locator == "" {
+			locator = config.Receiver.Locator
+		}
+		log.Printf("PSKReporter: Initializing for %s (%s)", callsign, locator)
+		if config.Receiver.Antenna != "" {
+			log.Printf("PSKReporter: Antenna: %s", config.Receiver.Antenna)
+		}
 
-	pskReporter, err := NewPSKReporter(
-		config.Receiver.Callsign,
-		config.Receiver.Locator,
-		"UberSDR WSPR",
-		config.Receiver.Antenna,
-	)
-	if err != nil {
-		log.Fatalf("Failed to initialize PSKReporter: %v", err)
-	}
+		pskReporter, err = NewPSKReporter(callsign, locator, "UberSDR WSPR", config.Receiver.Antenna)
+		if err != nil {
+			log.Fatalf("Failed to initialize PSKReporter: %v", err)
+		}
+		if config.DryRun {
+			pskReporter.SetDryRun(true)
+		}
 
-	// Connect to PSKReporter
-	if err := pskReporter.Connect(); err != nil {
-		log.Fatalf("Failed to connect to PSKReporter: %v", err)
-	}
-	defer pskReporter.Stop()
+		// Connect to PSKReporter
+		if err := pskReporter.Connect(); err != nil {
+			log.Fatalf("Failed to connect to PSKReporter: %v", err)
+		}
+		defer pskReporter.Stop()
 
-	log.Println("PSKReporter client initialized")
+		log.Println("PSKReporter client initialized")
+	}
 
 	// Initialize statistics tracker
 	stats := NewStatisticsTracker()
+	defer stats.Close()
 
 	// Set receiver location for distance calculations
 	stats.SetReceiverLocation(config.Receiver.Locator)
+	stats.SetOfflineTimeout(time.Duration(config.InstanceOfflineMinutes) * time.Minute)
+	stats.SetOnlineGrace(time.Duration(config.OnlineGraceMinutes) * time.Minute)
+	stats.SetRecentCallsignsLimit(config.RecentCallsigns)
+	stats.SetRetention(time.Duration(config.RetentionHours) * time.Hour)
+	stats.SetDedupWindow(config.DedupWindow())
+	stats.SetGridPrecision(config.GridPrecision)
+	stats.SetPersistenceFormat(config.PersistenceFormat)
+	if config.SNRAlerts.Enabled {
+		stats.SetSNRAlertMonitor(NewSNRAlertMonitor(config.SNRAlerts))
+	}
+	if config.WindowHook.Command != "" {
+		stats.SetWindowHook(NewWindowHook(config.WindowHook))
+	}
 
 	// Load persisted statistics if available
 	var wsprnetStats *WSPRNetStats
@@ -113,42 +214,111 @@ func main() {
 				wsprNet.SetStats(wsprnetStats.Successful, wsprnetStats.Failed, wsprnetStats.Retries)
 			}
 			if pskReporterStats != nil && pskReporter != nil {
-				log.Printf("Restoring PSKReporter stats: %d successful", pskReporterStats.Successful)
-				pskReporter.SetStats(pskReporterStats.Successful)
+				log.Printf("Restoring PSKReporter stats: %d successful, %d failed", pskReporterStats.Successful, pskReporterStats.Failed)
+				pskReporter.SetStats(pskReporterStats.Successful, pskReporterStats.Failed)
 			}
 		}
 	}
 
 	// Initialize spot writer for 24-hour rolling window
-	spotWriter, err := NewSpotWriter("./spots")
+	spotWriter, err := NewSpotWriter(spotsDir, config.SpotStorage, config.SpotRetentionDays, config.SpotLoadWorkers)
 	if err != nil {
 		log.Fatalf("Failed to initialize spot writer: %v", err)
 	}
 	defer spotWriter.Stop()
 
+	// Stopped before the spot writer, so spots WSPRNet gives up on at
+	// shutdown are recorded in the deduped log
+	defer wsprNet.Stop()
+
+	// Record the real WSPRNet outcome of each deduped spot once it is known
+	wsprNet.SetResultCallback(spotWriter.UpdateSubmission)
+
 	// Initialize spot aggregator for deduplication
-	aggregator := NewSpotAggregator(wsprNet, pskReporter, stats, config.PersistenceFile, spotWriter)
+	aggregator := NewSpotAggregator(wsprNet, pskReporter, stats, config.PersistenceFile, spotWriter, config.DedupWindow())
+	aggregator.SetExpectedInstances(instanceNames(config.MQTT.Instances))
+	aggregator.SetPreferences(instancePreferences(config.MQTT.Instances))
+	aggregator.SetCheckpointInterval(time.Duration(config.PersistenceIntervalSeconds) * time.Second)
+	if config.GridConsistency.Enabled {
+		aggregator.SetGridConsistency(config.GridConsistency.ToleranceKm, config.GridConsistency.Action)
+		log.Printf("Grid consistency check enabled: %.0f km tolerance, action %s", config.GridConsistency.ToleranceKm, config.GridConsistency.Action)
+	}
+	if config.WSPRNet.MinConfidence > 0 {
+		aggregator.SetMinConfidence(config.WSPRNet.MinConfidence)
+		log.Printf("Spots with a confidence score below %d are not submitted to WSPRNet", config.WSPRNet.MinConfidence)
+	}
+	aggregator.SetClockSkewThresholds(config.ClockSkew.DTWarnSeconds, config.ClockSkew.DelayWarnSeconds)
+	if len(config.DedupExemptCallsigns) > 0 {
+		aggregator.SetDedupExempt(config.DedupExemptCallsigns)
+		log.Printf("Deduplication disabled for %v: every instance's report is submitted", config.DedupExemptCallsigns)
+	}
+	if config.DedupKey == DedupKeyFrequency {
+		aggregator.SetDedupKey(config.DedupKey)
+		log.Printf("Deduplication keeps reports of one callsign more than %d Hz apart as separate spots", dedupFrequencyToleranceHz)
+	}
+	if config.Grayline {
+		aggregator.SetGrayline(config.Receiver.Locator)
+		log.Println("Grayline tagging enabled for deduplicated spots")
+	}
+	if config.InfluxDB.URL != "" {
+		// Stopped after the aggregator so spots from the final flush are written
+		influx := NewInfluxWriter(config.InfluxDB)
+		influx.Start()
+		defer influx.Stop()
+		aggregator.SetInfluxWriter(influx)
+		log.Printf("Exporting deduplicated spots to InfluxDB bucket %s at %s", config.InfluxDB.Bucket, config.InfluxDB.URL)
+	}
 	aggregator.Start()
 	defer aggregator.Stop()
 
-	log.Println("Spot aggregator initialized (4-minute window for deduplication)")
+	log.Printf("Spot aggregator initialized (%s window for deduplication)", config.DedupWindow())
+
+	// Config saved from the admin page is swapped in here
+	sharedConfig := NewSharedConfig(config)
 
 	// Initialize MQTT client with instance name mapping
-	mqttClient, err := NewMQTTClient(config, aggregator, stats)
+	mqttClient, err := NewMQTTClient(sharedConfig, aggregator, stats)
 	if err != nil {
 		log.Fatalf("Failed to initialize MQTT client: %v", err)
 	}
+	if config.UnknownBands == UnknownBandsQuarantine {
+		mqttClient.SetSpotWriter(spotWriter)
+	}
 
-	// Connect to MQTT broker
-	if err := mqttClient.Connect(); err != nil {
-		log.Fatalf("Failed to connect to MQTT broker: %v", err)
+	if *demo {
+		// Synthetic decodes go through the same workers as MQTT messages
+		generator := NewDemoGenerator(config.Demo, mqttClient, config.MQTT.Instances, config.Receiver.Locator)
+		generator.Start()
+		defer generator.Stop()
+	} else {
+		// Connect to MQTT broker
+		if err := mqttClient.Connect(); err != nil {
+			log.Fatalf("Failed to connect to MQTT broker: %v", err)
+		}
+		log.Println("MQTT client connected and subscribed")
 	}
 	defer mqttClient.Disconnect()
 
-	log.Println("MQTT client connected and subscribed")
-
 	// Initialize web server (after MQTT client so it can access status)
-	webServer := NewWebServer(stats, aggregator, wsprNet, config, config.WebPort, *configFile, mqttClient, spotWriter)
+	webServer := NewWebServer(stats, aggregator, wsprNet, sharedConfig, config.WebPort, *configFile, mqttClient, spotWriter)
+	if config.WSPRNet.Reconcile.Enabled {
+		reconciler := NewReconciler(config.WSPRNet.Reconcile, config.Receiver.Callsign, spotWriter)
+		reconciler.Start()
+		defer reconciler.Stop()
+		webServer.SetReconciler(reconciler)
+	}
+	if pskReporter != nil {
+		webServer.SetPSKReporter(pskReporter)
+	}
+	if config.Backfill.Enabled {
+		backfiller := NewBackfiller(config.Backfill.URL, config.Receiver.Callsign, stats)
+		backfiller.SetNormalizeCallsigns(config.NormalizeCallsigns)
+		webServer.SetBackfiller(backfiller)
+		if config.Backfill.OnStartup {
+			go backfiller.RunSinceLastWindow()
+		}
+	}
+	webServer.SetConfigReloader(NewConfigReloader(mqttClient, aggregator, stats, wsprNet, pskReporter, *demo))
 	if err := webServer.Start(); err != nil {
 		log.Fatalf("Failed to start web server: %v", err)
 	}
@@ -162,11 +332,18 @@ func main() {
 
 	<-sigChan
 	log.Println("Shutting down...")
+	restartGuard.Clear()
 }
 
+// Default MQTT message processing pool
+const (
+	DefaultMQTTWorkers   = 4
+	DefaultMQTTQueueSize = 1000
+)
+
 // MQTTClient handles MQTT connection and message processing
 type MQTTClient struct {
-	config           *Config
+	config           *SharedConfig
 	client           mqtt.Client
 	aggregator       *SpotAggregator
 	stats            *StatisticsTracker
@@ -174,11 +351,42 @@ type MQTTClient struct {
 	prefixToName     map[string]string // Maps topic prefix to instance name
 	startTime        time.Time         // Application start time for filtering retained messages
 	instanceMsgCount map[string]int64  // Message count per instance
-	mu               sync.RWMutex      // Protects instanceMsgCount
+	freqNormalized   map[string]int64  // Decodes per instance whose frequency was converted from kHz/MHz
+	freqRejected     map[string]int64  // Decodes per instance dropped for an implausible frequency
+	timeRejected     map[string]int64  // Decodes per instance dropped for an unparseable timestamp
+	unknownBand      map[string]int64  // Decodes per instance on a frequency outside every known band
+	unknownLogged    map[string]bool   // instance_band combinations already logged
+	bandFiltered     map[string]int64  // Decodes per band dropped by bands/disabled_bands
+	lowSNR           map[string]int64  // Decodes per instance dropped for an SNR below min_snr
+	queueDropped     int64             // Messages dropped because the processing queue was full
+	mu               sync.RWMutex      // Protects instanceMsgCount, the rejection counters and queueDropped
+
+	spotWriter *SpotWriter // Receives quarantined decodes when unknown_bands is "quarantine"
+
+	// Messages are handed from paho's callback to a pool of workers so slow
+	// processing never blocks the MQTT client
+	queue    chan mqtt.Message
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	// Subscription state per topic, checked after every (re)connect
+	subscriptions map[string]*SubscriptionState
+	subGeneration int // Bumped on each connect and connection loss to stop stale retries
+	subMu         sync.Mutex
+
+	// Each instance's topic filter, to tell which instance a message came from
+	topicRoutes []topicRoute
+	routesMu    sync.RWMutex
+
+	// Decodes timestamped before this, arriving just after startup, are
+	// treated as retained messages: startTime less retained_grace_seconds
+	retainedCutoff time.Time
 }
 
 // NewMQTTClient creates a new MQTT client
-func NewMQTTClient(config *Config, aggregator *SpotAggregator, stats *StatisticsTracker) (*MQTTClient, error) {
+func NewMQTTClient(shared *SharedConfig, aggregator *SpotAggregator, stats *StatisticsTracker) (*MQTTClient, error) {
+	config := shared.Load()
+
 	// Build prefix to name mapping
 	prefixToName := make(map[string]string)
 	for _, inst := range config.MQTT.Instances {
@@ -186,14 +394,35 @@ func NewMQTTClient(config *Config, aggregator *SpotAggregator, stats *Statistics
 	}
 
 	mc := &MQTTClient{
-		config:           config,
+		config:           shared,
 		aggregator:       aggregator,
 		stats:            stats,
 		prefixToName:     prefixToName,
 		startTime:        time.Now(),
 		instanceMsgCount: make(map[string]int64),
+		freqNormalized:   make(map[string]int64),
+		freqRejected:     make(map[string]int64),
+		timeRejected:     make(map[string]int64),
+		unknownBand:      make(map[string]int64),
+		unknownLogged:    make(map[string]bool),
+		bandFiltered:     make(map[string]int64),
+		lowSNR:           make(map[string]int64),
+		queue:            make(chan mqtt.Message, config.MQTT.QueueSize),
+		stopChan:         make(chan struct{}),
+		subscriptions:    make(map[string]*SubscriptionState),
+		topicRoutes:      newTopicRoutes(config.MQTT.Instances),
+	}
+	mc.retainedCutoff = mc.startTime.Add(-time.Duration(config.MQTT.RetainedGraceSeconds) * time.Second)
+	if !config.MQTT.IgnoresRetained() {
+		log.Println("MQTT: Retained-message filter disabled (ignore_retained: false)")
 	}
 
+	for i := 0; i < config.MQTT.Workers; i++ {
+		mc.wg.Add(1)
+		go mc.worker()
+	}
+	log.Printf("MQTT: Started %d message workers (queue size %d)", config.MQTT.Workers, config.MQTT.QueueSize)
+
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(config.MQTT.Broker)
 	opts.SetClientID(fmt.Sprintf("wsprnet_mqtt_%d", time.Now().Unix()))
@@ -204,6 +433,13 @@ func NewMQTTClient(config *Config, aggregator *SpotAggregator, stats *Statistics
 	if config.MQTT.Password != "" {
 		opts.SetPassword(config.MQTT.Password)
 	}
+	if isTLSBroker(config.MQTT.Broker) {
+		tlsConfig, err := config.MQTT.BuildTLS()
+		if err != nil {
+			return nil, fmt.Errorf("mqtt tls: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
 
 	opts.SetAutoReconnect(true)
 	opts.SetConnectRetry(true)
@@ -212,11 +448,12 @@ func NewMQTTClient(config *Config, aggregator *SpotAggregator, stats *Statistics
 
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		log.Println("MQTT: Connected to broker")
-		mc.subscribe()
+		mc.onConnect()
 	})
 
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		log.Printf("MQTT: Connection lost: %v", err)
+		mc.onConnectionLost()
 	})
 
 	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
@@ -238,42 +475,56 @@ func (mc *MQTTClient) Connect() error {
 	return nil
 }
 
-// subscribe subscribes to WSPR topics for all configured instances
-func (mc *MQTTClient) subscribe() {
-	// Subscribe to all WSPR bands under each instance's topic prefix
-	// Format: {prefix}/digital_modes/WSPR/+
-	for _, inst := range mc.config.MQTT.Instances {
-		topic := fmt.Sprintf("%s/digital_modes/WSPR/+", inst.TopicPrefix)
-
-		token := mc.client.Subscribe(topic, byte(mc.config.MQTT.QoS), mc.messageHandler)
-		if token.Wait() && token.Error() != nil {
-			log.Printf("MQTT: Failed to subscribe to %s (%s): %v", topic, inst.Name, token.Error())
-			continue
+// messageHandler queues incoming MQTT messages for the worker pool. When the
+// queue is full the message is dropped and counted rather than blocking paho.
+func (mc *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
+	atomic.AddInt64(&mc.msgCount, 1)
+
+	select {
+	case mc.queue <- msg:
+	default:
+		mc.mu.Lock()
+		mc.queueDropped++
+		dropped := mc.queueDropped
+		mc.mu.Unlock()
+		if dropped == 1 || dropped%1000 == 0 {
+			log.Printf("MQTT: Processing queue full, dropped %d messages so far (consider raising mqtt.workers or mqtt.queue_size)", dropped)
 		}
-
-		log.Printf("MQTT: Subscribed to %s (%s)", topic, inst.Name)
 	}
 }
 
-// messageHandler processes incoming MQTT messages
-func (mc *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
-	mc.msgCount++
-
-	// Extract topic prefix and instance name from the message topic
-	// Topic format: {prefix}/digital_modes/WSPR/{band}
-	topic := msg.Topic()
-	topicPrefix := ""
-	instanceName := ""
-	for _, inst := range mc.config.MQTT.Instances {
-		if len(topic) > len(inst.TopicPrefix) && topic[:len(inst.TopicPrefix)] == inst.TopicPrefix {
-			topicPrefix = inst.TopicPrefix
-			instanceName = inst.Name
-			break
+// worker processes queued messages until the client is disconnected, then
+// finishes whatever is left in the queue
+func (mc *MQTTClient) worker() {
+	defer mc.wg.Done()
+
+	for {
+		select {
+		case <-mc.stopChan:
+			for {
+				select {
+				case msg := <-mc.queue:
+					mc.processMessage(msg)
+				default:
+					return
+				}
+			}
+		case msg := <-mc.queue:
+			mc.processMessage(msg)
 		}
 	}
+}
 
-	if instanceName == "" {
-		instanceName = topicPrefix // Fallback to prefix if name not found
+// processMessage parses, validates and aggregates a single WSPR decode
+func (mc *MQTTClient) processMessage(msg mqtt.Message) {
+	config := mc.config.Load()
+
+	// Match the topic against each instance's filter (by default
+	// {prefix}/digital_modes/WSPR/{band}) to find where it came from
+	instanceName, topicBand, ok := mc.matchTopic(msg.Topic())
+	if !ok {
+		logDebugf("MQTT: Ignoring message on %s, which matches no instance's topic", msg.Topic())
+		return
 	}
 
 	// Parse the WSPR decode from JSON
@@ -288,59 +539,191 @@ func (mc *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 
-	if decode.Callsign == "" || decode.Locator == "" {
+	// Hashed callsigns could not be resolved by the decoder; what happens to
+	// them depends on the hashed_callsigns setting
+	hashed := decode.Callsign == "<...>"
+	if hashed && config.HashedCallsigns == HashedCallsignsDrop {
 		return
 	}
 
-	// Filter out hashed callsigns
-	if decode.Callsign == "<...>" {
+	if decode.Callsign == "" || (decode.Locator == "" && !hashed) {
 		return
 	}
 
-	// Parse timestamp
-	timestamp, err := time.Parse(time.RFC3339, decode.Timestamp)
+	// Parse timestamp; publishers differ in the format they use
+	timestamp, err := parseDecodeTimestamp(decode.Timestamp)
 	if err != nil {
-		log.Printf("MQTT: Failed to parse timestamp: %v", err)
+		mc.mu.Lock()
+		mc.timeRejected[instanceName]++
+		first := mc.timeRejected[instanceName] == 1
+		mc.mu.Unlock()
+		if first || DebugMode {
+			logFields{"instance": instanceName}.Printf("MQTT: Rejecting decode from %s with unparseable timestamp: %v", instanceName, err)
+		}
 		return
 	}
 
-	// Ignore messages with timestamps before application startup (retained messages)
-	// Only filter for the first 5 seconds after startup to avoid rejecting valid late-arriving messages
+	// Ignore messages with timestamps before application startup, less the
+	// grace period (retained messages). Only filter for the first 5 seconds
+	// after startup to avoid rejecting valid late-arriving messages.
 	timeSinceStartup := time.Since(mc.startTime)
-	if timeSinceStartup < 5*time.Second && timestamp.Before(mc.startTime) {
-		if mc.msgCount <= 100 {
-			// Log first few rejections so user knows filtering is working
-			log.Printf("MQTT: Ignoring retained message from %s (timestamp: %s, before startup at %s)",
-				decode.Callsign, timestamp.Format("15:04:05"), mc.startTime.Format("15:04:05"))
+	if config.MQTT.IgnoresRetained() && timeSinceStartup < 5*time.Second && timestamp.Before(mc.retainedCutoff) {
+		if atomic.LoadInt64(&mc.msgCount) <= 100 {
+			// Log the first few rejections at debug level to show filtering is working
+			logFields{"instance": instanceName, "callsign": decode.Callsign}.Debugf("MQTT: Ignoring retained message from %s (timestamp: %s, before cutoff at %s)",
+				decode.Callsign, timestamp.Format("15:04:05"), mc.retainedCutoff.Format("15:04:05"))
+		}
+		return
+	}
+
+	// Any decode shows the instance has reported for its cycle, even if it
+	// is filtered out below
+	mc.aggregator.RecordActivity(instanceName, timestamp)
+
+	// A missing SNR is not the same as a measured 0 dB - keep the spot but
+	// flag it so it doesn't drag down SNR averages
+	snr := 0
+	hasSNR := decode.SNR != nil
+	if hasSNR {
+		snr = *decode.SNR
+	} else {
+		logFields{"instance": instanceName, "callsign": decode.Callsign}.Debugf("MQTT: Decode for %s from %s has no SNR field", decode.Callsign, instanceName)
+	}
+
+	// Normalize frequencies to Hz - some publishers send kHz or MHz, which would
+	// otherwise land every spot from that instance on the wrong band
+	rxFreq, rxScaled, rxOK := normalizeFrequencyHz(decode.Frequency)
+	txFreq, txScaled, txOK := normalizeFrequencyHz(decode.TxFrequency)
+	if decode.TxFrequency == 0 {
+		// Older publishers omit tx_frequency; the dial frequency is the best we have
+		txFreq, txScaled, txOK = rxFreq, false, rxOK
+	}
+	if !rxOK || !txOK {
+		mc.mu.Lock()
+		mc.freqRejected[instanceName]++
+		first := mc.freqRejected[instanceName] == 1
+		mc.mu.Unlock()
+		if first || DebugMode {
+			logFields{"instance": instanceName}.Printf("MQTT: Rejecting decode from %s with implausible frequency (frequency: %v, tx_frequency: %v)",
+				instanceName, decode.Frequency, decode.TxFrequency)
+		}
+		return
+	}
+	if rxScaled || txScaled {
+		mc.mu.Lock()
+		mc.freqNormalized[instanceName]++
+		first := mc.freqNormalized[instanceName] == 1
+		mc.mu.Unlock()
+		if first {
+			logFields{"instance": instanceName}.Printf("MQTT: %s is publishing frequencies that are not in Hz (frequency: %v, tx_frequency: %v) - normalizing",
+				instanceName, decode.Frequency, decode.TxFrequency)
+		}
+	}
+
+	// Frequencies outside every band plan would otherwise show up in the band
+	// statistics and uploads under their raw MHz value. Each offending
+	// frequency is logged once per instance.
+	unknownBand := false
+	if band := frequencyToBand(rxFreq); !isKnownBand(band) {
+		unknownBand = true
+		mc.mu.Lock()
+		mc.unknownBand[instanceName]++
+		key := instanceName + "_" + band
+		first := !mc.unknownLogged[key]
+		mc.unknownLogged[key] = true
+		mc.mu.Unlock()
+		if first || DebugMode {
+			logFields{"instance": instanceName, "callsign": decode.Callsign, "band": band}.Printf("MQTT: Decode of %s from %s is on %d Hz, outside every known band (topic band %s, unknown_bands: %s)",
+				decode.Callsign, instanceName, rxFreq, topicBand, config.UnknownBands)
 		}
+		if config.UnknownBands == UnknownBandsDrop {
+			return
+		}
+	}
+
+	// Drop decodes on bands turned off with bands/disabled_bands before they
+	// reach the statistics or the aggregator. Unknown bands are left to
+	// unknown_bands.
+	if band := frequencyToBand(txFreq); !unknownBand && !config.BandEnabled(band) {
+		mc.mu.Lock()
+		mc.bandFiltered[band]++
+		mc.mu.Unlock()
+		logFields{"instance": instanceName, "callsign": decode.Callsign, "band": band}.Debugf("MQTT: Dropping decode of %s from %s on disabled band %s", decode.Callsign, instanceName, band)
+		return
+	}
+
+	// Drop decodes too weak to trust. Decodes without an SNR can't be judged
+	// and are kept.
+	if config.MinSNR != nil && hasSNR && snr < *config.MinSNR {
+		mc.mu.Lock()
+		mc.lowSNR[instanceName]++
+		mc.mu.Unlock()
+		logFields{"instance": instanceName, "callsign": decode.Callsign}.Debugf("MQTT: Dropping decode of %s from %s at %d dB, below min_snr %d dB", decode.Callsign, instanceName, snr, *config.MinSNR)
 		return
 	}
 
+	if hashed {
+		mc.stats.RecordHashedCallsign(frequencyToBand(rxFreq))
+		if config.HashedCallsigns != HashedCallsignsSubmit || decode.Locator == "" {
+			return
+		}
+	}
+
+	// Compound callsigns count as the base station for deduplication and
+	// statistics; the decoded form is still what gets uploaded
+	callsign := decode.Callsign
+	if config.NormalizeCallsigns && !hashed {
+		callsign = normalizeCallsign(callsign)
+	}
+
 	// Create WSPRNet report
 	report := WSPRReport{
-		Callsign:     decode.Callsign,
+		Callsign:     callsign,
 		Locator:      decode.Locator,
-		SNR:          decode.SNR,
-		Frequency:    decode.TxFrequency,
-		ReceiverFreq: decode.Frequency,
+		SNR:          snr,
+		HasSNR:       hasSNR,
+		Frequency:    txFreq,
+		ReceiverFreq: rxFreq,
 		DT:           float32(decode.DT),
 		Drift:        decode.Drift,
 		DBm:          decode.DBm,
 		EpochTime:    timestamp,
 		Mode:         decode.Mode,
 	}
+	if callsign != decode.Callsign {
+		report.DecodedCallsign = decode.Callsign
+	}
 
 	// Track message count per instance
 	mc.mu.Lock()
 	mc.instanceMsgCount[instanceName]++
 	mc.mu.Unlock()
 
+	if unknownBand && config.UnknownBands == UnknownBandsQuarantine {
+		if mc.spotWriter != nil {
+			quarantined := &WSPRReportWithSource{WSPRReport: &report, InstanceName: instanceName, Country: decode.Country}
+			if err := mc.spotWriter.WriteQuarantined(quarantined); err != nil {
+				logFields{"instance": instanceName, "callsign": decode.Callsign}.Printf("MQTT: Failed to quarantine decode of %s: %v", decode.Callsign, err)
+			}
+		}
+		return
+	}
+
+	mc.stats.RecordSoftware(instanceName, decode.Software, decode.Version)
+
 	// Add to aggregator for deduplication (with instance name and country for statistics)
 	mc.aggregator.AddSpot(&report, instanceName, decode.Country)
 }
 
+// SetSpotWriter sets where decodes outside every known band are quarantined
+func (mc *MQTTClient) SetSpotWriter(spotWriter *SpotWriter) {
+	mc.spotWriter = spotWriter
+}
+
 // GetStatus returns the current MQTT client status
 func (mc *MQTTClient) GetStatus() map[string]interface{} {
+	config := mc.config.Load()
+
 	mc.mu.RLock()
 	defer mc.mu.RUnlock()
 
@@ -349,11 +732,55 @@ func (mc *MQTTClient) GetStatus() map[string]interface{} {
 		instanceCounts[name] = count
 	}
 
+	freqNormalized := make(map[string]int64)
+	for name, count := range mc.freqNormalized {
+		freqNormalized[name] = count
+	}
+	freqRejected := make(map[string]int64)
+	for name, count := range mc.freqRejected {
+		freqRejected[name] = count
+	}
+	timeRejected := make(map[string]int64)
+	for name, count := range mc.timeRejected {
+		timeRejected[name] = count
+	}
+	unknownBand := make(map[string]int64)
+	for name, count := range mc.unknownBand {
+		unknownBand[name] = count
+	}
+	bandFiltered := make(map[string]int64)
+	for band, count := range mc.bandFiltered {
+		bandFiltered[band] = count
+	}
+	lowSNR := make(map[string]int64)
+	for name, count := range mc.lowSNR {
+		lowSNR[name] = count
+	}
+
+	displayNames := make(map[string]string)
+	for _, inst := range config.MQTT.Instances {
+		displayNames[inst.Name] = config.InstanceDisplayName(inst.Name)
+	}
+
 	return map[string]interface{}{
-		"connected":       mc.client.IsConnected(),
-		"total_messages":  mc.msgCount,
-		"instance_counts": instanceCounts,
-		"broker":          mc.config.MQTT.Broker,
+		"connected":            mc.client.IsConnected(),
+		"total_messages":       atomic.LoadInt64(&mc.msgCount),
+		"queue_length":         len(mc.queue),
+		"queue_capacity":       cap(mc.queue),
+		"queue_dropped":        mc.queueDropped,
+		"workers":              config.MQTT.Workers,
+		"instance_counts":      instanceCounts,
+		"display_names":        displayNames,
+		"frequency_normalized": freqNormalized,
+		"frequency_rejected":   freqRejected,
+		"timestamp_rejected":   timeRejected,
+		"unknown_band":         unknownBand,
+		"unknown_bands_mode":   config.UnknownBands,
+		"band_filtered":        bandFiltered,
+		"low_snr_filtered":     lowSNR,
+		"min_snr":              config.MinSNR,
+		"broker":               config.MQTT.Broker,
+		"unsubscribed_topics":  mc.UnsubscribedTopics(),
 	}
 }
 
@@ -363,25 +790,32 @@ func (mc *MQTTClient) Disconnect() {
 		mc.client.Disconnect(250)
 		log.Println("MQTT: Disconnected from broker")
 	}
+
+	// No more messages arrive once paho has disconnected; the workers
+	// process what is already queued and stop
+	close(mc.stopChan)
+	mc.wg.Wait()
 }
 
 // WSPRDecode represents a WSPR decode from MQTT
 type WSPRDecode struct {
-	Mode        string  `json:"mode"`
-	Band        string  `json:"band"`
-	Callsign    string  `json:"callsign"`
-	Locator     string  `json:"locator"`
-	Country     string  `json:"country"`
-	CQZone      int     `json:"CQZone"`
-	ITUZone     int     `json:"ITUZone"`
-	Continent   string  `json:"Continent"`
-	TimeOffset  float64 `json:"TimeOffset"`
-	SNR         int     `json:"snr"`
-	Frequency   uint64  `json:"frequency"`
-	Timestamp   string  `json:"timestamp"`
-	Message     string  `json:"message"`
-	DT          float64 `json:"dt"`
-	Drift       int     `json:"drift"`
-	DBm         int     `json:"dbm"`
-	TxFrequency uint64  `json:"tx_frequency"`
+	Mode        string          `json:"mode"`
+	Band        string          `json:"band"`
+	Callsign    string          `json:"callsign"`
+	Locator     string          `json:"locator"`
+	Country     string          `json:"country"`
+	CQZone      int             `json:"CQZone"`
+	ITUZone     int             `json:"ITUZone"`
+	Continent   string          `json:"Continent"`
+	TimeOffset  float64         `json:"TimeOffset"`
+	SNR         *int            `json:"snr"`       // nil when the decoder omitted the field
+	Frequency   float64         `json:"frequency"` // Hz expected; kHz/MHz values are normalized
+	Timestamp   json.RawMessage `json:"timestamp"` // RFC3339 (zone optional) or epoch seconds/milliseconds
+	Message     string          `json:"message"`
+	DT          float64         `json:"dt"`
+	Drift       int             `json:"drift"`
+	DBm         int             `json:"dbm"`
+	TxFrequency float64         `json:"tx_frequency"`       // Hz expected; kHz/MHz values are normalized
+	Software    string          `json:"software,omitempty"` // Optional decoder software name
+	Version     string          `json:"version,omitempty"`  // Optional decoder software version
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultMetricsPrefix starts every metric name served at /metrics
+const DefaultMetricsPrefix = "wspr"
+
+// metricsPrefixPattern matches prefixes that make valid Prometheus metric names
+var metricsPrefixPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// metricsWriter writes the Prometheus text exposition format
+type metricsWriter struct {
+	b      strings.Builder
+	prefix string
+}
+
+// metric writes an unlabelled metric with its HELP and TYPE lines
+func (m *metricsWriter) metric(name, kind, help string, value float64) {
+	full := m.prefix + "_" + name
+	fmt.Fprintf(&m.b, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", full, help, full, kind, full, formatMetricValue(value))
+}
+
+// labelled writes a metric with one sample per value of label, sorted by value
+func (m *metricsWriter) labelled(name, kind, help, label string, samples map[string]float64) {
+	full := m.prefix + "_" + name
+	fmt.Fprintf(&m.b, "# HELP %s %s\n# TYPE %s %s\n", full, help, full, kind)
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&m.b, "%s{%s=\"%s\"} %s\n", full, label, escapeLabelValue(k), formatMetricValue(samples[k]))
+	}
+}
+
+// formatMetricValue prints whole numbers without a fractional part
+func formatMetricValue(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// escapeLabelValue escapes a label value as the text format requires
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// intStat reads an int from a GetStats-style map, 0 if absent
+func intStat(stats map[string]interface{}, key string) float64 {
+	switch v := stats[key].(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// handleMetrics serves aggregator health in the Prometheus text format. The
+// _total counters are cumulative; the _24h gauges are the rolling numbers
+// shown on the dashboard.
+func (ws *WebServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	m := &metricsWriter{prefix: ws.config.Load().MetricsPrefix}
+
+	overall := ws.stats.GetOverallStats()
+	m.metric("spots_submitted_total", "counter", "Deduplicated spots passed on for submission.", intStat(overall, "total_submitted"))
+	m.metric("spots_duplicates_total", "counter", "Duplicate reports removed by deduplication.", intStat(overall, "total_duplicates"))
+
+	wsprnetStats := ws.wsprnet.GetStats()
+	m.metric("wsprnet_successful_total", "counter", "Spots WSPRNet accepted.", intStat(wsprnetStats, "successful"))
+	m.metric("wsprnet_failed_total", "counter", "Spots that failed to upload to WSPRNet.", intStat(wsprnetStats, "failed"))
+	m.metric("wsprnet_retries_total", "counter", "WSPRNet upload retries.", intStat(wsprnetStats, "retries"))
+
+	summary := ws.stats.GetSummary()
+	m.metric("spots_sent_24h", "gauge", "Spots sent in the last 24 hours.", float64(summary.Sent24h))
+	m.metric("spots_duplicates_24h", "gauge", "Duplicates removed in the last 24 hours.", float64(summary.Duplicates24h))
+	m.metric("spots_failed_24h", "gauge", "Failed submissions in the last 24 hours.", float64(summary.Failed24h))
+	m.metric("pending_spots", "gauge", "Spots waiting for their window to be submitted.", intStat(ws.aggregator.GetStats(), "pending_spots"))
+	m.metric("instances_online", "gauge", "Instances that reported within the offline timeout.", float64(summary.InstancesOnline))
+
+	instances := ws.stats.GetInstanceStats()
+	spots := make(map[string]float64, len(instances))
+	online := make(map[string]float64, len(instances))
+	for name, inst := range instances {
+		spots[name] = float64(inst.TotalSpots)
+		online[name] = 0
+		if inst.Online {
+			online[name] = 1
+		}
+	}
+	m.labelled("instance_spots_total", "counter", "Spots reported by each instance.", "instance", spots)
+	m.labelled("instance_online", "gauge", "Whether each instance reported within the offline timeout.", "instance", online)
+
+	if ws.mqttClient != nil {
+		status := ws.mqttClient.GetStatus()
+		connected := 0.0
+		if status["connected"] == true {
+			connected = 1
+		}
+		m.metric("mqtt_connected", "gauge", "Whether the MQTT client is connected.", connected)
+		m.metric("mqtt_messages_total", "counter", "MQTT messages received.", intStat(status, "total_messages"))
+		m.metric("mqtt_queue_dropped_total", "counter", "MQTT messages dropped because the processing queue was full.", intStat(status, "queue_dropped"))
+
+		messages := make(map[string]float64)
+		if counts, ok := status["instance_counts"].(map[string]int64); ok {
+			for name, count := range counts {
+				messages[name] = float64(count)
+			}
+		}
+		m.labelled("instance_messages_total", "counter", "Decodes processed from each instance.", "instance", messages)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(m.b.String()))
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Timing for MQTT subscriptions
+const (
+	mqttSubscribeTimeout    = 10 * time.Second // Wait for the broker's SUBACK
+	mqttResubscribeInitial  = 5 * time.Second  // First retry after a failed subscription
+	mqttResubscribeMaxDelay = 5 * time.Minute  // Longest gap between retries
+)
+
+// mqttSubackFailure is the SUBACK return code for a refused subscription
+const mqttSubackFailure = 0x80
+
+// SubscriptionState is the state of one instance's topic subscription
+type SubscriptionState struct {
+	Instance     string    `json:"instance"`
+	Topic        string    `json:"topic"`
+	Subscribed   bool      `json:"subscribed"`
+	SubscribedAt time.Time `json:"subscribed_at,omitempty"`
+	LastAttempt  time.Time `json:"last_attempt,omitempty"`
+	Failures     int       `json:"failures"` // Consecutive failed attempts
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// DefaultTopicPattern is the topic layout UberSDR publishes WSPR decodes under.
+// {prefix} is replaced with the instance's topic_prefix and {band} stands for
+// the band level.
+const DefaultTopicPattern = "{prefix}/digital_modes/WSPR/{band}"
+
+// instanceTopicPattern returns an instance's topic_pattern, or the default
+func instanceTopicPattern(inst InstanceConfig) string {
+	if inst.TopicPattern != "" {
+		return inst.TopicPattern
+	}
+	return DefaultTopicPattern
+}
+
+// instanceBandTopic returns the topic an instance publishes band's decodes on
+func instanceBandTopic(inst InstanceConfig, band string) string {
+	return strings.NewReplacer("{prefix}", inst.TopicPrefix, "{band}", band).Replace(instanceTopicPattern(inst))
+}
+
+// instanceTopic returns the WSPR topic filter for an instance
+func instanceTopic(inst InstanceConfig) string {
+	return instanceBandTopic(inst, "+")
+}
+
+// validateTopicPattern checks a topic_pattern has exactly one {band}, as a
+// whole topic level, and no MQTT wildcards of its own
+func validateTopicPattern(pattern string) error {
+	if strings.Count(pattern, "{band}") != 1 {
+		return fmt.Errorf("must contain {band} exactly once")
+	}
+	if strings.ContainsAny(pattern, "+#") {
+		return fmt.Errorf("must not contain the MQTT wildcards + or #; use {band} for the band level")
+	}
+	for _, level := range strings.Split(pattern, "/") {
+		if strings.Contains(level, "{band}") && level != "{band}" {
+			return fmt.Errorf("{band} must be a whole topic level, not part of %q", level)
+		}
+	}
+	return nil
+}
+
+// topicRoute maps one subscribed topic filter back to its instance
+type topicRoute struct {
+	instance  string
+	levels    []string // The filter split on "/", with "+" at the band level
+	bandLevel int
+}
+
+// newTopicRoutes builds the routes for every configured instance
+func newTopicRoutes(instances []InstanceConfig) []topicRoute {
+	routes := make([]topicRoute, 0, len(instances))
+	for _, inst := range instances {
+		levels := strings.Split(instanceBandTopic(inst, "{band}"), "/")
+		route := topicRoute{instance: inst.Name, levels: levels}
+		for i, level := range levels {
+			if level == "{band}" {
+				route.bandLevel = i
+				levels[i] = "+"
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// matchTopic returns the instance whose topic filter a received topic
+// matches, and the band from the topic
+func (mc *MQTTClient) matchTopic(topic string) (instance, band string, ok bool) {
+	mc.routesMu.RLock()
+	defer mc.routesMu.RUnlock()
+
+	levels := strings.Split(topic, "/")
+	for _, route := range mc.topicRoutes {
+		if len(levels) != len(route.levels) {
+			continue
+		}
+		matched := true
+		for i, level := range route.levels {
+			if level != "+" && level != levels[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route.instance, levels[route.bandLevel], true
+		}
+	}
+	return "", "", false
+}
+
+// onConnect subscribes to every instance's topic after a (re)connect. The
+// broker does not keep subscriptions for our clean session, so all of them are
+// made again. Any that fail are retried with backoff until they succeed or the
+// connection drops.
+func (mc *MQTTClient) onConnect() {
+	mc.subMu.Lock()
+	mc.subGeneration++
+	generation := mc.subGeneration
+	for _, state := range mc.subscriptions {
+		state.Subscribed = false
+	}
+	mc.subMu.Unlock()
+
+	if missing := mc.subscribeMissing(); len(missing) > 0 {
+		log.Printf("MQTT: %d topic(s) not subscribed, retrying in %s: %v", len(missing), mqttResubscribeInitial, missing)
+		go mc.retrySubscriptions(generation)
+		return
+	}
+	log.Printf("MQTT: All %d topic(s) subscribed", len(mc.config.Load().MQTT.Instances))
+}
+
+// onConnectionLost marks every subscription as lost and stops any retries
+func (mc *MQTTClient) onConnectionLost() {
+	mc.subMu.Lock()
+	defer mc.subMu.Unlock()
+
+	mc.subGeneration++
+	for _, state := range mc.subscriptions {
+		state.Subscribed = false
+	}
+}
+
+// subscribeMissing subscribes to each topic not currently subscribed and
+// returns the topics that still failed
+func (mc *MQTTClient) subscribeMissing() []string {
+	var missing []string
+	for _, inst := range mc.config.Load().MQTT.Instances {
+		topic := instanceTopic(inst)
+
+		mc.subMu.Lock()
+		state := mc.subscriptions[topic]
+		if state == nil {
+			state = &SubscriptionState{Instance: inst.Name, Topic: topic}
+			mc.subscriptions[topic] = state
+		}
+		done := state.Subscribed
+		mc.subMu.Unlock()
+		if done {
+			continue
+		}
+
+		err := mc.subscribeTopic(topic)
+
+		mc.subMu.Lock()
+		state.LastAttempt = time.Now()
+		if err != nil {
+			state.Failures++
+			state.LastError = err.Error()
+			missing = append(missing, topic)
+		} else {
+			state.Subscribed = true
+			state.SubscribedAt = state.LastAttempt
+			state.Failures = 0
+			state.LastError = ""
+		}
+		mc.subMu.Unlock()
+
+		if err != nil {
+			log.Printf("MQTT: Failed to subscribe to %s (%s): %v", topic, inst.Name, err)
+		} else {
+			log.Printf("MQTT: Subscribed to %s (%s)", topic, inst.Name)
+		}
+	}
+	return missing
+}
+
+// subscribeTopic subscribes to one topic and checks the broker granted it
+func (mc *MQTTClient) subscribeTopic(topic string) error {
+	token := mc.client.Subscribe(topic, byte(mc.config.Load().MQTT.QoS), mc.messageHandler)
+	if !token.WaitTimeout(mqttSubscribeTimeout) {
+		return fmt.Errorf("no response from broker after %s", mqttSubscribeTimeout)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+
+	// A SUBACK can still refuse the subscription, e.g. when an ACL denies it
+	if st, ok := token.(*mqtt.SubscribeToken); ok {
+		if code, ok := st.Result()[topic]; ok && code == mqttSubackFailure {
+			return fmt.Errorf("subscription refused by broker")
+		}
+	}
+	return nil
+}
+
+// retrySubscriptions retries failed subscriptions with exponential backoff. It
+// gives up when the connection that started it is lost or replaced.
+func (mc *MQTTClient) retrySubscriptions(generation int) {
+	delay := mqttResubscribeInitial
+	for {
+		select {
+		case <-mc.stopChan:
+			return
+		case <-time.After(delay):
+		}
+
+		mc.subMu.Lock()
+		current := mc.subGeneration == generation
+		mc.subMu.Unlock()
+		if !current || !mc.client.IsConnectionOpen() {
+			return
+		}
+
+		missing := mc.subscribeMissing()
+		if len(missing) == 0 {
+			log.Println("MQTT: All topics subscribed after retry")
+			return
+		}
+
+		delay *= 2
+		if delay > mqttResubscribeMaxDelay {
+			delay = mqttResubscribeMaxDelay
+		}
+		log.Printf("MQTT: %d topic(s) still not subscribed, retrying in %s: %v", len(missing), delay, missing)
+	}
+}
+
+// GetSubscriptions returns the state of every instance's subscription, sorted by instance
+func (mc *MQTTClient) GetSubscriptions() []SubscriptionState {
+	mc.subMu.Lock()
+	defer mc.subMu.Unlock()
+
+	instances := mc.config.Load().MQTT.Instances
+	states := make([]SubscriptionState, 0, len(instances))
+	for _, inst := range instances {
+		topic := instanceTopic(inst)
+		if state := mc.subscriptions[topic]; state != nil {
+			states = append(states, *state)
+		} else {
+			states = append(states, SubscriptionState{Instance: inst.Name, Topic: topic})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Instance < states[j].Instance })
+	return states
+}
+
+// UnsubscribedTopics returns the topics that are not currently subscribed
+func (mc *MQTTClient) UnsubscribedTopics() []string {
+	var topics []string
+	for _, state := range mc.GetSubscriptions() {
+		if !state.Subscribed {
+			topics = append(topics, state.Topic)
+		}
+	}
+	return topics
+}
+
+// ReloadInstances applies a changed mqtt.instances list while connected:
+// topics no longer configured are unsubscribed and new ones subscribed. The
+// config must already hold the new list.
+func (mc *MQTTClient) ReloadInstances() {
+	instances := mc.config.Load().MQTT.Instances
+	routes := newTopicRoutes(instances)
+	mc.routesMu.Lock()
+	mc.topicRoutes = routes
+	mc.routesMu.Unlock()
+
+	wanted := make(map[string]string, len(instances))
+	for _, inst := range instances {
+		wanted[instanceTopic(inst)] = inst.Name
+	}
+
+	// Bumping the generation stops any retry loop working from the old list
+	mc.subMu.Lock()
+	var removed []string
+	for topic, state := range mc.subscriptions {
+		name, ok := wanted[topic]
+		if !ok {
+			removed = append(removed, topic)
+			delete(mc.subscriptions, topic)
+			continue
+		}
+		state.Instance = name
+	}
+	mc.subGeneration++
+	generation := mc.subGeneration
+	mc.subMu.Unlock()
+
+	// When disconnected, onConnect subscribes to the new list on reconnect
+	if !mc.client.IsConnectionOpen() {
+		return
+	}
+
+	for _, topic := range removed {
+		token := mc.client.Unsubscribe(topic)
+		if !token.WaitTimeout(mqttSubscribeTimeout) {
+			log.Printf("MQTT: No response unsubscribing from %s", topic)
+		} else if err := token.Error(); err != nil {
+			log.Printf("MQTT: Failed to unsubscribe from %s: %v", topic, err)
+		} else {
+			log.Printf("MQTT: Unsubscribed from %s", topic)
+		}
+	}
+
+	if missing := mc.subscribeMissing(); len(missing) > 0 {
+		log.Printf("MQTT: %d topic(s) not subscribed, retrying in %s: %v", len(missing), mqttResubscribeInitial, missing)
+		go mc.retrySubscriptions(generation)
+	}
+}
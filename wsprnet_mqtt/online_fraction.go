@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultOnlineGrace is how long an instance may go without a spot before the
+// gap counts as downtime in its online fraction
+const DefaultOnlineGrace = 30 * time.Minute
+
+// onlineFractionPeriod is how far back online fractions are measured, matching
+// the per-window history they are computed from
+const onlineFractionPeriod = 24 * time.Hour
+
+// SetOnlineGrace sets the longest gap between an instance's spots that still
+// counts as online when computing its online fraction
+func (st *StatisticsTracker) SetOnlineGrace(grace time.Duration) {
+	st.instancesMu.Lock()
+	st.onlineGrace = grace
+	st.instancesMu.Unlock()
+}
+
+// onlineFractions returns the fraction of the last 24 hours (or of the history
+// held, if shorter) each instance was online. An instance is online from each
+// window it reported in until its next one, unless the gap between them is
+// longer than the grace. Instances with no reports in the period get 0. The
+// map is nil when the history is shorter than the grace, too short to tell.
+func (st *StatisticsTracker) onlineFractions(now time.Time) map[string]float64 {
+	st.instancesMu.RLock()
+	grace := st.onlineGrace
+	names := make([]string, 0, len(st.instances))
+	for name := range st.instances {
+		names = append(names, name)
+	}
+	st.instancesMu.RUnlock()
+
+	// The period starts at the oldest window held
+	start := now.Add(-onlineFractionPeriod)
+	st.recentWindowsMu.RLock()
+	if len(st.recentWindows) > 0 && st.recentWindows[0].WindowTime.After(start) {
+		start = st.recentWindows[0].WindowTime
+	}
+	st.recentWindowsMu.RUnlock()
+
+	period := now.Sub(start)
+	if period <= grace {
+		return nil
+	}
+
+	// Windows each instance reported in, from the per-band SNR history
+	active := make(map[string][]time.Time)
+	st.snrHistoryMu.RLock()
+	for _, instances := range st.snrHistory {
+		for instance, points := range instances {
+			for _, point := range points {
+				if !point.WindowTime.Before(start) {
+					active[instance] = append(active[instance], point.WindowTime)
+				}
+			}
+		}
+	}
+	st.snrHistoryMu.RUnlock()
+
+	fractions := make(map[string]float64, len(names))
+	for _, name := range names {
+		times := active[name]
+		if len(times) == 0 {
+			fractions[name] = 0
+			continue
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+		var offline time.Duration
+		previous := start
+		for _, t := range append(times, now) {
+			if gap := t.Sub(previous); gap > grace {
+				offline += gap
+			}
+			previous = t
+		}
+
+		fraction := 1 - float64(offline)/float64(period)
+		if fraction < 0 {
+			fraction = 0
+		}
+		fractions[name] = fraction
+	}
+	return fractions
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Persistence file encodings
+const (
+	PersistenceFormatJSON = "json" // Indented JSON, portable and human readable (default)
+	PersistenceFormatGob  = "gob"  // Go binary encoding, smaller and faster for long histories
+)
+
+// gobPersistenceMagic prefixes gob persistence files so the encoding can be
+// detected on load whatever format is currently configured
+var gobPersistenceMagic = []byte("WSPRSTATS-GOB1\n")
+
+// encodePersistence serializes persistence data in the given format
+func encodePersistence(data *PersistenceData, format string) ([]byte, error) {
+	switch format {
+	case PersistenceFormatGob:
+		var buf bytes.Buffer
+		buf.Write(gobPersistenceMagic)
+		if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case PersistenceFormatJSON, "":
+		return json.MarshalIndent(data, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown persistence format %q", format)
+	}
+}
+
+// decodePersistence parses persistence data written by encodePersistence,
+// detecting gob files by their magic prefix and treating anything else as JSON.
+// Returns the format that was detected.
+func decodePersistence(raw []byte, data *PersistenceData) (string, error) {
+	if bytes.HasPrefix(raw, gobPersistenceMagic) {
+		if err := gob.NewDecoder(bytes.NewReader(raw[len(gobPersistenceMagic):])).Decode(data); err != nil {
+			return PersistenceFormatGob, err
+		}
+		return PersistenceFormatGob, nil
+	}
+	return PersistenceFormatJSON, json.Unmarshal(raw, data)
+}
+
+// persistenceBackupPath is where the previous save is kept in case the
+// persistence file can't be read
+func persistenceBackupPath(filename string) string {
+	return filename + ".bak"
+}
+
+// readPersistence loads a persistence file, falling back to the backup of the
+// previous save if the file is missing or can't be decoded. It returns
+// os.ErrNotExist if there is neither.
+func readPersistence(filename string, data *PersistenceData) (string, error) {
+	format, err := decodePersistenceFile(filename, data)
+	if err == nil {
+		return format, nil
+	}
+
+	backup := persistenceBackupPath(filename)
+	*data = PersistenceData{}
+	backupFormat, backupErr := decodePersistenceFile(backup, data)
+	if backupErr != nil {
+		if errors.Is(backupErr, os.ErrNotExist) {
+			return format, err
+		}
+		return format, fmt.Errorf("%w (backup %s: %v)", err, backup, backupErr)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: Persistence file %s is unreadable (%v), loaded the previous save from %s", filename, err, backup)
+		// Move the damaged file aside so the next save doesn't replace the
+		// good backup with it
+		if err := os.Rename(filename, filename+".corrupt"); err != nil {
+			log.Printf("Warning: Failed to move aside %s: %v", filename, err)
+		}
+	} else {
+		log.Printf("Warning: Persistence file %s is missing, loaded the previous save from %s", filename, backup)
+	}
+	return backupFormat, nil
+}
+
+// decodePersistenceFile reads and decodes one persistence file
+func decodePersistenceFile(filename string, data *PersistenceData) (string, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	format, err := decodePersistence(raw, data)
+	if err != nil {
+		return format, fmt.Errorf("failed to unmarshal persistence data (%s): %w", format, err)
+	}
+	return format, nil
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory, syncing it and renaming it over path. A crash part way
+// through leaves the previous file intact. If backup is set, the previous
+// file is moved there first.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, backup string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if backup != "" {
+		if err := os.Rename(path, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: Failed to keep a backup of %s: %v", path, err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
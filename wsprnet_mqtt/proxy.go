@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Schemes accepted for proxy_url. net/http handles SOCKS5 itself; socks5h
+// has the proxy resolve host names too.
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// outboundProxy is the proxy_url outbound HTTP goes through, or nil. It is set
+// once at startup by setOutboundProxy, before any HTTP clients are created.
+var outboundProxy *url.URL
+
+// parseProxyURL checks a proxy_url value
+func parseProxyURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || !proxySchemes[u.Scheme] || u.Host == "" {
+		return nil, fmt.Errorf("proxy_url must be an http://, https://, socks5:// or socks5h:// URL with a host")
+	}
+	return u, nil
+}
+
+// setOutboundProxy sends outbound HTTP through proxy, or directly if nil
+func setOutboundProxy(proxy *url.URL) {
+	outboundProxy = proxy
+}
+
+// proxyFunc returns the Proxy function for an outbound http.Transport: the
+// proxy_url if set, otherwise nil for a direct connection
+func proxyFunc() func(*http.Request) (*url.URL, error) {
+	if outboundProxy == nil {
+		return nil
+	}
+	return http.ProxyURL(outboundProxy)
+}
+
+// outboundTransport returns the transport for an outbound HTTP client. Without
+// proxy_url it is nil, so the client uses http.DefaultTransport as before.
+func outboundTransport() http.RoundTripper {
+	if outboundProxy == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(outboundProxy)
+	return transport
+}
+
+// redactedProxy returns the proxy_url for logging, without any password
+func redactedProxy() string {
+	if outboundProxy == nil {
+		return ""
+	}
+	return outboundProxy.Redacted()
+}
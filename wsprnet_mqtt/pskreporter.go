@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +21,19 @@ const (
 	PSKMaxRetries               = 3
 )
 
+// PSKReporterConfig controls forwarding deduplicated spots to PSKReporter
+type PSKReporterConfig struct {
+	Enabled  *bool  `yaml:"enabled,omitempty" json:"enabled,omitempty"`   // Default true
+	Callsign string `yaml:"callsign,omitempty" json:"callsign,omitempty"` // Reporting callsign (default receiver.callsign)
+	Locator  string `yaml:"locator,omitempty" json:"locator,omitempty"`   // Reporting locator (default receiver.locator)
+}
+
+// IsEnabled reports whether spots are forwarded to PSKReporter. Forwarding is
+// on unless enabled is set to false.
+func (c PSKReporterConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
 // PSKReport represents a single spot report for PSKReporter
 type PSKReport struct {
 	Callsign  string
@@ -37,6 +51,7 @@ type PSKReporter struct {
 	receiverLocator  string
 	programName      string
 	antenna          string
+	dryRun           atomic.Bool // Changed in place on a config reload
 
 	// Socket
 	conn net.Conn
@@ -57,8 +72,10 @@ type PSKReporter struct {
 	sentMutex   sync.Mutex
 
 	// Statistics
-	countSendsOK int
-	statsMutex   sync.Mutex
+	countSendsOK     int
+	countSendsFailed int // Reports in packets that could not be sent
+	lastError        string
+	statsMutex       sync.Mutex
 
 	// Threading
 	running bool
@@ -116,6 +133,13 @@ func (psk *PSKReporter) Connect() error {
 	return nil
 }
 
+// SetDryRun turns dry run on or off. In dry run reports are not queued;
+// those already queued are still sent.
+func (psk *PSKReporter) SetDryRun(dryRun bool) {
+	psk.dryRun.Store(dryRun)
+	log.Printf("PSKReporter: Dry run %v", dryRun)
+}
+
 // Submit adds a report to the queue
 func (psk *PSKReporter) Submit(report *WSPRReport) error {
 	if !psk.running {
@@ -131,8 +155,13 @@ func (psk *PSKReporter) Submit(report *WSPRReport) error {
 		return nil
 	}
 
+	if psk.dryRun.Load() {
+		logDebugf("PSKReporter: [DRY RUN] Would send %s", report.Callsign)
+		return nil
+	}
+
 	pskReport := PSKReport{
-		Callsign:  report.Callsign,
+		Callsign:  report.UploadCallsign(),
 		Locator:   report.Locator,
 		SNR:       report.SNR,
 		Frequency: report.Frequency,
@@ -312,9 +341,15 @@ func (psk *PSKReporter) makePackets() int {
 	// Update packet length in header
 	binary.BigEndian.PutUint16(packet[2:4], uint16(offset))
 
-	// Send packet with retries
+	// Send packet with retries. Reports were counted as sent as they were
+	// added; move them to failed if the packet never went out.
 	if err := psk.sendPacketWithRetry(packet[:offset]); err != nil {
 		log.Printf("PSKReporter: Failed to send packet after %d retries: %v", PSKMaxRetries, err)
+		psk.statsMutex.Lock()
+		psk.countSendsOK -= reportCount
+		psk.countSendsFailed += reportCount
+		psk.lastError = err.Error()
+		psk.statsMutex.Unlock()
 	}
 
 	// Update tracking
@@ -601,20 +636,29 @@ func (psk *PSKReporter) Stop() {
 
 // GetStats returns current statistics
 func (psk *PSKReporter) GetStats() map[string]interface{} {
+	psk.queueMutex.Lock()
+	queued := len(psk.reportQueue)
+	psk.queueMutex.Unlock()
+
 	psk.statsMutex.Lock()
 	defer psk.statsMutex.Unlock()
 
 	return map[string]interface{}{
 		"successful": psk.countSendsOK,
+		"failed":     psk.countSendsFailed,
+		"queued":     queued,
+		"last_error": psk.lastError,
+		"dry_run":    psk.dryRun.Load(),
 	}
 }
 
 // SetStats restores statistics from persistence
-func (psk *PSKReporter) SetStats(successful int) {
+func (psk *PSKReporter) SetStats(successful, failed int) {
 	psk.statsMutex.Lock()
 	defer psk.statsMutex.Unlock()
 
 	psk.countSendsOK = successful
+	psk.countSendsFailed = failed
 }
 
 // ResetStats clears all statistics
@@ -623,6 +667,8 @@ func (psk *PSKReporter) ResetStats() {
 	defer psk.statsMutex.Unlock()
 
 	psk.countSendsOK = 0
+	psk.countSendsFailed = 0
+	psk.lastError = ""
 
 	log.Println("PSKReporter: Statistics reset to zero")
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits events to a number per minute. The bucket holds up to a
+// minute's worth of tokens, so a burst after a quiet spell goes out at once
+// and a steady stream is spaced out evenly.
+type tokenBucket struct {
+	mu        sync.Mutex
+	perMinute int
+	tokens    float64
+	last      time.Time
+}
+
+// newTokenBucket creates a full bucket allowing perMinute events a minute
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		perMinute: perMinute,
+		tokens:    float64(perMinute),
+		last:      time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it. Tokens
+// are handed out in order, so callers that wait their turn never overtake.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rate := float64(b.perMinute) / time.Minute.Seconds() // Tokens per second
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(float64(b.perMinute), b.tokens+elapsed*rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// SetRateLimit caps uploads to WSPRNet at perMinute requests a minute (a MEPT
+// batch, or one spot with the post and get methods). 0 means no limit. It
+// must be called before Connect.
+func (w *WSPRNet) SetRateLimit(perMinute int) {
+	if perMinute <= 0 {
+		w.rateLimit = nil
+		return
+	}
+	w.rateLimit = newTokenBucket(perMinute)
+}
+
+// waitForRateLimit blocks the upload worker until the next upload, offering
+// spots spots, is allowed. It returns false if WSPRNet is stopped first. Only
+// the worker waits here; Submit just queues, so the aggregator never blocks.
+func (w *WSPRNet) waitForRateLimit(spots int) bool {
+	if w.rateLimit == nil || w.dryRun.Load() {
+		return true
+	}
+	wait := w.rateLimit.reserve(time.Now())
+	if wait <= 0 {
+		return true
+	}
+
+	w.statsMutex.Lock()
+	w.countRateLimited += spots
+	w.rateLimitedUploads++
+	w.statsMutex.Unlock()
+	log.Printf("WSPRNet: Rate limit of %d uploads a minute reached, waiting %.1f seconds to upload %d spots",
+		w.rateLimit.perMinute, wait.Seconds(), spots)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.stopCh:
+		return false
+	}
+}
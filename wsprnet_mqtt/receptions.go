@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// receptionsChunk is how much of the spot history is grouped at once when
+// exporting receptions, bounding the memory an export needs
+const receptionsChunk = time.Hour
+
+// InstanceReception is one instance's report of a spot
+type InstanceReception struct {
+	Instance string  `json:"instance"`
+	SNR      int     `json:"snr"`
+	DT       float32 `json:"dt"`
+	Drift    int     `json:"drift"`
+	Locator  string  `json:"locator,omitempty"` // Only when it differs from the spot's locator
+}
+
+// SpotReceptions is every instance's report of one callsign on one band in one
+// WSPR cycle, with the instance whose report was kept by deduplication
+type SpotReceptions struct {
+	Window    time.Time           `json:"window"`
+	Band      string              `json:"band"`
+	Callsign  string              `json:"callsign"`
+	Locator   string              `json:"locator"`
+	HeardBy   int                 `json:"heard_by"`
+	Winner    string              `json:"winner,omitempty"` // Empty if no deduped record was kept
+	Instances []InstanceReception `json:"instances"`
+}
+
+// GetSpotReceptions groups the raw spots in [start, end) by cycle, band and
+// callsign, oldest cycle first. Instances within a record are ordered by SNR,
+// best first.
+func (sw *SpotWriter) GetSpotReceptions(band string, start, end time.Time) []SpotReceptions {
+	sw.cacheMu.RLock()
+	type groupKey struct {
+		window   int64
+		band     string
+		callsign string
+	}
+	groups := make(map[groupKey]*SpotReceptions)
+	for _, instanceSpots := range sw.rawSpots {
+		for _, spot := range instanceSpots {
+			if spot.Timestamp.Before(start) || !spot.Timestamp.Before(end) {
+				continue
+			}
+			if band != "" && band != "all" && spot.Band != band {
+				continue
+			}
+
+			window := (spot.Timestamp.Unix() / 120) * 120
+			key := groupKey{window, spot.Band, strings.ToUpper(spot.Callsign)}
+			group := groups[key]
+			if group == nil {
+				group = &SpotReceptions{
+					Window:   time.Unix(window, 0).UTC(),
+					Band:     spot.Band,
+					Callsign: key.callsign,
+					Locator:  spot.Locator,
+				}
+				groups[key] = group
+			}
+			group.Instances = append(group.Instances, InstanceReception{
+				Instance: spot.Instance,
+				SNR:      spot.SNR,
+				DT:       spot.DT,
+				Drift:    spot.Drift,
+				Locator:  spot.Locator,
+			})
+		}
+	}
+
+	for _, spot := range sw.dedupedSpots {
+		if spot.Timestamp.Before(start) || !spot.Timestamp.Before(end) {
+			continue
+		}
+		key := groupKey{(spot.Timestamp.Unix() / 120) * 120, spot.Band, strings.ToUpper(spot.Callsign)}
+		if group := groups[key]; group != nil {
+			group.Winner = spot.Instance
+			group.Locator = spot.Locator
+		}
+	}
+	sw.cacheMu.RUnlock()
+
+	result := make([]SpotReceptions, 0, len(groups))
+	for _, group := range groups {
+		for i := range group.Instances {
+			if strings.EqualFold(group.Instances[i].Locator, group.Locator) {
+				group.Instances[i].Locator = ""
+			}
+		}
+		sort.Slice(group.Instances, func(i, j int) bool {
+			a, b := group.Instances[i], group.Instances[j]
+			if a.SNR != b.SNR {
+				return a.SNR > b.SNR
+			}
+			return a.Instance < b.Instance
+		})
+		group.HeardBy = len(group.Instances)
+		result = append(result, *group)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Window.Equal(b.Window) {
+			return a.Window.Before(b.Window)
+		}
+		if a.Band != b.Band {
+			return bandLess(a.Band, b.Band)
+		}
+		return a.Callsign < b.Callsign
+	})
+	return result
+}
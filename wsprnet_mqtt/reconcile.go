@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReconcileURL is the wspr.live ClickHouse endpoint, a public mirror of the WSPRNet database
+const DefaultReconcileURL = "https://db1.wspr.live/"
+
+// reconcileSettleTime is how long spots are given to appear upstream before
+// a missing spot is reported
+const reconcileSettleTime = 20 * time.Minute
+
+// Characters allowed in a callsign used in a reconciliation query
+var reconcileCallsignPattern = regexp.MustCompile(`^[A-Za-z0-9/]+$`)
+
+// ReconcileReport is the result of the most recent reconciliation run
+type ReconcileReport struct {
+	Enabled  bool         `json:"enabled"`
+	LastRun  *time.Time   `json:"last_run"`        // nil until the first run completes
+	From     time.Time    `json:"from"`            // Start of the compared period
+	To       time.Time    `json:"to"`              // End of the compared period (now minus settle time)
+	Error    string       `json:"error,omitempty"` // Set if the upstream query failed
+	Checked  int          `json:"checked"`         // Locally submitted spots compared
+	Matched  int          `json:"matched"`         // Found upstream
+	Upstream int          `json:"upstream"`        // Spots upstream for this receiver in the period
+	Missing  []StoredSpot `json:"missing"`         // Submitted locally but not found upstream
+}
+
+// Reconciler periodically compares locally submitted spots with the spots
+// WSPRNet actually recorded for this receiver
+type Reconciler struct {
+	config     WSPRNetReconcileConfig
+	callsign   string
+	spotWriter *SpotWriter
+	client     *http.Client
+
+	mu     sync.RWMutex
+	report ReconcileReport
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewReconciler creates a reconciler for the given receiver callsign
+func NewReconciler(config WSPRNetReconcileConfig, callsign string, spotWriter *SpotWriter) *Reconciler {
+	return &Reconciler{
+		config:     config,
+		callsign:   strings.ToUpper(callsign),
+		spotWriter: spotWriter,
+		client:     &http.Client{Timeout: 60 * time.Second, Transport: outboundTransport()},
+		report:     ReconcileReport{Enabled: true, Missing: []StoredSpot{}},
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start begins periodic reconciliation
+func (rc *Reconciler) Start() {
+	log.Printf("Reconcile: Comparing submitted spots with %s every %d minutes (lookback %d hours)",
+		rc.config.URL, rc.config.IntervalMinutes, rc.config.LookbackHours)
+
+	rc.wg.Add(1)
+	go func() {
+		defer rc.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(rc.config.IntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rc.stopChan:
+				return
+			case <-ticker.C:
+				rc.run()
+			}
+		}
+	}()
+}
+
+// Stop stops periodic reconciliation
+func (rc *Reconciler) Stop() {
+	close(rc.stopChan)
+	rc.wg.Wait()
+}
+
+// GetReport returns a copy of the latest reconciliation report
+func (rc *Reconciler) GetReport() ReconcileReport {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	report := rc.report
+	report.Missing = append([]StoredSpot{}, rc.report.Missing...)
+	return report
+}
+
+// run performs one reconciliation pass
+func (rc *Reconciler) run() {
+	now := time.Now().UTC()
+	to := now.Add(-reconcileSettleTime)
+	from := now.Add(-time.Duration(rc.config.LookbackHours) * time.Hour)
+
+	report := ReconcileReport{
+		Enabled: true,
+		LastRun: &now,
+		From:    from,
+		To:      to,
+		Missing: []StoredSpot{},
+	}
+
+	submitted := true
+	local := rc.spotWriter.GetDedupedSpots("", from, to, &submitted)
+	report.Checked = len(local)
+
+	upstream, err := rc.fetchUpstream(from, to)
+	if err != nil {
+		report.Error = err.Error()
+		log.Printf("Reconcile: Failed to fetch WSPRNet records: %v", err)
+	} else {
+		report.Upstream = len(upstream)
+		for _, spot := range local {
+			if upstream[dedupedKey(normalizeCallsign(spot.Callsign), spot.Band, spot.Timestamp.Truncate(time.Minute))] {
+				report.Matched++
+			} else {
+				report.Missing = append(report.Missing, spot)
+			}
+		}
+		if len(report.Missing) > 0 {
+			log.Printf("Reconcile: %d of %d submitted spots are missing from WSPRNet", len(report.Missing), report.Checked)
+		} else {
+			logDebugf("Reconcile: All %d submitted spots found on WSPRNet", report.Checked)
+		}
+	}
+
+	rc.mu.Lock()
+	rc.report = report
+	rc.mu.Unlock()
+}
+
+// fetchUpstream queries the spots recorded for this receiver and returns their
+// keys (callsign, band, minute)
+func (rc *Reconciler) fetchUpstream(from, to time.Time) (map[string]bool, error) {
+	if !reconcileCallsignPattern.MatchString(rc.callsign) {
+		return nil, fmt.Errorf("receiver callsign %q cannot be used in a query", rc.callsign)
+	}
+
+	query := fmt.Sprintf("SELECT time, tx_sign, frequency FROM wspr.rx WHERE rx_sign = '%s' AND time >= '%s' AND time <= '%s' FORMAT JSONEachRow",
+		rc.callsign, from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"))
+
+	keys := make(map[string]bool)
+	err := queryWSPRLive(rc.client, rc.config.URL, query, func(line []byte) error {
+		var row struct {
+			Time      string      `json:"time"`
+			TxSign    string      `json:"tx_sign"`
+			Frequency json.Number `json:"frequency"`
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return fmt.Errorf("failed to parse row: %w", err)
+		}
+
+		spotTime, err := time.Parse("2006-01-02 15:04:05", row.Time)
+		if err != nil {
+			return fmt.Errorf("failed to parse time %q: %w", row.Time, err)
+		}
+		freq, err := strconv.ParseUint(row.Frequency.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse frequency %q: %w", row.Frequency, err)
+		}
+
+		keys[dedupedKey(normalizeCallsign(row.TxSign), frequencyToBand(freq), spotTime)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// queryWSPRLive runs a ClickHouse query against a wspr.live compatible endpoint
+// and calls handleRow for each line of a JSONEachRow response
+func queryWSPRLive(client *http.Client, baseURL, query string, handleRow func(line []byte) error) error {
+	resp, err := client.Get(baseURL + "?query=" + url.QueryEscape(query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err := handleRow(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
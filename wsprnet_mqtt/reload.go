@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// SharedConfig holds the config the running components read. A config saved
+// from the admin page is swapped in whole rather than copied over the old
+// one, so readers never see it half written; take one Load for a set of
+// settings that belong together.
+type SharedConfig struct {
+	current atomic.Pointer[Config]
+}
+
+// NewSharedConfig creates a shared config holding config
+func NewSharedConfig(config *Config) *SharedConfig {
+	sc := &SharedConfig{}
+	sc.current.Store(config)
+	return sc
+}
+
+// Load returns the config in use. It must not be modified.
+func (sc *SharedConfig) Load() *Config {
+	return sc.current.Load()
+}
+
+// Store makes config the one in use
+func (sc *SharedConfig) Store(config *Config) {
+	sc.current.Store(config)
+}
+
+// ConfigReloader applies a config saved from the admin page to the running
+// components, so that common changes don't need the process to exit and be
+// restarted. Receiver callsign and locator, dry_run and mqtt.instances are
+// applied in place; settings read from the config on each use take effect
+// by themselves. Anything else needs a restart.
+type ConfigReloader struct {
+	mqttClient *MQTTClient
+	aggregator *SpotAggregator
+	stats      *StatisticsTracker
+	wsprNet    *WSPRNet
+
+	pskReporter *PSKReporter // nil if disabled
+	demo        bool         // Demo mode forces dry run and feeds its own instance list
+}
+
+// NewConfigReloader creates a reloader for the running components
+func NewConfigReloader(mqttClient *MQTTClient, aggregator *SpotAggregator, stats *StatisticsTracker, wsprNet *WSPRNet, pskReporter *PSKReporter, demo bool) *ConfigReloader {
+	return &ConfigReloader{
+		mqttClient:  mqttClient,
+		aggregator:  aggregator,
+		stats:       stats,
+		wsprNet:     wsprNet,
+		pskReporter: pskReporter,
+		demo:        demo,
+	}
+}
+
+// instanceNames returns the names of the configured instances
+func instanceNames(instances []InstanceConfig) []string {
+	names := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		names = append(names, inst.Name)
+	}
+	return names
+}
+
+// instancePreferences returns the dedup preferences of the instances that set any
+func instancePreferences(instances []InstanceConfig) map[string]InstancePreference {
+	preferences := make(map[string]InstancePreference)
+	for _, inst := range instances {
+		if inst.Priority != 0 || inst.SNRHandicap != 0 {
+			preferences[inst.Name] = InstancePreference{Priority: inst.Priority, SNRHandicap: inst.SNRHandicap}
+			log.Printf("Dedup preference for %s: priority %d, SNR handicap +%d dB", inst.Name, inst.Priority, inst.SNRHandicap)
+		}
+	}
+	return preferences
+}
+
+// RestartReasons lists the settings that differ between old and new and
+// can't be applied while running, by config key. Empty means Apply can make
+// the change.
+func (cr *ConfigReloader) RestartReasons(old, new *Config) []string {
+	a, b := *old, *new
+
+	// Applied in place by Apply
+	b.MQTT.Instances, b.MQTT.TopicPrefixes = a.MQTT.Instances, a.MQTT.TopicPrefixes
+	b.Receiver.Callsign, b.Receiver.Locator = a.Receiver.Callsign, a.Receiver.Locator
+	b.DryRun = a.DryRun
+	// Read from the config on each use
+	b.AdminPassword = a.AdminPassword
+	b.RestartOnSave = a.RestartOnSave
+	b.AllowedOrigins = a.AllowedOrigins
+	b.APIKey = a.APIKey
+	b.AdminSessionHours = a.AdminSessionHours
+
+	var reasons []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			key, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("yaml"), ",")
+			reasons = append(reasons, key)
+		}
+	}
+
+	receiverChanged := old.Receiver.Callsign != new.Receiver.Callsign || old.Receiver.Locator != new.Receiver.Locator
+	if receiverChanged && (cr.pskReporter != nil || old.Grayline || old.Backfill.Enabled || old.WSPRNet.Reconcile.Enabled) {
+		reasons = append(reasons, "receiver (also used by PSKReporter, grayline, backfill or reconcile)")
+	}
+	if cr.demo && !reflect.DeepEqual(old.MQTT.Instances, new.MQTT.Instances) {
+		reasons = append(reasons, "mqtt.instances (demo mode)")
+	}
+	return reasons
+}
+
+// Prepare adjusts a new config for how the process is running, before it
+// is put in place
+func (cr *ConfigReloader) Prepare(new *Config) {
+	if cr.demo {
+		new.DryRun = true
+	}
+}
+
+// Apply makes the changes from old to new that RestartReasons allows. The
+// shared config must already hold new.
+func (cr *ConfigReloader) Apply(old, new *Config) {
+	if new.Receiver.Locator != old.Receiver.Locator {
+		cr.stats.SetReceiverLocation(new.Receiver.Locator)
+	}
+	if new.Receiver.Callsign != old.Receiver.Callsign || new.Receiver.Locator != old.Receiver.Locator {
+		cr.wsprNet.SetReceiver(new.Receiver.Callsign, new.Receiver.Locator)
+	}
+
+	if new.DryRun != old.DryRun {
+		cr.wsprNet.SetDryRun(new.DryRun)
+		if cr.pskReporter != nil {
+			cr.pskReporter.SetDryRun(new.DryRun)
+		}
+	}
+
+	if !reflect.DeepEqual(old.MQTT.Instances, new.MQTT.Instances) {
+		cr.aggregator.UpdateInstances(instanceNames(new.MQTT.Instances), instancePreferences(new.MQTT.Instances))
+		cr.mqttClient.ReloadInstances()
+		log.Printf("Config: Now monitoring %d instance(s)", len(new.MQTT.Instances))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultRestartGuardSeconds is how long (seconds) the first start after a
+// config change must run before the change is considered good
+const DefaultRestartGuardSeconds = 120
+
+// restartMarkerSuffix is appended to the config file path to name the marker
+const restartMarkerSuffix = ".changed"
+
+// restartMarker records a config change made through the admin interface that
+// has not yet been followed by a start that stayed up
+type restartMarker struct {
+	ChangedAt time.Time `json:"changed_at"`
+	Source    string    `json:"source"` // What changed the config: "update", "import" or "kiwi_sync"
+	Starts    int       `json:"starts"` // Starts since the change
+}
+
+// RestartGuard detects a config change that leaves the application crashing
+// on startup. The admin interface writes a marker when it saves a config and
+// exits for a restart. The first start after that removes the marker once it
+// has run for the guard period; if the marker is still there on the next
+// start, that start crashed or was killed early and the application comes up
+// in safe mode instead, with only the web server and admin interface running.
+type RestartGuard struct {
+	path   string
+	marker *restartMarker
+}
+
+// markConfigChanged writes the marker for a config change about to trigger a restart
+func markConfigChanged(configFile, source string) {
+	data, err := json.Marshal(restartMarker{ChangedAt: time.Now().UTC(), Source: source})
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(configFile+restartMarkerSuffix, data, 0644); err != nil {
+		log.Printf("Warning: Failed to write restart marker: %v", err)
+	}
+}
+
+// CheckRestartGuard reads the marker for configFile and records this start.
+// It returns a guard whose SafeMode reports whether this start should be in
+// safe mode.
+func CheckRestartGuard(configFile string) *RestartGuard {
+	g := &RestartGuard{path: configFile + restartMarkerSuffix}
+
+	data, err := os.ReadFile(g.path)
+	if os.IsNotExist(err) {
+		return g
+	}
+	var marker restartMarker
+	if err == nil {
+		err = json.Unmarshal(data, &marker)
+	}
+	if err != nil {
+		log.Printf("Warning: Ignoring unreadable restart marker %s: %v", g.path, err)
+		os.Remove(g.path)
+		return g
+	}
+
+	marker.Starts++
+	g.marker = &marker
+	if marker.Starts == 1 {
+		if data, err := json.Marshal(marker); err == nil {
+			if err := os.WriteFile(g.path, data, 0644); err != nil {
+				log.Printf("Warning: Failed to update restart marker: %v", err)
+			}
+		}
+	}
+	return g
+}
+
+// SafeMode reports whether the previous start after a config change failed to
+// stay up, so this start should not connect to MQTT or submit spots
+func (g *RestartGuard) SafeMode() bool {
+	return g.marker != nil && g.marker.Starts > 1
+}
+
+// Reason describes why safe mode is active
+func (g *RestartGuard) Reason() string {
+	if !g.SafeMode() {
+		return ""
+	}
+	return fmt.Sprintf("the first start after the config change at %s (%s) did not stay up",
+		g.marker.ChangedAt.Format(time.RFC3339), g.marker.Source)
+}
+
+// Watch removes the marker once this start has run for the guard period, if it
+// is the first start after a change. It does nothing in safe mode, so the
+// application stays in safe mode until the config is saved again.
+func (g *RestartGuard) Watch(period time.Duration) {
+	if g.marker == nil || g.SafeMode() {
+		return
+	}
+	go func() {
+		time.Sleep(period)
+		g.Clear()
+		log.Printf("Config change at %s has run for %s, restart guard cleared", g.marker.ChangedAt.Format(time.RFC3339), period)
+	}()
+}
+
+// Clear removes the marker. Called on a clean shutdown too, since a start that
+// is stopped deliberately did not crash.
+func (g *RestartGuard) Clear() {
+	if g.marker == nil || g.SafeMode() {
+		return
+	}
+	if err := os.Remove(g.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to remove restart marker: %v", err)
+	}
+}
+
+// runSafeMode serves the dashboard and admin interface without connecting to
+// MQTT or submitting anything, until the process is stopped or the config is
+// saved from the admin interface (which restarts the application)
+func runSafeMode(config *Config, configFile string, guard *RestartGuard) {
+	log.Printf("*** SAFE MODE: %s ***", guard.Reason())
+	log.Printf("*** MQTT and submissions are disabled. Fix the configuration in the admin interface, or delete %s and restart ***", guard.path)
+
+	// Not connected, so nothing is ever submitted
+	wsprNet, err := NewWSPRNet(config.WSPRNet.URL, config.Receiver.Callsign, config.Receiver.Locator, "UberSDR", "", true)
+	if err != nil {
+		log.Fatalf("Failed to initialize WSPRNet: %v", err)
+	}
+
+	// Statistics are not loaded or saved, so the persisted history is left untouched
+	stats := NewStatisticsTracker()
+	defer stats.Close()
+	aggregator := NewSpotAggregator(wsprNet, nil, stats, "", nil, DefaultDedupWindow*time.Second)
+
+	webServer := NewWebServer(stats, aggregator, wsprNet, NewSharedConfig(config), config.WebPort, configFile, nil, nil)
+	webServer.SetSafeMode(guard.Reason())
+	if err := webServer.Start(); err != nil {
+		log.Fatalf("Failed to start web server: %v", err)
+	}
+	log.Printf("Web dashboard available at http://localhost:%d", config.WebPort)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+	log.Println("Shutting down...")
+}
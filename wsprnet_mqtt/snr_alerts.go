@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Minimum baseline windows with SNR data before a band/instance is checked,
+// so a freshly started receiver does not alert on its first few windows
+const snrAlertMinBaseline = 5
+
+// Number of recent alerts kept for /api/snr-alerts
+const snrAlertHistorySize = 50
+
+// SNRAlert describes a sudden change in a band's average SNR on one instance
+type SNRAlert struct {
+	Time        time.Time `json:"time"`
+	WindowTime  time.Time `json:"window_time"`
+	Band        string    `json:"band"`
+	Instance    string    `json:"instance"`
+	Kind        string    `json:"kind"` // "drop" or "spike"
+	AverageSNR  float64   `json:"average_snr"`
+	BaselineSNR float64   `json:"baseline_snr"`
+	Deviation   float64   `json:"deviation"` // AverageSNR - BaselineSNR in dB
+	SNRCount    int       `json:"snr_count"`
+}
+
+// SNRAlertMonitor compares each window's per-band average SNR with a trailing
+// baseline taken from the SNR history and raises an alert when it moves by
+// more than the configured threshold
+type SNRAlertMonitor struct {
+	config SNRAlertConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	lastAlert map[string]time.Time // "band_instance" -> time of last alert
+	recent    []SNRAlert
+}
+
+// NewSNRAlertMonitor creates a monitor from validated configuration
+func NewSNRAlertMonitor(config SNRAlertConfig) *SNRAlertMonitor {
+	if config.WebhookURL != "" {
+		log.Printf("SNR alerts: enabled (threshold %.1f dB over %d windows), webhook %s",
+			config.ThresholdDB, config.BaselineWindows, config.WebhookURL)
+	} else {
+		log.Printf("SNR alerts: enabled (threshold %.1f dB over %d windows), log only",
+			config.ThresholdDB, config.BaselineWindows)
+	}
+	return &SNRAlertMonitor{
+		config:    config,
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: outboundTransport()},
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// baselineSNR returns the SNR-count weighted average SNR over the last
+// BaselineWindows points that carried SNR data, and how many points were used
+func (m *SNRAlertMonitor) baselineSNR(history []SNRHistoryPoint) (float64, int) {
+	var total float64
+	var weight, points int
+	for i := len(history) - 1; i >= 0 && points < m.config.BaselineWindows; i-- {
+		if history[i].SNRCount == 0 {
+			continue
+		}
+		total += history[i].AverageSNR * float64(history[i].SNRCount)
+		weight += history[i].SNRCount
+		points++
+	}
+	if weight == 0 {
+		return 0, 0
+	}
+	return total / float64(weight), points
+}
+
+// check compares a new history point against the points before it and raises
+// an alert if the deviation exceeds the threshold. previous must not include point.
+func (m *SNRAlertMonitor) check(band, instance string, point SNRHistoryPoint, previous []SNRHistoryPoint) {
+	if point.SNRCount < m.config.MinSpots {
+		return
+	}
+	baseline, points := m.baselineSNR(previous)
+	if points < snrAlertMinBaseline {
+		return
+	}
+
+	deviation := point.AverageSNR - baseline
+	kind := ""
+	switch {
+	case deviation <= -m.config.ThresholdDB:
+		kind = "drop"
+	case deviation >= m.config.ThresholdDB:
+		kind = "spike"
+	default:
+		return
+	}
+
+	key := band + "_" + instance
+	now := time.Now()
+	cooldown := time.Duration(m.config.CooldownMinutes) * time.Minute
+
+	m.mu.Lock()
+	if last, ok := m.lastAlert[key]; ok && now.Sub(last) < cooldown {
+		m.mu.Unlock()
+		return
+	}
+	m.lastAlert[key] = now
+
+	alert := SNRAlert{
+		Time:        now,
+		WindowTime:  point.WindowTime,
+		Band:        band,
+		Instance:    instance,
+		Kind:        kind,
+		AverageSNR:  point.AverageSNR,
+		BaselineSNR: baseline,
+		Deviation:   deviation,
+		SNRCount:    point.SNRCount,
+	}
+	m.recent = append(m.recent, alert)
+	if len(m.recent) > snrAlertHistorySize {
+		m.recent = m.recent[1:]
+	}
+	m.mu.Unlock()
+
+	logFields{"instance": instance, "band": band}.Printf("SNR alert: %s on %s (%s) - average %.1f dB vs baseline %.1f dB (%+.1f dB, %d spots)",
+		kind, band, instance, point.AverageSNR, baseline, deviation, point.SNRCount)
+
+	if m.config.WebhookURL != "" {
+		go m.sendWebhook(alert)
+	}
+}
+
+// sendWebhook posts an alert as JSON to the configured webhook URL
+func (m *SNRAlertMonitor) sendWebhook(alert SNRAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("SNR alerts: Failed to marshal webhook payload: %v", err)
+		return
+	}
+
+	resp, err := m.client.Post(m.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("SNR alerts: Webhook request failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("SNR alerts: Webhook returned %s", resp.Status)
+	}
+}
+
+// Recent returns a copy of the most recent alerts, oldest first
+func (m *SNRAlertMonitor) Recent() []SNRAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]SNRAlert, len(m.recent))
+	copy(result, m.recent)
+	return result
+}
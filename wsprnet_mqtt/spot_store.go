@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spot log storage backends (spot_storage)
+const (
+	SpotStorageJSONL  = "jsonl"  // One JSON Lines file per instance plus deduped.jsonl (default)
+	SpotStorageSQLite = "sqlite" // Indexed tables in spots.db
+)
+
+// spotStore keeps the spot logs on disk. SpotWriter serializes every write and
+// answers queries from its in-memory cache of the last 24 hours unless the
+// store is also a spotQuerier.
+type spotStore interface {
+	// load returns the raw spots by instance and the deduped spots newer than
+	// cutoff, oldest first
+	load(cutoff time.Time) (map[string][]StoredSpot, []StoredSpot, error)
+	writeRaw(instance string, spot StoredSpot) error
+	writeQuarantined(spot StoredSpot) error
+	writeDeduped(spot StoredSpot) error
+	// updateDeduped records a new submission outcome for a deduped spot that
+	// has already been written
+	updateDeduped(spot StoredSpot) error
+	// prune drops spots not newer than cutoff. raw and deduped are the spots
+	// still held in memory, for a store that keeps no more than the cache.
+	prune(cutoff time.Time, raw map[string][]StoredSpot, deduped []StoredSpot) error
+	// clear deletes every stored spot, quarantined ones included
+	clear() error
+	close() error
+}
+
+// spotQuerier is a spotStore that answers spot queries itself, over every spot
+// it keeps rather than only the cached 24 hours. Time ranges are inclusive and
+// a zero time leaves that end open; an empty instance or band matches all.
+type spotQuerier interface {
+	queryRaw(instance, band string, startTime, endTime time.Time) ([]StoredSpot, error)
+	queryDeduped(band string, startTime, endTime time.Time, submitted *bool) ([]StoredSpot, error)
+	// queryCallsign returns the raw spots of a callsign since startTime
+	queryCallsign(callsign string, startTime time.Time) ([]StoredSpot, error)
+	// queryCycle returns the deduped spots of a callsign in one WSPR cycle
+	queryCycle(callsign string, cycle time.Time) ([]StoredSpot, error)
+}
+
+// newSpotStore opens the spot logs in baseDir in the given format
+func newSpotStore(baseDir, storage string, loadWorkers int) (spotStore, error) {
+	switch storage {
+	case SpotStorageJSONL, "":
+		return newJSONLSpotStore(baseDir, loadWorkers)
+	case SpotStorageSQLite:
+		return newSQLiteSpotStore(filepath.Join(baseDir, SpotDatabaseFile))
+	default:
+		return nil, fmt.Errorf("unknown spot storage %q", storage)
+	}
+}
+
+// jsonlSpotStore appends spots to JSON Lines files: instance_<name>.jsonl for
+// raw spots and deduped.jsonl for deduped ones, where a submission update is
+// appended as a new record that replaces the earlier one when loaded
+type jsonlSpotStore struct {
+	baseDir     string
+	loadWorkers int
+	files       map[string]*os.File // instance name -> file handle
+	dedupedFile *os.File
+
+	// Opened on first use and never pruned
+	quarantineFile *os.File
+}
+
+// newJSONLSpotStore opens the JSON Lines spot logs in baseDir. loadWorkers
+// bounds how many files load reads concurrently.
+func newJSONLSpotStore(baseDir string, loadWorkers int) (*jsonlSpotStore, error) {
+	s := &jsonlSpotStore{
+		baseDir:     baseDir,
+		loadWorkers: loadWorkers,
+		files:       make(map[string]*os.File),
+	}
+	if err := s.openDeduped(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openDeduped opens deduped.jsonl for appending
+func (s *jsonlSpotStore) openDeduped() error {
+	dedupedPath := filepath.Join(s.baseDir, "deduped.jsonl")
+	f, err := os.OpenFile(dedupedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open deduped file: %w", err)
+	}
+	s.dedupedFile = f
+	return nil
+}
+
+// writeRaw appends a raw spot to its instance file
+func (s *jsonlSpotStore) writeRaw(instance string, spot StoredSpot) error {
+	// Open file if not already open
+	if s.files[instance] == nil {
+		filename := fmt.Sprintf("instance_%s.jsonl", instance)
+		path := filepath.Join(s.baseDir, filename)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open instance file: %w", err)
+		}
+		s.files[instance] = f
+	}
+
+	// Write to file
+	data, err := json.Marshal(spot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spot: %w", err)
+	}
+
+	if _, err := s.files[instance].Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write spot: %w", err)
+	}
+
+	// Flush to ensure data is written
+	if err := s.files[instance].Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return nil
+}
+
+// writeQuarantined appends a spot to the quarantine file
+func (s *jsonlSpotStore) writeQuarantined(spot StoredSpot) error {
+	if s.quarantineFile == nil {
+		f, err := os.OpenFile(filepath.Join(s.baseDir, QuarantineFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open quarantine file: %w", err)
+		}
+		s.quarantineFile = f
+	}
+
+	data, err := json.Marshal(spot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spot: %w", err)
+	}
+	if _, err := s.quarantineFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write quarantined spot: %w", err)
+	}
+	return nil
+}
+
+// writeDeduped appends a record to the deduped file
+func (s *jsonlSpotStore) writeDeduped(spot StoredSpot) error {
+	data, err := json.Marshal(spot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deduped spot: %w", err)
+	}
+
+	if _, err := s.dedupedFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write deduped spot: %w", err)
+	}
+
+	// Flush to ensure data is written
+	if err := s.dedupedFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync deduped file: %w", err)
+	}
+	return nil
+}
+
+// updateDeduped appends the updated record; the last record for a spot wins
+// when the file is loaded
+func (s *jsonlSpotStore) updateDeduped(spot StoredSpot) error {
+	return s.writeDeduped(spot)
+}
+
+// load reads the spot files, up to loadWorkers at a time
+func (s *jsonlSpotStore) load(cutoff time.Time) (map[string][]StoredSpot, []StoredSpot, error) {
+	start := time.Now()
+	raw := make(map[string][]StoredSpot)
+	deduped := make([]StoredSpot, 0)
+
+	// Load instance files
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return raw, deduped, fmt.Errorf("failed to read spots directory: %w", err)
+	}
+
+	var filenames []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		filename := entry.Name()
+		if filename == "deduped.jsonl" ||
+			(len(filename) > 9 && filename[:9] == "instance_" && filename[len(filename)-6:] == ".jsonl") {
+			filenames = append(filenames, filename)
+		}
+	}
+	if len(filenames) == 0 {
+		return raw, deduped, nil
+	}
+
+	loadWorkers := s.loadWorkers
+	if loadWorkers < 1 {
+		loadWorkers = 1
+	}
+	if loadWorkers > len(filenames) {
+		loadWorkers = len(filenames)
+	}
+
+	jobs := make(chan string)
+	var loaded, totalSpots int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < loadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filename := range jobs {
+				instance, spots := s.loadFile(filename, cutoff)
+
+				mu.Lock()
+				if filename == "deduped.jsonl" {
+					deduped = spots
+				} else {
+					raw[instance] = spots
+				}
+				loaded++
+				totalSpots += len(spots)
+				log.Printf("Loading spots: %d/%d files (%s: %d spots)", loaded, len(filenames), filename, len(spots))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, filename := range filenames {
+		jobs <- filename
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("Loaded %d spots from %d files in %s using %d workers",
+		totalSpots, len(filenames), time.Since(start).Round(time.Millisecond), loadWorkers)
+	return raw, deduped, nil
+}
+
+// loadFile loads one spot file and returns the instance it is for (empty for
+// deduped.jsonl) and the spots kept. Safe to call from several goroutines.
+func (s *jsonlSpotStore) loadFile(filename string, cutoff time.Time) (string, []StoredSpot) {
+	path := filepath.Join(s.baseDir, filename)
+
+	if filename == "deduped.jsonl" {
+		// Load deduped spots
+		spots, err := loadSpotsFromFile(path, cutoff)
+		if err != nil {
+			log.Printf("Warning: Failed to load deduped spots: %v", err)
+			return "", []StoredSpot{}
+		}
+		return "", mergeDedupedUpdates(spots)
+	}
+
+	// Extract instance name
+	instanceName := filename[9 : len(filename)-6]
+
+	// Load instance spots
+	spots, err := loadSpotsFromFile(path, cutoff)
+	if err != nil {
+		logFields{"instance": instanceName}.Printf("Warning: Failed to load spots for instance %s: %v", instanceName, err)
+		return instanceName, []StoredSpot{}
+	}
+	return instanceName, spots
+}
+
+// mergeDedupedUpdates collapses submission updates appended by UpdateSubmission,
+// keeping the last record for each spot in its original position. The instance
+// is part of the key so dedup-exempt callsigns keep one record per instance.
+func mergeDedupedUpdates(spots []StoredSpot) []StoredSpot {
+	index := make(map[string]int, len(spots))
+	merged := make([]StoredSpot, 0, len(spots))
+	for _, spot := range spots {
+		key := dedupedKey(spot.Callsign, spot.Band, spot.Timestamp) + "_" + spot.Instance
+		if i, exists := index[key]; exists {
+			merged[i] = spot
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, spot)
+	}
+	return merged
+}
+
+// loadSpotsFromFile loads spots from a JSONL file, filtering to last 24 hours
+func loadSpotsFromFile(path string, cutoff time.Time) ([]StoredSpot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []StoredSpot{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var spots []StoredSpot
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var spot StoredSpot
+		if err := json.Unmarshal(scanner.Bytes(), &spot); err != nil {
+			log.Printf("Warning: Failed to parse spot line: %v", err)
+			continue
+		}
+
+		// Only keep spots from last 24 hours
+		if spot.Timestamp.After(cutoff) {
+			spots = append(spots, spot)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return spots, nil
+}
+
+// prune rewrites all files with only the spots in memory (last 24 hours)
+func (s *jsonlSpotStore) prune(cutoff time.Time, raw map[string][]StoredSpot, deduped []StoredSpot) error {
+	// Rewrite instance files
+	for instance, spots := range raw {
+		filename := fmt.Sprintf("instance_%s.jsonl", instance)
+		path := filepath.Join(s.baseDir, filename)
+
+		if err := rewriteSpotFile(path, spots); err != nil {
+			logFields{"instance": instance}.Printf("Warning: Failed to rewrite file for instance %s: %v", instance, err)
+		}
+	}
+
+	// Rewrite deduped file
+	dedupedPath := filepath.Join(s.baseDir, "deduped.jsonl")
+	if err := rewriteSpotFile(dedupedPath, deduped); err != nil {
+		return fmt.Errorf("failed to rewrite deduped file: %w", err)
+	}
+	return nil
+}
+
+// rewriteSpotFile rewrites a file with the given spots
+func rewriteSpotFile(path string, spots []StoredSpot) error {
+	// Write to temporary file first
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	for _, spot := range spots {
+		data, err := json.Marshal(spot)
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Rename temporary file to actual file
+	return os.Rename(tmpPath, path)
+}
+
+// clear deletes every spot file and reopens an empty deduped file
+func (s *jsonlSpotStore) clear() error {
+	// Close all open files
+	s.closeFiles()
+	s.files = make(map[string]*os.File)
+
+	// Delete all spot files
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read spots directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		filename := entry.Name()
+		// Delete all .jsonl files (instance files, deduped file and quarantine file)
+		if strings.HasSuffix(filename, ".jsonl") {
+			path := filepath.Join(s.baseDir, filename)
+			if err := os.Remove(path); err != nil {
+				log.Printf("Warning: Failed to delete spot file %s: %v", filename, err)
+			} else {
+				log.Printf("Deleted spot file: %s", filename)
+			}
+		}
+	}
+
+	// Reopen deduped file
+	if err := s.openDeduped(); err != nil {
+		return fmt.Errorf("failed to reopen deduped file: %w", err)
+	}
+	return nil
+}
+
+// closeFiles closes every open spot file
+func (s *jsonlSpotStore) closeFiles() {
+	for _, f := range s.files {
+		f.Close()
+	}
+	if s.dedupedFile != nil {
+		s.dedupedFile.Close()
+		s.dedupedFile = nil
+	}
+	if s.quarantineFile != nil {
+		s.quarantineFile.Close()
+		s.quarantineFile = nil
+	}
+}
+
+// close closes all files
+func (s *jsonlSpotStore) close() error {
+	s.closeFiles()
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go driver, so builds without cgo still work
+)
+
+// SpotDatabaseFile is the file in the spots directory that holds the spot logs
+// when spot_storage is "sqlite"
+const SpotDatabaseFile = "spots.db"
+
+// DefaultSpotRetentionDays is how long spots.db keeps spots unless
+// spot_retention_days says otherwise
+const DefaultSpotRetentionDays = 30
+
+// rawColumns are the columns of a raw spot, in the order spotValues returns
+// them and scanSpot reads them. timestamp is in Unix seconds.
+const rawColumns = `instance, timestamp, callsign, locator, snr, frequency, band, dbm, drift, dt, country`
+
+// dedupedColumns add the submission outcome, confidence and grayline flag to
+// rawColumns
+const dedupedColumns = rawColumns + `, submitted, pending, error, confidence, grayline`
+
+// spotColumnDefs declares rawColumns in every spot table
+const spotColumnDefs = `
+	instance TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	callsign TEXT NOT NULL,
+	locator TEXT NOT NULL,
+	snr INTEGER NOT NULL,
+	frequency INTEGER NOT NULL,
+	band TEXT NOT NULL,
+	dbm INTEGER NOT NULL,
+	drift INTEGER NOT NULL,
+	dt REAL NOT NULL,
+	country TEXT NOT NULL`
+
+// sqliteSchema creates the spot tables. Raw and deduped spots are indexed for
+// the time, instance, band and callsign queries the API makes; a deduped spot
+// is unique per callsign, band, cycle and instance, as in the JSONL file.
+// Quarantined spots are only kept for review.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS raw_spots (` + spotColumnDefs + `
+);
+CREATE INDEX IF NOT EXISTS raw_spots_timestamp ON raw_spots (timestamp);
+CREATE INDEX IF NOT EXISTS raw_spots_instance ON raw_spots (instance, timestamp);
+CREATE INDEX IF NOT EXISTS raw_spots_callsign ON raw_spots (callsign COLLATE NOCASE, timestamp);
+
+CREATE TABLE IF NOT EXISTS deduped_spots (` + spotColumnDefs + `,
+	submitted INTEGER NOT NULL DEFAULT 0,
+	pending INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	confidence INTEGER NOT NULL DEFAULT 0,
+	grayline INTEGER,
+	UNIQUE (callsign, band, timestamp, instance)
+);
+CREATE INDEX IF NOT EXISTS deduped_spots_timestamp ON deduped_spots (timestamp);
+CREATE INDEX IF NOT EXISTS deduped_spots_band ON deduped_spots (band, timestamp);
+CREATE INDEX IF NOT EXISTS deduped_spots_callsign ON deduped_spots (callsign COLLATE NOCASE, timestamp);
+
+CREATE TABLE IF NOT EXISTS quarantined_spots (` + spotColumnDefs + `
+);
+`
+
+// sqliteSpotStore keeps the spot logs in an SQLite database and answers spot
+// queries from it
+type sqliteSpotStore struct {
+	db *sql.DB
+}
+
+// newSQLiteSpotStore opens or creates the spot database at path
+func newSQLiteSpotStore(path string) (*sqliteSpotStore, error) {
+	// WAL lets the database be read with other tools while spots are written
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spot database: %w", err)
+	}
+	// SpotWriter serializes writes; one connection keeps them in order
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create spot tables in %s: %w", path, err)
+	}
+	return &sqliteSpotStore{db: db}, nil
+}
+
+// spotValues returns the rawColumns values of spot
+func spotValues(instance string, spot StoredSpot) []interface{} {
+	return []interface{}{
+		instance, spot.Timestamp.Unix(), spot.Callsign, spot.Locator, spot.SNR, int64(spot.Frequency),
+		spot.Band, spot.DBm, spot.Drift, float64(spot.DT), spot.Country,
+	}
+}
+
+// dedupedValues returns the dedupedColumns values of spot
+func dedupedValues(spot StoredSpot) []interface{} {
+	var errorMsg interface{}
+	if spot.Error != nil {
+		errorMsg = *spot.Error
+	}
+	var grayline interface{}
+	if spot.Grayline != nil {
+		grayline = *spot.Grayline
+	}
+	return append(spotValues(spot.Instance, spot), spot.Submitted, spot.Pending, errorMsg, spot.Confidence, grayline)
+}
+
+// placeholders returns a parameter for each of columns
+func placeholders(columns string) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", strings.Count(columns, ",")+1), ", ")
+}
+
+// scanSpot reads a row selected with rawColumns, or dedupedColumns if deduped
+func scanSpot(rows *sql.Rows, deduped bool) (StoredSpot, error) {
+	var spot StoredSpot
+	var timestamp, frequency int64
+	var dt float64
+	var errorMsg sql.NullString
+	var grayline sql.NullBool
+	dest := []interface{}{&spot.Instance, &timestamp, &spot.Callsign, &spot.Locator, &spot.SNR, &frequency,
+		&spot.Band, &spot.DBm, &spot.Drift, &dt, &spot.Country}
+	if deduped {
+		dest = append(dest, &spot.Submitted, &spot.Pending, &errorMsg, &spot.Confidence, &grayline)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return spot, err
+	}
+	spot.Timestamp = time.Unix(timestamp, 0)
+	spot.Frequency = uint64(frequency)
+	spot.DT = float32(dt)
+	if errorMsg.Valid {
+		spot.Error = &errorMsg.String
+	}
+	if grayline.Valid {
+		spot.Grayline = &grayline.Bool
+	}
+	return spot, nil
+}
+
+// writeRaw inserts a raw spot
+func (s *sqliteSpotStore) writeRaw(instance string, spot StoredSpot) error {
+	_, err := s.db.Exec(`INSERT INTO raw_spots (`+rawColumns+`) VALUES (`+placeholders(rawColumns)+`)`,
+		spotValues(instance, spot)...)
+	if err != nil {
+		return fmt.Errorf("failed to write spot: %w", err)
+	}
+	return nil
+}
+
+// writeQuarantined inserts a spot outside every known band
+func (s *sqliteSpotStore) writeQuarantined(spot StoredSpot) error {
+	_, err := s.db.Exec(`INSERT INTO quarantined_spots (`+rawColumns+`) VALUES (`+placeholders(rawColumns)+`)`,
+		spotValues(spot.Instance, spot)...)
+	if err != nil {
+		return fmt.Errorf("failed to write quarantined spot: %w", err)
+	}
+	return nil
+}
+
+// writeDeduped inserts a deduped spot, replacing an earlier record of the same
+// spot as a reload of deduped.jsonl would
+func (s *sqliteSpotStore) writeDeduped(spot StoredSpot) error {
+	_, err := s.db.Exec(`INSERT INTO deduped_spots (`+dedupedColumns+`) VALUES (`+placeholders(dedupedColumns)+`)
+		ON CONFLICT (callsign, band, timestamp, instance) DO UPDATE SET
+			locator = excluded.locator, snr = excluded.snr, frequency = excluded.frequency,
+			dbm = excluded.dbm, drift = excluded.drift, dt = excluded.dt, country = excluded.country,
+			submitted = excluded.submitted, pending = excluded.pending, error = excluded.error,
+			confidence = excluded.confidence, grayline = excluded.grayline`,
+		dedupedValues(spot)...)
+	if err != nil {
+		return fmt.Errorf("failed to write deduped spot: %w", err)
+	}
+	return nil
+}
+
+// updateDeduped sets the submission outcome of a deduped spot
+func (s *sqliteSpotStore) updateDeduped(spot StoredSpot) error {
+	var errorMsg interface{}
+	if spot.Error != nil {
+		errorMsg = *spot.Error
+	}
+	_, err := s.db.Exec(`UPDATE deduped_spots SET submitted = ?, pending = ?, error = ?
+		WHERE callsign = ? AND band = ? AND timestamp = ? AND instance = ?`,
+		spot.Submitted, spot.Pending, errorMsg, spot.Callsign, spot.Band, spot.Timestamp.Unix(), spot.Instance)
+	if err != nil {
+		return fmt.Errorf("failed to update deduped spot: %w", err)
+	}
+	return nil
+}
+
+// querySpots runs a SELECT of rawColumns, or dedupedColumns if deduped, and
+// returns the spots
+func (s *sqliteSpotStore) querySpots(deduped bool, query string, args ...interface{}) ([]StoredSpot, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spots := make([]StoredSpot, 0)
+	for rows.Next() {
+		spot, err := scanSpot(rows, deduped)
+		if err != nil {
+			return nil, err
+		}
+		spots = append(spots, spot)
+	}
+	return spots, rows.Err()
+}
+
+// load reads the spots newer than cutoff in the order they were written
+func (s *sqliteSpotStore) load(cutoff time.Time) (map[string][]StoredSpot, []StoredSpot, error) {
+	start := time.Now()
+	raw := make(map[string][]StoredSpot)
+	deduped := make([]StoredSpot, 0)
+
+	spots, err := s.querySpots(false, `SELECT `+rawColumns+` FROM raw_spots WHERE timestamp > ? ORDER BY rowid`, cutoff.Unix())
+	if err != nil {
+		return raw, deduped, fmt.Errorf("failed to read raw spots: %w", err)
+	}
+	for _, spot := range spots {
+		raw[spot.Instance] = append(raw[spot.Instance], spot)
+	}
+
+	deduped, err = s.querySpots(true, `SELECT `+dedupedColumns+` FROM deduped_spots WHERE timestamp > ? ORDER BY rowid`, cutoff.Unix())
+	if err != nil {
+		return raw, make([]StoredSpot, 0), fmt.Errorf("failed to read deduped spots: %w", err)
+	}
+
+	log.Printf("Loaded %d raw and %d deduped spots from %s in %s",
+		len(spots), len(deduped), SpotDatabaseFile, time.Since(start).Round(time.Millisecond))
+	return raw, deduped, nil
+}
+
+// spotFilter collects the conditions of a spot query
+type spotFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add adds a condition with its arguments
+func (f *spotFilter) add(condition string, args ...interface{}) {
+	f.conditions = append(f.conditions, condition)
+	f.args = append(f.args, args...)
+}
+
+// timeRange adds the bounds of an inclusive time range; zero means unbounded
+func (f *spotFilter) timeRange(startTime, endTime time.Time) {
+	if !startTime.IsZero() {
+		f.add("timestamp >= ?", startTime.Unix())
+	}
+	if !endTime.IsZero() {
+		f.add("timestamp <= ?", endTime.Unix())
+	}
+}
+
+// where returns the WHERE clause, empty without conditions
+func (f *spotFilter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// queryRaw returns the raw spots of instance on band between startTime and
+// endTime, oldest first
+func (s *sqliteSpotStore) queryRaw(instance, band string, startTime, endTime time.Time) ([]StoredSpot, error) {
+	var f spotFilter
+	if instance != "" {
+		f.add("instance = ?", instance)
+	}
+	if band != "" {
+		f.add("band = ?", band)
+	}
+	f.timeRange(startTime, endTime)
+	return s.querySpots(false, `SELECT `+rawColumns+` FROM raw_spots`+f.where()+` ORDER BY timestamp, rowid`, f.args...)
+}
+
+// queryDeduped returns the deduped spots on band between startTime and
+// endTime, oldest first, optionally only those with the given submitted flag
+func (s *sqliteSpotStore) queryDeduped(band string, startTime, endTime time.Time, submitted *bool) ([]StoredSpot, error) {
+	var f spotFilter
+	if band != "" {
+		f.add("band = ?", band)
+	}
+	f.timeRange(startTime, endTime)
+	if submitted != nil {
+		f.add("submitted = ?", *submitted)
+	}
+	return s.querySpots(true, `SELECT `+dedupedColumns+` FROM deduped_spots`+f.where()+` ORDER BY timestamp, rowid`, f.args...)
+}
+
+// queryCallsign returns the raw spots of callsign, in any case, since
+// startTime, oldest first
+func (s *sqliteSpotStore) queryCallsign(callsign string, startTime time.Time) ([]StoredSpot, error) {
+	return s.querySpots(false, `SELECT `+rawColumns+` FROM raw_spots
+		WHERE callsign = ? COLLATE NOCASE AND timestamp >= ? ORDER BY timestamp, instance`,
+		callsign, startTime.Unix())
+}
+
+// queryCycle returns the deduped spots of callsign, in any case, in the WSPR
+// cycle starting at cycle
+func (s *sqliteSpotStore) queryCycle(callsign string, cycle time.Time) ([]StoredSpot, error) {
+	return s.querySpots(true, `SELECT `+dedupedColumns+` FROM deduped_spots
+		WHERE callsign = ? COLLATE NOCASE AND timestamp >= ? AND timestamp < ? ORDER BY rowid`,
+		callsign, cycle.Unix(), cycle.Unix()+120)
+}
+
+// prune deletes raw and deduped spots not newer than cutoff
+func (s *sqliteSpotStore) prune(cutoff time.Time, _ map[string][]StoredSpot, _ []StoredSpot) error {
+	for _, table := range []string{"raw_spots", "deduped_spots"} {
+		if _, err := s.db.Exec(`DELETE FROM `+table+` WHERE timestamp <= ?`, cutoff.Unix()); err != nil {
+			return fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// clear deletes every spot
+func (s *sqliteSpotStore) clear() error {
+	for _, table := range []string{"raw_spots", "deduped_spots", "quarantined_spots"} {
+		if _, err := s.db.Exec(`DELETE FROM ` + table); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	log.Printf("Deleted all spots from %s", SpotDatabaseFile)
+	return nil
+}
+
+// close closes the database
+func (s *sqliteSpotStore) close() error {
+	return s.db.Close()
+}
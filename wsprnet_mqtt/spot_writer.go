@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,19 +26,42 @@ type StoredSpot struct {
 	// Fields only for deduped spots
 	Instance  string  `json:"instance,omitempty"`  // Winning instance name
 	Submitted bool    `json:"submitted,omitempty"` // True if HTTP request succeeded
+	Pending   bool    `json:"pending,omitempty"`   // Queued for WSPRNet, outcome not yet known
 	Error     *string `json:"error,omitempty"`     // Error message if submission failed
+
+	// Confidence score from 1 to 100 (see spotConfidence); 0 for raw spots and
+	// deduped spots recorded before it was added
+	Confidence int `json:"confidence,omitempty"`
+
+	// Whether both the receiver and the transmitter were on the grayline at
+	// spot time; only set on deduped spots when grayline is enabled
+	Grayline *bool `json:"grayline,omitempty"`
 }
 
-// SpotWriter manages writing spots to files
+// dedupedKey identifies a deduped spot: one per callsign, band and cycle
+func dedupedKey(callsign, band string, timestamp time.Time) string {
+	return fmt.Sprintf("%s_%s_%d", callsign, band, timestamp.Unix())
+}
+
+// SpotWriter manages writing spots to the spot logs
 type SpotWriter struct {
-	baseDir     string
-	files       map[string]*os.File // instance name -> file handle
-	dedupedFile *os.File
-	mu          sync.Mutex
+	store spotStore // JSONL files or SQLite database (spot_storage)
+	mu    sync.Mutex
+
+	// Set when the store answers queries itself (SQLite); JSONL queries are
+	// answered from the cache
+	querier spotQuerier
+
+	// How long the store keeps spots: 24 hours for JSONL, spot_retention_days
+	// for SQLite
+	retention time.Duration
 
 	// In-memory cache for queries (last 24 hours)
 	rawSpots     map[string][]StoredSpot // instance name -> spots
 	dedupedSpots []StoredSpot
+	// dedupedKey -> positions in dedupedSpots. A dedup-exempt callsign has
+	// one deduped spot per instance, so a key can match several.
+	dedupedIndex map[string][]int
 	cacheMu      sync.RWMutex
 
 	// Control
@@ -47,39 +69,53 @@ type SpotWriter struct {
 	wg       sync.WaitGroup
 }
 
-// NewSpotWriter creates a new spot writer
-func NewSpotWriter(baseDir string) (*SpotWriter, error) {
+// DefaultSpotLoadWorkers is the number of spot files read concurrently at startup
+const DefaultSpotLoadWorkers = 4
+
+// NewSpotWriter creates a new spot writer keeping its logs in baseDir in the
+// given storage format (SpotStorageJSONL or SpotStorageSQLite). An SQLite
+// database keeps retentionDays of spots; JSONL files keep 24 hours.
+// loadWorkers bounds how many existing JSONL files are read concurrently while
+// loading the last 24 hours.
+func NewSpotWriter(baseDir, storage string, retentionDays, loadWorkers int) (*SpotWriter, error) {
 	// Create base directory if it doesn't exist
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create spots directory: %w", err)
 	}
 
-	sw := &SpotWriter{
-		baseDir:      baseDir,
-		files:        make(map[string]*os.File),
-		rawSpots:     make(map[string][]StoredSpot),
-		dedupedSpots: make([]StoredSpot, 0),
-		stopChan:     make(chan struct{}),
+	store, err := newSpotStore(baseDir, storage, loadWorkers)
+	if err != nil {
+		return nil, err
 	}
 
-	// Open deduped file
-	dedupedPath := filepath.Join(baseDir, "deduped.jsonl")
-	f, err := os.OpenFile(dedupedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open deduped file: %w", err)
+	sw := &SpotWriter{
+		store:     store,
+		retention: 24 * time.Hour,
+		stopChan:  make(chan struct{}),
+	}
+	if querier, ok := store.(spotQuerier); ok {
+		sw.querier = querier
+		if retentionDays > 0 {
+			sw.retention = time.Duration(retentionDays) * 24 * time.Hour
+		}
 	}
-	sw.dedupedFile = f
 
-	// Load existing spots from files
-	if err := sw.loadExistingSpots(); err != nil {
+	// Load existing spots
+	sw.rawSpots, sw.dedupedSpots, err = store.load(time.Now().Add(-24 * time.Hour))
+	if err != nil {
 		log.Printf("Warning: Failed to load existing spots: %v", err)
 	}
+	sw.indexDeduped()
 
 	// Start cleanup goroutine
 	sw.wg.Add(1)
 	go sw.cleanupOldSpots()
 
-	log.Printf("Spot writer initialized (directory: %s)", baseDir)
+	if storage == SpotStorageSQLite {
+		log.Printf("Spot writer initialized (database: %s, keeping %s)", filepath.Join(baseDir, SpotDatabaseFile), sw.retention)
+	} else {
+		log.Printf("Spot writer initialized (directory: %s)", baseDir)
+	}
 	return sw, nil
 }
 
@@ -93,17 +129,6 @@ func (sw *SpotWriter) WriteRaw(spot *WSPRReportWithSource) error {
 		instanceName = "unknown"
 	}
 
-	// Open file if not already open
-	if sw.files[instanceName] == nil {
-		filename := fmt.Sprintf("instance_%s.jsonl", instanceName)
-		path := filepath.Join(sw.baseDir, filename)
-		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open instance file: %w", err)
-		}
-		sw.files[instanceName] = f
-	}
-
 	// Create stored spot
 	stored := StoredSpot{
 		Timestamp: spot.EpochTime,
@@ -119,19 +144,8 @@ func (sw *SpotWriter) WriteRaw(spot *WSPRReportWithSource) error {
 		Instance:  spot.InstanceName,
 	}
 
-	// Write to file
-	data, err := json.Marshal(stored)
-	if err != nil {
-		return fmt.Errorf("failed to marshal spot: %w", err)
-	}
-
-	if _, err := sw.files[instanceName].Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write spot: %w", err)
-	}
-
-	// Flush to ensure data is written
-	if err := sw.files[instanceName].Sync(); err != nil {
-		return fmt.Errorf("failed to sync file: %w", err)
+	if err := sw.store.writeRaw(instanceName, stored); err != nil {
+		return err
 	}
 
 	// Add to in-memory cache
@@ -142,8 +156,36 @@ func (sw *SpotWriter) WriteRaw(spot *WSPRReportWithSource) error {
 	return nil
 }
 
-// WriteDeduped writes a deduped spot with submission status
-func (sw *SpotWriter) WriteDeduped(spot *WSPRReportWithSource, submitted bool, errorMsg string) error {
+// QuarantineFile is the file in the spots directory that holds spots on
+// frequencies outside every known band, with JSONL storage
+const QuarantineFile = "unknown_band.jsonl"
+
+// WriteQuarantined stores a spot whose frequency is outside every known band
+// in the quarantine file or table. Quarantined spots are never pruned and are
+// not loaded into the spot cache.
+func (sw *SpotWriter) WriteQuarantined(spot *WSPRReportWithSource) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	stored := StoredSpot{
+		Timestamp: spot.EpochTime,
+		Callsign:  spot.Callsign,
+		Locator:   spot.Locator,
+		SNR:       spot.SNR,
+		Frequency: spot.ReceiverFreq,
+		Band:      frequencyToBand(spot.ReceiverFreq),
+		DBm:       spot.DBm,
+		Drift:     spot.Drift,
+		DT:        spot.DT,
+		Country:   spot.Country,
+		Instance:  spot.InstanceName,
+	}
+	return sw.store.writeQuarantined(stored)
+}
+
+// WriteDeduped writes a deduped spot with submission status. Spots written with
+// pending set are updated by UpdateSubmission once WSPRNet reports the outcome.
+func (sw *SpotWriter) WriteDeduped(spot *WSPRReportWithSource, submitted, pending bool, errorMsg string) error {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
@@ -161,115 +203,71 @@ func (sw *SpotWriter) WriteDeduped(spot *WSPRReportWithSource, submitted bool, e
 		Country:   spot.Country,
 		Instance:  spot.InstanceName,
 		Submitted: submitted,
+		Pending:   pending,
+
+		Confidence: spot.confidence,
+		Grayline:   spot.grayline,
 	}
 
 	if errorMsg != "" {
 		stored.Error = &errorMsg
 	}
 
-	// Write to file
-	data, err := json.Marshal(stored)
-	if err != nil {
-		return fmt.Errorf("failed to marshal deduped spot: %w", err)
-	}
-
-	if _, err := sw.dedupedFile.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write deduped spot: %w", err)
-	}
-
-	// Flush to ensure data is written
-	if err := sw.dedupedFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync deduped file: %w", err)
+	if err := sw.store.writeDeduped(stored); err != nil {
+		return err
 	}
 
 	// Add to in-memory cache
 	sw.cacheMu.Lock()
+	key := dedupedKey(stored.Callsign, stored.Band, stored.Timestamp)
+	sw.dedupedIndex[key] = append(sw.dedupedIndex[key], len(sw.dedupedSpots))
 	sw.dedupedSpots = append(sw.dedupedSpots, stored)
 	sw.cacheMu.Unlock()
 
 	return nil
 }
 
-// loadExistingSpots loads spots from existing files into memory
-func (sw *SpotWriter) loadExistingSpots() error {
-	cutoff := time.Now().Add(-24 * time.Hour)
-
-	// Load instance files
-	entries, err := os.ReadDir(sw.baseDir)
-	if err != nil {
-		return fmt.Errorf("failed to read spots directory: %w", err)
-	}
+// UpdateSubmission records the final WSPRNet outcome for deduped spots that were
+// written as pending. With JSONL storage the updated record is appended to the
+// deduped file; when the file is loaded the last record for a spot wins. Matches
+// the SubmissionResultFunc signature so it can be registered with
+// WSPRNet.SetResultCallback.
+func (sw *SpotWriter) UpdateSubmission(reports []WSPRReport, submitted bool, errorMsg string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
 
-	for _, entry := range entries {
-		if entry.IsDir() {
+	sw.cacheMu.Lock()
+	var updated []StoredSpot
+	done := make(map[string]bool, len(reports))
+	for _, report := range reports {
+		key := dedupedKey(report.Callsign, frequencyToBand(report.ReceiverFreq), report.EpochTime)
+		if done[key] {
 			continue
 		}
-
-		filename := entry.Name()
-		path := filepath.Join(sw.baseDir, filename)
-
-		if filename == "deduped.jsonl" {
-			// Load deduped spots
-			spots, err := sw.loadSpotsFromFile(path, cutoff)
-			if err != nil {
-				log.Printf("Warning: Failed to load deduped spots: %v", err)
-				continue
+		done[key] = true
+		for _, i := range sw.dedupedIndex[key] {
+			spot := &sw.dedupedSpots[i]
+			spot.Submitted = submitted
+			spot.Pending = false
+			spot.Error = nil
+			if errorMsg != "" {
+				msg := errorMsg
+				spot.Error = &msg
 			}
-			sw.dedupedSpots = spots
-			log.Printf("Loaded %d deduped spots from file", len(spots))
-		} else if len(filename) > 9 && filename[:9] == "instance_" && filename[len(filename)-6:] == ".jsonl" {
-			// Extract instance name
-			instanceName := filename[9 : len(filename)-6]
-
-			// Load instance spots
-			spots, err := sw.loadSpotsFromFile(path, cutoff)
-			if err != nil {
-				log.Printf("Warning: Failed to load spots for instance %s: %v", instanceName, err)
-				continue
-			}
-			sw.rawSpots[instanceName] = spots
-			log.Printf("Loaded %d spots for instance %s", len(spots), instanceName)
-		}
-	}
-
-	return nil
-}
-
-// loadSpotsFromFile loads spots from a JSONL file, filtering to last 24 hours
-func (sw *SpotWriter) loadSpotsFromFile(path string, cutoff time.Time) ([]StoredSpot, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []StoredSpot{}, nil
+			updated = append(updated, *spot)
 		}
-		return nil, err
 	}
-	defer file.Close()
-
-	var spots []StoredSpot
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		var spot StoredSpot
-		if err := json.Unmarshal(scanner.Bytes(), &spot); err != nil {
-			log.Printf("Warning: Failed to parse spot line: %v", err)
-			continue
-		}
+	sw.cacheMu.Unlock()
 
-		// Only keep spots from last 24 hours
-		if spot.Timestamp.After(cutoff) {
-			spots = append(spots, spot)
+	for _, spot := range updated {
+		if err := sw.store.updateDeduped(spot); err != nil {
+			logFields{"callsign": spot.Callsign}.Printf("Warning: Failed to record submission result for %s: %v", spot.Callsign, err)
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	return spots, nil
 }
 
-// cleanupOldSpots periodically removes spots older than 24 hours
+// cleanupOldSpots periodically removes spots older than 24 hours from memory
+// and those past the retention from the spot logs
 func (sw *SpotWriter) cleanupOldSpots() {
 	defer sw.wg.Done()
 
@@ -286,9 +284,11 @@ func (sw *SpotWriter) cleanupOldSpots() {
 	}
 }
 
-// performCleanup removes spots older than 24 hours from memory and rewrites files
+// performCleanup removes spots older than 24 hours from memory, then those
+// past the retention from the spot logs
 func (sw *SpotWriter) performCleanup() {
-	cutoff := time.Now().Add(-24 * time.Hour)
+	now := time.Now()
+	cutoff := now.Add(-24 * time.Hour)
 
 	sw.cacheMu.Lock()
 	defer sw.cacheMu.Unlock()
@@ -312,72 +312,65 @@ func (sw *SpotWriter) performCleanup() {
 		}
 	}
 	sw.dedupedSpots = filtered
+	sw.indexDeduped()
 
-	// Rewrite files (do this in background to avoid blocking)
-	go sw.rewriteFiles()
+	// Prune the spot logs (do this in background to avoid blocking)
+	go sw.pruneStore(now.Add(-sw.retention))
 
-	log.Printf("Cleanup: Kept spots from last 24 hours (cutoff: %s)", cutoff.Format("2006-01-02 15:04:05"))
+	logDebugf("Cleanup: Kept spots from last 24 hours (cutoff: %s)", cutoff.Format("2006-01-02 15:04:05"))
 }
 
-// rewriteFiles rewrites all files with only the spots in memory (last 24 hours)
-func (sw *SpotWriter) rewriteFiles() {
+// indexDeduped rebuilds dedupedIndex from dedupedSpots. Caller must hold cacheMu
+// or be the constructor.
+func (sw *SpotWriter) indexDeduped() {
+	sw.dedupedIndex = make(map[string][]int, len(sw.dedupedSpots))
+	for i, spot := range sw.dedupedSpots {
+		key := dedupedKey(spot.Callsign, spot.Band, spot.Timestamp)
+		sw.dedupedIndex[key] = append(sw.dedupedIndex[key], i)
+	}
+}
+
+// pruneStore drops the spots not newer than cutoff from the spot logs
+func (sw *SpotWriter) pruneStore(cutoff time.Time) {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
 	sw.cacheMu.RLock()
 	defer sw.cacheMu.RUnlock()
 
-	// Rewrite instance files
-	for instance, spots := range sw.rawSpots {
-		filename := fmt.Sprintf("instance_%s.jsonl", instance)
-		path := filepath.Join(sw.baseDir, filename)
-
-		if err := sw.rewriteFile(path, spots); err != nil {
-			log.Printf("Warning: Failed to rewrite file for instance %s: %v", instance, err)
-		}
+	if err := sw.store.prune(cutoff, sw.rawSpots, sw.dedupedSpots); err != nil {
+		log.Printf("Warning: Failed to prune spot logs: %v", err)
 	}
+}
 
-	// Rewrite deduped file
-	dedupedPath := filepath.Join(sw.baseDir, "deduped.jsonl")
-	if err := sw.rewriteFile(dedupedPath, sw.dedupedSpots); err != nil {
-		log.Printf("Warning: Failed to rewrite deduped file: %v", err)
+// allFilter maps the "all" value of an instance or band filter to no filter
+func allFilter(value string) string {
+	if value == "all" {
+		return ""
 	}
+	return value
 }
 
-// rewriteFile rewrites a file with the given spots
-func (sw *SpotWriter) rewriteFile(path string, spots []StoredSpot) error {
-	// Write to temporary file first
-	tmpPath := path + ".tmp"
-	f, err := os.Create(tmpPath)
-	if err != nil {
-		return err
+// queryStart is where a store query starts: startTime, or the 24 hours in
+// the cache if unset
+func queryStart(startTime time.Time) time.Time {
+	if startTime.IsZero() {
+		return time.Now().Add(-24 * time.Hour)
 	}
+	return startTime
+}
 
-	for _, spot := range spots {
-		data, err := json.Marshal(spot)
-		if err != nil {
-			f.Close()
-			os.Remove(tmpPath)
-			return err
-		}
-		if _, err := f.Write(append(data, '\n')); err != nil {
-			f.Close()
-			os.Remove(tmpPath)
-			return err
+// GetRawSpots returns raw spots for an instance with optional filters. With
+// SQLite storage a start time can reach back over the whole retention.
+func (sw *SpotWriter) GetRawSpots(instance, band string, startTime, endTime time.Time) []StoredSpot {
+	if sw.querier != nil {
+		spots, err := sw.querier.queryRaw(allFilter(instance), allFilter(band), queryStart(startTime), endTime)
+		if err == nil {
+			return spots
 		}
+		log.Printf("Warning: Failed to query raw spots, using the last 24 hours in memory: %v", err)
 	}
 
-	if err := f.Close(); err != nil {
-		os.Remove(tmpPath)
-		return err
-	}
-
-	// Rename temporary file to actual file
-	return os.Rename(tmpPath, path)
-}
-
-// GetRawSpots returns raw spots for an instance with optional filters
-func (sw *SpotWriter) GetRawSpots(instance, band string, startTime, endTime time.Time) []StoredSpot {
 	sw.cacheMu.RLock()
 	defer sw.cacheMu.RUnlock()
 
@@ -395,8 +388,29 @@ func (sw *SpotWriter) GetRawSpots(instance, band string, startTime, endTime time
 	return sw.filterSpots(spots, band, startTime, endTime)
 }
 
-// GetDedupedSpots returns deduped spots with optional filters
+// RawSpotsSnapshot returns the cached raw spots of one instance, oldest
+// first, and whether the instance has any. Spots are only ever appended to
+// the cache, and cleanup replaces the slice rather than changing it, so the
+// result can be read after the lock is released without holding up writers.
+func (sw *SpotWriter) RawSpotsSnapshot(instance string) ([]StoredSpot, bool) {
+	sw.cacheMu.RLock()
+	defer sw.cacheMu.RUnlock()
+
+	spots, ok := sw.rawSpots[instance]
+	return spots[:len(spots):len(spots)], ok
+}
+
+// GetDedupedSpots returns deduped spots with optional filters. With SQLite
+// storage a start time can reach back over the whole retention.
 func (sw *SpotWriter) GetDedupedSpots(band string, startTime, endTime time.Time, submittedOnly *bool) []StoredSpot {
+	if sw.querier != nil {
+		spots, err := sw.querier.queryDeduped(allFilter(band), queryStart(startTime), endTime, submittedOnly)
+		if err == nil {
+			return spots
+		}
+		log.Printf("Warning: Failed to query deduped spots, using the last 24 hours in memory: %v", err)
+	}
+
 	sw.cacheMu.RLock()
 	defer sw.cacheMu.RUnlock()
 
@@ -416,6 +430,62 @@ func (sw *SpotWriter) GetDedupedSpots(band string, startTime, endTime time.Time,
 	return spots
 }
 
+// GetCallsignSpots returns every raw spot of a callsign across all instances
+// in the last 24 hours, oldest first
+func (sw *SpotWriter) GetCallsignSpots(callsign string) []StoredSpot {
+	if sw.querier != nil {
+		spots, err := sw.querier.queryCallsign(callsign, queryStart(time.Time{}))
+		if err == nil {
+			return spots
+		}
+		log.Printf("Warning: Failed to query spots of %s, using the last 24 hours in memory: %v", callsign, err)
+	}
+
+	sw.cacheMu.RLock()
+	var spots []StoredSpot
+	for _, instanceSpots := range sw.rawSpots {
+		for _, spot := range instanceSpots {
+			if strings.EqualFold(spot.Callsign, callsign) {
+				spots = append(spots, spot)
+			}
+		}
+	}
+	sw.cacheMu.RUnlock()
+
+	sort.Slice(spots, func(i, j int) bool {
+		if spots[i].Timestamp.Equal(spots[j].Timestamp) {
+			return spots[i].Instance < spots[j].Instance
+		}
+		return spots[i].Timestamp.Before(spots[j].Timestamp)
+	})
+	return spots
+}
+
+// FindDeduped returns the deduped spots for a callsign in the WSPR cycle
+// containing t (one per band the callsign was heard on). With SQLite storage
+// the cycle can be anywhere in the retention.
+func (sw *SpotWriter) FindDeduped(callsign string, t time.Time) []StoredSpot {
+	cycle := (t.Unix() / 120) * 120
+	if sw.querier != nil {
+		spots, err := sw.querier.queryCycle(callsign, time.Unix(cycle, 0))
+		if err == nil {
+			return spots
+		}
+		log.Printf("Warning: Failed to query spots of %s, using the last 24 hours in memory: %v", callsign, err)
+	}
+
+	sw.cacheMu.RLock()
+	defer sw.cacheMu.RUnlock()
+
+	var matches []StoredSpot
+	for _, spot := range sw.dedupedSpots {
+		if (spot.Timestamp.Unix()/120)*120 == cycle && strings.EqualFold(spot.Callsign, callsign) {
+			matches = append(matches, spot)
+		}
+	}
+	return matches
+}
+
 // filterSpots applies band and time range filters
 func (sw *SpotWriter) filterSpots(spots []StoredSpot, band string, startTime, endTime time.Time) []StoredSpot {
 	filtered := make([]StoredSpot, 0, len(spots))
@@ -626,53 +696,17 @@ func (sw *SpotWriter) ClearAllSpots() error {
 	// Clear in-memory caches
 	sw.rawSpots = make(map[string][]StoredSpot)
 	sw.dedupedSpots = make([]StoredSpot, 0)
+	sw.indexDeduped()
 
-	// Close all open files
-	for _, f := range sw.files {
-		f.Close()
-	}
-	sw.files = make(map[string]*os.File)
-
-	if sw.dedupedFile != nil {
-		sw.dedupedFile.Close()
-	}
-
-	// Delete all spot files
-	entries, err := os.ReadDir(sw.baseDir)
-	if err != nil {
-		return fmt.Errorf("failed to read spots directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		filename := entry.Name()
-		// Delete all .jsonl files (instance files and deduped file)
-		if len(filename) > 6 && filename[len(filename)-6:] == ".jsonl" {
-			path := filepath.Join(sw.baseDir, filename)
-			if err := os.Remove(path); err != nil {
-				log.Printf("Warning: Failed to delete spot file %s: %v", filename, err)
-			} else {
-				log.Printf("Deleted spot file: %s", filename)
-			}
-		}
-	}
-
-	// Reopen deduped file
-	dedupedPath := filepath.Join(sw.baseDir, "deduped.jsonl")
-	f, err := os.OpenFile(dedupedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to reopen deduped file: %w", err)
+	if err := sw.store.clear(); err != nil {
+		return err
 	}
-	sw.dedupedFile = f
 
 	log.Println("All spot logs cleared successfully")
 	return nil
 }
 
-// Stop stops the spot writer and closes all files
+// Stop stops the spot writer and closes the spot logs
 func (sw *SpotWriter) Stop() {
 	close(sw.stopChan)
 	sw.wg.Wait()
@@ -680,14 +714,8 @@ func (sw *SpotWriter) Stop() {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
-	// Close all instance files
-	for _, f := range sw.files {
-		f.Close()
-	}
-
-	// Close deduped file
-	if sw.dedupedFile != nil {
-		sw.dedupedFile.Close()
+	if err := sw.store.close(); err != nil {
+		log.Printf("Warning: Failed to close spot logs: %v", err)
 	}
 
 	log.Println("Spot writer stopped")
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testSpot returns a 20m report of callsign heard by instance at t
+func testSpot(instance, callsign string, t time.Time) *WSPRReportWithSource {
+	return &WSPRReportWithSource{
+		WSPRReport: &WSPRReport{
+			Callsign:     callsign,
+			Locator:      "FN31pr",
+			SNR:          -14,
+			HasSNR:       true,
+			Frequency:    14097100,
+			ReceiverFreq: 14097100,
+			DBm:          37,
+			Drift:        -1,
+			DT:           0.5,
+			EpochTime:    t,
+			Mode:         "WSPR",
+		},
+		InstanceName: instance,
+		Country:      "United States",
+	}
+}
+
+// storedSpots reads everything a fresh store finds in dir, however old
+func storedSpots(t *testing.T, dir, storage string) (map[string][]StoredSpot, []StoredSpot) {
+	t.Helper()
+
+	store, err := newSpotStore(dir, storage, 1)
+	if err != nil {
+		t.Fatalf("newSpotStore: %v", err)
+	}
+	defer store.close()
+	raw, deduped, err := store.load(time.Time{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return raw, deduped
+}
+
+func TestSpotWriterStorage(t *testing.T) {
+	for _, storage := range []string{SpotStorageJSONL, SpotStorageSQLite} {
+		t.Run(storage, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now().Truncate(2 * time.Minute)
+			old := now.Add(-25 * time.Hour)
+
+			sw, err := NewSpotWriter(dir, storage, DefaultSpotRetentionDays, 1)
+			if err != nil {
+				t.Fatalf("NewSpotWriter: %v", err)
+			}
+			for _, spot := range []*WSPRReportWithSource{
+				testSpot("kiwi1", "K1ABC", old),
+				testSpot("kiwi1", "K1ABC", now),
+				testSpot("kiwi_2", "K1ABC", now),
+				testSpot("kiwi_2", "K1XYZ", now),
+			} {
+				if err := sw.WriteRaw(spot); err != nil {
+					t.Fatalf("WriteRaw: %v", err)
+				}
+			}
+
+			grayline := true
+			submitted := testSpot("kiwi1", "K1ABC", now)
+			submitted.confidence = 87
+			submitted.grayline = &grayline
+			if err := sw.WriteDeduped(submitted, false, true, ""); err != nil {
+				t.Fatalf("WriteDeduped: %v", err)
+			}
+			if err := sw.WriteDeduped(testSpot("kiwi_2", "K1XYZ", now), false, true, ""); err != nil {
+				t.Fatalf("WriteDeduped: %v", err)
+			}
+			if err := sw.WriteDeduped(testSpot("kiwi1", "K1OLD", old), true, false, ""); err != nil {
+				t.Fatalf("WriteDeduped: %v", err)
+			}
+			sw.UpdateSubmission([]WSPRReport{*submitted.WSPRReport}, true, "")
+			sw.UpdateSubmission([]WSPRReport{*testSpot("kiwi_2", "K1XYZ", now).WSPRReport}, false, "upload failed after 3 retries")
+
+			quarantined := testSpot("kiwi1", "K1ABC", now)
+			quarantined.ReceiverFreq = 27555000
+			if err := sw.WriteQuarantined(quarantined); err != nil {
+				t.Fatalf("WriteQuarantined: %v", err)
+			}
+			sw.Stop()
+
+			// Reopened, the writer has the last 24 hours with the final outcomes
+			sw, err = NewSpotWriter(dir, storage, DefaultSpotRetentionDays, 1)
+			if err != nil {
+				t.Fatalf("reopen NewSpotWriter: %v", err)
+			}
+			defer func() { sw.Stop() }()
+
+			if raw := sw.GetRawSpots("kiwi1", "", time.Time{}, time.Time{}); len(raw) != 1 || !raw[0].Timestamp.Equal(now) {
+				t.Errorf("kiwi1 raw spots = %+v, want the one from the last 24 hours", raw)
+			}
+			raw := sw.GetRawSpots("kiwi_2", "20m", time.Time{}, time.Time{})
+			if len(raw) != 2 || raw[0].Callsign != "K1ABC" || raw[1].Callsign != "K1XYZ" {
+				t.Fatalf("kiwi_2 raw spots = %+v, want K1ABC then K1XYZ", raw)
+			}
+			want := StoredSpot{
+				Timestamp: now, Callsign: "K1ABC", Locator: "FN31pr", SNR: -14, Frequency: 14097100,
+				Band: "20m", DBm: 37, Drift: -1, DT: 0.5, Country: "United States", Instance: "kiwi_2",
+			}
+			if got := raw[0]; !got.Timestamp.Equal(want.Timestamp) {
+				t.Errorf("raw spot time = %s, want %s", got.Timestamp, want.Timestamp)
+			} else {
+				got.Timestamp = want.Timestamp
+				if got != want {
+					t.Errorf("raw spot = %+v, want %+v", got, want)
+				}
+			}
+
+			deduped := sw.GetDedupedSpots("", time.Time{}, time.Time{}, nil)
+			if len(deduped) != 2 {
+				t.Fatalf("deduped spots = %+v, want 2", deduped)
+			}
+			if d := deduped[0]; d.Callsign != "K1ABC" || !d.Submitted || d.Pending || d.Error != nil ||
+				d.Confidence != 87 || d.Grayline == nil || !*d.Grayline {
+				t.Errorf("submitted deduped spot = %+v, want submitted with confidence 87 on the grayline", d)
+			}
+			if d := deduped[1]; d.Callsign != "K1XYZ" || d.Submitted || d.Pending || d.Error == nil ||
+				*d.Error != "upload failed after 3 retries" || d.Grayline != nil {
+				t.Errorf("failed deduped spot = %+v, want the upload error", d)
+			}
+
+			// Callsign lookups cover the last 24 hours in any case
+			if spots := sw.GetCallsignSpots("k1abc"); len(spots) != 2 || spots[0].Instance != "kiwi1" || spots[1].Instance != "kiwi_2" {
+				t.Errorf("k1abc spots = %+v, want kiwi1's then kiwi_2's", spots)
+			}
+
+			// Only the database answers for spots older than the cache
+			older := 0
+			if storage == SpotStorageSQLite {
+				older = 1
+			}
+			since := now.Add(-48 * time.Hour)
+			if got := len(sw.GetRawSpots("kiwi1", "all", since, time.Time{})); got != 1+older {
+				t.Errorf("kiwi1 raw spots in 48 hours = %d, want %d", got, 1+older)
+			}
+			submittedOnly := true
+			if got := len(sw.GetDedupedSpots("20m", since, time.Time{}, &submittedOnly)); got != 1+older {
+				t.Errorf("submitted deduped spots in 48 hours = %d, want %d", got, 1+older)
+			}
+			if got := len(sw.FindDeduped("k1old", old.Add(time.Minute))); got != older {
+				t.Errorf("K1OLD deduped spots in its cycle = %d, want %d", got, older)
+			}
+
+			// Pruning drops what is older than the cutoff from the store too
+			allRaw, allDeduped := storedSpots(t, dir, storage)
+			sw.pruneStore(now.Add(-24 * time.Hour))
+			prunedRaw, prunedDeduped := storedSpots(t, dir, storage)
+			if len(allRaw["kiwi1"]) != 2 || len(allDeduped) != 3 {
+				t.Errorf("before pruning: %d kiwi1 raw and %d deduped spots stored, want 2 and 3", len(allRaw["kiwi1"]), len(allDeduped))
+			}
+			if len(prunedRaw["kiwi1"]) != 1 || len(prunedRaw["kiwi_2"]) != 2 || len(prunedDeduped) != 2 {
+				t.Errorf("after pruning: raw %v, %d deduped spots, want 1 kiwi1, 2 kiwi_2 and 2 deduped", prunedRaw, len(prunedDeduped))
+			}
+
+			// Clearing empties the store
+			if err := sw.ClearAllSpots(); err != nil {
+				t.Fatalf("ClearAllSpots: %v", err)
+			}
+			if err := sw.WriteRaw(testSpot("kiwi1", "K1NEW", now)); err != nil {
+				t.Fatalf("WriteRaw after clearing: %v", err)
+			}
+			clearedRaw, clearedDeduped := storedSpots(t, dir, storage)
+			if len(clearedRaw) != 1 || len(clearedRaw["kiwi1"]) != 1 || len(clearedDeduped) != 0 {
+				t.Errorf("after clearing: raw %v, deduped %v, want only the spot written since", clearedRaw, clearedDeduped)
+			}
+		})
+	}
+}
+
+func TestNewSpotWriterUnknownStorage(t *testing.T) {
+	if sw, err := NewSpotWriter(t.TempDir(), "csv", DefaultSpotRetentionDays, 1); err == nil {
+		sw.Stop()
+		t.Fatal("NewSpotWriter with storage csv succeeded, want an error")
+	}
+}
+
+// TestUpdateSubmissionAfterCleanup records an outcome for a spot that moved in
+// the cache when older spots were cleaned up ahead of it
+func TestUpdateSubmissionAfterCleanup(t *testing.T) {
+	sw, err := NewSpotWriter(t.TempDir(), SpotStorageJSONL, DefaultSpotRetentionDays, 1)
+	if err != nil {
+		t.Fatalf("NewSpotWriter: %v", err)
+	}
+	defer sw.Stop()
+
+	now := time.Now().Truncate(2 * time.Minute)
+	for _, spot := range []*WSPRReportWithSource{
+		testSpot("kiwi1", "K1OLD", now.Add(-25*time.Hour)),
+		testSpot("kiwi1", "K1ABC", now),
+		testSpot("kiwi_2", "K1ABC", now), // Dedup-exempt: one deduped spot per instance
+	} {
+		if err := sw.WriteDeduped(spot, false, true, ""); err != nil {
+			t.Fatalf("WriteDeduped: %v", err)
+		}
+	}
+	sw.performCleanup()
+	sw.UpdateSubmission([]WSPRReport{*testSpot("kiwi1", "K1ABC", now).WSPRReport}, true, "")
+
+	deduped := sw.GetDedupedSpots("", time.Time{}, time.Time{}, nil)
+	if len(deduped) != 2 {
+		t.Fatalf("deduped spots after cleanup = %+v, want the 2 K1ABC spots", deduped)
+	}
+	for _, d := range deduped {
+		if d.Callsign != "K1ABC" || !d.Submitted || d.Pending {
+			t.Errorf("deduped spot = %+v, want K1ABC submitted", d)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,14 +15,20 @@ import (
 // InstanceStats tracks statistics for a single UberSDR instance
 type InstanceStats struct {
 	Name            string                        `json:"Name"`
+	DisplayName     string                        `json:"DisplayName,omitempty"` // Set from config when served, not persisted
 	TotalSpots      int                           `json:"TotalSpots"`
-	UniqueSpots     int                           `json:"UniqueSpots"` // Spots only this instance reported
-	BestSNRWins     int                           `json:"BestSNRWins"` // Times this instance had the best SNR
-	TiedSNR         int                           `json:"TiedSNR"`     // Times this instance tied for best SNR
+	UniqueSpots     int                           `json:"UniqueSpots"`  // Spots only this instance reported
+	BestSNRWins     int                           `json:"BestSNRWins"`  // Times this instance had the best SNR
+	TiedSNR         int                           `json:"TiedSNR"`      // Times this instance tied for best SNR
+	PriorityWins    int                           `json:"PriorityWins"` // BestSNRWins decided by priority/snr_handicap rather than raw SNR
 	BandStats       map[string]*BandInstanceStats `json:"BandStats"`
 	LastReportTime  time.Time                     `json:"LastReportTime"`
 	LastWindowTime  time.Time                     `json:"LastWindowTime"`
-	RecentCallsigns []string                      `json:"RecentCallsigns"` // Last 10 callsigns reported
+	RecentCallsigns []string                      `json:"RecentCallsigns"`           // Most recent callsigns reported (recent_callsigns, default 10)
+	Online          bool                          `json:"Online"`                    // Reported within the offline timeout; set when served
+	OnlineFraction  *float64                      `json:"OnlineFraction,omitempty"`  // Fraction of the last 24 hours online; set when served, nil if too little history
+	Software        string                        `json:"Software,omitempty"`        // Decoder software from the most recent decode, if reported
+	SoftwareVersion string                        `json:"SoftwareVersion,omitempty"` // Decoder version from the most recent decode, if reported
 }
 
 // BandInstanceStats tracks per-band statistics for an instance
@@ -29,6 +37,7 @@ type BandInstanceStats struct {
 	UniqueSpots     int            `json:"UniqueSpots"`
 	BestSNRWins     int            `json:"BestSNRWins"`
 	TiedSNR         int            `json:"TiedSNR"`
+	PriorityWins    int            `json:"PriorityWins"`
 	TiedWith        map[string]int `json:"TiedWith"`       // instance name -> tie count
 	DuplicatesWith  map[string]int `json:"DuplicatesWith"` // instance name -> duplicate count (all duplicates, not just ties)
 	AverageSNR      float64        `json:"AverageSNR"`
@@ -49,9 +58,20 @@ type CountryStats struct {
 	MinSNR          int
 	MaxSNR          int
 	TotalSNR        int
+	SNRCount        int // Spots that reported an SNR (Count includes those that didn't)
 	Count           int
 }
 
+// CountrySummary is a cross-band view of one country: how many bands it has
+// been heard on, a rough indicator of how well the path is propagating
+type CountrySummary struct {
+	Country         string   `json:"country"`
+	BandCount       int      `json:"band_count"`
+	Bands           []string `json:"bands"`            // In frequency order
+	UniqueCallsigns int      `json:"unique_callsigns"` // Across all bands
+	TotalSpots      int      `json:"total_spots"`
+}
+
 // SpotLocation represents a spot with location info for mapping
 type SpotLocation struct {
 	Callsign string   `json:"callsign"`
@@ -59,6 +79,57 @@ type SpotLocation struct {
 	Bands    []string `json:"bands"`
 	SNR      []int    `json:"snr"` // SNR values corresponding to each band
 	Country  string   `json:"country"`
+	// Instance name -> last time that instance heard this callsign. Used to
+	// hide spots on the live map once every instance that heard them is offline.
+	HeardBy map[string]time.Time `json:"heard_by,omitempty"`
+	// Path from the receiver, from the most precise grid heard for this callsign
+	DistanceKm    float64 `json:"distance_km,omitempty"`
+	Bearing       float64 `json:"bearing,omitempty"`        // Degrees true from the receiver
+	GridPrecision int     `json:"grid_precision,omitempty"` // Locator characters used: 4 or 6
+	// When any instance first and last heard this callsign. The spot is
+	// removed once LastHeard is older than the retention period.
+	FirstHeard time.Time `json:"first_heard"`
+	LastHeard  time.Time `json:"last_heard"`
+}
+
+// key returns the band and instance the snapshot is for, from its fields or,
+// in older files, from its "band_instance" map key. Band names never contain
+// an underscore, so the key splits at the first one.
+func (s *WindowSNRSnapshot) key(name string) (bandInstanceKey, bool) {
+	if s.Band != "" && s.Instance != "" {
+		return bandInstanceKey{band: s.Band, instance: s.Instance}, true
+	}
+	band, instance, ok := strings.Cut(name, "_")
+	if !ok || band == "" || instance == "" {
+		return bandInstanceKey{}, false
+	}
+	return bandInstanceKey{band: band, instance: instance}, true
+}
+
+// bandInstanceKey identifies one instance's data on one band
+type bandInstanceKey struct {
+	band, instance string
+}
+
+// String returns the key as "band_instance", as used in the persistence file
+func (k bandInstanceKey) String() string {
+	return k.band + "_" + k.instance
+}
+
+// windowSNRAccumulator sums one band and instance's SNR and distance over an
+// open window
+type windowSNRAccumulator struct {
+	totalSNR, count, snrCount    int
+	totalDistance, distanceCount int
+}
+
+// add sums other into a
+func (a *windowSNRAccumulator) add(other *windowSNRAccumulator) {
+	a.totalSNR += other.totalSNR
+	a.count += other.count
+	a.snrCount += other.snrCount
+	a.totalDistance += other.totalDistance
+	a.distanceCount += other.distanceCount
 }
 
 // WindowStats tracks statistics for a single submission window
@@ -72,6 +143,7 @@ type WindowStats struct {
 	TiedSNRByInstance map[string]int      // instance -> count of tied SNR
 	BandBreakdown     map[string]int      // band -> spot count
 	SubmittedAt       time.Time
+	Imported          bool `json:",omitempty"` // Backfilled from WSPRNet, not received or submitted locally
 }
 
 // PersistenceData contains all statistics data for saving/loading
@@ -82,9 +154,42 @@ type PersistenceData struct {
 	CountryStats     map[string]*CountryStatsExport          `json:"country_stats"`
 	MapSpots         map[string]*SpotLocation                `json:"map_spots"`
 	SNRHistory       map[string]map[string][]SNRHistoryPoint `json:"snr_history"`
+	FrequencyStats   map[string]*FrequencyStats              `json:"frequency_stats"`
 	TotalStats       OverallStats                            `json:"total_stats"`
 	WSPRNetStats     WSPRNetStats                            `json:"wsprnet_stats"`
 	PSKReporterStats PSKReporterStats                        `json:"pskreporter_stats"`
+
+	// Hourly spot counts per instance per country (hour -> instance -> country -> spots)
+	InstanceCountryHours map[int64]map[string]map[string]int `json:"instance_country_hours,omitempty"`
+
+	// In-progress window state, restored on startup if the file is recent
+	CurrentWindow    *WindowStats                  `json:"current_window,omitempty"`
+	CurrentWindowSNR map[string]*WindowSNRSnapshot `json:"current_window_snr,omitempty"`
+}
+
+// WindowSNRSnapshot is a serializable copy of the SNR and distance accumulated
+// for one band and instance in an open window
+type WindowSNRSnapshot struct {
+	// Start of the window (Unix seconds); 0 in files saved before it was added
+	Window int64 `json:"window,omitempty"`
+
+	// Files saved before these were added only have the "band_instance" map key
+	Band     string `json:"band,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	TotalSNR      int `json:"total_snr"`
+	Count         int `json:"count"`
+	SNRCount      int `json:"snr_count"`
+	TotalDistance int `json:"total_distance"`
+	DistanceCount int `json:"distance_count"`
+}
+
+// inProgressRestoreMaxAge is how old a persistence file may be for its
+// in-progress window state to be restored: the deduplication window plus a
+// minute (5 minutes by default). Older partial data would be attributed to the
+// wrong window.
+func (st *StatisticsTracker) inProgressRestoreMaxAge() time.Duration {
+	return st.dedupWindow + time.Minute
 }
 
 // WSPRNetStats contains WSPRNet submission statistics
@@ -97,6 +202,7 @@ type WSPRNetStats struct {
 // PSKReporterStats contains PSKReporter submission statistics
 type PSKReporterStats struct {
 	Successful int `json:"successful"`
+	Failed     int `json:"failed"`
 }
 
 // CountryStatsExport is a serializable version of CountryStats
@@ -107,20 +213,45 @@ type CountryStatsExport struct {
 	MinSNR          int      `json:"min_snr"`
 	MaxSNR          int      `json:"max_snr"`
 	TotalSNR        int      `json:"total_snr"`
+	SNRCount        int      `json:"snr_count"`
 	Count           int      `json:"count"`
 }
 
 // OverallStats contains overall statistics
 type OverallStats struct {
-	TotalSubmitted  int `json:"total_submitted"`
-	TotalDuplicates int `json:"total_duplicates"`
-	TotalUnique     int `json:"total_unique"`
+	TotalSubmitted  int            `json:"total_submitted"`
+	TotalDuplicates int            `json:"total_duplicates"`
+	TotalUnique     int            `json:"total_unique"`
+	HashedCallsigns map[string]int `json:"hashed_callsigns,omitempty"` // Band -> unresolved "<...>" decodes
+	TotalImported   int            `json:"total_imported,omitempty"`   // Spots backfilled from WSPRNet
+}
+
+// Transmit frequency histogram covers the 200 Hz WSPR passband in 10 Hz bins
+const (
+	freqHistogramStart = 1400 // Hz above dial
+	freqHistogramWidth = 10   // Hz per bin
+	freqHistogramBins  = 20
+)
+
+// FrequencyStats tracks where in a band's WSPR passband stations transmit.
+// Offsets are in Hz relative to the band's nominal WSPR dial frequency.
+type FrequencyStats struct {
+	Band        string `json:"band"`
+	DialFreq    uint64 `json:"dial_frequency"`
+	MinOffset   int64  `json:"min_offset"`
+	MaxOffset   int64  `json:"max_offset"`
+	TotalOffset int64  `json:"total_offset"`
+	Count       int    `json:"count"`
+	Histogram   []int  `json:"histogram"` // freqHistogramBins bins starting at freqHistogramStart
+	Below       int    `json:"below"`     // Offsets below the histogram range
+	Above       int    `json:"above"`     // Offsets above the histogram range
 }
 
 // SNRHistoryPoint represents average SNR for an instance on a band at a specific time
 type SNRHistoryPoint struct {
 	WindowTime      time.Time `json:"window_time"`
 	AverageSNR      float64   `json:"average_snr"`
+	SNRCount        int       `json:"snr_count"` // Spots that contributed to AverageSNR
 	SpotCount       int       `json:"spot_count"`
 	AverageDistance float64   `json:"average_distance"` // Average distance in km for this window
 	DistanceCount   int       `json:"distance_count"`   // Number of spots with valid distance
@@ -138,17 +269,58 @@ type StatisticsTracker struct {
 	instances   map[string]*InstanceStats
 	instancesMu sync.RWMutex
 
+	// How long an instance may go without reporting before it is offline (guarded by instancesMu)
+	offlineTimeout time.Duration
+
+	// Longest gap between an instance's spots that still counts as online time (guarded by instancesMu)
+	onlineGrace time.Duration
+
+	// How many recent callsigns to keep per instance (guarded by instancesMu)
+	recentCallsignsLimit int
+
+	// Encoding used when saving the persistence file (PersistenceFormatJSON or PersistenceFormatGob)
+	persistenceFormat string
+
+	// Held while the persistence file is written, so a checkpoint and a
+	// window flush never write it at the same time
+	saveMu sync.Mutex
+
+	// Optional SNR anomaly detection, checked as each window's SNR history is recorded
+	snrAlerts *SNRAlertMonitor
+
+	// Optional command run with each finalized window's summary
+	windowHook *WindowHook
+
+	// Channels signalled each time a window finishes (see SubscribeWindows)
+	windowListeners   map[chan struct{}]bool
+	windowListenersMu sync.Mutex
+
 	// Country statistics per band
 	// Key: "band_country" (e.g., "40m_United States")
 	countryStats   map[string]*CountryStats
 	countryStatsMu sync.RWMutex
 
+	// Spots per instance per country in hourly buckets, pruned to the retention period
+	// Key: hour (Unix seconds) -> instance name -> country -> spot count
+	instanceCountryHours map[int64]map[string]map[string]int
+	instanceCountryMu    sync.Mutex
+
+	// Transmit frequency offset statistics per band (key: band)
+	frequencyStats   map[string]*FrequencyStats
+	frequencyStatsMu sync.RWMutex
+
 	// Spots for mapping from last 24 hours (callsign -> spot info)
 	// This is updated from recent windows, not just current window
 	mapSpots   map[string]*SpotLocation
 	mapSpotsMu sync.RWMutex
 
-	// Recent windows (keep last 720 for 24 hours of history)
+	// How much window and SNR history is kept (default 24 hours)
+	retention time.Duration
+
+	// How long the aggregator holds a window open from the start of its cycle
+	dedupWindow time.Duration
+
+	// Recent windows (keep one per 2-minute cycle for the retention period)
 	recentWindows   []*WindowStats
 	recentWindowsMu sync.RWMutex
 
@@ -156,28 +328,55 @@ type StatisticsTracker struct {
 	currentWindow   *WindowStats
 	currentWindowMu sync.Mutex
 
-	// SNR history per band per instance (keep last 720 windows = 24 hours)
+	// SNR history per band per instance (one point per window for the retention period)
 	// Key: band name -> instance name -> history points
 	snrHistory   map[string]map[string][]SNRHistoryPoint
 	snrHistoryMu sync.RWMutex
 
-	// Current window SNR and distance accumulation for history
-	// Key: "band_instance" -> {totalSNR, count, totalDistance, distanceCount}
-	currentWindowSNR map[string]*struct {
-		totalSNR, count, totalDistance int
-		distanceCount                  int
-	}
+	// SNR and distance accumulated for the history of each open window
+	// Key: window start (Unix seconds) -> band and instance
+	currentWindowSNR   map[int64]map[bandInstanceKey]*windowSNRAccumulator
 	currentWindowSNRMu sync.Mutex
 
 	// Overall statistics
 	totalSubmitted  int
 	totalDuplicates int
 	totalUnique     int
+	hashedCallsigns map[string]int // Band -> count of "<...>" decodes (hashed_callsigns: count/submit)
+	totalImported   int            // Spots backfilled from WSPRNet (not included in the totals above)
 	statsMu         sync.RWMutex
 
-	// Receiver location for distance calculations
+	// Receiver location for distance calculations (receiverSet once a valid
+	// locator has been given)
 	receiverLat float64
 	receiverLon float64
+	receiverSet bool
+	receiverMu  sync.RWMutex
+
+	// Use only the 4-character square of each locator for distances (grid_precision: square)
+	squareGridsOnly bool
+
+	// Background cleanup control
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Units for distances served by the API. Statistics are always kept in km.
+const (
+	DistanceUnitKm = "km"
+	DistanceUnitMi = "mi"
+)
+
+// kmPerMile converts between the distance units
+const kmPerMile = 1.609344
+
+// distanceInUnit converts a distance in km to unit
+func distanceInUnit(km float64, unit string) float64 {
+	if unit == DistanceUnitMi {
+		return km / kmPerMile
+	}
+	return km
 }
 
 // haversineDistance calculates the great circle distance between two points
@@ -200,37 +399,112 @@ func haversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return earthRadius * c
 }
 
+// bearingDegrees returns the initial great circle bearing from the first point
+// to the second (decimal degrees), in degrees true from 0 to 360
+func bearingDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLon := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// Grid precision settings for distance calculations
+const (
+	GridPrecisionAuto   = "auto"   // Use the 6-character subsquare when the decode has one
+	GridPrecisionSquare = "square" // Always use the 4-character square
+)
+
+// SpotPath is the great circle path from the receiver to a transmitter's locator
+type SpotPath struct {
+	Km        float64 `json:"distance_km"`
+	Bearing   float64 `json:"bearing"`        // Degrees true from the receiver
+	Precision int     `json:"grid_precision"` // Locator characters used: 4 or 6
+}
+
+// SetGridPrecision selects how much of each locator is used for distances
+// (GridPrecisionAuto or GridPrecisionSquare). Must be called before spots are recorded.
+func (st *StatisticsTracker) SetGridPrecision(precision string) {
+	st.squareGridsOnly = precision == GridPrecisionSquare
+}
+
+// DistanceTo returns the path from the receiver to a locator. A 6-character
+// locator is placed at the centre of its subsquare (about 5 km across) instead
+// of its square (about 100-200 km across) unless grid_precision is "square".
+// It returns false if the receiver location is unset or the locator is invalid.
+func (st *StatisticsTracker) DistanceTo(locator string) (SpotPath, bool) {
+	st.receiverMu.RLock()
+	receiverLat, receiverLon, receiverSet := st.receiverLat, st.receiverLon, st.receiverSet
+	st.receiverMu.RUnlock()
+	if !receiverSet {
+		return SpotPath{}, false
+	}
+
+	precision := 4
+	if len(locator) >= 6 && !st.squareGridsOnly {
+		precision = 6
+	}
+	if len(locator) > precision {
+		locator = locator[:precision]
+	}
+
+	lat, lon, ok := maidenheadToLatLon(locator)
+	if !ok && precision == 6 {
+		// Garbled subsquare; the square may still be usable
+		precision = 4
+		lat, lon, ok = maidenheadToLatLon(locator[:4])
+	}
+	if !ok {
+		return SpotPath{}, false
+	}
+	return SpotPath{
+		Km:        haversineDistance(receiverLat, receiverLon, lat, lon),
+		Bearing:   bearingDegrees(receiverLat, receiverLon, lat, lon),
+		Precision: precision,
+	}, true
+}
+
 // maidenheadToLatLon converts a Maidenhead locator to latitude/longitude
-// Returns lat, lon in decimal degrees, or 0, 0 if invalid
-func maidenheadToLatLon(locator string) (float64, float64) {
-	if len(locator) < 4 {
-		return 0, 0
+// Returns lat, lon in decimal degrees and whether the locator was valid; 0, 0
+// is a real place, so it says nothing on its own.
+// The result is the centre of the square (4 chars) or subsquare (6 chars),
+// matching the dashboard's JavaScript conversion.
+func maidenheadToLatLon(locator string) (lat, lon float64, ok bool) {
+	// Use the square or subsquare; extended-precision characters are ignored
+	switch {
+	case len(locator) < 4:
+		return 0, 0, false
+	case len(locator) < 6:
+		locator = locator[:4]
+	default:
+		locator = locator[:6]
 	}
 
-	locator = string([]byte{
-		locator[0] | 0x20, // to lowercase
-		locator[1] | 0x20,
-		locator[2],
-		locator[3],
-	})
+	loc := []byte(strings.ToUpper(locator))
+
+	// Field A-R, square 0-9, subsquare A-X
+	if loc[0] < 'A' || loc[0] > 'R' || loc[1] < 'A' || loc[1] > 'R' ||
+		loc[2] < '0' || loc[2] > '9' || loc[3] < '0' || loc[3] > '9' {
+		return 0, 0, false
+	}
+	if len(loc) == 6 && (loc[4] < 'A' || loc[4] > 'X' || loc[5] < 'A' || loc[5] > 'X') {
+		return 0, 0, false
+	}
 
 	// Field (first 2 chars): 20° longitude, 10° latitude
-	lon1 := float64(locator[0]-'a') * 20.0
-	lat1 := float64(locator[1]-'a') * 10.0
+	lon = float64(loc[0]-'A')*20.0 - 180.0
+	lat = float64(loc[1]-'A')*10.0 - 90.0
 
 	// Square (next 2 chars): 2° longitude, 1° latitude
-	lon2 := float64(locator[2]-'0') * 2.0
-	lat2 := float64(locator[3]-'0') * 1.0
-
-	lon := lon1 + lon2 - 180.0
-	lat := lat1 + lat2 - 90.0
+	lon += float64(loc[2]-'0') * 2.0
+	lat += float64(loc[3]-'0') * 1.0
 
 	// Subsquare (optional 2 chars): 5' (2/24°) longitude, 2.5' (1/24°) latitude
-	if len(locator) >= 6 {
-		lon3 := float64(locator[4]|0x20-'a') * (2.0 / 24.0)
-		lat3 := float64(locator[5]|0x20-'a') * (1.0 / 24.0)
-		lon += lon3
-		lat += lat3
+	if len(loc) == 6 {
+		lon += float64(loc[4]-'A') * (2.0 / 24.0)
+		lat += float64(loc[5]-'A') * (1.0 / 24.0)
 		// Center of subsquare
 		lon += (1.0 / 24.0)
 		lat += (1.0 / 48.0)
@@ -240,80 +514,126 @@ func maidenheadToLatLon(locator string) (float64, float64) {
 		lat += 0.5
 	}
 
-	return lat, lon
+	return lat, lon, true
 }
 
 // NewStatisticsTracker creates a new statistics tracker
 func NewStatisticsTracker() *StatisticsTracker {
 	st := &StatisticsTracker{
-		instances:     make(map[string]*InstanceStats),
-		countryStats:  make(map[string]*CountryStats),
-		mapSpots:      make(map[string]*SpotLocation),
-		recentWindows: make([]*WindowStats, 0, 720),
-		snrHistory:    make(map[string]map[string][]SNRHistoryPoint),
-		currentWindowSNR: make(map[string]*struct {
-			totalSNR, count, totalDistance int
-			distanceCount                  int
-		}),
+		instances:            make(map[string]*InstanceStats),
+		countryStats:         make(map[string]*CountryStats),
+		frequencyStats:       make(map[string]*FrequencyStats),
+		instanceCountryHours: make(map[int64]map[string]map[string]int),
+		mapSpots:             make(map[string]*SpotLocation),
+		retention:            DefaultRetentionHours * time.Hour,
+		dedupWindow:          DefaultDedupWindow * time.Second,
+		recentWindows:        make([]*WindowStats, 0, DefaultRetentionHours*windowsPerHour),
+		snrHistory:           make(map[string]map[string][]SNRHistoryPoint),
+		currentWindowSNR:     make(map[int64]map[bandInstanceKey]*windowSNRAccumulator),
+		offlineTimeout:       DefaultInstanceOfflineTimeout,
+		onlineGrace:          DefaultOnlineGrace,
+		recentCallsignsLimit: DefaultRecentCallsigns,
+		persistenceFormat:    PersistenceFormatJSON,
+		stopChan:             make(chan struct{}),
 	}
 
 	// Start background cleanup goroutine
+	st.wg.Add(1)
 	go st.cleanupOldData()
 
 	return st
 }
 
-// cleanupOldData periodically removes data older than 24 hours from memory
+// Close stops the background cleanup goroutine. It is safe to call more than once.
+func (st *StatisticsTracker) Close() {
+	st.closeOnce.Do(func() {
+		close(st.stopChan)
+	})
+	st.wg.Wait()
+}
+
+// cleanupOldData periodically removes data older than the retention period from memory
 func (st *StatisticsTracker) cleanupOldData() {
+	defer st.wg.Done()
+
 	ticker := time.NewTicker(10 * time.Minute) // Run every 10 minutes
 	defer ticker.Stop()
 
-	for range ticker.C {
-		cutoff := time.Now().Add(-24 * time.Hour)
+	for {
+		select {
+		case <-st.stopChan:
+			return
+		case <-ticker.C:
+			st.performCleanup()
+		}
+	}
+}
+
+// performCleanup removes windows and SNR history older than the retention period
+func (st *StatisticsTracker) performCleanup() {
+	cutoff := time.Now().Add(-st.retention)
 
-		// Clean up recent windows
-		st.recentWindowsMu.Lock()
-		filtered := make([]*WindowStats, 0, len(st.recentWindows))
-		for _, window := range st.recentWindows {
-			if window.WindowTime.After(cutoff) {
-				filtered = append(filtered, window)
-			}
+	// Clean up recent windows
+	st.recentWindowsMu.Lock()
+	filtered := make([]*WindowStats, 0, len(st.recentWindows))
+	for _, window := range st.recentWindows {
+		if window.WindowTime.After(cutoff) {
+			filtered = append(filtered, window)
 		}
-		st.recentWindows = filtered
-		st.recentWindowsMu.Unlock()
+	}
+	st.recentWindows = filtered
+	kept := len(filtered)
+	st.recentWindowsMu.Unlock()
 
-		// Clean up SNR history
-		st.snrHistoryMu.Lock()
-		for band, instances := range st.snrHistory {
-			for instance, points := range instances {
-				filtered := make([]SNRHistoryPoint, 0, len(points))
-				for _, point := range points {
-					if point.WindowTime.After(cutoff) {
-						filtered = append(filtered, point)
-					}
-				}
-				if len(filtered) > 0 {
-					st.snrHistory[band][instance] = filtered
-				} else {
-					delete(st.snrHistory[band], instance)
+	// Clean up SNR history
+	st.snrHistoryMu.Lock()
+	for band, instances := range st.snrHistory {
+		for instance, points := range instances {
+			filtered := make([]SNRHistoryPoint, 0, len(points))
+			for _, point := range points {
+				if point.WindowTime.After(cutoff) {
+					filtered = append(filtered, point)
 				}
 			}
-			// Remove empty band entries
-			if len(st.snrHistory[band]) == 0 {
-				delete(st.snrHistory, band)
+			if len(filtered) > 0 {
+				st.snrHistory[band][instance] = filtered
+			} else {
+				delete(st.snrHistory[band], instance)
 			}
 		}
-		st.snrHistoryMu.Unlock()
+		// Remove empty band entries
+		if len(st.snrHistory[band]) == 0 {
+			delete(st.snrHistory, band)
+		}
+	}
+	st.snrHistoryMu.Unlock()
 
-		log.Printf("Cleanup: Removed data older than %s, kept %d windows", cutoff.Format("2006-01-02 15:04:05"), len(st.recentWindows))
+	st.pruneInstanceCountries(cutoff)
+
+	// Clean up map spots not heard within the retention period
+	st.mapSpotsMu.Lock()
+	for callsign, spot := range st.mapSpots {
+		if spot.LastHeard.Before(cutoff) {
+			delete(st.mapSpots, callsign)
+		}
 	}
+	st.mapSpotsMu.Unlock()
+
+	logDebugf("Cleanup: Removed data older than %s, kept %d windows", cutoff.Format("2006-01-02 15:04:05"), kept)
 }
 
 // SetReceiverLocation sets the receiver's location for distance calculations
 func (st *StatisticsTracker) SetReceiverLocation(locator string) {
-	lat, lon := maidenheadToLatLon(locator)
+	lat, lon, ok := maidenheadToLatLon(locator)
+	st.receiverMu.Lock()
 	st.receiverLat = lat
 	st.receiverLon = lon
+	st.receiverSet = ok
+	st.receiverMu.Unlock()
+	if !ok {
+		log.Printf("Warning: Receiver locator %q is not valid; distances will not be calculated", locator)
+		return
+	}
 	log.Printf("Receiver location set to: %.4f, %.4f (from %s)", lat, lon, locator)
 }
 
@@ -322,6 +642,7 @@ func (st *StatisticsTracker) StartWindow(windowTime time.Time) {
 	st.currentWindowMu.Lock()
 	defer st.currentWindowMu.Unlock()
 
+	previous := st.currentWindow
 	st.currentWindow = &WindowStats{
 		WindowTime:        windowTime,
 		UniqueByInstance:  make(map[string][]string),
@@ -330,23 +651,31 @@ func (st *StatisticsTracker) StartWindow(windowTime time.Time) {
 		BandBreakdown:     make(map[string]int),
 	}
 
-	// Don't clear currentWindowSNR here - it will be cleared after recording history in FinishWindow
+	// A window left unfinished (restored after a restart) is carried into this
+	// one rather than dropped
+	if previous != nil {
+		for inst, callsigns := range previous.UniqueByInstance {
+			st.currentWindow.UniqueByInstance[inst] = append(st.currentWindow.UniqueByInstance[inst], callsigns...)
+		}
+		for inst, count := range previous.BestSNRByInstance {
+			st.currentWindow.BestSNRByInstance[inst] += count
+		}
+		for inst, count := range previous.TiedSNRByInstance {
+			st.currentWindow.TiedSNRByInstance[inst] += count
+		}
+	}
+
+	// SNR for this window is gathered by RecordSpot and recorded in FinishWindow
 }
 
-// RecordSpot records a spot from an instance
-func (st *StatisticsTracker) RecordSpot(instanceName, band, callsign, country, locator string, snr int) {
+// RecordSpot records a spot from an instance for the window starting at
+// windowTime. When hasSNR is false the spot is still counted but left out of
+// all SNR aggregates.
+func (st *StatisticsTracker) RecordSpot(windowTime time.Time, instanceName, band, callsign, country, locator string, snr int, hasSNR bool) {
 	st.instancesMu.Lock()
 	defer st.instancesMu.Unlock()
 
-	// Get or create instance stats
-	if st.instances[instanceName] == nil {
-		st.instances[instanceName] = &InstanceStats{
-			Name:            instanceName,
-			BandStats:       make(map[string]*BandInstanceStats),
-			RecentCallsigns: make([]string, 0, 10),
-		}
-	}
-	instance := st.instances[instanceName]
+	instance := st.getOrCreateInstance(instanceName)
 
 	// Update instance stats
 	instance.TotalSpots++
@@ -361,80 +690,135 @@ func (st *StatisticsTracker) RecordSpot(instanceName, band, callsign, country, l
 	}
 	bandStats := instance.BandStats[band]
 	bandStats.TotalSpots++
-	bandStats.TotalSNR += snr
-	bandStats.SNRCount++
-	bandStats.AverageSNR = float64(bandStats.TotalSNR) / float64(bandStats.SNRCount)
+	if hasSNR {
+		bandStats.TotalSNR += snr
+		bandStats.SNRCount++
+		bandStats.AverageSNR = float64(bandStats.TotalSNR) / float64(bandStats.SNRCount)
+	}
 
 	// Calculate distance once if we have valid locators
-	var distance float64
-	var hasDistance bool
-	if locator != "" && st.receiverLat != 0 && st.receiverLon != 0 {
-		spotLat, spotLon := maidenheadToLatLon(locator)
-		if spotLat != 0 || spotLon != 0 {
-			distance = haversineDistance(st.receiverLat, st.receiverLon, spotLat, spotLon)
-			hasDistance = true
-
-			// Update distance statistics for 24h summary
-			if bandStats.DistanceCount == 0 {
-				// First distance measurement
+	path, hasDistance := st.DistanceTo(locator)
+	distance := path.Km
+	if hasDistance {
+		// Update distance statistics for 24h summary
+		if bandStats.DistanceCount == 0 {
+			// First distance measurement
+			bandStats.MinDistance = distance
+			bandStats.MaxDistance = distance
+		} else {
+			if distance < bandStats.MinDistance {
 				bandStats.MinDistance = distance
+			}
+			if distance > bandStats.MaxDistance {
 				bandStats.MaxDistance = distance
-			} else {
-				if distance < bandStats.MinDistance {
-					bandStats.MinDistance = distance
-				}
-				if distance > bandStats.MaxDistance {
-					bandStats.MaxDistance = distance
-				}
 			}
-			bandStats.TotalDistance += distance
-			bandStats.DistanceCount++
-			bandStats.AverageDistance = bandStats.TotalDistance / float64(bandStats.DistanceCount)
 		}
+		bandStats.TotalDistance += distance
+		bandStats.DistanceCount++
+		bandStats.AverageDistance = bandStats.TotalDistance / float64(bandStats.DistanceCount)
 	}
 
-	// Update recent callsigns (keep last 10)
+	// Update recent callsigns (keep the configured number, newest last)
 	instance.RecentCallsigns = append(instance.RecentCallsigns, callsign)
-	if len(instance.RecentCallsigns) > 10 {
-		instance.RecentCallsigns = instance.RecentCallsigns[1:]
+	if excess := len(instance.RecentCallsigns) - st.recentCallsignsLimit; excess > 0 {
+		instance.RecentCallsigns = instance.RecentCallsigns[excess:]
 	}
 
 	// Update country stats
 	if country != "" {
-		st.recordCountryStats(band, country, callsign, snr)
+		st.recordCountryStats(band, country, callsign, snr, hasSNR)
+		st.recordInstanceCountry(instanceName, country, time.Now())
 	}
 
 	// Update current spots for mapping
 	if locator != "" {
-		st.recordSpotLocation(callsign, locator, band, country, snr)
+		st.recordSpotLocation(instanceName, callsign, locator, band, country, snr, path, hasDistance)
 	}
 
-	// Accumulate SNR and distance for current window history
+	// Accumulate SNR and distance for the window's history
 	st.currentWindowSNRMu.Lock()
-	key := band + "_" + instanceName
-	if st.currentWindowSNR[key] == nil {
-		st.currentWindowSNR[key] = &struct {
-			totalSNR, count, totalDistance int
-			distanceCount                  int
-		}{}
+	acc := st.windowSNRAccumulator(windowTime.Unix(), bandInstanceKey{band: band, instance: instanceName})
+	acc.count++
+	if hasSNR {
+		acc.totalSNR += snr
+		acc.snrCount++
 	}
-	st.currentWindowSNR[key].totalSNR += snr
-	st.currentWindowSNR[key].count++
 
 	// Add distance if we calculated it (reuse the distance we already calculated)
 	if hasDistance {
-		st.currentWindowSNR[key].totalDistance += int(distance)
-		st.currentWindowSNR[key].distanceCount++
+		acc.totalDistance += int(distance)
+		acc.distanceCount++
 	}
 	st.currentWindowSNRMu.Unlock()
 }
 
-// recordSpotLocation updates spot location info for mapping
-func (st *StatisticsTracker) recordSpotLocation(callsign, locator, band, country string, snr int) {
+// windowSNRAccumulator returns the SNR accumulated for key in the window
+// starting at window, creating it if needed. Caller must hold currentWindowSNRMu.
+func (st *StatisticsTracker) windowSNRAccumulator(window int64, key bandInstanceKey) *windowSNRAccumulator {
+	if st.currentWindowSNR[window] == nil {
+		st.currentWindowSNR[window] = make(map[bandInstanceKey]*windowSNRAccumulator)
+	}
+	if st.currentWindowSNR[window][key] == nil {
+		st.currentWindowSNR[window][key] = &windowSNRAccumulator{}
+	}
+	return st.currentWindowSNR[window][key]
+}
+
+// getOrCreateInstance returns the stats for an instance, creating them if needed.
+// Caller must hold instancesMu.
+func (st *StatisticsTracker) getOrCreateInstance(instanceName string) *InstanceStats {
+	if st.instances[instanceName] == nil {
+		st.instances[instanceName] = &InstanceStats{
+			Name:            instanceName,
+			BandStats:       make(map[string]*BandInstanceStats),
+			RecentCallsigns: make([]string, 0, st.recentCallsignsLimit),
+		}
+	}
+	return st.instances[instanceName]
+}
+
+// RecordSoftware records the decoder software and version an instance reports.
+// Empty values are ignored so a decode without the fields doesn't clear known info.
+func (st *StatisticsTracker) RecordSoftware(instanceName, software, version string) {
+	if software == "" && version == "" {
+		return
+	}
+
+	st.instancesMu.Lock()
+	defer st.instancesMu.Unlock()
+
+	instance := st.getOrCreateInstance(instanceName)
+	if software != "" {
+		instance.Software = software
+	}
+	if version != "" {
+		instance.SoftwareVersion = version
+	}
+}
+
+// recordSpotLocation updates spot location info for mapping. A more precise
+// locator (6 rather than 4 characters) replaces the one already recorded.
+func (st *StatisticsTracker) recordSpotLocation(instanceName, callsign, locator, band, country string, snr int, path SpotPath, hasPath bool) {
 	st.mapSpotsMu.Lock()
 	defer st.mapSpotsMu.Unlock()
 
+	now := time.Now()
 	if spot, exists := st.mapSpots[callsign]; exists {
+		if spot.HeardBy == nil {
+			spot.HeardBy = make(map[string]time.Time)
+		}
+		spot.HeardBy[instanceName] = now
+		spot.LastHeard = now
+
+		if len(locator) > len(spot.Locator) {
+			spot.Locator = locator
+		}
+		if hasPath && path.Precision >= spot.GridPrecision {
+			spot.DistanceKm = path.Km
+			spot.Bearing = path.Bearing
+			spot.GridPrecision = path.Precision
+		}
+
 		// Add band if not already present
 		found := false
 		for i, b := range spot.Bands {
@@ -452,18 +836,27 @@ func (st *StatisticsTracker) recordSpotLocation(callsign, locator, band, country
 			spot.SNR = append(spot.SNR, snr)
 		}
 	} else {
-		st.mapSpots[callsign] = &SpotLocation{
-			Callsign: callsign,
-			Locator:  locator,
-			Bands:    []string{band},
-			SNR:      []int{snr},
-			Country:  country,
+		spot := &SpotLocation{
+			Callsign:   callsign,
+			Locator:    locator,
+			Bands:      []string{band},
+			SNR:        []int{snr},
+			Country:    country,
+			HeardBy:    map[string]time.Time{instanceName: now},
+			FirstHeard: now,
+			LastHeard:  now,
+		}
+		if hasPath {
+			spot.DistanceKm = path.Km
+			spot.Bearing = path.Bearing
+			spot.GridPrecision = path.Precision
 		}
+		st.mapSpots[callsign] = spot
 	}
 }
 
 // recordCountryStats updates country statistics
-func (st *StatisticsTracker) recordCountryStats(band, country, callsign string, snr int) {
+func (st *StatisticsTracker) recordCountryStats(band, country, callsign string, snr int, hasSNR bool) {
 	st.countryStatsMu.Lock()
 	defer st.countryStatsMu.Unlock()
 
@@ -473,22 +866,97 @@ func (st *StatisticsTracker) recordCountryStats(band, country, callsign string,
 			Country:         country,
 			Band:            band,
 			UniqueCallsigns: make(map[string]bool),
-			MinSNR:          snr,
-			MaxSNR:          snr,
 		}
 	}
 
 	stats := st.countryStats[key]
 	stats.UniqueCallsigns[callsign] = true
-	stats.TotalSNR += snr
 	stats.Count++
 
-	if snr < stats.MinSNR {
+	if !hasSNR {
+		return
+	}
+	if stats.SNRCount == 0 || snr < stats.MinSNR {
 		stats.MinSNR = snr
 	}
-	if snr > stats.MaxSNR {
+	if stats.SNRCount == 0 || snr > stats.MaxSNR {
 		stats.MaxSNR = snr
 	}
+	stats.TotalSNR += snr
+	stats.SNRCount++
+}
+
+// RecordTxFrequency records the transmit frequency of a deduplicated spot as an
+// offset from the band's nominal WSPR dial. Bands without a known dial are ignored.
+func (st *StatisticsTracker) RecordTxFrequency(band string, txFreq uint64) {
+	dial, ok := bandDialFrequency(band)
+	if !ok || txFreq == 0 {
+		return
+	}
+	offset := int64(txFreq) - int64(dial)
+
+	st.frequencyStatsMu.Lock()
+	defer st.frequencyStatsMu.Unlock()
+
+	stats := st.frequencyStats[band]
+	if stats == nil {
+		stats = &FrequencyStats{
+			Band:      band,
+			DialFreq:  dial,
+			MinOffset: offset,
+			MaxOffset: offset,
+			Histogram: make([]int, freqHistogramBins),
+		}
+		st.frequencyStats[band] = stats
+	}
+
+	if offset < stats.MinOffset {
+		stats.MinOffset = offset
+	}
+	if offset > stats.MaxOffset {
+		stats.MaxOffset = offset
+	}
+	stats.TotalOffset += offset
+	stats.Count++
+
+	bin := (offset - freqHistogramStart) / freqHistogramWidth
+	switch {
+	case offset < freqHistogramStart:
+		stats.Below++
+	case bin >= freqHistogramBins:
+		stats.Above++
+	default:
+		stats.Histogram[bin]++
+	}
+}
+
+// GetFrequencyStats returns transmit frequency offset statistics keyed by band
+func (st *StatisticsTracker) GetFrequencyStats() map[string]map[string]interface{} {
+	st.frequencyStatsMu.RLock()
+	defer st.frequencyStatsMu.RUnlock()
+
+	result := make(map[string]map[string]interface{})
+	for band, stats := range st.frequencyStats {
+		if stats.Count == 0 {
+			continue
+		}
+		histogram := make([]int, len(stats.Histogram))
+		copy(histogram, stats.Histogram)
+
+		result[band] = map[string]interface{}{
+			"dial_frequency": stats.DialFreq,
+			"min_offset":     stats.MinOffset,
+			"max_offset":     stats.MaxOffset,
+			"avg_offset":     float64(stats.TotalOffset) / float64(stats.Count),
+			"count":          stats.Count,
+			"histogram":      histogram,
+			"bin_start":      freqHistogramStart,
+			"bin_width":      freqHistogramWidth,
+			"below":          stats.Below,
+			"above":          stats.Above,
+		}
+	}
+	return result
 }
 
 // RecordUnique records a spot that was unique to an instance
@@ -530,18 +998,36 @@ func (st *StatisticsTracker) RecordBestSNR(instanceName, band string) {
 	st.currentWindowMu.Unlock()
 }
 
-// RecordTiedSNR records when an instance tied for the best SNR with another instance
-func (st *StatisticsTracker) RecordTiedSNR(instanceName, band, tiedWithInstance string) {
+// RecordPriorityWin records that an instance's report was kept because of its
+// configured priority or SNR handicap. It is recorded once per spot, when its
+// window is flushed.
+func (st *StatisticsTracker) RecordPriorityWin(instanceName, band string) {
+	st.instancesMu.Lock()
+	defer st.instancesMu.Unlock()
+
+	if st.instances[instanceName] != nil {
+		st.instances[instanceName].PriorityWins++
+		if st.instances[instanceName].BandStats[band] != nil {
+			st.instances[instanceName].BandStats[band].PriorityWins++
+		}
+	}
+}
+
+// RecordTiedSNR records one spot on which an instance tied for the best SNR
+// with each of the tiedWith instances
+func (st *StatisticsTracker) RecordTiedSNR(instanceName, band string, tiedWith []string) {
 	st.instancesMu.Lock()
 	if st.instances[instanceName] != nil {
 		st.instances[instanceName].TiedSNR++
 		if st.instances[instanceName].BandStats[band] != nil {
 			st.instances[instanceName].BandStats[band].TiedSNR++
-			// Track which instance this one tied with
+			// Track which instances this one tied with
 			if st.instances[instanceName].BandStats[band].TiedWith == nil {
 				st.instances[instanceName].BandStats[band].TiedWith = make(map[string]int)
 			}
-			st.instances[instanceName].BandStats[band].TiedWith[tiedWithInstance]++
+			for _, other := range tiedWith {
+				st.instances[instanceName].BandStats[band].TiedWith[other]++
+			}
 		}
 	}
 	st.instancesMu.Unlock()
@@ -588,11 +1074,14 @@ func (st *StatisticsTracker) FinishWindow(totalSpots, duplicates, failed int, ba
 		}
 		st.instancesMu.Unlock()
 
-		// Add to recent windows
+		// Add a copy to recent windows so the history never shares maps with
+		// the window being built or the caller; windows in the history are
+		// not modified once appended
+		finished := st.currentWindow.clone()
 		st.recentWindowsMu.Lock()
-		st.recentWindows = append(st.recentWindows, st.currentWindow)
-		// Keep only last 720 windows (24 hours)
-		if len(st.recentWindows) > 720 {
+		st.recentWindows = append(st.recentWindows, finished)
+		// Keep only the windows in the retention period
+		if len(st.recentWindows) > st.MaxWindows() {
 			st.recentWindows = st.recentWindows[1:]
 		}
 		st.recentWindowsMu.Unlock()
@@ -607,54 +1096,78 @@ func (st *StatisticsTracker) FinishWindow(totalSpots, duplicates, failed int, ba
 		// Record SNR history for this window
 		st.recordSNRHistory(windowTime)
 
-		// Clear current window SNR and distance accumulation AFTER recording history
-		st.currentWindowSNRMu.Lock()
-		st.currentWindowSNR = make(map[string]*struct {
-			totalSNR, count, totalDistance int
-			distanceCount                  int
-		})
-		st.currentWindowSNRMu.Unlock()
+		if st.windowHook != nil {
+			st.windowHook.Run(finished.clone())
+		}
 	}
+	wasOpen := st.currentWindow != nil
 	st.currentWindow = nil
 	st.currentWindowMu.Unlock()
+
+	if wasOpen {
+		st.notifyWindowFinished()
+	}
+}
+
+// LastWindowFinished returns when the most recent live window was finished,
+// or the zero time if none has been since startup or in the loaded history
+func (st *StatisticsTracker) LastWindowFinished() time.Time {
+	st.recentWindowsMu.RLock()
+	defer st.recentWindowsMu.RUnlock()
+
+	for i := len(st.recentWindows) - 1; i >= 0; i-- {
+		if !st.recentWindows[i].Imported {
+			return st.recentWindows[i].SubmittedAt
+		}
+	}
+	return time.Time{}
 }
 
-// recordSNRHistory records the average SNR for each band/instance combination for this window
+// recordSNRHistory records the average SNR for each band/instance combination
+// for this window. SNR left over from windows whose deduplication window ended
+// before this one started (late duplicates, or restored after a restart) is
+// carried into this window rather than dropped.
 func (st *StatisticsTracker) recordSNRHistory(windowTime time.Time) {
 	st.currentWindowSNRMu.Lock()
 	defer st.currentWindowSNRMu.Unlock()
 
-	st.snrHistoryMu.Lock()
-	defer st.snrHistoryMu.Unlock()
-
-	if len(st.currentWindowSNR) == 0 {
+	window := windowTime.Unix()
+	accumulated := st.currentWindowSNR[window]
+	delete(st.currentWindowSNR, window)
+	for w, leftover := range st.currentWindowSNR {
+		if w+int64(st.dedupWindow/time.Second) > window {
+			continue // Still open
+		}
+		if accumulated == nil {
+			accumulated = make(map[bandInstanceKey]*windowSNRAccumulator)
+		}
+		for key, data := range leftover {
+			if accumulated[key] == nil {
+				accumulated[key] = &windowSNRAccumulator{}
+			}
+			accumulated[key].add(data)
+		}
+		delete(st.currentWindowSNR, w)
+	}
+	if len(accumulated) == 0 {
 		return
 	}
 
-	// Process each band_instance combination
-	for key, data := range st.currentWindowSNR {
+	st.snrHistoryMu.Lock()
+	defer st.snrHistoryMu.Unlock()
+
+	// Process each band/instance combination
+	for key, data := range accumulated {
 		if data.count == 0 {
 			continue
 		}
+		band, instance := key.band, key.instance
 
-		// Parse band and instance from key
-		// Key format: "band_instance"
-		var band, instance string
-		for i := 0; i < len(key); i++ {
-			if key[i] == '_' {
-				band = key[:i]
-				instance = key[i+1:]
-				break
-			}
-		}
-
-		if band == "" || instance == "" {
-			log.Printf("SNR History: Failed to parse key '%s'", key)
-			continue
+		avgSNR := 0.0
+		if data.snrCount > 0 {
+			avgSNR = float64(data.totalSNR) / float64(data.snrCount)
 		}
 
-		avgSNR := float64(data.totalSNR) / float64(data.count)
-
 		// Calculate average distance if we have distance data
 		avgDistance := 0.0
 		if data.distanceCount > 0 {
@@ -670,15 +1183,20 @@ func (st *StatisticsTracker) recordSNRHistory(windowTime time.Time) {
 		point := SNRHistoryPoint{
 			WindowTime:      windowTime,
 			AverageSNR:      avgSNR,
+			SNRCount:        data.snrCount,
 			SpotCount:       data.count,
 			AverageDistance: avgDistance,
 			DistanceCount:   data.distanceCount,
 		}
 
+		if st.snrAlerts != nil {
+			st.snrAlerts.check(band, instance, point, st.snrHistory[band][instance])
+		}
+
 		st.snrHistory[band][instance] = append(st.snrHistory[band][instance], point)
 
-		// Keep only last 720 points (24 hours)
-		if len(st.snrHistory[band][instance]) > 720 {
+		// Keep only the points in the retention period
+		if len(st.snrHistory[band][instance]) > st.MaxWindows() {
 			st.snrHistory[band][instance] = st.snrHistory[band][instance][1:]
 		}
 	}
@@ -686,58 +1204,65 @@ func (st *StatisticsTracker) recordSNRHistory(windowTime time.Time) {
 
 // GetInstanceStats returns statistics for all instances
 func (st *StatisticsTracker) GetInstanceStats() map[string]*InstanceStats {
+	now := time.Now()
+	fractions := st.onlineFractions(now)
+
 	st.instancesMu.RLock()
 	defer st.instancesMu.RUnlock()
 
 	// Create a copy to avoid race conditions
 	result := make(map[string]*InstanceStats)
 	for k, v := range st.instances {
-		instanceCopy := &InstanceStats{
-			Name:            v.Name,
-			TotalSpots:      v.TotalSpots,
-			UniqueSpots:     v.UniqueSpots,
-			BestSNRWins:     v.BestSNRWins,
-			TiedSNR:         v.TiedSNR,
-			LastReportTime:  v.LastReportTime,
-			LastWindowTime:  v.LastWindowTime,
-			RecentCallsigns: make([]string, len(v.RecentCallsigns)),
-			BandStats:       make(map[string]*BandInstanceStats),
+		instanceCopy := v.clone()
+		instanceCopy.Online = st.isOnline(v.LastReportTime, now)
+		if fraction, ok := fractions[k]; ok {
+			instanceCopy.OnlineFraction = &fraction
 		}
-		copy(instanceCopy.RecentCallsigns, v.RecentCallsigns)
-
-		for band, stats := range v.BandStats {
-			// Copy TiedWith map
-			tiedWithCopy := make(map[string]int)
-			for k, v := range stats.TiedWith {
-				tiedWithCopy[k] = v
-			}
+		result[k] = instanceCopy
+	}
+	return result
+}
 
-			// Copy DuplicatesWith map
-			duplicatesWithCopy := make(map[string]int)
-			for k, v := range stats.DuplicatesWith {
-				duplicatesWithCopy[k] = v
-			}
+// clone returns a deep copy of the instance stats, including per-band maps.
+// Callers must hold instancesMu.
+func (v *InstanceStats) clone() *InstanceStats {
+	instanceCopy := *v
+	instanceCopy.RecentCallsigns = make([]string, len(v.RecentCallsigns))
+	copy(instanceCopy.RecentCallsigns, v.RecentCallsigns)
+
+	instanceCopy.BandStats = make(map[string]*BandInstanceStats, len(v.BandStats))
+	for band, stats := range v.BandStats {
+		bandCopy := *stats
+
+		// Copy TiedWith map
+		bandCopy.TiedWith = make(map[string]int, len(stats.TiedWith))
+		for k, v := range stats.TiedWith {
+			bandCopy.TiedWith[k] = v
+		}
 
-			instanceCopy.BandStats[band] = &BandInstanceStats{
-				TotalSpots:      stats.TotalSpots,
-				UniqueSpots:     stats.UniqueSpots,
-				BestSNRWins:     stats.BestSNRWins,
-				TiedSNR:         stats.TiedSNR,
-				TiedWith:        tiedWithCopy,
-				DuplicatesWith:  duplicatesWithCopy,
-				AverageSNR:      stats.AverageSNR,
-				TotalSNR:        stats.TotalSNR,
-				SNRCount:        stats.SNRCount,
-				MinDistance:     stats.MinDistance,
-				MaxDistance:     stats.MaxDistance,
-				TotalDistance:   stats.TotalDistance,
-				DistanceCount:   stats.DistanceCount,
-				AverageDistance: stats.AverageDistance,
-			}
+		// Copy DuplicatesWith map
+		bandCopy.DuplicatesWith = make(map[string]int, len(stats.DuplicatesWith))
+		for k, v := range stats.DuplicatesWith {
+			bandCopy.DuplicatesWith[k] = v
 		}
-		result[k] = instanceCopy
+
+		instanceCopy.BandStats[band] = &bandCopy
 	}
-	return result
+	return &instanceCopy
+}
+
+// clone returns a deep copy of the window statistics
+func (w *WindowStats) clone() *WindowStats {
+	windowCopy := *w
+
+	windowCopy.UniqueByInstance = make(map[string][]string, len(w.UniqueByInstance))
+	for k, v := range w.UniqueByInstance {
+		windowCopy.UniqueByInstance[k] = append([]string(nil), v...)
+	}
+	windowCopy.BestSNRByInstance = copyCounts(w.BestSNRByInstance)
+	windowCopy.TiedSNRByInstance = copyCounts(w.TiedSNRByInstance)
+	windowCopy.BandBreakdown = copyCounts(w.BandBreakdown)
+	return &windowCopy
 }
 
 // GetSNRHistory returns SNR history for all bands and instances
@@ -747,8 +1272,7 @@ func (st *StatisticsTracker) GetSNRHistory() map[string]*BandSNRHistory {
 
 	result := make(map[string]*BandSNRHistory)
 
-	// Calculate cutoff time (24 hours ago)
-	cutoff := time.Now().Add(-24 * time.Hour)
+	cutoff := time.Now().Add(-st.retention)
 
 	for band, instances := range st.snrHistory {
 		bandHistory := &BandSNRHistory{
@@ -757,7 +1281,7 @@ func (st *StatisticsTracker) GetSNRHistory() map[string]*BandSNRHistory {
 		}
 
 		for instance, points := range instances {
-			// Filter and copy only points from last 24 hours
+			// Filter and copy only points from the retention period
 			filteredPoints := make([]SNRHistoryPoint, 0, len(points))
 			for _, point := range points {
 				if point.WindowTime.After(cutoff) {
@@ -775,7 +1299,8 @@ func (st *StatisticsTracker) GetSNRHistory() map[string]*BandSNRHistory {
 	return result
 }
 
-// GetRecentWindows returns the recent window statistics
+// GetRecentWindows returns deep copies of the most recent windows, so callers
+// can read and serialize them while new windows are being finished
 func (st *StatisticsTracker) GetRecentWindows(count int) []*WindowStats {
 	st.recentWindowsMu.RLock()
 	defer st.recentWindowsMu.RUnlock()
@@ -787,10 +1312,160 @@ func (st *StatisticsTracker) GetRecentWindows(count int) []*WindowStats {
 	// Return the last N windows
 	start := len(st.recentWindows) - count
 	result := make([]*WindowStats, count)
-	copy(result, st.recentWindows[start:])
+	for i, window := range st.recentWindows[start:] {
+		result[i] = window.clone()
+	}
 	return result
 }
 
+// ImportWindow adds a window of spots backfilled from WSPRNet to the history,
+// marked as imported. It returns false without changing anything if the window
+// is already in the history or older than the retention period. Imported spots only fill
+// the window history; they are not counted as submitted or attributed to any
+// instance.
+func (st *StatisticsTracker) ImportWindow(windowTime time.Time, spots []ImportedSpot) bool {
+	if len(spots) == 0 || windowTime.Before(time.Now().Add(-st.retention)) {
+		return false
+	}
+
+	window := &WindowStats{
+		WindowTime:        windowTime,
+		TotalSpots:        len(spots),
+		UniqueByInstance:  make(map[string][]string),
+		BestSNRByInstance: make(map[string]int),
+		TiedSNRByInstance: make(map[string]int),
+		BandBreakdown:     make(map[string]int),
+		Imported:          true,
+	}
+	for _, spot := range spots {
+		window.BandBreakdown[spot.Band]++
+	}
+
+	st.recentWindowsMu.Lock()
+	// Find the insertion point, keeping the history in chronological order
+	i := len(st.recentWindows)
+	for i > 0 && !st.recentWindows[i-1].WindowTime.Before(windowTime) {
+		if st.recentWindows[i-1].WindowTime.Equal(windowTime) {
+			st.recentWindowsMu.Unlock()
+			return false
+		}
+		i--
+	}
+	st.recentWindows = append(st.recentWindows, nil)
+	copy(st.recentWindows[i+1:], st.recentWindows[i:])
+	st.recentWindows[i] = window
+	if limit := st.MaxWindows(); len(st.recentWindows) > limit {
+		st.recentWindows = st.recentWindows[len(st.recentWindows)-limit:]
+	}
+	st.recentWindowsMu.Unlock()
+
+	st.statsMu.Lock()
+	st.totalImported += len(spots)
+	st.statsMu.Unlock()
+
+	return true
+}
+
+// DefaultInstanceOfflineTimeout is how long an instance may go without
+// reporting before it is considered offline
+const DefaultInstanceOfflineTimeout = 10 * time.Minute
+
+// SetOfflineTimeout sets how long an instance may go without reporting before
+// it is shown as offline and its spots are dropped from the live map
+func (st *StatisticsTracker) SetOfflineTimeout(timeout time.Duration) {
+	st.instancesMu.Lock()
+	st.offlineTimeout = timeout
+	st.instancesMu.Unlock()
+}
+
+// DefaultRetentionHours is how much window and SNR history is kept by default
+const DefaultRetentionHours = 24
+
+// windowsPerHour is the number of 2-minute WSPR cycles in an hour
+const windowsPerHour = 30
+
+// SetRetention sets how much window and SNR history is kept. It must be called
+// before windows are recorded or statistics are loaded.
+func (st *StatisticsTracker) SetRetention(retention time.Duration) {
+	st.retention = retention
+}
+
+// SetDedupWindow sets how long the aggregator holds a window open from the start
+// of its cycle, so SNR history gathered for a window is kept until it finishes.
+// It must be called before statistics are loaded.
+func (st *StatisticsTracker) SetDedupWindow(window time.Duration) {
+	st.dedupWindow = window
+}
+
+// MaxWindows is the number of windows held for the retention period
+func (st *StatisticsTracker) MaxWindows() int {
+	return int(st.retention / time.Hour * windowsPerHour)
+}
+
+// DefaultRecentCallsigns is how many recently heard callsigns are kept per instance
+const DefaultRecentCallsigns = 10
+
+// SetRecentCallsignsLimit sets how many recently heard callsigns are kept per
+// instance. Lists already longer than the limit are trimmed on the next spot.
+func (st *StatisticsTracker) SetRecentCallsignsLimit(limit int) {
+	st.instancesMu.Lock()
+	st.recentCallsignsLimit = limit
+	st.instancesMu.Unlock()
+}
+
+// isOnline reports whether an instance last heard at lastReport counts as online.
+// Callers must hold instancesMu.
+func (st *StatisticsTracker) isOnline(lastReport, now time.Time) bool {
+	return !lastReport.IsZero() && now.Sub(lastReport) <= st.offlineTimeout
+}
+
+// SummaryStats holds the headline numbers for lightweight status displays
+type SummaryStats struct {
+	Sent24h         int        `json:"sent_24h"`
+	Duplicates24h   int        `json:"duplicates_24h"`
+	Failed24h       int        `json:"failed_24h"`
+	Pending         int        `json:"pending"` // Filled in by the caller from the aggregator
+	InstancesOnline int        `json:"instances_online"`
+	InstancesTotal  int        `json:"instances_total"`
+	LastSpotTime    *time.Time `json:"last_spot_time"` // nil until the first spot arrives
+}
+
+// GetSummary returns 24-hour totals and instance liveness without copying window details
+func (st *StatisticsTracker) GetSummary() SummaryStats {
+	var summary SummaryStats
+	now := time.Now()
+	cutoff := now.Add(-24 * time.Hour)
+
+	st.recentWindowsMu.RLock()
+	for _, window := range st.recentWindows {
+		if window.WindowTime.Before(cutoff) {
+			continue
+		}
+		summary.Sent24h += window.TotalSpots
+		summary.Duplicates24h += window.DuplicateCount
+		summary.Failed24h += window.FailedCount
+	}
+	st.recentWindowsMu.RUnlock()
+
+	st.instancesMu.RLock()
+	var lastSpot time.Time
+	for _, instance := range st.instances {
+		summary.InstancesTotal++
+		if st.isOnline(instance.LastReportTime, now) {
+			summary.InstancesOnline++
+		}
+		if instance.LastReportTime.After(lastSpot) {
+			lastSpot = instance.LastReportTime
+		}
+	}
+	st.instancesMu.RUnlock()
+
+	if !lastSpot.IsZero() {
+		summary.LastSpotTime = &lastSpot
+	}
+	return summary
+}
+
 // GetCountryStats returns country statistics grouped by band
 func (st *StatisticsTracker) GetCountryStats() map[string][]map[string]interface{} {
 	st.countryStatsMu.RLock()
@@ -801,8 +1476,8 @@ func (st *StatisticsTracker) GetCountryStats() map[string][]map[string]interface
 
 	for _, stats := range st.countryStats {
 		avgSNR := 0.0
-		if stats.Count > 0 {
-			avgSNR = float64(stats.TotalSNR) / float64(stats.Count)
+		if stats.SNRCount > 0 {
+			avgSNR = float64(stats.TotalSNR) / float64(stats.SNRCount)
 		}
 
 		countryData := map[string]interface{}{
@@ -820,6 +1495,80 @@ func (st *StatisticsTracker) GetCountryStats() map[string][]map[string]interface
 	return result
 }
 
+// GetCountrySummary returns every country heard with the distinct bands it was
+// heard on, most bands first. Ties are broken by unique callsigns, then name.
+func (st *StatisticsTracker) GetCountrySummary() []CountrySummary {
+	st.countryStatsMu.RLock()
+	defer st.countryStatsMu.RUnlock()
+
+	type countryTotals struct {
+		bands     []string
+		callsigns map[string]bool
+		spots     int
+	}
+	totals := make(map[string]*countryTotals)
+	for _, stats := range st.countryStats {
+		t := totals[stats.Country]
+		if t == nil {
+			t = &countryTotals{callsigns: make(map[string]bool)}
+			totals[stats.Country] = t
+		}
+		t.bands = append(t.bands, stats.Band)
+		for callsign := range stats.UniqueCallsigns {
+			t.callsigns[callsign] = true
+		}
+		t.spots += stats.Count
+	}
+
+	summary := make([]CountrySummary, 0, len(totals))
+	for country, t := range totals {
+		sortBands(t.bands)
+		summary = append(summary, CountrySummary{
+			Country:         country,
+			BandCount:       len(t.bands),
+			Bands:           t.bands,
+			UniqueCallsigns: len(t.callsigns),
+			TotalSpots:      t.spots,
+		})
+	}
+
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].BandCount != summary[j].BandCount {
+			return summary[i].BandCount > summary[j].BandCount
+		}
+		if summary[i].UniqueCallsigns != summary[j].UniqueCallsigns {
+			return summary[i].UniqueCallsigns > summary[j].UniqueCallsigns
+		}
+		return summary[i].Country < summary[j].Country
+	})
+	return summary
+}
+
+// SetPersistenceFormat selects the encoding used by SaveToFile. Loading detects
+// the encoding from the file, so switching formats keeps existing history.
+func (st *StatisticsTracker) SetPersistenceFormat(format string) {
+	st.persistenceFormat = format
+}
+
+// SetSNRAlertMonitor enables SNR anomaly alerts. It must be called before windows are recorded.
+func (st *StatisticsTracker) SetSNRAlertMonitor(monitor *SNRAlertMonitor) {
+	st.snrAlerts = monitor
+}
+
+// SetWindowHook sets a command to run after each window is finalized. It must be
+// called before windows are recorded.
+func (st *StatisticsTracker) SetWindowHook(hook *WindowHook) {
+	st.windowHook = hook
+}
+
+// GetSNRAlerts returns recent SNR alerts, or nil if alerts are disabled
+func (st *StatisticsTracker) GetSNRAlerts() []SNRAlert {
+	if st.snrAlerts == nil {
+		return nil
+	}
+	return st.snrAlerts.Recent()
+}
+
 // SaveToFile saves all statistics to a JSON file (without reporter stats)
 func (st *StatisticsTracker) SaveToFile(filename string) error {
 	return st.SaveToFileWithReporters(filename, nil, nil)
@@ -838,10 +1587,12 @@ func (st *StatisticsTracker) SaveToFileWithReporters(filename string, wsprnetSta
 	copy(windows, st.recentWindows)
 	st.recentWindowsMu.RUnlock()
 
+	// Deep-copy anything RecordSpot mutates in place so marshalling below
+	// doesn't race with incoming spots
 	st.instancesMu.RLock()
 	instances := make(map[string]*InstanceStats)
 	for k, v := range st.instances {
-		instances[k] = v
+		instances[k] = v.clone()
 	}
 	st.instancesMu.RUnlock()
 
@@ -860,15 +1611,26 @@ func (st *StatisticsTracker) SaveToFileWithReporters(filename string, wsprnetSta
 			MinSNR:          v.MinSNR,
 			MaxSNR:          v.MaxSNR,
 			TotalSNR:        v.TotalSNR,
+			SNRCount:        v.SNRCount,
 			Count:           v.Count,
 		}
 	}
 	st.countryStatsMu.RUnlock()
 
+	st.frequencyStatsMu.RLock()
+	frequencyStats := make(map[string]*FrequencyStats)
+	for k, v := range st.frequencyStats {
+		statsCopy := *v
+		statsCopy.Histogram = make([]int, len(v.Histogram))
+		copy(statsCopy.Histogram, v.Histogram)
+		frequencyStats[k] = &statsCopy
+	}
+	st.frequencyStatsMu.RUnlock()
+
 	st.mapSpotsMu.RLock()
 	mapSpots := make(map[string]*SpotLocation)
 	for k, v := range st.mapSpots {
-		mapSpots[k] = v
+		mapSpots[k] = copySpotLocation(v)
 	}
 	st.mapSpotsMu.RUnlock()
 
@@ -877,16 +1639,44 @@ func (st *StatisticsTracker) SaveToFileWithReporters(filename string, wsprnetSta
 	for band, instances := range st.snrHistory {
 		snrHistory[band] = make(map[string][]SNRHistoryPoint)
 		for inst, points := range instances {
-			snrHistory[band][inst] = points
+			snrHistory[band][inst] = append([]SNRHistoryPoint(nil), points...)
 		}
 	}
 	st.snrHistoryMu.RUnlock()
 
+	// Snapshot the window being built so a restart mid-window can pick it up
+	st.currentWindowMu.Lock()
+	var currentWindow *WindowStats
+	if st.currentWindow != nil {
+		currentWindow = st.currentWindow.clone()
+	}
+	st.currentWindowMu.Unlock()
+
+	st.currentWindowSNRMu.Lock()
+	currentWindowSNR := make(map[string]*WindowSNRSnapshot)
+	for window, accumulated := range st.currentWindowSNR {
+		for k, v := range accumulated {
+			currentWindowSNR[fmt.Sprintf("%s@%d", k, window)] = &WindowSNRSnapshot{
+				Window:        window,
+				Band:          k.band,
+				Instance:      k.instance,
+				TotalSNR:      v.totalSNR,
+				Count:         v.count,
+				SNRCount:      v.snrCount,
+				TotalDistance: v.totalDistance,
+				DistanceCount: v.distanceCount,
+			}
+		}
+	}
+	st.currentWindowSNRMu.Unlock()
+
 	st.statsMu.RLock()
 	totalStats := OverallStats{
 		TotalSubmitted:  st.totalSubmitted,
 		TotalDuplicates: st.totalDuplicates,
 		TotalUnique:     st.totalUnique,
+		HashedCallsigns: copyCounts(st.hashedCallsigns),
+		TotalImported:   st.totalImported,
 	}
 	st.statsMu.RUnlock()
 
@@ -910,6 +1700,9 @@ func (st *StatisticsTracker) SaveToFileWithReporters(filename string, wsprnetSta
 		if successful, ok := pskReporterStats["successful"].(int); ok {
 			pskReporterStatsData.Successful = successful
 		}
+		if failed, ok := pskReporterStats["failed"].(int); ok {
+			pskReporterStatsData.Failed = failed
+		}
 	}
 
 	// Create persistence data structure
@@ -920,51 +1713,60 @@ func (st *StatisticsTracker) SaveToFileWithReporters(filename string, wsprnetSta
 		CountryStats:     countryStats,
 		MapSpots:         mapSpots,
 		SNRHistory:       snrHistory,
+		FrequencyStats:   frequencyStats,
 		TotalStats:       totalStats,
 		WSPRNetStats:     wsprnetStatsData,
 		PSKReporterStats: pskReporterStatsData,
+		CurrentWindow:    currentWindow,
+		CurrentWindowSNR: currentWindowSNR,
 	}
+	data.InstanceCountryHours = st.copyInstanceCountryHours()
 
-	// Marshal to JSON
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+	// Encode in the configured format
+	encoded, err := encodePersistence(&data, st.persistenceFormat)
 	if err != nil {
 		return fmt.Errorf("failed to marshal persistence data: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(filename, jsonData, 0644); err != nil {
+	return st.writePersistenceFile(filename, encoded)
+}
+
+// writePersistenceFile atomically replaces the persistence file with encoded
+// data, keeping the previous save as a backup
+func (st *StatisticsTracker) writePersistenceFile(filename string, encoded []byte) error {
+	st.saveMu.Lock()
+	defer st.saveMu.Unlock()
+
+	if err := writeFileAtomic(filename, encoded, 0644, persistenceBackupPath(filename)); err != nil {
 		return fmt.Errorf("failed to write persistence file: %w", err)
 	}
-
 	return nil
 }
 
-// LoadFromFile loads all statistics from a JSON file and filters to last 24 hours
+// LoadFromFile loads all statistics from a JSON file; history older than the
+// retention period is dropped at the next cleanup
 // Returns WSPRNet and PSKReporter stats separately so they can be restored to the clients
 func (st *StatisticsTracker) LoadFromFile(filename string) (*WSPRNetStats, *PSKReporterStats, error) {
-	// Check if file exists
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
+	// Decode data (JSON or gob, detected from the file contents), or the
+	// previous save if the file is damaged
+	var data PersistenceData
+	format, err := readPersistence(filename, &data)
+	if errors.Is(err, os.ErrNotExist) {
 		// File doesn't exist yet, that's okay
 		return nil, nil, nil
 	}
-
-	// Read file
-	jsonData, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read persistence file: %w", err)
+		return nil, nil, err
 	}
-
-	// Unmarshal data
-	var data PersistenceData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, nil, fmt.Errorf("failed to unmarshal persistence data: %w", err)
+	if format != st.persistenceFormat {
+		log.Printf("Persistence file %s is %s encoded; it will be rewritten as %s on the next save", filename, format, st.persistenceFormat)
 	}
 
 	// Restore all windows (will be filtered at query time and cleaned up periodically)
 	st.recentWindowsMu.Lock()
 	st.recentWindows = data.Windows
 	if st.recentWindows == nil {
-		st.recentWindows = make([]*WindowStats, 0, 720)
+		st.recentWindows = make([]*WindowStats, 0, st.MaxWindows())
 	}
 	st.recentWindowsMu.Unlock()
 
@@ -984,6 +1786,11 @@ func (st *StatisticsTracker) LoadFromFile(filename string) (*WSPRNetStats, *PSKR
 		for _, cs := range v.UniqueCallsigns {
 			callsignsMap[cs] = true
 		}
+		// Files written before snr_count existed counted every spot towards the SNR total
+		snrCount := v.SNRCount
+		if snrCount == 0 && v.TotalSNR != 0 {
+			snrCount = v.Count
+		}
 		st.countryStats[k] = &CountryStats{
 			Country:         v.Country,
 			Band:            v.Band,
@@ -991,17 +1798,54 @@ func (st *StatisticsTracker) LoadFromFile(filename string) (*WSPRNetStats, *PSKR
 			MinSNR:          v.MinSNR,
 			MaxSNR:          v.MaxSNR,
 			TotalSNR:        v.TotalSNR,
+			SNRCount:        snrCount,
 			Count:           v.Count,
 		}
 	}
 	st.countryStatsMu.Unlock()
 
+	// Restore instance/country counts; stale hours are pruned at the next cleanup
+	st.instanceCountryMu.Lock()
+	st.instanceCountryHours = data.InstanceCountryHours
+	if st.instanceCountryHours == nil {
+		st.instanceCountryHours = make(map[int64]map[string]map[string]int)
+	}
+	st.instanceCountryMu.Unlock()
+
+	// Restore frequency stats
+	st.frequencyStatsMu.Lock()
+	st.frequencyStats = make(map[string]*FrequencyStats)
+	for band, v := range data.FrequencyStats {
+		if len(v.Histogram) != freqHistogramBins {
+			continue
+		}
+		st.frequencyStats[band] = v
+	}
+	st.frequencyStatsMu.Unlock()
+
 	// Restore map spots
 	st.mapSpotsMu.Lock()
 	st.mapSpots = data.MapSpots
 	if st.mapSpots == nil {
 		st.mapSpots = make(map[string]*SpotLocation)
 	}
+	for _, spot := range st.mapSpots {
+		// Older files have no heard times; take them from the instances that
+		// heard the spot, or failing that start the retention period now
+		if spot.LastHeard.IsZero() {
+			for _, heard := range spot.HeardBy {
+				if heard.After(spot.LastHeard) {
+					spot.LastHeard = heard
+				}
+			}
+			if spot.LastHeard.IsZero() {
+				spot.LastHeard = time.Now()
+			}
+		}
+		if spot.FirstHeard.IsZero() {
+			spot.FirstHeard = spot.LastHeard
+		}
+	}
 	st.mapSpotsMu.Unlock()
 
 	// Restore SNR history (will be filtered at query time and cleaned up periodically)
@@ -1010,6 +1854,16 @@ func (st *StatisticsTracker) LoadFromFile(filename string) (*WSPRNetStats, *PSKR
 	if st.snrHistory == nil {
 		st.snrHistory = make(map[string]map[string][]SNRHistoryPoint)
 	}
+	// Files written before snr_count existed counted every spot towards the average
+	for _, instances := range st.snrHistory {
+		for _, points := range instances {
+			for i := range points {
+				if points[i].SNRCount == 0 && points[i].AverageSNR != 0 {
+					points[i].SNRCount = points[i].SpotCount
+				}
+			}
+		}
+	}
 	st.snrHistoryMu.Unlock()
 
 	// Restore overall stats
@@ -1017,8 +1871,39 @@ func (st *StatisticsTracker) LoadFromFile(filename string) (*WSPRNetStats, *PSKR
 	st.totalSubmitted = data.TotalStats.TotalSubmitted
 	st.totalDuplicates = data.TotalStats.TotalDuplicates
 	st.totalUnique = data.TotalStats.TotalUnique
+	st.hashedCallsigns = data.TotalStats.HashedCallsigns
+	st.totalImported = data.TotalStats.TotalImported
 	st.statsMu.Unlock()
 
+	// Restore the in-progress window if the file was saved recently enough
+	// for it to still belong to an open window
+	if age := time.Since(data.SavedAt); age <= st.inProgressRestoreMaxAge() && (data.CurrentWindow != nil || len(data.CurrentWindowSNR) > 0) {
+		st.currentWindowMu.Lock()
+		st.currentWindow = data.CurrentWindow
+		st.currentWindowMu.Unlock()
+
+		st.currentWindowSNRMu.Lock()
+		for name, v := range data.CurrentWindowSNR {
+			k, ok := v.key(name)
+			if !ok {
+				log.Printf("Warning: Skipping in-progress window data with unreadable key %q", name)
+				continue
+			}
+			// Older files have no window; their data is carried into the
+			// first window finished
+			acc := st.windowSNRAccumulator(v.Window, k)
+			acc.totalSNR += v.TotalSNR
+			acc.count += v.Count
+			acc.snrCount += v.SNRCount
+			acc.totalDistance += v.TotalDistance
+			acc.distanceCount += v.DistanceCount
+		}
+		st.currentWindowSNRMu.Unlock()
+
+		log.Printf("Restored in-progress window data for %d band/instance pairs (saved %s ago)",
+			len(data.CurrentWindowSNR), age.Round(time.Second))
+	}
+
 	// Return WSPRNet and PSKReporter stats for restoration
 	return &data.WSPRNetStats, &data.PSKReporterStats, nil
 }
@@ -1032,27 +1917,102 @@ func (st *StatisticsTracker) GetOverallStats() map[string]interface{} {
 		"total_submitted":  st.totalSubmitted,
 		"total_duplicates": st.totalDuplicates,
 		"total_unique":     st.totalUnique,
+		"hashed_callsigns": copyCounts(st.hashedCallsigns),
+		"total_imported":   st.totalImported,
 	}
 }
 
+// RecordHashedCallsign counts a decode whose callsign was the unresolved hash "<...>"
+func (st *StatisticsTracker) RecordHashedCallsign(band string) {
+	st.statsMu.Lock()
+	defer st.statsMu.Unlock()
+
+	if st.hashedCallsigns == nil {
+		st.hashedCallsigns = make(map[string]int)
+	}
+	st.hashedCallsigns[band]++
+}
+
+// copyCounts returns a copy of a string -> count map, never nil
+func copyCounts(counts map[string]int) map[string]int {
+	result := make(map[string]int, len(counts))
+	for k, v := range counts {
+		result[k] = v
+	}
+	return result
+}
+
 // GetCurrentSpots returns spots for mapping from the last 24 hours
 func (st *StatisticsTracker) GetCurrentSpots() []*SpotLocation {
+	// Work out which instances are online before taking the map lock
+	now := time.Now()
+	online := make(map[string]bool)
+	st.instancesMu.RLock()
+	for name, instance := range st.instances {
+		if st.isOnline(instance.LastReportTime, now) {
+			online[name] = true
+		}
+	}
+	st.instancesMu.RUnlock()
+
 	st.mapSpotsMu.RLock()
 	defer st.mapSpotsMu.RUnlock()
 
 	result := make([]*SpotLocation, 0, len(st.mapSpots))
 	for _, spot := range st.mapSpots {
-		// Create a copy to avoid race conditions
-		spotCopy := &SpotLocation{
-			Callsign: spot.Callsign,
-			Locator:  spot.Locator,
-			Bands:    make([]string, len(spot.Bands)),
-			SNR:      make([]int, len(spot.SNR)),
-			Country:  spot.Country,
-		}
-		copy(spotCopy.Bands, spot.Bands)
-		copy(spotCopy.SNR, spot.SNR)
-		result = append(result, spotCopy)
+		if !heardByOnlineInstance(spot, online) {
+			continue
+		}
+
+		result = append(result, copySpotLocation(spot))
+	}
+	return result
+}
+
+// GetSpotLocation returns the map spot for callsign, heard within the last 24
+// hours, whether or not the instances that heard it are online
+func (st *StatisticsTracker) GetSpotLocation(callsign string) (*SpotLocation, bool) {
+	st.mapSpotsMu.RLock()
+	defer st.mapSpotsMu.RUnlock()
+
+	spot, ok := st.mapSpots[callsign]
+	if !ok {
+		return nil, false
+	}
+	return copySpotLocation(spot), true
+}
+
+// copySpotLocation returns a copy of spot that shares no slices or maps with it
+func copySpotLocation(spot *SpotLocation) *SpotLocation {
+	spotCopy := *spot
+	spotCopy.Bands = append([]string(nil), spot.Bands...)
+	spotCopy.SNR = append([]int(nil), spot.SNR...)
+	spotCopy.HeardBy = copyHeardBy(spot.HeardBy)
+	return &spotCopy
+}
+
+// heardByOnlineInstance reports whether at least one online instance heard the spot.
+// Spots loaded from older persistence files have no HeardBy and are always kept.
+func heardByOnlineInstance(spot *SpotLocation, online map[string]bool) bool {
+	if len(spot.HeardBy) == 0 {
+		return true
+	}
+	for name := range spot.HeardBy {
+		if online[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// copyHeardBy returns a copy of a spot's HeardBy map
+func copyHeardBy(heardBy map[string]time.Time) map[string]time.Time {
+	if heardBy == nil {
+		return nil
+	}
+	result := make(map[string]time.Time, len(heardBy))
+	for k, v := range heardBy {
+		result[k] = v
 	}
 	return result
 }
@@ -1072,12 +2032,11 @@ func (st *StatisticsTracker) GetInstancePerformance() map[string][]InstancePerfo
 	// Key: instance name -> list of performance points
 	result := make(map[string][]InstancePerformancePoint)
 
-	// Calculate cutoff time (24 hours ago)
-	cutoff := time.Now().Add(-24 * time.Hour)
+	cutoff := time.Now().Add(-st.retention)
 
-	// Process each window (only include windows from last 24 hours)
+	// Process each window (only include windows from the retention period)
 	for _, window := range st.recentWindows {
-		// Skip windows older than 24 hours
+		// Skip windows older than the retention period
 		if window.WindowTime.Before(cutoff) {
 			continue
 		}
@@ -1123,15 +2082,14 @@ func (st *StatisticsTracker) GetInstancePerformanceRaw() map[string][]InstancePe
 	// Key: instance name -> list of performance points
 	result := make(map[string][]InstancePerformancePoint)
 
-	// Calculate cutoff time (24 hours ago)
-	cutoff := time.Now().Add(-24 * time.Hour)
+	cutoff := time.Now().Add(-st.retention)
 
-	// Collect all unique window times across all bands (only from last 24 hours)
+	// Collect all unique window times across all bands (only from the retention period)
 	windowTimes := make(map[time.Time]bool)
 	for _, instances := range st.snrHistory {
 		for _, points := range instances {
 			for _, point := range points {
-				// Skip points older than 24 hours
+				// Skip points older than the retention period
 				if point.WindowTime.Before(cutoff) {
 					continue
 				}
@@ -1149,7 +2107,7 @@ func (st *StatisticsTracker) GetInstancePerformanceRaw() map[string][]InstancePe
 				instanceWindows[instance] = make(map[time.Time]int)
 			}
 			for _, point := range points {
-				// Skip points older than 24 hours
+				// Skip points older than the retention period
 				if point.WindowTime.Before(cutoff) {
 					continue
 				}
@@ -1191,12 +2149,20 @@ func (st *StatisticsTracker) ClearAllStatistics() {
 	st.countryStats = make(map[string]*CountryStats)
 	st.countryStatsMu.Unlock()
 
+	st.frequencyStatsMu.Lock()
+	st.frequencyStats = make(map[string]*FrequencyStats)
+	st.frequencyStatsMu.Unlock()
+
+	st.instanceCountryMu.Lock()
+	st.instanceCountryHours = make(map[int64]map[string]map[string]int)
+	st.instanceCountryMu.Unlock()
+
 	st.mapSpotsMu.Lock()
 	st.mapSpots = make(map[string]*SpotLocation)
 	st.mapSpotsMu.Unlock()
 
 	st.recentWindowsMu.Lock()
-	st.recentWindows = make([]*WindowStats, 0, 720)
+	st.recentWindows = make([]*WindowStats, 0, st.MaxWindows())
 	st.recentWindowsMu.Unlock()
 
 	st.snrHistoryMu.Lock()
@@ -1204,16 +2170,15 @@ func (st *StatisticsTracker) ClearAllStatistics() {
 	st.snrHistoryMu.Unlock()
 
 	st.currentWindowSNRMu.Lock()
-	st.currentWindowSNR = make(map[string]*struct {
-		totalSNR, count, totalDistance int
-		distanceCount                  int
-	})
+	st.currentWindowSNR = make(map[int64]map[bandInstanceKey]*windowSNRAccumulator)
 	st.currentWindowSNRMu.Unlock()
 
 	st.statsMu.Lock()
 	st.totalSubmitted = 0
 	st.totalDuplicates = 0
 	st.totalUnique = 0
+	st.hashedCallsigns = nil
+	st.totalImported = 0
 	st.statsMu.Unlock()
 
 	log.Println("All statistics cleared from memory")
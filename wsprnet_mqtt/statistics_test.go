@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestStatisticsTracker returns a tracker with a receiver location, so
+// spots get distances, that is closed when the test ends
+func newTestStatisticsTracker(t *testing.T) *StatisticsTracker {
+	t.Helper()
+
+	st := NewStatisticsTracker()
+	st.SetReceiverLocation("IO91wm")
+	t.Cleanup(st.Close)
+	return st
+}
+
+// TestSaveWhileRecording saves the statistics while spots are being recorded
+// into the same instances and bands. Run with -race: saving must not read the
+// instance and band stats RecordSpot is updating.
+func TestSaveWhileRecording(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	const recorders = 4
+	const saves = 20
+	bands := []string{"20m", "40m"}
+
+	// Record until the saves are done, so every save overlaps recording
+	done := make(chan struct{})
+	var recorded atomic.Int64
+	var wg sync.WaitGroup
+	for r := 0; r < recorders; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			instance := fmt.Sprintf("kiwi%d", r%2)
+			other := fmt.Sprintf("kiwi%d", (r+1)%2)
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				band := bands[i%len(bands)]
+				callsign := fmt.Sprintf("K%dA%c", r, 'A'+i%26)
+				st.RecordSpot(time.Now(), instance, band, callsign, "United States", "FN31pr", -10+i%20, true)
+				st.RecordTxFrequency(band, 14097100)
+				st.RecordDuplicate(instance, band, other)
+				st.RecordTiedSNR(instance, band, []string{other})
+				recorded.Add(1)
+			}
+		}(r)
+	}
+
+	for i := 0; i < saves; i++ {
+		if err := st.SaveToFile(path); err != nil {
+			close(done)
+			wg.Wait()
+			t.Fatalf("SaveToFile while recording: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// A save after recording has stopped holds every spot
+	if err := st.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	loaded := newTestStatisticsTracker(t)
+	if _, _, err := loaded.LoadFromFile(path); err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	total := 0
+	for _, inst := range loaded.GetInstanceStats() {
+		total += inst.TotalSpots
+	}
+	if want := int(recorded.Load()); total != want {
+		t.Errorf("loaded %d spots, want %d", total, want)
+	}
+}
+
+// TestCurrentSpotsWhileRecording reads the live map spots, which saving also
+// copies, while spots for the same callsigns are recorded. Run with -race.
+func TestCurrentSpotsWhileRecording(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			st.RecordSpot(time.Now(), fmt.Sprintf("kiwi%d", i%2), "20m", fmt.Sprintf("K1A%c", 'A'+i%26), "United States", "FN31pr", i%20, true)
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		for _, spot := range st.GetCurrentSpots() {
+			if len(spot.Bands) != len(spot.SNR) {
+				t.Errorf("%s: %d bands but %d SNRs", spot.Callsign, len(spot.Bands), len(spot.SNR))
+			}
+			for instance, heard := range spot.HeardBy {
+				if heard.IsZero() {
+					t.Errorf("%s: zero heard time for %s", spot.Callsign, instance)
+				}
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestRecentWindowsWhileFinishing reads and modifies the recent windows while
+// new ones are being finished. Run with -race: the windows returned must be
+// copies that share nothing with the history or the window being built.
+func TestRecentWindowsWhileFinishing(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+
+	// Finish windows until the readers are done, so every read overlaps one
+	done := make(chan struct{})
+	first := make(chan struct{})
+	finished := make(chan int)
+	go func() {
+		start := time.Now().Truncate(2 * time.Minute).Add(-12 * time.Hour)
+		i := 0
+		for ; ; i++ {
+			select {
+			case <-done:
+				finished <- i
+				return
+			default:
+			}
+			st.StartWindow(start.Add(time.Duration(i%360) * 2 * time.Minute))
+			st.RecordUnique("kiwi1", "20m", "K1ABC")
+			st.RecordBestSNR("kiwi1", "20m")
+			st.RecordTiedSNR("kiwi2", "20m", []string{"kiwi3"})
+			breakdown := map[string]int{"20m": 2, "40m": 1}
+			st.FinishWindow(3, 1, 0, breakdown)
+			// The caller's map is not kept either
+			breakdown["20m"] = 50
+			if i == 0 {
+				close(first)
+			}
+		}
+	}()
+
+	// Start reading once there is a window, even with a single CPU
+	<-first
+	var wg sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for _, window := range st.GetRecentWindows(20) {
+					if _, err := json.Marshal(window); err != nil {
+						t.Errorf("marshal window: %v", err)
+						return
+					}
+					total := 0
+					for _, count := range window.BandBreakdown {
+						total += count
+					}
+					if total != window.TotalSpots {
+						t.Errorf("window %s: band breakdown totals %d, want %d", window.WindowTime, total, window.TotalSpots)
+					}
+					// Changing a copy must not affect the history
+					window.BandBreakdown["20m"] += 100
+					window.BestSNRByInstance["kiwi1"]++
+					window.UniqueByInstance["kiwi1"] = append(window.UniqueByInstance["kiwi1"], "N0CALL")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	if n := <-finished; n == 0 {
+		t.Fatal("no windows finished")
+	}
+
+	for _, window := range st.GetRecentWindows(0) {
+		if window.BandBreakdown["20m"] != 2 || window.BestSNRByInstance["kiwi1"] != 1 || len(window.UniqueByInstance["kiwi1"]) != 1 {
+			t.Fatalf("window %s was changed through a copy: %+v", window.WindowTime, window)
+		}
+	}
+}
+
+func TestWindowSNRSnapshotKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot WindowSNRSnapshot
+		want     bandInstanceKey
+		ok       bool
+	}{
+		{"20m_kiwi1", WindowSNRSnapshot{Band: "20m", Instance: "kiwi1"}, bandInstanceKey{"20m", "kiwi1"}, true},
+		{"20m_kiwi_2", WindowSNRSnapshot{Band: "20m", Instance: "kiwi_2"}, bandInstanceKey{"20m", "kiwi_2"}, true},
+		// Older files only have the map key; the band is up to the first underscore
+		{"20m_kiwi1", WindowSNRSnapshot{}, bandInstanceKey{"20m", "kiwi1"}, true},
+		{"20m_kiwi_2", WindowSNRSnapshot{}, bandInstanceKey{"20m", "kiwi_2"}, true},
+		{"2200m_site_north_a", WindowSNRSnapshot{}, bandInstanceKey{"2200m", "site_north_a"}, true},
+		{"20m", WindowSNRSnapshot{}, bandInstanceKey{}, false},
+		{"20m_", WindowSNRSnapshot{}, bandInstanceKey{}, false},
+		{"_kiwi1", WindowSNRSnapshot{}, bandInstanceKey{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.snapshot.key(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("key(%q) with %+v = %+v, %v, want %+v, %v", tt.name, tt.snapshot, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Keys written for the file parse back to the same band and instance
+	for _, k := range []bandInstanceKey{{"20m", "kiwi_2"}, {"40m", "site_north"}, {"630m", "a_b_c"}} {
+		if got, ok := (&WindowSNRSnapshot{}).key(k.String()); !ok || got != k {
+			t.Errorf("key(%q) = %+v, %v, want %+v", k.String(), got, ok, k)
+		}
+	}
+}
+
+// TestSNRHistoryUnderscoreInstances records, saves and restores an in-progress
+// window for instances with underscores in their names, then checks the SNR
+// history is filed under the whole instance name
+func TestSNRHistoryUnderscoreInstances(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+	window := time.Now().Truncate(2 * time.Minute)
+	st.StartWindow(window)
+	st.RecordSpot(window, "site_north", "20m", "K1ABC", "United States", "FN31pr", -10, true)
+	st.RecordSpot(window, "site_north", "20m", "K1XYZ", "United States", "FN31pr", -20, true)
+	st.RecordSpot(window, "site_south", "20m", "K1ABC", "United States", "FN31pr", -4, true)
+	st.RecordSpot(window, "kiwi_2", "40m", "K1ABC", "United States", "FN31pr", -7, true)
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := st.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	loaded := newTestStatisticsTracker(t)
+	if _, _, err := loaded.LoadFromFile(path); err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+
+	for name, tracker := range map[string]*StatisticsTracker{"recorded": st, "restored": loaded} {
+		tracker.FinishWindow(4, 0, 0, map[string]int{"20m": 3, "40m": 1})
+		history := tracker.GetSNRHistory()
+
+		want := map[string]map[string]float64{
+			"20m": {"site_north": -15, "site_south": -4},
+			"40m": {"kiwi_2": -7},
+		}
+		if len(history) != len(want) {
+			t.Errorf("%s: history for %d bands, want %d", name, len(history), len(want))
+		}
+		for band, instances := range want {
+			if history[band] == nil {
+				t.Errorf("%s: no history for %s", name, band)
+				continue
+			}
+			got := history[band].Instances
+			if len(got) != len(instances) {
+				t.Errorf("%s: %s history for %d instances, want %d", name, band, len(got), len(instances))
+			}
+			for instance, snr := range instances {
+				points := got[instance]
+				if len(points) != 1 || points[0].AverageSNR != snr {
+					t.Errorf("%s: %s %s history = %+v, want one point at %.0f dB", name, band, instance, points, snr)
+				}
+			}
+		}
+	}
+}
+
+// TestSNRHistoryPerWindow keeps the SNR of two open windows apart, as happens
+// when a window is held for a slow instance while the next one fills
+func TestSNRHistoryPerWindow(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+	first := time.Now().Truncate(2 * time.Minute).Add(-4 * time.Minute)
+	second := first.Add(2 * time.Minute)
+
+	st.RecordSpot(first, "kiwi1", "20m", "K1ABC", "United States", "FN31pr", -10, true)
+	st.RecordSpot(second, "kiwi1", "20m", "K1ABC", "United States", "FN31pr", -20, true)
+	st.RecordSpot(second, "kiwi1", "20m", "K1XYZ", "United States", "FN31pr", -24, true)
+
+	for _, window := range []struct {
+		start time.Time
+		snr   []float64
+	}{
+		{first, []float64{-10}},
+		{second, []float64{-10, -22}},
+	} {
+		st.StartWindow(window.start)
+		st.FinishWindow(1, 0, 0, map[string]int{"20m": 1})
+
+		history := st.GetSNRHistory()
+		if history["20m"] == nil {
+			t.Fatalf("after %s: no 20m history", window.start.Format("15:04"))
+		}
+		points := history["20m"].Instances["kiwi1"]
+		if len(points) != len(window.snr) {
+			t.Fatalf("after %s: kiwi1 history = %+v, want %v dB", window.start.Format("15:04"), points, window.snr)
+		}
+		for i, snr := range window.snr {
+			if points[i].AverageSNR != snr {
+				t.Errorf("after %s: kiwi1 history = %+v, want %v dB", window.start.Format("15:04"), points, window.snr)
+			}
+		}
+	}
+}
+
+// TestSNRHistorySNRCountBackfill loads history saved before snr_count existed,
+// where every spot counted towards the average
+func TestSNRHistorySNRCountBackfill(t *testing.T) {
+	st := newTestStatisticsTracker(t)
+	window := time.Now().Truncate(2 * time.Minute)
+	st.snrHistory["20m"] = map[string][]SNRHistoryPoint{
+		"kiwi1": {
+			{WindowTime: window.Add(-4 * time.Minute), AverageSNR: -12.5, SpotCount: 4},
+			// No spot carried an SNR
+			{WindowTime: window.Add(-2 * time.Minute), SpotCount: 2},
+			{WindowTime: window, AverageSNR: -8, SNRCount: 1, SpotCount: 3},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := st.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	loaded := newTestStatisticsTracker(t)
+	if _, _, err := loaded.LoadFromFile(path); err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+
+	points := loaded.GetSNRHistory()["20m"].Instances["kiwi1"]
+	want := []int{4, 0, 1}
+	if len(points) != len(want) {
+		t.Fatalf("kiwi1 history = %+v, want %d points", points, len(want))
+	}
+	for i, count := range want {
+		if points[i].SNRCount != count {
+			t.Errorf("point %d SNR count = %d, want %d", i, points[i].SNRCount, count)
+		}
+	}
+}
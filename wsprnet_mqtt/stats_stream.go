@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// statsStreamKeepAlive is how often a comment is sent to an idle stream so
+// proxies keep the connection open and closed clients are noticed
+const statsStreamKeepAlive = 30 * time.Second
+
+// SubscribeWindows returns a channel that is signalled each time a window
+// finishes, and a function to stop listening. Signals are dropped rather than
+// queued while the listener is busy, so a slow listener only sees the latest.
+func (st *StatisticsTracker) SubscribeWindows() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	st.windowListenersMu.Lock()
+	if st.windowListeners == nil {
+		st.windowListeners = make(map[chan struct{}]bool)
+	}
+	st.windowListeners[ch] = true
+	st.windowListenersMu.Unlock()
+
+	return ch, func() {
+		st.windowListenersMu.Lock()
+		delete(st.windowListeners, ch)
+		st.windowListenersMu.Unlock()
+	}
+}
+
+// notifyWindowFinished signals every window listener without blocking
+func (st *StatisticsTracker) notifyWindowFinished() {
+	st.windowListenersMu.Lock()
+	defer st.windowListenersMu.Unlock()
+
+	for ch := range st.windowListeners {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// handleStatsStream streams the /api/stats object, plus pending_spots, as
+// Server-Sent Events: once on connecting and again each time a window finishes
+func (ws *WebServer) handleStatsStream(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	windows, unsubscribe := ws.stats.SubscribeWindows()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+
+	keepAlive := time.NewTicker(statsStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	send := func() error {
+		stats := ws.stats.GetOverallStats()
+		stats["hashed_callsigns_mode"] = ws.config.Load().HashedCallsigns
+		stats["pending_spots"] = ws.aggregator.GetStats()["pending_spots"]
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if send() != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-windows:
+			if send() != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
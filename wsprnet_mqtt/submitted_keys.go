@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the submitted spot key store
+const (
+	DefaultSubmittedKeysFile  = "wsprnet_submitted.jsonl"
+	DefaultSubmittedKeysHours = 24
+)
+
+// submittedKeysCompactInterval is how often expired keys are dropped and the file rewritten
+const submittedKeysCompactInterval = time.Hour
+
+// spotIdempotencyKey identifies a spot independently of which instance heard it
+// or when it was uploaded: callsign, band, WSPR slot and grid
+func spotIdempotencyKey(report *WSPRReport) string {
+	slot := (report.EpochTime.Unix() / 120) * 120
+	return fmt.Sprintf("%s_%s_%d_%s", strings.ToUpper(report.Callsign), frequencyToBand(report.Frequency), slot, strings.ToUpper(report.Locator))
+}
+
+// submittedKeyEntry is one line of the key file
+type submittedKeyEntry struct {
+	Key      string    `json:"key"`
+	Accepted time.Time `json:"accepted"`
+}
+
+// SubmittedKeys is a persistent set of idempotency keys for spots WSPRNet has
+// accepted. Keys are appended to a file as soon as an upload succeeds so that
+// spots decoded again after a crash or restart are not uploaded twice.
+type SubmittedKeys struct {
+	path   string
+	maxAge time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]time.Time // Key -> time WSPRNet accepted it
+	file        *os.File
+	lastCompact time.Time
+}
+
+// NewSubmittedKeys loads the key file at path, dropping keys older than maxAge,
+// and opens it for appending
+func NewSubmittedKeys(path string, maxAge time.Duration) (*SubmittedKeys, error) {
+	sk := &SubmittedKeys{
+		path:   path,
+		maxAge: maxAge,
+		keys:   make(map[string]time.Time),
+	}
+
+	if err := sk.load(); err != nil {
+		return nil, err
+	}
+	if err := sk.compact(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("WSPRNet: Loaded %d submitted spot keys from %s", len(sk.keys), path)
+	return sk, nil
+}
+
+// load reads the key file, if it exists. Unreadable lines (e.g. one cut short
+// by a crash) are skipped.
+func (sk *SubmittedKeys) load() error {
+	f, err := os.Open(sk.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open submitted keys file: %w", err)
+	}
+	defer f.Close()
+
+	cutoff := time.Now().Add(-sk.maxAge)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry submittedKeyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Key == "" {
+			continue
+		}
+		if entry.Accepted.After(cutoff) {
+			sk.keys[entry.Key] = entry.Accepted
+		}
+	}
+	return scanner.Err()
+}
+
+// compact drops expired keys and rewrites the file with the remainder. The new
+// file replaces the old one atomically. Caller must hold mu or be the constructor.
+func (sk *SubmittedKeys) compact() error {
+	cutoff := time.Now().Add(-sk.maxAge)
+	for key, accepted := range sk.keys {
+		if !accepted.After(cutoff) {
+			delete(sk.keys, key)
+		}
+	}
+
+	tmpPath := sk.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create submitted keys file: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for key, accepted := range sk.keys {
+		if err := enc.Encode(submittedKeyEntry{Key: key, Accepted: accepted}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write submitted keys file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write submitted keys file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync submitted keys file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close submitted keys file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, sk.path); err != nil {
+		return fmt.Errorf("failed to replace submitted keys file: %w", err)
+	}
+	if sk.file != nil {
+		sk.file.Close()
+		sk.file = nil
+	}
+
+	f, err := os.OpenFile(sk.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open submitted keys file: %w", err)
+	}
+	sk.file = f
+	sk.lastCompact = time.Now()
+	return nil
+}
+
+// Contains reports whether WSPRNet has already accepted a spot with this key
+func (sk *SubmittedKeys) Contains(key string) bool {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+
+	accepted, ok := sk.keys[key]
+	return ok && time.Since(accepted) < sk.maxAge
+}
+
+// Add records keys as accepted and syncs them to disk before returning
+func (sk *SubmittedKeys) Add(keys []string) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+
+	if time.Since(sk.lastCompact) >= submittedKeysCompactInterval {
+		if err := sk.compact(); err != nil {
+			log.Printf("WSPRNet: Failed to compact submitted keys: %v", err)
+		}
+	}
+
+	now := time.Now()
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	for _, key := range keys {
+		sk.keys[key] = now
+		enc.Encode(submittedKeyEntry{Key: key, Accepted: now})
+	}
+
+	if sk.file == nil {
+		return
+	}
+	if _, err := sk.file.WriteString(buf.String()); err != nil {
+		log.Printf("WSPRNet: Failed to record submitted keys: %v", err)
+		return
+	}
+	if err := sk.file.Sync(); err != nil {
+		log.Printf("WSPRNet: Failed to sync submitted keys: %v", err)
+	}
+}
+
+// Len returns the number of keys currently held
+func (sk *SubmittedKeys) Len() int {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	return len(sk.keys)
+}
+
+// Close closes the key file
+func (sk *SubmittedKeys) Close() error {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+
+	if sk.file == nil {
+		return nil
+	}
+	err := sk.file.Close()
+	sk.file = nil
+	return err
+}
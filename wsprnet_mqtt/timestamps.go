@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodeTimeLayouts are the text timestamp formats accepted from publishers.
+// Layouts without a zone are taken as UTC. Fractional seconds are accepted
+// after the seconds field in all of them.
+var decodeTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+}
+
+// epochMillisThreshold separates epoch seconds from milliseconds: as seconds it
+// is in the year 5138, as milliseconds in 1973
+const epochMillisThreshold = 1e11
+
+// parseDecodeTimestamp parses a decode's timestamp field, which may be an RFC3339
+// string, an RFC3339 string without a zone (assumed UTC), or Unix epoch seconds
+// or milliseconds given as a number or a numeric string. The result is in UTC.
+func parseDecodeTimestamp(raw json.RawMessage) (time.Time, error) {
+	value := strings.TrimSpace(string(raw))
+	if value == "" || value == "null" {
+		return time.Time{}, fmt.Errorf("missing timestamp")
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %s", raw)
+		}
+		value = strings.TrimSpace(value)
+	}
+
+	if epoch, err := strconv.ParseFloat(value, 64); err == nil {
+		return parseEpoch(epoch)
+	}
+
+	for _, layout := range decodeTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp format %q", value)
+}
+
+// parseEpoch converts Unix epoch seconds or milliseconds to a UTC time
+func parseEpoch(epoch float64) (time.Time, error) {
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) || epoch <= 0 {
+		return time.Time{}, fmt.Errorf("invalid epoch timestamp %v", epoch)
+	}
+	if epoch >= epochMillisThreshold {
+		return time.UnixMilli(int64(epoch)).UTC(), nil
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Default and largest number of entries returned by /api/top-dx
+const (
+	defaultTopDXLimit = 10
+	maxTopDXLimit     = 500
+)
+
+// TopDXEntry is one callsign on one band in the farthest-spots ranking
+type TopDXEntry struct {
+	Callsign   string  `json:"callsign"`
+	Country    string  `json:"country"`
+	Locator    string  `json:"locator"`
+	Band       string  `json:"band"`
+	DistanceKm float64 `json:"distance_km"`
+	SNR        int     `json:"snr"` // Latest SNR on the band
+}
+
+// GetTopDX ranks the map spots from the last 24 hours by distance from the
+// receiver, farthest first, with one entry per callsign and band. band limits
+// it to one band when set. Spots with an unusable locator are left out, as is
+// everything if the receiver location is unset.
+func (st *StatisticsTracker) GetTopDX(band string, limit int) []TopDXEntry {
+	entries := make([]TopDXEntry, 0)
+	for _, spot := range st.GetCurrentSpots() {
+		path, ok := st.DistanceTo(spot.Locator)
+		if !ok {
+			continue
+		}
+		for i, spotBand := range spot.Bands {
+			if band != "" && spotBand != band {
+				continue
+			}
+			entry := TopDXEntry{
+				Callsign:   spot.Callsign,
+				Country:    spot.Country,
+				Locator:    spot.Locator,
+				Band:       spotBand,
+				DistanceKm: path.Km,
+			}
+			if i < len(spot.SNR) {
+				entry.SNR = spot.SNR[i]
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.DistanceKm != b.DistanceKm {
+			return a.DistanceKm > b.DistanceKm
+		}
+		if a.Callsign != b.Callsign {
+			return a.Callsign < b.Callsign
+		}
+		return bandLess(a.Band, b.Band)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// handleTopDX returns the farthest stations heard in the last 24 hours, with
+// optional band and limit query parameters
+func (ws *WebServer) handleTopDX(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	limit := defaultTopDXLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTopDXLimit {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a whole number from 1 to %d", maxTopDXLimit))
+			return
+		}
+		limit = n
+	}
+
+	band := r.URL.Query().Get("band")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"band":  band,
+		"limit": limit,
+		"spots": ws.stats.GetTopDX(band, limit),
+	})
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -16,16 +25,22 @@ type WebServer struct {
 	stats        *StatisticsTracker
 	aggregator   *SpotAggregator
 	wsprnet      *WSPRNet
-	config       *Config
+	config       *SharedConfig
 	port         int
 	adminHandler *AdminHandler
 	configFile   string
 	mqttClient   *MQTTClient
 	spotWriter   *SpotWriter
+	reconciler   *Reconciler // nil unless wsprnet.reconcile is enabled
+	backfiller   *Backfiller // nil unless backfill is enabled
+	safeMode     string      // Why the application started in safe mode; empty normally
+
+	// nil when PSKReporter is disabled or in dry run mode
+	pskReporter *PSKReporter
 }
 
 // NewWebServer creates a new web server
-func NewWebServer(stats *StatisticsTracker, aggregator *SpotAggregator, wsprnet *WSPRNet, config *Config, port int, configFile string, mqttClient *MQTTClient, spotWriter *SpotWriter) *WebServer {
+func NewWebServer(stats *StatisticsTracker, aggregator *SpotAggregator, wsprnet *WSPRNet, config *SharedConfig, port int, configFile string, mqttClient *MQTTClient, spotWriter *SpotWriter) *WebServer {
 	return &WebServer{
 		stats:        stats,
 		aggregator:   aggregator,
@@ -39,27 +54,60 @@ func NewWebServer(stats *StatisticsTracker, aggregator *SpotAggregator, wsprnet
 	}
 }
 
+// SetConfigReloader lets config changes saved from the admin page be applied
+// without a restart (restart_on_save: false)
+func (ws *WebServer) SetConfigReloader(reloader *ConfigReloader) {
+	ws.adminHandler.reloader = reloader
+}
+
+// SetSafeMode marks the server as running in safe mode, with the reason shown
+// in /api/health and on the admin page
+func (ws *WebServer) SetSafeMode(reason string) {
+	ws.safeMode = reason
+}
+
 // Start starts the web server
 func (ws *WebServer) Start() error {
-	// API endpoints
-	http.HandleFunc("/api/stats", ws.handleStats)
-	http.HandleFunc("/api/instances", ws.handleInstances)
-	http.HandleFunc("/api/windows", ws.handleWindows)
-	http.HandleFunc("/api/aggregator", ws.handleAggregator)
-	http.HandleFunc("/api/countries", ws.handleCountries)
-	http.HandleFunc("/api/spots", ws.handleSpots)
-	http.HandleFunc("/api/wsprnet", ws.handleWSPRNet)
-	http.HandleFunc("/api/snr-history", ws.handleSNRHistory)
-	http.HandleFunc("/api/receiver", ws.handleReceiver)
-	http.HandleFunc("/api/instance-performance", ws.handleInstancePerformance)
-	http.HandleFunc("/api/instance-performance-raw", ws.handleInstancePerformanceRaw)
-	http.HandleFunc("/api/mqtt/status", ws.handleMQTTStatus)
+	// API endpoints (all carry X-API-Version and honour Accept-Version)
+	http.HandleFunc("/api/stats", withAPIVersion(ws.handleStats))
+	http.HandleFunc("/api/summary", withAPIVersion(ws.handleSummary))
+	http.HandleFunc("/api/activity", withAPIVersion(ws.handleActivity))
+	http.HandleFunc("/api/instances", withAPIVersion(ws.handleInstances))
+	http.HandleFunc("/api/instances/", withAPIVersion(ws.handleInstance))
+	http.HandleFunc("/api/windows", withAPIVersion(ws.handleWindows))
+	http.HandleFunc("/api/aggregator", withAPIVersion(ws.handleAggregator))
+	http.HandleFunc("/api/window-arrivals", withAPIVersion(ws.handleWindowArrivals))
+	http.HandleFunc("/api/countries", withAPIVersion(ws.handleCountries))
+	http.HandleFunc("/api/countries/summary", withAPIVersion(ws.handleCountriesSummary))
+	http.HandleFunc("/api/dxcc-summary", withAPIVersion(ws.handleDXCCSummary))
+	http.HandleFunc("/api/instance-countries", withAPIVersion(ws.handleInstanceCountries))
+	http.HandleFunc("/api/frequencies", withAPIVersion(ws.handleFrequencies))
+	http.HandleFunc("/api/spots", withAPIVersion(ws.handleSpots))
+	http.HandleFunc("/api/spots.csv", withAPIVersion(ws.handleSpotsCSV))
+	http.HandleFunc("/api/top-dx", withAPIVersion(ws.handleTopDX))
+	http.HandleFunc("/api/wsprnet", withAPIVersion(ws.handleWSPRNet))
+	http.HandleFunc("/api/wsprnet/reconcile", withAPIVersion(ws.handleReconcile))
+	http.HandleFunc("/api/pskreporter", withAPIVersion(ws.handlePSKReporter))
+	http.HandleFunc("/api/snr-history", withAPIVersion(ws.handleSNRHistory))
+	http.HandleFunc("/api/snr-alerts", withAPIVersion(ws.handleSNRAlerts))
+	http.HandleFunc("/api/receiver", withAPIVersion(ws.handleReceiver))
+	http.HandleFunc("/api/bands", withAPIVersion(ws.handleBands))
+	http.HandleFunc("/api/instance-performance", withAPIVersion(ws.handleInstancePerformance))
+	http.HandleFunc("/api/instance-performance-raw", withAPIVersion(ws.handleInstancePerformanceRaw))
+	http.HandleFunc("/api/mqtt/status", withAPIVersion(ws.handleMQTTStatus))
+	http.HandleFunc("/api/health", withAPIVersion(ws.handleHealth))
+	http.HandleFunc("/api/stream/stats", withAPIVersion(ws.handleStatsStream))
 
 	// Spot history endpoints
-	http.HandleFunc("/api/spots/raw", ws.handleRawSpots)
-	http.HandleFunc("/api/spots/deduped", ws.handleDedupedSpots)
-	http.HandleFunc("/api/spots/instances", ws.handleSpotInstances)
-	http.HandleFunc("/api/spots/gaps", ws.handleSpotGaps)
+	http.HandleFunc("/api/spots/raw", withAPIVersion(ws.handleRawSpots))
+	http.HandleFunc("/api/spots/deduped", withAPIVersion(ws.handleDedupedSpots))
+	http.HandleFunc("/api/spots/export.csv", withAPIVersion(ws.handleSpotsExportCSV))
+	http.HandleFunc("/api/spots/receptions.jsonl", withAPIVersion(ws.handleSpotReceptions))
+	http.HandleFunc("/api/export/adif", withAPIVersion(ws.handleADIFExport))
+	http.HandleFunc("/api/spots/status", withAPIVersion(ws.handleSpotStatus))
+	http.HandleFunc("/api/spots/instances", withAPIVersion(ws.handleSpotInstances))
+	http.HandleFunc("/api/spots/gaps", withAPIVersion(ws.handleSpotGaps))
+	http.HandleFunc("/api/callsign/", withAPIVersion(ws.handleCallsign))
 
 	// Admin endpoints
 	http.HandleFunc("/admin/login", ws.adminHandler.HandleAdminLogin)
@@ -71,11 +119,24 @@ func (ws *WebServer) Start() error {
 	http.HandleFunc("/admin/api/mqtt/test", ws.adminHandler.AuthMiddleware(ws.handleMQTTTest))
 	http.HandleFunc("/admin/api/kiwi/sync", ws.adminHandler.AuthMiddleware(ws.adminHandler.HandleSyncKiwis))
 	http.HandleFunc("/admin/api/stats/clear", ws.adminHandler.AuthMiddleware(ws.handleClearStats))
+	http.HandleFunc("/admin/api/backfill", ws.adminHandler.AuthMiddleware(ws.handleBackfill))
+	http.HandleFunc("/api/raw-spots", withAPIVersion(ws.adminHandler.AuthMiddleware(ws.handleRawSpotsDownload)))
 	http.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
 	})
 
+	// Prometheus metrics (no admin auth, for scrapers)
+	http.HandleFunc("/metrics", ws.handleMetrics)
+
+	// Health check for load balancers and watchdogs (no admin auth)
+	http.HandleFunc("/health", ws.handleHealthCheck)
+
 	// Dashboard
+	http.HandleFunc("/favicon.ico", ws.handleFavicon)
+	http.HandleFunc("/branding/logo", ws.handleLogo)
+	if ws.config.Load().Dashboard.MapTiles.Dir != "" {
+		http.Handle("/map-tiles/", ws.handleMapTiles())
+	}
 	http.HandleFunc("/", ws.handleDashboard)
 
 	addr := fmt.Sprintf(":%d", ws.port)
@@ -87,7 +148,9 @@ func (ws *WebServer) Start() error {
 	}
 
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
+		// /api responses get CORS headers from allowed_origins, need api_key
+		// if it is set, and are gzipped for clients that accept it
+		if err := http.ListenAndServe(addr, withGzip(ws.withCORS(ws.withAPIKey(http.DefaultServeMux)))); err != nil {
 			log.Printf("Web server error: %v", err)
 		}
 	}()
@@ -97,114 +160,443 @@ func (ws *WebServer) Start() error {
 
 // handleStats returns overall statistics
 func (ws *WebServer) handleStats(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	stats := ws.stats.GetOverallStats()
-	_ = json.NewEncoder(w).Encode(stats)
+	stats["hashed_callsigns_mode"] = ws.config.Load().HashedCallsigns
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleSummary returns a small set of headline numbers for embedded displays
+func (ws *WebServer) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	summary := ws.stats.GetSummary()
+	summary.Pending, _ = ws.aggregator.GetStats()["pending_spots"].(int)
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleActivity returns submission totals and the band breakdown for the
+// last hours hours (default 1), plus per-country statistics for the same range
+func (ws *WebServer) handleActivity(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	hours, err := parseActivityHours(r, defaultActivityHours)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	activity := ws.stats.GetActivity(hours)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"activity":  activity,
+		"countries": ws.countriesSince(hours),
+	})
 }
 
 // handleInstances returns per-instance statistics
 func (ws *WebServer) handleInstances(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	instances := ws.stats.GetInstanceStats()
-	_ = json.NewEncoder(w).Encode(instances)
+	response := make(map[string]*InstanceStatsResponse, len(instances))
+	for name, inst := range instances {
+		ws.prepareInstanceStats(name, inst)
+		response[name] = newInstanceStatsResponse(inst)
+	}
+
+	// Version 1 clients get the original Go field names
+	if requestAPIVersion(r) < 2 {
+		writeJSON(w, http.StatusOK, instances)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleInstance returns the statistics of one instance, including its
+// per-band breakdown and recent callsigns. The name is the last path element,
+// URL-encoded if it contains spaces or other reserved characters.
+func (ws *WebServer) handleInstance(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	// Decode the raw path so an encoded "/" in a name is not taken as a separator
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/instances/"))
+	if err != nil || name == "" {
+		writeJSONError(w, http.StatusBadRequest, "instance name is required: /api/instances/{name}")
+		return
+	}
+
+	inst, ok := ws.stats.GetInstanceStats()[name]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unknown instance %q", name))
+		return
+	}
+	ws.prepareInstanceStats(name, inst)
+
+	// Version 1 clients get the original Go field names
+	if requestAPIVersion(r) < 2 {
+		writeJSON(w, http.StatusOK, inst)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceStatsResponse(inst))
+}
+
+// prepareInstanceStats fills in the display name of a copy of an instance's
+// statistics and converts its distances to the configured unit
+func (ws *WebServer) prepareInstanceStats(name string, inst *InstanceStats) {
+	config := ws.config.Load()
+	inst.DisplayName = config.InstanceDisplayName(name)
+	for _, band := range inst.BandStats {
+		band.MinDistance = distanceInUnit(band.MinDistance, config.DistanceUnit)
+		band.MaxDistance = distanceInUnit(band.MaxDistance, config.DistanceUnit)
+		band.TotalDistance = distanceInUnit(band.TotalDistance, config.DistanceUnit)
+		band.AverageDistance = distanceInUnit(band.AverageDistance, config.DistanceUnit)
+	}
 }
 
 // handleWindows returns recent window statistics
 func (ws *WebServer) handleWindows(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
+
+	// Get every window in the retention period (720 for 24 hours)
+	windows := ws.stats.GetRecentWindows(ws.stats.MaxWindows())
+
+	// Version 1 clients get the original Go field names
+	if requestAPIVersion(r) < 2 {
+		writeJSON(w, http.StatusOK, windows)
+		return
+	}
 
-	// Get last 720 windows (24 hours of history)
-	windows := ws.stats.GetRecentWindows(720)
-	_ = json.NewEncoder(w).Encode(windows)
+	response := make([]*WindowStatsResponse, len(windows))
+	for i, window := range windows {
+		response[i] = newWindowStatsResponse(window)
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 // handleAggregator returns current aggregator state
 func (ws *WebServer) handleAggregator(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	aggStats := ws.aggregator.GetStats()
-	_ = json.NewEncoder(w).Encode(aggStats)
+	writeJSON(w, http.StatusOK, aggStats)
+}
+
+// handleWindowArrivals returns when each instance's reports arrived for the
+// most recent windows, relative to the end of each WSPR cycle
+func (ws *WebServer) handleWindowArrivals(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"submission_deadline": int(ws.aggregator.SubmissionDeadline() / time.Second),
+		"windows":             ws.aggregator.GetWindowArrivals(),
+	})
 }
 
 // handleCountries returns country statistics
 func (ws *WebServer) handleCountries(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
+
+	hours, err := parseActivityHours(r, maxActivityHours)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ws.countriesSince(hours))
+}
+
+// countriesSince returns country statistics for the last hours hours. The full
+// 24 hours come from the country statistics; shorter ranges are counted from
+// the deduplicated spot log.
+func (ws *WebServer) countriesSince(hours int) map[string][]map[string]interface{} {
+	if hours >= maxActivityHours || ws.spotWriter == nil {
+		return ws.stats.GetCountryStats()
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	return countryStatsFromSpots(ws.spotWriter.GetDedupedSpots("", since, time.Time{}, nil))
+}
+
+// handleCountriesSummary returns the number of distinct bands each country was heard on
+func (ws *WebServer) handleCountriesSummary(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"countries": ws.stats.GetCountrySummary(),
+	})
+}
+
+// handleInstanceCountries returns spot counts per instance per country over the last 24 hours
+func (ws *WebServer) handleInstanceCountries(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ws.stats.GetInstanceCountryMatrix())
+}
+
+// handleFrequencies returns transmit frequency offset statistics per band
+func (ws *WebServer) handleFrequencies(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
 
-	countries := ws.stats.GetCountryStats()
-	_ = json.NewEncoder(w).Encode(countries)
+	frequencies := ws.stats.GetFrequencyStats()
+	writeJSON(w, http.StatusOK, frequencies)
 }
 
 // handleSpots returns current spots for mapping
 func (ws *WebServer) handleSpots(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	spots := ws.stats.GetCurrentSpots()
-	_ = json.NewEncoder(w).Encode(spots)
+	writeJSON(w, http.StatusOK, spots)
+}
+
+// handleSpotsCSV serves the map spots from /api/spots as a CSV download, one
+// row per band each callsign was heard on, with an optional band filter
+func (ws *WebServer) handleSpotsCSV(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	band := r.URL.Query().Get("band")
+	spots := ws.stats.GetCurrentSpots()
+	sort.Slice(spots, func(i, j int) bool {
+		return spots[i].Callsign < spots[j].Callsign
+	})
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=wspr_spots.csv")
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"callsign", "locator", "country", "band", "snr", "distance_km"})
+	for _, spot := range spots {
+		// Blank if the locator or receiver location is unusable
+		distance := ""
+		if path, ok := ws.stats.DistanceTo(spot.Locator); ok {
+			distance = strconv.FormatFloat(path.Km, 'f', 1, 64)
+		}
+		for i, spotBand := range spot.Bands {
+			if band != "" && band != "all" && spotBand != band {
+				continue
+			}
+			snr := ""
+			if i < len(spot.SNR) {
+				snr = strconv.Itoa(spot.SNR[i])
+			}
+			cw.Write([]string{spot.Callsign, spot.Locator, spot.Country, spotBand, snr, distance})
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Warning: Spots CSV download ended early: %v", err)
+	}
 }
 
 // handleWSPRNet returns WSPRNet statistics
 func (ws *WebServer) handleWSPRNet(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	wsprnetStats := ws.wsprnet.GetStats()
-	_ = json.NewEncoder(w).Encode(wsprnetStats)
+	writeJSON(w, http.StatusOK, wsprnetStats)
 }
 
 // handleSNRHistory returns SNR history for all bands and instances
 func (ws *WebServer) handleSNRHistory(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	snrHistory := ws.stats.GetSNRHistory()
-	_ = json.NewEncoder(w).Encode(snrHistory)
+	for _, band := range snrHistory {
+		for _, points := range band.Instances {
+			for i := range points {
+				points[i].AverageDistance = distanceInUnit(points[i].AverageDistance, ws.config.Load().DistanceUnit)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, snrHistory)
+}
+
+// SetPSKReporter attaches the PSKReporter client reported at /api/pskreporter
+func (ws *WebServer) SetPSKReporter(pskReporter *PSKReporter) {
+	ws.pskReporter = pskReporter
+}
+
+// handlePSKReporter returns PSKReporter forwarding statistics
+func (ws *WebServer) handlePSKReporter(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.pskReporter == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+	pskStats := ws.pskReporter.GetStats()
+	pskStats["enabled"] = true
+	writeJSON(w, http.StatusOK, pskStats)
+}
+
+// SetReconciler attaches the WSPRNet reconciler served at /api/wsprnet/reconcile
+func (ws *WebServer) SetReconciler(reconciler *Reconciler) {
+	ws.reconciler = reconciler
+}
+
+// handleReconcile returns the latest comparison of submitted spots with WSPRNet's records
+func (ws *WebServer) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.reconciler == nil {
+		writeJSON(w, http.StatusOK, ReconcileReport{Enabled: false, Missing: []StoredSpot{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, ws.reconciler.GetReport())
+}
+
+// SetBackfiller attaches the WSPRNet importer used by /admin/api/backfill
+func (ws *WebServer) SetBackfiller(backfiller *Backfiller) {
+	ws.backfiller = backfiller
+}
+
+// handleBackfill imports this receiver's spots from WSPRNet for a time range
+// (from and to in RFC3339, default the last 24 hours) to fill gaps in the history
+func (ws *WebServer) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.backfiller == nil {
+		writeJSONError(w, http.StatusNotFound, "Backfill is not enabled (set backfill.enabled in the config)")
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+	}
+
+	from, err := parseOptionalTime(req.From)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid from: %v", err))
+		return
+	}
+	to, err := parseOptionalTime(req.To)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid to: %v", err))
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-24 * time.Hour)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	log.Printf("Admin: Backfilling statistics from WSPRNet (%s to %s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	result, err := ws.backfiller.Run(from, to)
+	if errors.Is(err, errBackfillEmptyRange) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, fmt.Sprintf("Backfill failed: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleSNRAlerts returns recent SNR anomaly alerts
+func (ws *WebServer) handleSNRAlerts(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	alerts := ws.stats.GetSNRAlerts()
+	if alerts == nil {
+		alerts = []SNRAlert{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": ws.config.Load().SNRAlerts.Enabled,
+		"alerts":  alerts,
+	})
 }
 
 // handleReceiver returns receiver information from config
 func (ws *WebServer) handleReceiver(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
+	config := ws.config.Load()
 	receiverInfo := map[string]interface{}{
-		"callsign": ws.config.Receiver.Callsign,
-		"locator":  ws.config.Receiver.Locator,
+		"callsign":      config.Receiver.Callsign,
+		"locator":       config.Receiver.Locator,
+		"distance_unit": config.DistanceUnit,
 	}
-	_ = json.NewEncoder(w).Encode(receiverInfo)
+	writeJSON(w, http.StatusOK, receiverInfo)
 }
 
 // handleInstancePerformance returns instance performance data over time
 func (ws *WebServer) handleInstancePerformance(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	performance := ws.stats.GetInstancePerformance()
-	_ = json.NewEncoder(w).Encode(performance)
+	writeJSON(w, http.StatusOK, performance)
 }
 
 // handleInstancePerformanceRaw returns raw instance performance data over time (pre-deduplication)
 func (ws *WebServer) handleInstancePerformanceRaw(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	performance := ws.stats.GetInstancePerformanceRaw()
-	_ = json.NewEncoder(w).Encode(performance)
+	writeJSON(w, http.StatusOK, performance)
 }
 
 // handleMQTTStatus returns the current MQTT connection status
 func (ws *WebServer) handleMQTTStatus(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	if ws.mqttClient == nil {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"connected": false,
 			"error":     "MQTT client not initialized",
 		})
@@ -212,7 +604,104 @@ func (ws *WebServer) handleMQTTStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	status := ws.mqttClient.GetStatus()
-	_ = json.NewEncoder(w).Encode(status)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleHealth reports whether the MQTT connection is up and every instance's
+// topic is subscribed. It returns 503 when degraded so it can back a health
+// check. Clock skew warnings are reported but don't make the service unhealthy.
+func (ws *WebServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.safeMode != "" {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":           "degraded",
+			"safe_mode":        true,
+			"safe_mode_reason": ws.safeMode,
+		})
+		return
+	}
+	if ws.mqttClient == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "degraded",
+			"error":  "MQTT client not initialized",
+		})
+		return
+	}
+
+	connected := ws.mqttClient.client.IsConnected()
+	unsubscribed := ws.mqttClient.UnsubscribedTopics()
+	if unsubscribed == nil {
+		unsubscribed = []string{}
+	}
+
+	clockSkew := ws.aggregator.GetClockSkew()
+
+	status, code := "ok", http.StatusOK
+	if !connected || len(unsubscribed) > 0 {
+		status, code = "degraded", http.StatusServiceUnavailable
+	} else if len(clockSkew.Warnings) > 0 {
+		status = "warning"
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status":              status,
+		"mqtt_connected":      connected,
+		"subscriptions":       ws.mqttClient.GetSubscriptions(),
+		"unsubscribed_topics": unsubscribed,
+		"clock_skew":          clockSkew,
+	})
+}
+
+// handleHealthCheck is a cheap liveness check: 200 while MQTT is connected
+// and the last WSPRNet upload didn't fail for good, otherwise 503 with the
+// reason. Unlike /api/health it doesn't look at subscriptions or clock skew.
+func (ws *WebServer) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	result := map[string]interface{}{
+		"status": "ok",
+	}
+	var reason string
+
+	if ws.mqttClient != nil {
+		result["uptime_seconds"] = int64(time.Since(ws.mqttClient.startTime).Seconds())
+		result["mqtt_connected"] = ws.mqttClient.client.IsConnected()
+	}
+	var lastWindow *time.Time
+	if t := ws.stats.LastWindowFinished(); !t.IsZero() {
+		lastWindow = &t
+	}
+	result["last_window_finished"] = lastWindow
+
+	lastUpload, uploadError := ws.wsprnet.LastUpload()
+	if !lastUpload.IsZero() {
+		result["last_upload"] = lastUpload
+	}
+
+	switch {
+	case ws.safeMode != "":
+		reason = "safe mode: " + ws.safeMode
+	case ws.mqttClient == nil:
+		reason = "MQTT client not initialized"
+	case result["mqtt_connected"] != true:
+		reason = "MQTT broker not connected"
+	case uploadError != "":
+		reason = "last WSPRNet upload failed: " + uploadError
+	}
+
+	code := http.StatusOK
+	if reason != "" {
+		code = http.StatusServiceUnavailable
+		result["status"] = "unhealthy"
+		result["reason"] = reason
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code, result)
 }
 
 // handleAdminAPI handles admin API requests (GET and POST for config)
@@ -226,6 +715,12 @@ func (ws *WebServer) handleAdminAPI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Bounds for the admin MQTT connection test timeout
+const (
+	DefaultMQTTTestTimeout = 5 * time.Second
+	maxMQTTTestTimeout     = 30 * time.Second
+)
+
 // handleMQTTTest tests the MQTT connection with provided parameters
 func (ws *WebServer) handleMQTTTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -235,10 +730,16 @@ func (ws *WebServer) handleMQTTTest(w http.ResponseWriter, r *http.Request) {
 
 	// Parse MQTT config from request body
 	var testConfig struct {
-		Broker   string `json:"broker"`
-		Username string `json:"username"`
-		Password string `json:"password"`
-		QoS      int    `json:"qos"`
+		Broker   string  `json:"broker"`
+		Username string  `json:"username"`
+		Password string  `json:"password"`
+		QoS      int     `json:"qos"`
+		Timeout  float64 `json:"timeout"` // Seconds, optional (default 5, max 30)
+
+		// TLS settings for ssl:// and mqtts:// brokers; the saved settings if omitted
+		TLS        *MQTTTLSConfig `json:"tls"`
+		ClientCert *string        `json:"client_cert"`
+		ClientKey  *string        `json:"client_key"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&testConfig); err != nil {
@@ -246,14 +747,24 @@ func (ws *WebServer) handleMQTTTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	timeout := DefaultMQTTTestTimeout
+	if testConfig.Timeout != 0 {
+		timeout = time.Duration(testConfig.Timeout * float64(time.Second))
+		if timeout < time.Second || timeout > maxMQTTTestTimeout {
+			http.Error(w, fmt.Sprintf("timeout must be between 1 and %d seconds", int(maxMQTTTestTimeout/time.Second)), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Test MQTT connection
 	result := map[string]interface{}{
-		"success": false,
-		"message": "",
+		"success":         false,
+		"message":         "",
+		"timeout_seconds": timeout.Seconds(),
 	}
 
 	// Try to create a test MQTT connection
-	log.Printf("Testing MQTT connection to %s", testConfig.Broker)
+	log.Printf("Testing MQTT connection to %s (timeout %s)", testConfig.Broker, timeout)
 
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(testConfig.Broker)
@@ -265,67 +776,72 @@ func (ws *WebServer) handleMQTTTest(w http.ResponseWriter, r *http.Request) {
 	if testConfig.Password != "" {
 		opts.SetPassword(testConfig.Password)
 	}
+	if isTLSBroker(testConfig.Broker) {
+		tlsSettings := ws.config.Load().MQTT
+		if testConfig.TLS != nil {
+			tlsSettings.TLS = *testConfig.TLS
+		}
+		if testConfig.ClientCert != nil || testConfig.ClientKey != nil {
+			tlsSettings.ClientCert, tlsSettings.ClientKey = "", ""
+			if testConfig.ClientCert != nil {
+				tlsSettings.ClientCert = *testConfig.ClientCert
+			}
+			if testConfig.ClientKey != nil {
+				tlsSettings.ClientKey = *testConfig.ClientKey
+			}
+		}
+		tlsConfig, err := tlsSettings.BuildTLS()
+		if err != nil {
+			result["message"] = fmt.Sprintf("❌ Invalid TLS settings: %v", err)
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
 
 	// Disable auto-reconnect for testing
 	opts.SetAutoReconnect(false)
 	opts.SetConnectRetry(false)
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetPingTimeout(10 * time.Second)
-	opts.SetConnectTimeout(5 * time.Second)
-
-	// Channel to track connection result
-	connectedChan := make(chan bool, 1)
+	opts.SetConnectTimeout(timeout)
 
-	// Set connection handlers
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		log.Println("MQTT test: Connected to broker")
-		connectedChan <- true
-	})
+	// The test is cancelled when the timeout expires or the admin closes the request
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
 
 	client := mqtt.NewClient(opts)
 
 	// Attempt connection
 	log.Printf("MQTT test: Connecting to broker: %s", testConfig.Broker)
+	start := time.Now()
 	token := client.Connect()
 
-	// Monitor connection in background
-	go func() {
-		if token.WaitTimeout(5 * time.Second) {
-			if token.Error() != nil {
-				log.Printf("MQTT test: Connection failed: %v", token.Error())
-				connectedChan <- false
-			}
-			// If no error, the OnConnect handler will send true
-		} else {
-			log.Printf("MQTT test: Connection timeout")
-			connectedChan <- false
-		}
-	}()
+	// Always disconnect. If the attempt is still in progress this cancels it and
+	// paho tears the client down once the connect timeout bounds the dial and
+	// handshake, so nothing outlives the test for long.
+	defer client.Disconnect(250)
 
-	// Wait for connection result with timeout
 	select {
-	case connected := <-connectedChan:
-		if connected {
-			result["success"] = true
-			result["message"] = fmt.Sprintf("✓ Successfully connected to MQTT broker at %s", testConfig.Broker)
-			log.Printf("MQTT test successful: %s", testConfig.Broker)
-			// Disconnect after successful test
-			if client.IsConnected() {
-				client.Disconnect(250)
-			}
+	case <-token.Done():
+		elapsed := time.Since(start)
+		result["elapsed_ms"] = elapsed.Milliseconds()
+		if err := token.Error(); err != nil {
+			result["message"] = fmt.Sprintf("❌ Failed to connect to MQTT broker at %s: %v", testConfig.Broker, err)
+			log.Printf("MQTT test failed: connection to %s failed: %v", testConfig.Broker, err)
 		} else {
-			result["success"] = false
-			result["message"] = fmt.Sprintf("❌ Failed to connect to MQTT broker at %s", testConfig.Broker)
-			log.Printf("MQTT test failed: connection failed to %s", testConfig.Broker)
+			result["success"] = true
+			result["connect_ms"] = elapsed.Milliseconds()
+			result["message"] = fmt.Sprintf("✓ Successfully connected to MQTT broker at %s in %d ms", testConfig.Broker, elapsed.Milliseconds())
+			log.Printf("MQTT test successful: %s (%s)", testConfig.Broker, elapsed.Round(time.Millisecond))
 		}
-	case <-time.After(6 * time.Second):
-		result["success"] = false
-		result["message"] = fmt.Sprintf("❌ Connection timeout - could not connect to MQTT broker at %s", testConfig.Broker)
+	case <-ctx.Done():
+		result["elapsed_ms"] = time.Since(start).Milliseconds()
+		result["message"] = fmt.Sprintf("❌ Connection timeout - could not connect to MQTT broker at %s within %s", testConfig.Broker, timeout)
 		log.Printf("MQTT test failed: connection timeout to %s", testConfig.Broker)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	writeJSON(w, http.StatusOK, result)
 }
 
 // handleClearStats clears all statistics from memory and disk
@@ -341,7 +857,8 @@ func (ws *WebServer) handleClearStats(w http.ResponseWriter, r *http.Request) {
 	ws.stats.ClearAllStatistics()
 
 	// Clear the persistence file by writing an empty/initial state
-	if ws.config.PersistenceFile != "" {
+	config := ws.config.Load()
+	if config.PersistenceFile != "" {
 		emptyStats := &PersistenceData{
 			SavedAt:      time.Now(),
 			Windows:      make([]*WindowStats, 0),
@@ -361,24 +878,32 @@ func (ws *WebServer) handleClearStats(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 
-		data, err := json.MarshalIndent(emptyStats, "", "  ")
+		data, err := encodePersistence(emptyStats, config.PersistenceFormat)
 		if err != nil {
 			log.Printf("Error marshaling empty stats: %v", err)
 			http.Error(w, fmt.Sprintf("Failed to clear statistics file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		if err := os.WriteFile(ws.config.PersistenceFile, data, 0644); err != nil {
+		if err := ws.stats.writePersistenceFile(config.PersistenceFile, data); err != nil {
 			log.Printf("Error writing empty stats file: %v", err)
 			http.Error(w, fmt.Sprintf("Failed to clear statistics file: %v", err), http.StatusInternalServerError)
 			return
 		}
+		// The backup now holds the cleared statistics; don't let a later
+		// fallback bring them back
+		if err := os.Remove(persistenceBackupPath(config.PersistenceFile)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to remove statistics backup: %v", err)
+		}
 
-		log.Printf("Statistics file cleared: %s", ws.config.PersistenceFile)
+		log.Printf("Statistics file cleared: %s", config.PersistenceFile)
 	}
 
-	// Also reset WSPRNet stats
+	// Also reset WSPRNet and PSKReporter stats
 	ws.wsprnet.ResetStats()
+	if ws.pskReporter != nil {
+		ws.pskReporter.ResetStats()
+	}
 
 	// Clear all spot logs
 	if ws.spotWriter != nil {
@@ -389,8 +914,7 @@ func (ws *WebServer) handleClearStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"status":  "success",
 		"message": "All statistics and spot logs have been cleared successfully",
 	})
@@ -400,15 +924,26 @@ func (ws *WebServer) handleClearStats(w http.ResponseWriter, r *http.Request) {
 
 // handleDashboard serves the HTML dashboard
 func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
+	// "/" is a catch-all pattern, so anything other than the root is unknown
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	html := `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>WSPR MQTT Aggregator Dashboard</title>
-    <script src="https://cdn.jsdelivr.net/npm/chart.js@4.4.0/dist/chart.umd.min.js"></script>
+    <title>{{TITLE}} Dashboard</title>
+{{FAVICON}}    <script src="https://cdn.jsdelivr.net/npm/chart.js@4.4.0/dist/chart.umd.min.js"></script>
     <script src="https://cdn.jsdelivr.net/npm/chartjs-adapter-date-fns@3.0.0/dist/chartjs-adapter-date-fns.bundle.min.js"></script>
     <link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css" />
     <script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
@@ -516,6 +1051,11 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             opacity: 0.9;
             font-size: 1.1em;
         }
+        .header-logo {
+            height: 1.2em;
+            vertical-align: middle;
+            margin-right: 12px;
+        }
         .stats-grid {
             display: grid;
             grid-template-columns: repeat(auto-fit, minmax(250px, 1fr));
@@ -598,6 +1138,21 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             background: #f59e0b;
             color: white;
         }
+        .badge-offline {
+            background: #ef4444;
+            color: white;
+        }
+        .recent-callsigns summary {
+            cursor: pointer;
+            color: #94a3b8;
+        }
+        .recent-callsigns div {
+            max-width: 320px;
+            margin-top: 6px;
+            font-family: monospace;
+            font-size: 0.85em;
+            line-height: 1.5;
+        }
         .last-update {
             text-align: center;
             color: #94a3b8;
@@ -771,8 +1326,8 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
     <div class="header">
-        <h1>🛰️ WSPR MQTT Aggregator</h1>
-        <div class="subtitle">Real-time monitoring and statistics</div>
+        <h1>{{LOGO}}{{TITLE}}</h1>
+        <div class="subtitle">{{SUBTITLE}}</div>
     </div>
 
     <div class="tabs">
@@ -789,22 +1344,35 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
     <!-- Overview Tab -->
     <div id="overview" class="tab-content active">
+    <div style="display: flex; justify-content: flex-end; align-items: center; gap: 8px; margin-bottom: 15px;">
+        <span style="color: #94a3b8; font-size: 0.9em;">Time range:</span>
+        <button class="control-btn activity-range-btn" data-hours="1" onclick="setActivityHours(1)">1h</button>
+        <button class="control-btn activity-range-btn" data-hours="6" onclick="setActivityHours(6)">6h</button>
+        <button class="control-btn activity-range-btn" data-hours="24" onclick="setActivityHours(24)">24h</button>
+    </div>
     <div class="stats-grid">
         <div class="stat-card">
-            <div class="stat-label">Spots Sent (24h)</div>
+            <div class="stat-label">Spots Sent (<span class="activity-range-label">24h</span>)</div>
             <div class="stat-value" id="successfulSent" style="color: #10b981;">-</div>
         </div>
         <div class="stat-card">
-            <div class="stat-label">Duplicates Removed (24h)</div>
+            <div class="stat-label">Duplicates Removed (<span class="activity-range-label">24h</span>)</div>
             <div class="stat-value" id="totalDuplicates">-</div>
         </div>
         <div class="stat-card">
-            <div class="stat-label">Failed Submissions (24h)</div>
+            <div class="stat-label">Failed Submissions (<span class="activity-range-label">24h</span>)</div>
             <div class="stat-value" id="failedSent" style="color: #ef4444;">-</div>
+            <div class="stat-label" id="failureBreakdown" style="display: none; margin-top: 8px;"></div>
         </div>
         <div class="stat-card">
             <div class="stat-label">Pending Spots</div>
             <div class="stat-value" id="pendingSpots">-</div>
+            <div class="stat-label" id="quietHoursNote" style="display: none; margin-top: 8px; color: #fbbf24;">🌙 Quiet hours - uploads held</div>
+        </div>
+        <div class="stat-card" id="hashedCallsignsCard" style="display: none;">
+            <div class="stat-label">Hashed Callsigns &lt;...&gt;</div>
+            <div class="stat-value" id="hashedCallsigns">-</div>
+            <div class="stat-label" id="hashedCallsignsBands" style="margin-top: 8px;"></div>
         </div>
     </div>
 
@@ -861,6 +1429,8 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     <th>Tied SNR</th>
                     <th>Win Rate</th>
                     <th>Last Report</th>
+                    <th>Recently Heard</th>
+                    <th>Software</th>
                 </tr>
             </thead>
             <tbody id="instanceTableBody">
@@ -891,6 +1461,13 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             <canvas id="instancePerformanceChart" style="max-height: 300px;"></canvas>
         </div>
     </div>
+
+    <div class="chart-container">
+        <div class="chart-title">⏱️ Report Arrival Timeline</div>
+        <div id="arrivalTimelineInfo" style="color: #94a3b8; font-size: 0.9em; margin-bottom: 10px;"></div>
+        <canvas id="arrivalTimelineChart" style="max-height: 300px;"></canvas>
+        <div id="arrivalSpreadTable" style="margin-top: 15px;"></div>
+    </div>
     </div>
     <!-- End Instances Tab -->
 
@@ -910,6 +1487,10 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
         </div>
         <div id="bandInstanceTables"></div>
     </div>
+    <div class="chart-container">
+        <div class="chart-title">Transmit Frequency Distribution (offset from WSPR dial)</div>
+        <div id="frequencyHistograms"></div>
+    </div>
     </div>
     <!-- End Per Band Tab -->
 
@@ -970,6 +1551,16 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
         <div id="countrySummary"></div>
     </div>
     
+    <div class="chart-container">
+        <div class="chart-title">🏆 Most Bands Heard</div>
+        <div id="countryBandsLeaderboard"></div>
+    </div>
+    
+    <div class="chart-container">
+        <div class="chart-title">🗺️ Countries by Instance (24 hours)</div>
+        <div id="instanceCountryHeatmap"></div>
+    </div>
+    
     <div class="chart-container">
         <div class="chart-title">Country Statistics by Band</div>
         <div id="countryTables"></div>
@@ -1009,6 +1600,14 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         <option value="false">Failed to Send</option>
                     </select>
                 </div>
+                <div>
+                    <label style="display: block; color: #94a3b8; font-size: 0.9em; margin-bottom: 5px;">Grayline</label>
+                    <select id="spotGraylineFilter" style="width: 100%; padding: 8px; background: #1e293b; color: #e2e8f0; border: 1px solid #334155; border-radius: 6px;">
+                        <option value="">All</option>
+                        <option value="true">Both Ends in Grayline</option>
+                        <option value="false">Not Grayline</option>
+                    </select>
+                </div>
                 <div>
                     <label style="display: block; color: #94a3b8; font-size: 0.9em; margin-bottom: 5px;">Search Callsign</label>
                     <input type="text" id="spotCallsignSearch" placeholder="Filter by callsign..." style="width: 100%; padding: 8px; background: #1e293b; color: #e2e8f0; border: 1px solid #334155; border-radius: 6px;">
@@ -1151,6 +1750,27 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
     </div>
 
     <script>
+        // API key for /api requests when the server sets api_key: taken from
+        // ?key= on the dashboard URL, then remembered in this browser
+        const pageParams = new URLSearchParams(window.location.search);
+        if (pageParams.has('key')) {
+            localStorage.setItem('apiKey', pageParams.get('key'));
+            // Keep the key out of the address bar and history
+            pageParams.delete('key');
+            const query = pageParams.toString();
+            history.replaceState(null, '', window.location.pathname + (query ? '?' + query : '') + window.location.hash);
+        }
+        const apiKey = localStorage.getItem('apiKey') || '';
+        if (apiKey) {
+            const plainFetch = window.fetch.bind(window);
+            window.fetch = (url, options = {}) => {
+                if (typeof url === 'string' && url.startsWith('/api/')) {
+                    options = { ...options, headers: { ...(options.headers || {}), 'Authorization': 'Bearer ' + apiKey } };
+                }
+                return plainFetch(url, options);
+            };
+        }
+
         // Tab switching function
         function switchTab(tabName) {
             // Hide all tab contents
@@ -1202,7 +1822,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         });
 
-        let spotsChart, bandChart, instancePerformanceChart, instancePerformanceRawChart, instanceComparisonChart, map, markerClusterGroup, receiverMarker;
+        let spotsChart, bandChart, instancePerformanceChart, instancePerformanceRawChart, instanceComparisonChart, arrivalTimelineChart, map, markerClusterGroup, receiverMarker;
         let allSpots = []; // Store all spots for filtering
         let activeBands = new Set(); // Track which bands are active
         let snrSmoothingEnabled = true; // Track SNR smoothing state (default enabled)
@@ -1215,8 +1835,54 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
         let rawInstanceData = {}; // Store raw instance performance data for re-rendering
         let rawInstanceRawData = {}; // Store raw instance performance data (pre-dedup) for re-rendering
         let rawWindowsData = []; // Store raw windows data for re-rendering
+        let activityHours = [1, 6, 24].includes(parseInt(localStorage.getItem('activityHours'))) ? parseInt(localStorage.getItem('activityHours')) : 24; // Time range for the headline stats, band chart and countries
+        let instanceDisplayNames = {}; // Instance name -> display name (from /api/instances)
+        let distanceUnit = 'km'; // "km" or "mi" (from /api/receiver)
+
+        // Friendly label for an instance, falling back to its technical name
+        function instanceLabel(name) {
+            return instanceDisplayNames[name] || name;
+        }
+
+        // Converts a distance in km (e.g. /api/spots distance_km) to the configured unit.
+        // Distances in /api/instances and /api/snr-history are already converted.
+        function kmToDistanceUnit(km) {
+            return distanceUnit === 'mi' ? km / 1.609344 : km;
+        }
+
+        // Chart colors for instances, in sorted name order
+        const instancePalette = [
+            '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
+            '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
+            '#f97316', '#14b8a6', '#a855f7', '#22c55e'
+        ];
+
+        // Color for the idx-th instance. Beyond the palette, later rounds use
+        // alternately lighter and darker shades so every line stays distinct.
+        function instanceColor(idx) {
+            const base = instancePalette[idx % instancePalette.length];
+            const round = Math.floor(idx / instancePalette.length);
+            if (round === 0) return base;
+            const step = Math.min(Math.ceil(round / 2) * 0.3, 0.75);
+            return shadeColor(base, round % 2 === 1 ? step : -step);
+        }
 
-        // Band colors for map markers (2200m through 10m)
+        // Mix a #rrggbb color towards white (amount > 0) or black (amount < 0)
+        function shadeColor(hex, amount) {
+            const target = amount > 0 ? 255 : 0;
+            const weight = Math.abs(amount);
+            let out = '#';
+            for (let i = 1; i < 7; i += 2) {
+                const c = parseInt(hex.slice(i, i + 2), 16);
+                out += Math.round(c + (target - c) * weight).toString(16).padStart(2, '0');
+            }
+            return out;
+        }
+
+        // Known bands in frequency order, from the server's band table
+        const wsprBands = {{BANDS}};
+
+        // Band colors for map markers (2200m through 2m)
         const bandColors = {
             '2200m': '#7c2d12',
             '630m': '#991b1b',
@@ -1229,16 +1895,23 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             '17m': '#10b981',
             '15m': '#14b8a6',
             '12m': '#06b6d4',
-            '10m': '#0ea5e9'
+            '10m': '#0ea5e9',
+            '6m': '#3b82f6',
+            '4m': '#6366f1',
+            '2m': '#8b5cf6'
         };
+        // Bands added with band_table get a color derived from their name
+        wsprBands.forEach(band => {
+            if (bandColors[band]) return;
+            let hash = 0;
+            for (const ch of band) hash = (hash * 31 + ch.charCodeAt(0)) >>> 0;
+            bandColors[band] = 'hsl(' + (hash % 360) + ', 70%, 55%)';
+        });
 
         // Initialize band filters
         function initBandFilters() {
             const container = document.getElementById('bandFilters');
-            const bands = [
-                '2200m', '630m', '160m', '80m', '60m', '40m',
-                '30m', '20m', '17m', '15m', '12m', '10m'
-            ];
+            const bands = wsprBands;
             
             bands.forEach(band => {
                 const btn = document.createElement('button');
@@ -1270,10 +1943,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
         // Select all bands
         function selectAllBands() {
-            const bands = [
-                '2200m', '630m', '160m', '80m', '60m', '40m',
-                '30m', '20m', '17m', '15m', '12m', '10m'
-            ];
+            const bands = wsprBands;
             bands.forEach(band => {
                 activeBands.add(band);
                 const btn = document.querySelector('[data-band="' + band + '"]');
@@ -1287,10 +1957,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
         // Deselect all bands
         function deselectAllBands() {
-            const bands = [
-                '2200m', '630m', '160m', '80m', '60m', '40m',
-                '30m', '20m', '17m', '15m', '12m', '10m'
-            ];
+            const bands = wsprBands;
             bands.forEach(band => {
                 activeBands.delete(band);
                 const btn = document.querySelector('[data-band="' + band + '"]');
@@ -1339,11 +2006,16 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 
                 const bandList = spot.bands.map(b => ` + "`" + `<span style="color: ${bandColors[b]}">${b}</span>` + "`" + `).join(', ');
                 const snrList = spot.bands.map((b, i) => ` + "`" + `${b}: ${spot.snr[i]} dB` + "`" + `).join('<br>');
+                // A 4-character square is roughly 100 x 200 km, so its distance is approximate
+                const pathLine = spot.grid_precision
+                    ? ` + "`" + `Distance: ${spot.grid_precision < 6 ? '~' : ''}${Math.round(kmToDistanceUnit(spot.distance_km))} ${distanceUnit} at ${Math.round(spot.bearing)}°<br>` + "`" + `
+                    : '';
                 
                 marker.bindPopup(` + "`" + `
                     <strong>${spot.callsign}</strong><br>
                     ${spot.country}<br>
                     Locator: ${spot.locator}<br>
+                    ${pathLine}
                     Bands: ${bandList}<br>
                     SNR:<br>${snrList}
                 ` + "`" + `);
@@ -1352,13 +2024,47 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             });
         }
 
+        // Sunrise/sunset line for the given time as [lat, lon] points from
+        // -180 to 180 longitude, with the solar declination in degrees
+        function terminatorLine(date) {
+            const rad = Math.PI / 180;
+            const start = Date.UTC(date.getUTCFullYear(), 0, 0);
+            const day = (date.getTime() - start) / 86400000;
+            const decl = -23.44 * Math.cos(2 * Math.PI / 365 * (day + 10));
+            const hours = date.getUTCHours() + date.getUTCMinutes() / 60 + date.getUTCSeconds() / 3600;
+            const sunLon = (12 - hours) * 15;
+            const tanDecl = Math.tan((Math.abs(decl) < 0.1 ? 0.1 : decl) * rad);
+            const points = [];
+            for (let lon = -180; lon <= 180; lon += 2) {
+                const lat = Math.atan(-Math.cos((lon - sunLon) * rad) / tanDecl) / rad;
+                points.push([lat, lon]);
+            }
+            return {decl: decl, points: points};
+        }
+
         // Initialize map
         function initMap() {
             map = L.map('map').setView([20, 0], 2);
-            L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
-                attribution: '© OpenStreetMap contributors',
-                maxZoom: 18
+            const tiles = {{MAP_TILES}};
+            L.tileLayer(tiles.url, {
+                attribution: tiles.attribution,
+                maxZoom: tiles.max_zoom
             }).addTo(map);
+
+            // Day/night terminator, off by default
+            const grayline = L.layerGroup();
+            const drawGrayline = () => {
+                grayline.clearLayers();
+                const t = terminatorLine(new Date());
+                const pole = t.decl > 0 ? -90 : 90;
+                const night = t.points.slice();
+                night.push([pole, 180], [pole, -180]);
+                L.polygon(night, {stroke: false, fillColor: '#000', fillOpacity: 0.25, interactive: false}).addTo(grayline);
+                L.polyline(t.points, {color: '#fbbf24', weight: 1, opacity: 0.8, interactive: false}).addTo(grayline);
+            };
+            drawGrayline();
+            setInterval(drawGrayline, 5 * 60 * 1000);
+            L.control.layers(null, {'Grayline': grayline}, {position: 'topright'}).addTo(map);
             
             // Initialize marker cluster group
             markerClusterGroup = L.markerClusterGroup({
@@ -1376,10 +2082,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 const div = L.DomUtil.create('div', 'legend');
                 div.innerHTML = '<h4>WSPR Bands</h4>';
                 
-                const bands = [
-                    '2200m', '630m', '160m', '80m', '60m', '40m',
-                    '30m', '20m', '17m', '15m', '12m', '10m'
-                ];
+                const bands = wsprBands;
                 
                 bands.forEach(band => {
                     div.innerHTML += ` + "`" + `
@@ -1397,7 +2100,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
         // Helper function to sort bands in proper order
         function sortBands(bands) {
-            const bandOrder = ['2200m', '630m', '160m', '80m', '60m', '40m', '30m', '20m', '17m', '15m', '12m', '10m'];
+            const bandOrder = wsprBands;
             return bands.sort((a, b) => {
                 const aIndex = bandOrder.indexOf(a);
                 const bIndex = bandOrder.indexOf(b);
@@ -1413,7 +2116,11 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
         function maidenheadToLatLon(locator) {
             if (!locator || locator.length < 4) return null;
 
-            locator = locator.toUpperCase();
+            // Use the square or subsquare; extended-precision characters are ignored
+            locator = locator.toUpperCase().substring(0, locator.length >= 6 ? 6 : 4);
+
+            // Same validation as the server: field A-R, square 0-9, optional subsquare A-X
+            if (!/^[A-R]{2}[0-9]{2}([A-X]{2})?$/.test(locator)) return null;
 
             // Field (first 2 chars): 20° longitude, 10° latitude
             const lon1 = (locator.charCodeAt(0) - 65) * 20 - 180;
@@ -1534,31 +2241,44 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
         async function fetchData() {
             try {
-                const [stats, instances, windows, aggregator, countries, spots, wsprnet, snrHistory, receiver, instancePerformance, instancePerformanceRaw] = await Promise.all([
+                const [stats, instances, windows, aggregator, countries, spots, wsprnet, snrHistory, receiver, instancePerformance, instancePerformanceRaw, frequencies, countriesSummary, windowArrivals, instanceCountries] = await Promise.all([
                     fetch('/api/stats').then(r => r.json()),
                     fetch('/api/instances').then(r => r.json()),
                     fetch('/api/windows').then(r => r.json()),
                     fetch('/api/aggregator').then(r => r.json()),
-                    fetch('/api/countries').then(r => r.json()),
+                    fetch('/api/countries?hours=' + activityHours).then(r => r.json()),
                     fetch('/api/spots').then(r => r.json()),
                     fetch('/api/wsprnet').then(r => r.json()),
                     fetch('/api/snr-history').then(r => r.json()),
                     fetch('/api/receiver').then(r => r.json()),
                     fetch('/api/instance-performance').then(r => r.json()),
-                    fetch('/api/instance-performance-raw').then(r => r.json())
+                    fetch('/api/instance-performance-raw').then(r => r.json()),
+                    fetch('/api/frequencies').then(r => r.json()),
+                    fetch('/api/countries/summary').then(r => r.json()),
+                    fetch('/api/window-arrivals').then(r => r.json()),
+                    fetch('/api/instance-countries').then(r => r.json())
                 ]);
 
+                Object.values(instances).forEach(inst => {
+                    instanceDisplayNames[inst.name] = inst.display_name || inst.name;
+                });
+                distanceUnit = receiver.distance_unit || 'km';
+
                 updateCharts(windows);
                 updateStats(stats, aggregator, wsprnet);
                 updateInstanceComparisonChart(instances);
                 updateInstanceTable(instances);
                 updateInstancePerformanceRawChart(instancePerformanceRaw);
                 updateInstancePerformanceChart(instancePerformance);
+                updateArrivalTimeline(windowArrivals);
                 updateBandInstanceTable(instances, snrHistory);
+                updateFrequencyHistograms(frequencies);
                 updateRelationships(instances);
                 updateMultiInstanceAnalysis(instances);
                 updateSNRHistoryCharts(snrHistory);
                 updateCountryTables(countries);
+                updateCountryBandsLeaderboard(countriesSummary.countries);
+                updateInstanceCountryHeatmap(instanceCountries);
                 updateMap(spots);
                 updateReceiverMarker(receiver);
                 
@@ -1568,24 +2288,77 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // Switch the overview and countries between the last 1, 6 or 24 hours
+        function setActivityHours(hours) {
+            activityHours = hours;
+            localStorage.setItem('activityHours', hours);
+            updateActivityRangeControls();
+            fetchData();
+        }
+
+        function updateActivityRangeControls() {
+            document.querySelectorAll('.activity-range-btn').forEach(btn => {
+                const active = parseInt(btn.dataset.hours) === activityHours;
+                btn.style.borderColor = active ? '#60a5fa' : '';
+                btn.style.color = active ? '#60a5fa' : '';
+            });
+            document.querySelectorAll('.activity-range-label').forEach(label => {
+                label.textContent = activityHours + 'h';
+            });
+        }
+
+        // Windows from the selected time range
+        function windowsInActivityRange(windows) {
+            const cutoff = Date.now() - activityHours * 60 * 60 * 1000;
+            return (windows || []).filter(w => new Date(w.window_time).getTime() >= cutoff);
+        }
+
         function updateStats(stats, aggregator, wsprnet) {
-            // Calculate 24-hour rolling window stats from rawWindowsData
-            let rolling24hSent = 0;
-            let rolling24hDuplicates = 0;
-            let rolling24hFailed = 0;
+            // Calculate rolling window stats for the selected range from rawWindowsData
+            let rollingSent = 0;
+            let rollingDuplicates = 0;
+            let rollingFailed = 0;
 
             if (rawWindowsData && rawWindowsData.length > 0) {
-                rawWindowsData.forEach(window => {
-                    rolling24hSent += window.TotalSpots || 0;
-                    rolling24hDuplicates += window.DuplicateCount || 0;
-                    rolling24hFailed += window.FailedCount || 0;
+                windowsInActivityRange(rawWindowsData).forEach(window => {
+                    // Windows backfilled from WSPRNet were not sent by this aggregator
+                    if (window.imported) return;
+                    rollingSent += window.total_spots || 0;
+                    rollingDuplicates += window.duplicate_count || 0;
+                    rollingFailed += window.failed_count || 0;
                 });
             }
 
-            document.getElementById('successfulSent').textContent = rolling24hSent;
-            document.getElementById('failedSent').textContent = rolling24hFailed;
-            document.getElementById('totalDuplicates').textContent = rolling24hDuplicates;
+            document.getElementById('successfulSent').textContent = rollingSent;
+            document.getElementById('failedSent').textContent = rollingFailed;
+            document.getElementById('totalDuplicates').textContent = rollingDuplicates;
             document.getElementById('pendingSpots').textContent = aggregator.pending_spots || 0;
+            document.getElementById('quietHoursNote').style.display = wsprnet.quiet ? 'block' : 'none';
+
+            // Failed upload attempts by cause, e.g. "5xx: 3 · timeout: 1"
+            const failures = wsprnet.failures_by_status || {};
+            const failureKinds = Object.keys(failures).sort();
+            const breakdown = document.getElementById('failureBreakdown');
+            breakdown.textContent = 'Upload attempts failed: ' + failureKinds.map(kind => kind + ': ' + failures[kind]).join(' · ');
+            breakdown.title = wsprnet.last_failure
+                ? 'Last failure ' + new Date(wsprnet.last_failure.time).toLocaleString() + ': ' + wsprnet.last_failure.detail
+                : '';
+            breakdown.style.display = failureKinds.length > 0 ? 'block' : 'none';
+
+            // Unresolved hashed callsigns are only counted when hashed_callsigns is count or submit
+            const hashedCard = document.getElementById('hashedCallsignsCard');
+            if (stats.hashed_callsigns_mode && stats.hashed_callsigns_mode !== 'drop') {
+                const hashed = stats.hashed_callsigns || {};
+                const bands = sortBands(Object.keys(hashed));
+                const total = bands.reduce((sum, band) => sum + hashed[band], 0);
+                document.getElementById('hashedCallsigns').textContent = total;
+                document.getElementById('hashedCallsignsBands').textContent = bands.length > 0
+                    ? bands.map(band => band + ': ' + hashed[band]).join(' · ')
+                    : (stats.hashed_callsigns_mode === 'submit' ? 'Submitted to WSPRNet' : 'Counted, not submitted');
+                hashedCard.style.display = 'block';
+            } else {
+                hashedCard.style.display = 'none';
+            }
         }
 
         function updateCharts(windows) {
@@ -1594,13 +2367,20 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             // Store raw data for re-rendering when smoothing is toggled
             rawWindowsData = windows;
 
-            // Spots over time chart
+            // Spots over time chart. With more than 24 hours of history
+            // (retention_hours) the day is added so times don't repeat.
+            const spanMs = new Date(windows[windows.length - 1].window_time) - new Date(windows[0].window_time);
+            const labelFormat = spanMs > 86400000
+                ? {weekday: 'short', hour: '2-digit', minute: '2-digit'}
+                : {hour: '2-digit', minute: '2-digit'};
             const labels = windows.map(w => {
-                const date = new Date(w.WindowTime);
-                return date.toLocaleTimeString([], {hour: '2-digit', minute: '2-digit'});
+                const date = new Date(w.window_time);
+                return date.toLocaleString([], labelFormat);
             });
-            let spotData = windows.map(w => w.TotalSpots);
-            let dupData = windows.map(w => w.DuplicateCount);
+            // Windows backfilled from WSPRNet are plotted as their own series
+            let spotData = windows.map(w => w.imported ? null : w.total_spots);
+            let dupData = windows.map(w => w.imported ? null : w.duplicate_count);
+            const importedData = windows.map(w => w.imported ? w.total_spots : null);
 
             // Apply smoothing if enabled
             if (spotsSmoothingEnabled) {
@@ -1612,6 +2392,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 spotsChart.data.labels = labels;
                 spotsChart.data.datasets[0].data = spotData;
                 spotsChart.data.datasets[1].data = dupData;
+                spotsChart.data.datasets[2].data = importedData;
                 spotsChart.update();
             } else {
                 const ctx = document.getElementById('spotsChart').getContext('2d');
@@ -1637,6 +2418,16 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                             tension: 0.4,
                             pointRadius: 0,
                             pointHoverRadius: 3
+                        }, {
+                            label: 'Imported from WSPRNet',
+                            data: importedData,
+                            borderColor: '#94a3b8',
+                            backgroundColor: 'rgba(148, 163, 184, 0.1)',
+                            borderWidth: 1.5,
+                            borderDash: [4, 4],
+                            tension: 0.4,
+                            pointRadius: 0,
+                            pointHoverRadius: 3
                         }]
                     },
                     options: {
@@ -1662,13 +2453,13 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 });
             }
 
-            // Band distribution (sum of all windows in last 24 hours)
+            // Band distribution (sum of all windows in the selected range)
             if (windows && windows.length > 0) {
                 // Aggregate band counts across all windows
                 const bandTotals = {};
-                windows.forEach(window => {
-                    if (window.BandBreakdown) {
-                        Object.entries(window.BandBreakdown).forEach(([band, count]) => {
+                windowsInActivityRange(windows).forEach(window => {
+                    if (window.band_breakdown) {
+                        Object.entries(window.band_breakdown).forEach(([band, count]) => {
                             bandTotals[band] = (bandTotals[band] || 0) + count;
                         });
                     }
@@ -1681,6 +2472,8 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 if (bandChart) {
                     bandChart.data.labels = sortedBands;
                     bandChart.data.datasets[0].data = counts;
+                    bandChart.data.datasets[0].label = 'Spots per Band (' + activityHours + 'h)';
+                    bandChart.options.plugins.title.text = 'Last ' + activityHours + (activityHours === 1 ? ' Hour' : ' Hours');
                     bandChart.update();
                 } else {
                     const ctx = document.getElementById('bandChart').getContext('2d');
@@ -1689,7 +2482,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         data: {
                             labels: sortedBands,
                             datasets: [{
-                                label: 'Spots per Band (24h)',
+                                label: 'Spots per Band (' + activityHours + 'h)',
                                 data: counts,
                                 backgroundColor: [
                                     '#3b82f6', '#8b5cf6', '#ec4899', '#f59e0b',
@@ -1705,7 +2498,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                 legend: { display: false },
                                 title: {
                                     display: true,
-                                    text: 'Last 24 Hours',
+                                    text: 'Last ' + activityHours + (activityHours === 1 ? ' Hour' : ' Hours'),
                                     color: '#94a3b8',
                                     font: { size: 12 }
                                 }
@@ -1727,18 +2520,127 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // Scatter of when each instance's reports for the latest window arrived,
+        // in seconds after the WSPR cycle ended, one row per instance
+        function updateArrivalTimeline(data) {
+            const info = document.getElementById('arrivalTimelineInfo');
+            const tableContainer = document.getElementById('arrivalSpreadTable');
+            const windows = (data && data.windows) || [];
+            if (windows.length === 0) {
+                info.textContent = 'No reports received yet';
+                tableContainer.innerHTML = '';
+                return;
+            }
+
+            const win = windows[0];
+            const instanceNames = Object.keys(win.instances).sort();
+            const cycle = new Date(win.window_time).toISOString().substr(11, 5);
+            info.textContent = ` + "`" + `Window ${cycle} UTC (${win.open ? 'waiting to submit' : 'submitted'}): ${win.arrivals.length} reports from ${instanceNames.length} instance(s). 0 s is the end of the WSPR cycle; the dashed line is the ${data.submission_deadline} s submission deadline.` + "`" + `;
+
+            const datasets = instanceNames.map((instance, idx) => ({
+                label: instanceLabel(instance),
+                data: win.arrivals
+                    .filter(a => a.instance === instance)
+                    .map(a => ({ x: a.offset_seconds, y: idx, callsign: a.callsign, band: a.band })),
+                backgroundColor: instanceColor(idx),
+                pointRadius: 4
+            }));
+            datasets.push({
+                label: 'Submission deadline',
+                type: 'line',
+                data: [{ x: data.submission_deadline, y: -0.5 }, { x: data.submission_deadline, y: instanceNames.length - 0.5 }],
+                borderColor: '#ef4444',
+                borderDash: [6, 4],
+                pointRadius: 0,
+                showLine: true
+            });
+
+            if (arrivalTimelineChart) {
+                arrivalTimelineChart.destroy();
+            }
+            const ctx = document.getElementById('arrivalTimelineChart').getContext('2d');
+            arrivalTimelineChart = new Chart(ctx, {
+                type: 'scatter',
+                data: { datasets: datasets },
+                options: {
+                    responsive: true,
+                    maintainAspectRatio: true,
+                    animation: false,
+                    plugins: {
+                        legend: { labels: { color: '#e2e8f0' } },
+                        tooltip: {
+                            callbacks: {
+                                label: function(context) {
+                                    const p = context.raw;
+                                    if (!p.callsign) return context.dataset.label;
+                                    return ` + "`" + `${context.dataset.label}: ${p.callsign} (${p.band}) at ${p.x.toFixed(1)} s` + "`" + `;
+                                }
+                            }
+                        }
+                    },
+                    scales: {
+                        x: {
+                            title: { display: true, text: 'Seconds after cycle end', color: '#94a3b8' },
+                            ticks: { color: '#94a3b8' },
+                            grid: { color: '#334155' }
+                        },
+                        y: {
+                            min: -0.5,
+                            max: instanceNames.length - 0.5,
+                            ticks: {
+                                color: '#94a3b8',
+                                stepSize: 1,
+                                callback: value => Number.isInteger(value) && instanceNames[value] ? instanceLabel(instanceNames[value]) : ''
+                            },
+                            grid: { color: '#334155' }
+                        }
+                    }
+                }
+            });
+
+            tableContainer.innerHTML = ` + "`" + `
+                <table style="width: 100%;">
+                    <thead>
+                        <tr>
+                            <th>Instance</th>
+                            <th>Reports</th>
+                            <th>First</th>
+                            <th>Median</th>
+                            <th>Last</th>
+                            <th>Spread</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        ${instanceNames.map(name => {
+                            const s = win.instances[name];
+                            return ` + "`" + `
+                                <tr>
+                                    <td><strong>${instanceLabel(name)}</strong></td>
+                                    <td>${s.count}</td>
+                                    <td>${s.first_offset_seconds.toFixed(1)} s</td>
+                                    <td>${s.median_offset_seconds.toFixed(1)} s</td>
+                                    <td>${s.last_offset_seconds.toFixed(1)} s</td>
+                                    <td>${s.spread_seconds.toFixed(1)} s</td>
+                                </tr>
+                            ` + "`" + `;
+                        }).join('')}
+                    </tbody>
+                </table>
+            ` + "`" + `;
+        }
+
         function updateInstanceComparisonChart(instances) {
             if (!instances || Object.keys(instances).length === 0) return;
 
             // Sort instances alphabetically by name
             const sortedInstances = Object.values(instances).sort((a, b) =>
-                a.Name.localeCompare(b.Name)
+                a.name.localeCompare(b.name)
             );
 
-            const labels = sortedInstances.map(inst => inst.Name);
-            const bestSNRData = sortedInstances.map(inst => inst.BestSNRWins || 0);
-            const tiedSNRData = sortedInstances.map(inst => inst.TiedSNR || 0);
-            const uniqueData = sortedInstances.map(inst => inst.UniqueSpots || 0);
+            const labels = sortedInstances.map(inst => instanceLabel(inst.name));
+            const bestSNRData = sortedInstances.map(inst => inst.best_snr_wins || 0);
+            const tiedSNRData = sortedInstances.map(inst => inst.tied_snr || 0);
+            const uniqueData = sortedInstances.map(inst => inst.unique_spots || 0);
 
             if (instanceComparisonChart) {
                 instanceComparisonChart.data.labels = labels;
@@ -1822,31 +2724,42 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // Recently heard callsigns for an instance, newest first, collapsed to a count
+        function recentCallsignsCell(callsigns) {
+            if (!callsigns || callsigns.length === 0) return '-';
+            const newestFirst = callsigns.slice().reverse();
+            return ` + "`" + `<details class="recent-callsigns"><summary>${newestFirst[0]}${newestFirst.length > 1 ? ' +' + (newestFirst.length - 1) : ''}</summary><div>${newestFirst.join(', ')}</div></details>` + "`" + `;
+        }
+
         function updateInstanceTable(instances) {
             const tbody = document.getElementById('instanceTableBody');
             tbody.innerHTML = '';
 
             // Sort instances alphabetically by name
             const sortedInstances = Object.values(instances).sort((a, b) =>
-                a.Name.localeCompare(b.Name)
+                a.name.localeCompare(b.name)
             );
 
             sortedInstances.forEach(inst => {
-                const winRate = inst.TotalSpots > 0
-                    ? ((inst.BestSNRWins / inst.TotalSpots) * 100).toFixed(1)
+                const winRate = inst.total_spots > 0
+                    ? ((inst.best_snr_wins / inst.total_spots) * 100).toFixed(1)
                     : '0.0';
                 
-                const lastReport = inst.LastReportTime
-                    ? new Date(inst.LastReportTime).toLocaleTimeString()
+                const lastReport = inst.last_report_time
+                    ? new Date(inst.last_report_time).toLocaleTimeString()
                     : 'Never';
 
+                const status = inst.online
+                    ? ''
+                    : ' <span class="badge badge-offline" title="No reports within the offline timeout">offline</span>';
+
                 const row = ` + "`" + `
                     <tr>
-                        <td><span class="instance-name">${inst.Name}</span></td>
-                        <td>${inst.TotalSpots}</td>
-                        <td><span class="badge badge-success">${inst.UniqueSpots}</span></td>
-                        <td><span class="badge badge-primary">${inst.BestSNRWins}</span></td>
-                        <td><span class="badge badge-warning">${inst.TiedSNR || 0}</span></td>
+                        <td><span class="instance-name">${instanceLabel(inst.name)}</span>${status}</td>
+                        <td>${inst.total_spots}</td>
+                        <td><span class="badge badge-success">${inst.unique_spots}</span></td>
+                        <td><span class="badge badge-primary">${inst.best_snr_wins}</span></td>
+                        <td><span class="badge badge-warning">${inst.tied_snr || 0}</span></td>
                         <td>
                             ${winRate}%
                             <div class="progress-bar">
@@ -1854,6 +2767,8 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                             </div>
                         </td>
                         <td>${lastReport}</td>
+                        <td>${recentCallsignsCell(inst.recent_callsigns)}</td>
+                        <td>${inst.software ? (inst.software + (inst.software_version ? ' ' + inst.software_version : '')) : 'unknown'}</td>
                     </tr>
                 ` + "`" + `;
                 tbody.innerHTML += row;
@@ -1869,16 +2784,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             // Sort instances alphabetically
             const instanceNames = Object.keys(performanceData).sort();
 
-            // Generate colors for each instance
-            const colors = [
-                '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
-                '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
-                '#f97316', '#14b8a6', '#a855f7', '#22c55e'
-            ];
-
             const datasets = instanceNames.map((instance, idx) => {
                 const points = performanceData[instance];
-                const color = colors[idx % colors.length];
+                const color = instanceColor(idx);
 
                 let dataPoints = points.map(p => ({
                     x: new Date(p.window_time),
@@ -1891,7 +2799,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 }
 
                 return {
-                    label: instance,
+                    label: instanceLabel(instance),
                     data: dataPoints,
                     borderColor: color,
                     backgroundColor: color + '20',
@@ -1981,16 +2889,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             // Sort instances alphabetically
             const instanceNames = Object.keys(performanceData).sort();
 
-            // Generate colors for each instance
-            const colors = [
-                '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
-                '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
-                '#f97316', '#14b8a6', '#a855f7', '#22c55e'
-            ];
-
             const datasets = instanceNames.map((instance, idx) => {
                 const points = performanceData[instance];
-                const color = colors[idx % colors.length];
+                const color = instanceColor(idx);
 
                 let dataPoints = points.map(p => ({
                     x: new Date(p.window_time),
@@ -2003,7 +2904,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 }
 
                 return {
-                    label: instance,
+                    label: instanceLabel(instance),
                     data: dataPoints,
                     borderColor: color,
                     backgroundColor: color + '20',
@@ -2131,16 +3032,16 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             
             // Sort instances alphabetically by name
             const sortedInstances = Object.values(instances).sort((a, b) =>
-                a.Name.localeCompare(b.Name)
+                a.name.localeCompare(b.name)
             );
             
             sortedInstances.forEach(inst => {
-                Object.entries(inst.BandStats || {}).forEach(([band, stats]) => {
+                Object.entries(inst.band_stats || {}).forEach(([band, stats]) => {
                     if (!bandData[band]) {
                         bandData[band] = [];
                     }
                     bandData[band].push({
-                        name: inst.Name,
+                        name: inst.name,
                         stats: stats
                     });
                 });
@@ -2200,26 +3101,26 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                             </thead>
                             <tbody>
                                 ${instanceList.map(item => {
-                                    const winRate = item.stats.TotalSpots > 0
-                                        ? ((item.stats.BestSNRWins / item.stats.TotalSpots) * 100).toFixed(1)
+                                    const winRate = item.stats.total_spots > 0
+                                        ? ((item.stats.best_snr_wins / item.stats.total_spots) * 100).toFixed(1)
                                         : '0.0';
-                                    const minDist = item.stats.DistanceCount > 0 ? item.stats.MinDistance.toFixed(0) + ' km' : '-';
-                                    const maxDist = item.stats.DistanceCount > 0 ? item.stats.MaxDistance.toFixed(0) + ' km' : '-';
-                                    const avgDist = item.stats.DistanceCount > 0 ? item.stats.AverageDistance.toFixed(0) + ' km' : '-';
+                                    const minDist = item.stats.distance_count > 0 ? item.stats.min_distance.toFixed(0) + ' ' + distanceUnit : '-';
+                                    const maxDist = item.stats.distance_count > 0 ? item.stats.max_distance.toFixed(0) + ' ' + distanceUnit : '-';
+                                    const avgDist = item.stats.distance_count > 0 ? item.stats.average_distance.toFixed(0) + ' ' + distanceUnit : '-';
                                     return ` + "`" + `
                                         <tr>
-                                            <td><span class="instance-name">${item.name}</span></td>
-                                            <td>${item.stats.TotalSpots}</td>
-                                            <td><span class="badge badge-success">${item.stats.UniqueSpots}</span></td>
-                                            <td><span class="badge badge-primary">${item.stats.BestSNRWins}</span></td>
-                                            <td><span class="badge badge-warning">${item.stats.TiedSNR || 0}</span></td>
+                                            <td><span class="instance-name">${instanceLabel(item.name)}</span></td>
+                                            <td>${item.stats.total_spots}</td>
+                                            <td><span class="badge badge-success">${item.stats.unique_spots}</span></td>
+                                            <td><span class="badge badge-primary">${item.stats.best_snr_wins}</span></td>
+                                            <td><span class="badge badge-warning">${item.stats.tied_snr || 0}</span></td>
                                             <td>
                                                 ${winRate}%
                                                 <div class="progress-bar">
                                                     <div class="progress-fill" style="width: ${winRate}%"></div>
                                                 </div>
                                             </td>
-                                            <td>${item.stats.AverageSNR.toFixed(1)} dB</td>
+                                            <td>${item.stats.average_snr.toFixed(1)} dB</td>
                                             <td>${minDist}</td>
                                             <td>${maxDist}</td>
                                             <td>${avgDist}</td>
@@ -2243,15 +3144,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         const bandHistory = snrHistory[band];
                         const instanceNames = Object.keys(bandHistory.instances || {}).sort();
 
-                        const colors = [
-                            '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
-                            '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
-                            '#f97316', '#14b8a6', '#a855f7', '#22c55e'
-                        ];
-
                         const timeDatasets = instanceNames.map((instance, idx) => {
                             const points = bandHistory.instances[instance];
-                            const color = colors[idx % colors.length];
+                            const color = instanceColor(idx);
 
                             let dataPoints = points.map(p => ({
                                 x: new Date(p.window_time),
@@ -2264,7 +3159,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                             }
 
                             return {
-                                label: instance,
+                                label: instanceLabel(instance),
                                 data: dataPoints,
                                 borderColor: color,
                                 backgroundColor: color + '20',
@@ -2350,15 +3245,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         const bandHistory = snrHistory[band];
                         const instanceNames = Object.keys(bandHistory.instances || {}).sort();
 
-                        const colors = [
-                            '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
-                            '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
-                            '#f97316', '#14b8a6', '#a855f7', '#22c55e'
-                        ];
-
                         const distanceDatasets = instanceNames.map((instance, idx) => {
                             const points = bandHistory.instances[instance];
-                            const color = colors[idx % colors.length];
+                            const color = instanceColor(idx);
 
                             // Filter to only points with distance data
                             const dataPoints = points
@@ -2369,7 +3258,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                 }));
 
                             return {
-                                label: instance,
+                                label: instanceLabel(instance),
                                 data: dataPoints,
                                 borderColor: color,
                                 backgroundColor: color + '20',
@@ -2407,7 +3296,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                     tooltip: {
                                         callbacks: {
                                             label: function(context) {
-                                                return context.dataset.label + ': ' + context.parsed.y.toFixed(0) + ' km';
+                                                return context.dataset.label + ': ' + context.parsed.y.toFixed(0) + ' ' + distanceUnit;
                                             }
                                         }
                                     }
@@ -2434,13 +3323,13 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                         ticks: {
                                             color: '#94a3b8',
                                             callback: function(value) {
-                                                return value + ' km';
+                                                return value + ' ' + distanceUnit;
                                             }
                                         },
                                         grid: { color: '#334155' },
                                         title: {
                                             display: true,
-                                            text: 'Distance (km)',
+                                            text: 'Distance (' + distanceUnit + ')',
                                             color: '#94a3b8'
                                         }
                                     }
@@ -2453,11 +3342,11 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     const ctx = document.getElementById(chartId);
                     if (!ctx) return;
 
-                    const labels = instanceList.map(item => item.name);
-                    const totalData = instanceList.map(item => item.stats.TotalSpots);
-                    const bestSNRData = instanceList.map(item => item.stats.BestSNRWins || 0);
-                    const tiedSNRData = instanceList.map(item => item.stats.TiedSNR || 0);
-                    const uniqueData = instanceList.map(item => item.stats.UniqueSpots);
+                    const labels = instanceList.map(item => instanceLabel(item.name));
+                    const totalData = instanceList.map(item => item.stats.total_spots);
+                    const bestSNRData = instanceList.map(item => item.stats.best_snr_wins || 0);
+                    const tiedSNRData = instanceList.map(item => item.stats.tied_snr || 0);
+                    const uniqueData = instanceList.map(item => item.stats.unique_spots);
 
                     // Destroy existing chart if it exists
                     if (bandCharts[band]) {
@@ -2757,6 +3646,96 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // Countries ranked by how many bands they were heard on (top 10)
+        function updateCountryBandsLeaderboard(summary) {
+            const container = document.getElementById('countryBandsLeaderboard');
+            if (!container) return;
+
+            if (!summary || summary.length === 0) {
+                container.innerHTML = '<p style="color: #94a3b8; text-align: center;">No country data available yet</p>';
+                return;
+            }
+
+            container.innerHTML = ` + "`" + `
+                <table style="width: 100%;">
+                    <thead>
+                        <tr>
+                            <th>#</th>
+                            <th>Country</th>
+                            <th>Bands Heard</th>
+                            <th>Bands</th>
+                            <th>Unique Callsigns</th>
+                            <th>Total Spots</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        ${summary.slice(0, 10).map((c, idx) => ` + "`" + `
+                            <tr>
+                                <td>${idx + 1}</td>
+                                <td><strong>${c.country}</strong></td>
+                                <td><span class="badge badge-success">${c.band_count}</span></td>
+                                <td>${c.bands.map(b => ` + "`" + `<span style="color: ${bandColors[b] || '#e2e8f0'}">${b}</span>` + "`" + `).join(', ')}</td>
+                                <td>${c.unique_callsigns}</td>
+                                <td>${c.total_spots}</td>
+                            </tr>
+                        ` + "`" + `).join('')}
+                    </tbody>
+                </table>
+            ` + "`" + `;
+        }
+
+        // Heatmap of spots per country (rows, top 30) per instance (columns).
+        // Countries heard by only one instance are marked with a star.
+        function updateInstanceCountryHeatmap(matrix) {
+            const container = document.getElementById('instanceCountryHeatmap');
+            if (!container) return;
+
+            if (!matrix || !matrix.countries || matrix.countries.length === 0) {
+                container.innerHTML = '<p style="color: #94a3b8; text-align: center;">No country data available yet</p>';
+                return;
+            }
+
+            const countries = matrix.countries.slice(0, 30);
+            let max = 0;
+            matrix.instances.forEach(inst => {
+                countries.forEach(c => { max = Math.max(max, matrix.counts[inst][c] || 0); });
+            });
+
+            const cell = (inst, country) => {
+                const count = matrix.counts[inst][country] || 0;
+                if (count === 0) return '<td style="text-align: center; color: #475569;">-</td>';
+                // Scale opacity with the square root so small counts stay visible
+                const alpha = 0.15 + 0.85 * Math.sqrt(count / max);
+                const unique = matrix.unique_to[country] === inst;
+                return ` + "`" + `<td style="text-align: center; background: rgba(16, 185, 129, ${alpha.toFixed(2)}); color: #f1f5f9;${unique ? ' font-weight: bold;' : ''}" title="${instanceLabel(inst)}: ${count} spots from ${country}${unique ? ' (only this instance)' : ''}">${count}${unique ? ' ★' : ''}</td>` + "`" + `;
+            };
+
+            container.innerHTML = ` + "`" + `
+                <div style="color: #94a3b8; font-size: 0.9em; margin-bottom: 10px;">
+                    Spots per country heard by each instance. ★ marks countries only that instance heard.
+                    ${matrix.countries.length > countries.length ? ` + "`" + `Showing the ${countries.length} busiest of ${matrix.countries.length} countries.` + "`" + ` : ''}
+                </div>
+                <div style="overflow-x: auto;">
+                    <table style="width: 100%;">
+                        <thead>
+                            <tr>
+                                <th>Country</th>
+                                ${matrix.instances.map(inst => ` + "`" + `<th style="text-align: center;">${instanceLabel(inst)}</th>` + "`" + `).join('')}
+                            </tr>
+                        </thead>
+                        <tbody>
+                            ${countries.map(country => ` + "`" + `
+                                <tr>
+                                    <td><strong>${country}</strong></td>
+                                    ${matrix.instances.map(inst => cell(inst, country)).join('')}
+                                </tr>
+                            ` + "`" + `).join('')}
+                        </tbody>
+                    </table>
+                </div>
+            ` + "`" + `;
+        }
+
         function updateRelationships(instances) {
             const container = document.getElementById('relationshipsContainer');
             
@@ -2777,7 +3756,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             const bandTotalSpots = {}; // band -> total spots count
             
             Object.values(instances).forEach(inst => {
-                Object.entries(inst.BandStats || {}).forEach(([band, stats]) => {
+                Object.entries(inst.band_stats || {}).forEach(([band, stats]) => {
                     // Initialize band data structures
                     if (!bandTies[band]) bandTies[band] = {};
                     if (!bandDuplicates[band]) bandDuplicates[band] = {};
@@ -2785,18 +3764,18 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     if (!bandTotalSpots[band]) bandTotalSpots[band] = 0;
                     
                     // Calculate totals
-                    bandTotalDuplicates[band] += (stats.TotalSpots - stats.UniqueSpots);
-                    bandTotalSpots[band] += stats.TotalSpots;
+                    bandTotalDuplicates[band] += (stats.total_spots - stats.unique_spots);
+                    bandTotalSpots[band] += stats.total_spots;
                     
                     // Process TiedWith relationships
-                    if (stats.TiedWith) {
-                        Object.entries(stats.TiedWith).forEach(([otherInstance, count]) => {
-                            if (inst.Name === otherInstance) return;
-                            const pair = [inst.Name, otherInstance].sort().join(' ↔ ');
+                    if (stats.tied_with) {
+                        Object.entries(stats.tied_with).forEach(([otherInstance, count]) => {
+                            if (inst.name === otherInstance) return;
+                            const pair = [inst.name, otherInstance].sort().join(' ↔ ');
                             if (!bandTies[band][pair]) {
                                 bandTies[band][pair] = {
-                                    instance1: inst.Name < otherInstance ? inst.Name : otherInstance,
-                                    instance2: inst.Name < otherInstance ? otherInstance : inst.Name,
+                                    instance1: inst.name < otherInstance ? inst.name : otherInstance,
+                                    instance2: inst.name < otherInstance ? otherInstance : inst.name,
                                     count: 0
                                 };
                             }
@@ -2805,14 +3784,14 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     }
                     
                     // Process DuplicatesWith relationships
-                    if (stats.DuplicatesWith) {
-                        Object.entries(stats.DuplicatesWith).forEach(([otherInstance, count]) => {
-                            if (inst.Name === otherInstance) return;
-                            const pair = [inst.Name, otherInstance].sort().join(' ↔ ');
+                    if (stats.duplicates_with) {
+                        Object.entries(stats.duplicates_with).forEach(([otherInstance, count]) => {
+                            if (inst.name === otherInstance) return;
+                            const pair = [inst.name, otherInstance].sort().join(' ↔ ');
                             if (!bandDuplicates[band][pair]) {
                                 bandDuplicates[band][pair] = {
-                                    instance1: inst.Name < otherInstance ? inst.Name : otherInstance,
-                                    instance2: inst.Name < otherInstance ? otherInstance : inst.Name,
+                                    instance1: inst.name < otherInstance ? inst.name : otherInstance,
+                                    instance2: inst.name < otherInstance ? otherInstance : inst.name,
                                     count: 0
                                 };
                             }
@@ -2889,9 +3868,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                     return ` + "`" + `
                                         <tr>
                                             <td style="padding: 8px;">
-                                                <span class="instance-name" style="font-size: 0.9em;">${tie.instance1}</span>
+                                                <span class="instance-name" style="font-size: 0.9em;">${instanceLabel(tie.instance1)}</span>
                                                 <span style="color: #f59e0b; margin: 0 4px;">↔</span>
-                                                <span class="instance-name" style="font-size: 0.9em;">${tie.instance2}</span>
+                                                <span class="instance-name" style="font-size: 0.9em;">${instanceLabel(tie.instance2)}</span>
                                             </td>
                                             <td style="padding: 8px;"><span class="badge badge-warning">${tie.count}</span></td>
                                             <td style="padding: 8px;">
@@ -2937,9 +3916,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                     return ` + "`" + `
                                         <tr>
                                             <td style="padding: 8px;">
-                                                <span class="instance-name" style="font-size: 0.9em;">${dup.instance1}</span>
+                                                <span class="instance-name" style="font-size: 0.9em;">${instanceLabel(dup.instance1)}</span>
                                                 <span style="color: #3b82f6; margin: 0 4px;">↔</span>
-                                                <span class="instance-name" style="font-size: 0.9em;">${dup.instance2}</span>
+                                                <span class="instance-name" style="font-size: 0.9em;">${instanceLabel(dup.instance2)}</span>
                                             </td>
                                             <td style="padding: 8px;"><span class="badge badge-primary">${dup.count}</span></td>
                                             <td style="padding: 8px;">
@@ -2971,6 +3950,10 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // Instances online for less than this fraction of the last 24 hours are
+        // shown in the value analysis but not assessed
+        const PARTIAL_UPTIME = 0.8;
+
         function updateMultiInstanceAnalysis(instances) {
             const container = document.getElementById('multiInstanceAnalysis');
             
@@ -2987,9 +3970,18 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             // Collect per-band analysis data
             const bandAnalysis = {};
 
+            // Instances with no spots in the last 24 hours are left out entirely;
+            // the rest are weighted by the fraction of that time they were online
+            const excludedInstances = [];
+
             // Organize data by band
             Object.values(instances).forEach(inst => {
-                Object.entries(inst.BandStats || {}).forEach(([band, stats]) => {
+                const onlineFraction = inst.online_fraction ?? 1;
+                if (onlineFraction === 0) {
+                    excludedInstances.push(inst.name);
+                    return;
+                }
+                Object.entries(inst.band_stats || {}).forEach(([band, stats]) => {
                     if (!bandAnalysis[band]) {
                         bandAnalysis[band] = {
                             instances: [],
@@ -2999,15 +3991,16 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     }
 
                     bandAnalysis[band].instances.push({
-                        name: inst.Name,
-                        totalSpots: stats.TotalSpots,
-                        uniqueSpots: stats.UniqueSpots,
-                        bestSNRWins: stats.BestSNRWins,
-                        tiedSNR: stats.TiedSNR || 0,
-                        duplicatesWith: stats.DuplicatesWith || {}
+                        name: inst.name,
+                        totalSpots: stats.total_spots,
+                        uniqueSpots: stats.unique_spots,
+                        bestSNRWins: stats.best_snr_wins,
+                        tiedSNR: stats.tied_snr || 0,
+                        duplicatesWith: stats.duplicates_with || {},
+                        onlineFraction
                     });
 
-                    bandAnalysis[band].totalSpots += stats.TotalSpots;
+                    bandAnalysis[band].totalSpots += stats.total_spots;
                 });
             });
 
@@ -3016,9 +4009,12 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             Object.entries(bandAnalysis).forEach(([band, data]) => {
                 if (data.instances.length === 0) return;
                 
-                // Find best single instance
+                // Find best single instance, by spots per unit of online time so a
+                // receiver that was down for part of the period isn't passed over
+                const onlineWeighted = value => inst => value(inst) / Math.max(inst.onlineFraction, 0.05);
+                const weightedSpots = onlineWeighted(inst => inst.totalSpots);
                 const bestInstance = data.instances.reduce((best, inst) =>
-                    inst.totalSpots > best.totalSpots ? inst : best
+                    weightedSpots(inst) > weightedSpots(best) ? inst : best
                 );
 
                 // Calculate total unique callsigns across all instances
@@ -3060,8 +4056,10 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 const overlapPercentage = data.totalSpots > 0
                     ? (bandDuplicateCount / data.totalSpots) * 100
                     : 0;
-                // Calculate total SNR wins across all instances for proper percentage calculation
-                const totalSNRWins = data.instances.reduce((sum, inst) => sum + inst.bestSNRWins, 0);
+                // Calculate total SNR wins across all instances for proper percentage calculation,
+                // weighted by online time
+                const weightedWins = onlineWeighted(inst => inst.bestSNRWins);
+                const totalSNRWins = data.instances.reduce((sum, inst) => sum + weightedWins(inst), 0);
 
                 
                 // Calculate unique contribution percentage for each instance
@@ -3071,7 +4069,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     return {
                         name: inst.name,
                         uniquePercent: inst.totalSpots > 0 ? (inst.uniqueSpots / inst.totalSpots) * 100 : 0,
-                        winRate: totalSNRWins > 0 ? (inst.bestSNRWins / totalSNRWins) * 100 : 0
+                        winRate: totalSNRWins > 0 ? (weightedWins(inst) / totalSNRWins) * 100 : 0,
+                        onlineFraction: inst.onlineFraction,
+                        partialUptime: inst.onlineFraction < PARTIAL_UPTIME
                     };
                 });
                 
@@ -3082,8 +4082,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     recommendationColor = '#94a3b8';
                     recommendationIcon = 'ℹ️';
                 } else {
-                    // Check if any instance has very low unique contribution (<5%)
-                    const hasVeryLowContribution = instanceContributions.some(inst => inst.uniquePercent < 5.0);
+                    // Check if any instance has very low unique contribution (<5%). Instances
+                    // that were down for much of the period aren't judged on it.
+                    const hasVeryLowContribution = instanceContributions.some(inst => !inst.partialUptime && inst.uniquePercent < 5.0);
 
                     if (hasVeryLowContribution) {
                         recommendation = 'High redundancy. One or more instances provide minimal unique coverage (<5%) - consider repositioning.';
@@ -3144,6 +4145,10 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             html += '<h3 style="color: #60a5fa; margin-bottom: 15px;">📈 Coverage Gain Analysis</h3>';
             html += '<p style="color: #cbd5e1; margin-bottom: 10px;">This analysis shows how much additional coverage you gain by running multiple instances per band.</p>';
             html += '<p style="color: #cbd5e1; font-size: 0.9em;"><strong>Coverage Gain</strong> = Total unique spots across all instances ÷ Best single instance spots</p>';
+            html += '<p style="color: #cbd5e1; font-size: 0.9em;">Spot counts and SNR wins are weighted by each instance\'s online time over the last 24 hours. Instances online less than ' + (PARTIAL_UPTIME * 100) + '% of that time are not assessed.</p>';
+            if (excludedInstances.length > 0) {
+                html += '<p style="color: #94a3b8; font-size: 0.9em;">Not included (no spots in the last 24 hours): ' + excludedInstances.map(instanceLabel).join(', ') + '</p>';
+            }
             html += '</div>';
 
             // Create per-band analysis
@@ -3214,13 +4219,17 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                             <th style="text-align: left; padding: 10px; background: #1e293b;">Instance</th>
                                             <th style="text-align: center; padding: 10px; background: #1e293b;">Unique %</th>
                                             <th style="text-align: center; padding: 10px; background: #1e293b;">SNR Win Rate</th>
+                                            <th style="text-align: center; padding: 10px; background: #1e293b;">Online</th>
                                             <th style="text-align: left; padding: 10px; background: #1e293b;">Assessment</th>
                                         </tr>
                                     </thead>
                                     <tbody>
                                         ${metrics.instanceContributions.map(inst => {
                                             let assessment, assessmentColor;
-                                            if (inst.uniquePercent >= 25) {
+                                            if (inst.partialUptime) {
+                                                assessment = 'Partial uptime - not assessed';
+                                                assessmentColor = '#94a3b8';
+                                            } else if (inst.uniquePercent >= 25) {
                                                 assessment = 'Excellent contribution';
                                                 assessmentColor = '#10b981';
                                             } else if (inst.uniquePercent >= 15) {
@@ -3236,7 +4245,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                             
                                             return ` + "`" + `
                                                 <tr style="border-top: 1px solid #334155;">
-                                                    <td style="padding: 10px;"><span class="instance-name">${inst.name}</span></td>
+                                                    <td style="padding: 10px;"><span class="instance-name">${instanceLabel(inst.name)}</span></td>
                                                     <td style="padding: 10px; text-align: center;">
                                                         <span style="font-weight: 600; color: ${inst.uniquePercent >= 20 ? '#10b981' : inst.uniquePercent >= 10 ? '#f59e0b' : '#ef4444'};">
                                                             ${inst.uniquePercent.toFixed(1)}%
@@ -3247,6 +4256,9 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                                                             ${inst.winRate.toFixed(1)}%
                                                         </span>
                                                     </td>
+                                                    <td style="padding: 10px; text-align: center; color: ${inst.partialUptime ? '#f59e0b' : '#cbd5e1'};">
+                                                        ${(inst.onlineFraction * 100).toFixed(0)}%
+                                                    </td>
                                                     <td style="padding: 10px; color: ${assessmentColor}; font-size: 0.9em;">
                                                         ${assessment}
                                                     </td>
@@ -3288,25 +4300,108 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     return aVal < bVal ? 1 : aVal > bVal ? -1 : 0;
                 }
             });
-            
-            // Update table body
-            const tableId = ` + "`" + `countryTable_${band.replace(/[^a-zA-Z0-9]/g, '_')}` + "`" + `;
-            const tbody = document.querySelector(` + "`" + `#${tableId} tbody` + "`" + `);
-            
-            tbody.innerHTML = countryList.map(c => ` + "`" + `
-                <tr>
-                    <td><strong>${c.country}</strong></td>
-                    <td><span class="badge badge-success">${c.unique_callsigns}</span></td>
-                    <td>${c.total_spots}</td>
-                    <td>${c.min_snr} dB</td>
-                    <td>${c.max_snr} dB</td>
-                    <td>${c.avg_snr.toFixed(1)} dB</td>
-                </tr>
-            ` + "`" + `).join('');
+            
+            // Update table body
+            const tableId = ` + "`" + `countryTable_${band.replace(/[^a-zA-Z0-9]/g, '_')}` + "`" + `;
+            const tbody = document.querySelector(` + "`" + `#${tableId} tbody` + "`" + `);
+            
+            tbody.innerHTML = countryList.map(c => ` + "`" + `
+                <tr>
+                    <td><strong>${c.country}</strong></td>
+                    <td><span class="badge badge-success">${c.unique_callsigns}</span></td>
+                    <td>${c.total_spots}</td>
+                    <td>${c.min_snr} dB</td>
+                    <td>${c.max_snr} dB</td>
+                    <td>${c.avg_snr.toFixed(1)} dB</td>
+                </tr>
+            ` + "`" + `).join('');
+        }
+
+        // Store SNR charts globally
+        const snrCharts = {};
+        const frequencyCharts = {};
+
+        function updateFrequencyHistograms(frequencies) {
+            const container = document.getElementById('frequencyHistograms');
+
+            if (!frequencies || Object.keys(frequencies).length === 0) {
+                container.innerHTML = '<p style="color: #94a3b8; text-align: center;">No frequency data available yet</p>';
+                return;
+            }
+
+            const bands = sortBands(Object.keys(frequencies));
+
+            Object.values(frequencyCharts).forEach(chart => chart.destroy());
+            container.innerHTML = bands.map(band => {
+                const data = frequencies[band];
+                const chartId = 'freqChart_' + band.replace(/[^a-zA-Z0-9]/g, '_');
+                return ` + "`" + `
+                    <div style="margin-bottom: 30px;">
+                        <h3 style="color: #60a5fa; margin-bottom: 10px;">
+                            <span class="badge badge-warning" style="font-size: 1.1em; padding: 6px 14px;">${band}</span>
+                            <span style="font-size: 0.8em; color: #94a3b8; margin-left: 10px;">
+                                ${data.count} spots &middot; min ${data.min_offset} Hz &middot; avg ${data.avg_offset.toFixed(0)} Hz &middot; max ${data.max_offset} Hz
+                                ${data.below + data.above > 0 ? ` + "`" + `&middot; ${data.below + data.above} outside passband` + "`" + ` : ''}
+                            </span>
+                        </h3>
+                        <div style="background: #1e293b; padding: 20px; border-radius: 12px; border: 1px solid #334155;">
+                            <canvas id="${chartId}" style="max-height: 200px;"></canvas>
+                        </div>
+                    </div>
+                ` + "`" + `;
+            }).join('');
+
+            bands.forEach(band => {
+                const data = frequencies[band];
+                const chartId = 'freqChart_' + band.replace(/[^a-zA-Z0-9]/g, '_');
+                const labels = data.histogram.map((_, i) => data.bin_start + i * data.bin_width);
+
+                frequencyCharts[band] = new Chart(document.getElementById(chartId), {
+                    type: 'bar',
+                    data: {
+                        labels: labels,
+                        datasets: [{
+                            label: 'Spots',
+                            data: data.histogram,
+                            backgroundColor: '#3b82f6',
+                            borderWidth: 0
+                        }]
+                    },
+                    options: {
+                        responsive: true,
+                        maintainAspectRatio: true,
+                        plugins: {
+                            legend: { display: false },
+                            tooltip: {
+                                callbacks: {
+                                    title: function(items) {
+                                        const start = Number(items[0].label);
+                                        return start + '-' + (start + data.bin_width) + ' Hz';
+                                    }
+                                }
+                            }
+                        },
+                        scales: {
+                            x: {
+                                ticks: { color: '#94a3b8' },
+                                grid: { color: '#334155' },
+                                title: {
+                                    display: true,
+                                    text: 'Offset from dial (Hz)',
+                                    color: '#94a3b8'
+                                }
+                            },
+                            y: {
+                                beginAtZero: true,
+                                ticks: { color: '#94a3b8', precision: 0 },
+                                grid: { color: '#334155' }
+                            }
+                        }
+                    }
+                });
+            });
         }
 
-        // Store SNR charts globally
-        const snrCharts = {};
 
         // Apply moving average smoothing to data (works for both SNR and spot count data)
         function applySmoothingToSNR(data, windowSize = 5) {
@@ -3332,9 +4427,14 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
             const smoothed = [];
             for (let i = 0; i < data.length; i++) {
+                // Gaps (null) stay gaps and are left out of their neighbours' averages
+                if (data[i] === null) {
+                    smoothed.push(null);
+                    continue;
+                }
                 const start = Math.max(0, i - Math.floor(windowSize / 2));
                 const end = Math.min(data.length, i + Math.ceil(windowSize / 2));
-                const window = data.slice(start, end);
+                const window = data.slice(start, end).filter(val => val !== null);
                 const sum = window.reduce((acc, val) => acc + val, 0);
                 smoothed.push(sum / window.length);
             }
@@ -3387,18 +4487,12 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     // Sort instances alphabetically
                     const instanceNames = Object.keys(bandData.instances).sort();
 
-                    // Generate colors for each instance
-                    const colors = [
-                        '#3b82f6', '#10b981', '#f59e0b', '#ef4444',
-                        '#8b5cf6', '#ec4899', '#06b6d4', '#84cc16',
-                        '#f97316', '#14b8a6', '#a855f7', '#22c55e'
-                    ];
-
                     const datasets = instanceNames.map((instance, idx) => {
                         const points = bandData.instances[instance];
-                        const color = colors[idx % colors.length];
+                        const color = instanceColor(idx);
 
-                        let dataPoints = points.map(p => ({
+                        // Skip windows where no spot carried an SNR
+                        let dataPoints = points.filter(p => p.snr_count !== 0).map(p => ({
                             x: new Date(p.window_time),
                             y: p.average_snr
                         }));
@@ -3409,7 +4503,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         }
 
                         return {
-                            label: instance,
+                            label: instanceLabel(instance),
                             data: dataPoints,
                             borderColor: color,
                             backgroundColor: color + '20',
@@ -3551,6 +4645,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             const bandFilter = document.getElementById('spotBandFilter').value;
             const timeFilter = parseInt(document.getElementById('spotTimeFilter').value);
             const submittedFilter = document.getElementById('spotSubmittedFilter').value;
+            const graylineFilter = document.getElementById('spotGraylineFilter').value;
 
             // Calculate time range
             const endTime = new Date();
@@ -3566,6 +4661,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
                 if (sourceFilter === 'deduped') {
                     if (submittedFilter) params.append('submitted', submittedFilter);
+                    if (graylineFilter) params.append('grayline', graylineFilter);
                     url = '/api/spots/deduped?' + params.toString();
                 } else {
                     params.append('instance', sourceFilter);
@@ -3721,8 +4817,12 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 
                 let statusHtml = '';
                 if (isDeduped) {
-                    if (spot.submitted) {
-                        statusHtml = '<span class="badge badge-success">✓ Sent</span>';
+                    if (spot.pending) {
+                        statusHtml = '<span class="badge badge-warning" title="Queued for WSPRNet, result not yet known">… Pending</span>';
+                    } else if (spot.submitted) {
+                        statusHtml = spot.error
+                            ? ` + "`" + `<span class="badge badge-success" title="${spot.error}">✓ Sent</span>` + "`" + `
+                            : '<span class="badge badge-success">✓ Sent</span>';
                     } else {
                         const errorMsg = spot.error || 'Unknown error';
                         statusHtml = ` + "`" + `<span class="badge" style="background: #ef4444; color: white;" title="${errorMsg}">✗ Failed</span>` + "`" + `;
@@ -3741,7 +4841,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                         <td><span class="badge" style="background: ${bandColor}; color: white;">${spot.band}</span></td>
                         <td>${spot.dbm} dBm</td>
                         <td>${spot.country || '-'}</td>
-                        <td>${spot.instance || '-'}</td>
+                        <td>${spot.instance ? instanceLabel(spot.instance) : '-'}</td>
                         <td>${statusHtml}</td>
                     </tr>
                 ` + "`" + `;
@@ -3846,7 +4946,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 csv += ` + "`" + `${timestamp},${spot.callsign},${spot.locator},${spot.snr},${freqMHz},${spot.band},${spot.dbm},` + "`" + `;
                 
                 if (isDeduped) {
-                    csv += ` + "`" + `${spot.instance || ''},${spot.submitted ? 'Yes' : 'No'},"${spot.error || ''}"\n` + "`" + `;
+                    csv += ` + "`" + `${spot.instance || ''},${spot.pending ? 'Pending' : (spot.submitted ? 'Yes' : 'No')},"${spot.error || ''}"\n` + "`" + `;
                 } else {
                     csv += ` + "`" + `${spot.country || ''}\n` + "`" + `;
                 }
@@ -3875,6 +4975,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             const sourceFilter = document.getElementById('spotSourceFilter').value;
             const timeFilter = parseInt(document.getElementById('spotTimeFilter').value);
             const submittedFilter = document.getElementById('spotSubmittedFilter').value;
+            const graylineFilter = document.getElementById('spotGraylineFilter').value;
 
             const endTime = new Date();
             const startTime = new Date(endTime.getTime() - (timeFilter * 60 * 60 * 1000));
@@ -3888,6 +4989,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
                 if (sourceFilter === 'deduped') {
                     if (submittedFilter) params.append('submitted', submittedFilter);
+                    if (graylineFilter) params.append('grayline', graylineFilter);
                     url = '/api/spots/deduped?' + params.toString();
                 } else {
                     params.append('instance', sourceFilter);
@@ -3980,7 +5082,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 instances.sort().forEach(instance => {
                     const option = document.createElement('option');
                     option.value = instance;
-                    option.textContent = ` + "`" + `Instance: ${instance}` + "`" + `;
+                    option.textContent = ` + "`" + `Instance: ${instanceLabel(instance)}` + "`" + `;
                     sourceSelect.appendChild(option);
                 });
             } catch (error) {
@@ -3989,7 +5091,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
             // Create band filter buttons
             const bandButtonsContainer = document.getElementById('spotBandButtons');
-            const bands = ['all', '2200m', '630m', '160m', '80m', '60m', '40m', '30m', '20m', '17m', '15m', '12m', '10m'];
+            const bands = ['all', ...wsprBands];
             bands.forEach(band => {
                 const btn = document.createElement('button');
                 btn.className = 'filter-btn' + (band === 'all' ? ' active' : ' inactive');
@@ -4010,6 +5112,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 const sourceFilter = document.getElementById('spotSourceFilter').value;
                 const submittedFilter = document.getElementById('spotSubmittedFilter').parentElement;
                 submittedFilter.style.display = sourceFilter === 'deduped' ? 'block' : 'none';
+                document.getElementById('spotGraylineFilter').parentElement.style.display = sourceFilter === 'deduped' ? 'block' : 'none';
                 currentPage = 1;
                 loadSpots();
             });
@@ -4021,6 +5124,10 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                 currentPage = 1;
                 loadSpots();
             });
+            document.getElementById('spotGraylineFilter').addEventListener('change', () => {
+                currentPage = 1;
+                loadSpots();
+            });
             
             // Per-page selector
             document.getElementById('spotsPerPage').addEventListener('change', (e) => {
@@ -4105,7 +5212,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
             html += '<option value="deduped">Deduped (Sent to WSPRNet)</option>';
             
             instances.forEach(instance => {
-                html += '<option value="' + instance + '">Instance: ' + instance + '</option>';
+                html += '<option value="' + instance + '">Instance: ' + instanceLabel(instance) + '</option>';
             });
             
             select.innerHTML = html;
@@ -4292,7 +5399,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
                     const maxDisplay = 20;
                     const displayCycles = gap.missing_cycles.slice(0, maxDisplay);
                     const remaining = gap.missing_cycles.length - maxDisplay;
-                    const displayName = gap.instance === 'deduped' ? '📤 Deduped (Sent to WSPRNet)' : ` + "`" + `🖥️ ${gap.instance}` + "`" + `;
+                    const displayName = gap.instance === 'deduped' ? '📤 Deduped (Sent to WSPRNet)' : ` + "`" + `🖥️ ${instanceLabel(gap.instance)}` + "`" + `;
                     const gapDataId = ` + "`" + `gapdata_${gap.instance}_${band.replace(/[^a-zA-Z0-9]/g, '_')}` + "`" + `;
 
                     html += ` + "`" + `
@@ -4527,6 +5634,7 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
         initBandFilters();
         initSpotsTab();
         initGapsTab();
+        updateActivityRangeControls();
 
         // Initial load
         fetchData();
@@ -4553,16 +5661,130 @@ func (ws *WebServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 </body>
 </html>`
 
-	_, _ = w.Write([]byte(html))
+	html = ws.applyBranding(html)
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(html)); err != nil {
+		log.Printf("Error writing dashboard: %v", err)
+	}
+}
+
+// applyBranding fills the dashboard title, subtitle, favicon and logo placeholders from config
+func (ws *WebServer) applyBranding(page string) string {
+	branding := ws.config.Load().Dashboard
+
+	title := branding.Title
+	if title == "" {
+		title = "WSPR MQTT Aggregator"
+	}
+	subtitle := branding.Subtitle
+	if subtitle == "" {
+		subtitle = "Real-time monitoring and statistics"
+	}
+
+	// Branding files that are missing fall back to the defaults
+	favicon := ""
+	if brandingFileExists(branding.FaviconPath) {
+		favicon = "    <link rel=\"icon\" href=\"/favicon.ico\">\n"
+	}
+
+	// Keep the default emoji unless a logo has been configured
+	logo := "🛰️ "
+	if brandingFileExists(branding.LogoPath) {
+		logo = "<img class=\"header-logo\" src=\"/branding/logo\" alt=\"\">"
+	}
+
+	// The tile layer settings are embedded as a JS object literal. The local
+	// tile directory is left out; the page only needs the URL.
+	mapTiles := branding.MapTiles
+	mapTiles.Dir = ""
+	tiles, err := json.Marshal(mapTiles)
+	if err != nil {
+		tiles = []byte("{}")
+	}
+
+	bands, err := json.Marshal(activeBandTable.names())
+	if err != nil {
+		bands = []byte("[]")
+	}
+
+	return strings.NewReplacer(
+		"{{TITLE}}", html.EscapeString(title),
+		"{{SUBTITLE}}", html.EscapeString(subtitle),
+		"{{FAVICON}}", favicon,
+		"{{LOGO}}", logo,
+		"{{MAP_TILES}}", string(tiles),
+		"{{BANDS}}", string(bands),
+	).Replace(page)
+}
+
+// handleMapTiles serves map tiles from the configured local directory. Directory
+// listings are not served.
+func (ws *WebServer) handleMapTiles() http.Handler {
+	files := http.StripPrefix("/map-tiles/", http.FileServer(http.Dir(ws.config.Load().Dashboard.MapTiles.Dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// handleFavicon serves the configured favicon file
+func (ws *WebServer) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	ws.serveBrandingFile(w, r, ws.config.Load().Dashboard.FaviconPath)
+}
+
+// handleLogo serves the configured header logo file
+func (ws *WebServer) handleLogo(w http.ResponseWriter, r *http.Request) {
+	ws.serveBrandingFile(w, r, ws.config.Load().Dashboard.LogoPath)
+}
+
+// brandingFileExists reports whether a branding file is configured and present
+func brandingFileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// serveBrandingFile serves an operator-supplied branding file, or 404 if none is configured
+func (ws *WebServer) serveBrandingFile(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Branding file %s unavailable: %v", path, err)
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeFile(w, r, path)
 }
 
 // handleRawSpots returns raw spots from instances with optional filters
 func (ws *WebServer) handleRawSpots(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	if ws.spotWriter == nil {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Spot writer not initialized",
 			"spots": []interface{}{},
 		})
@@ -4576,29 +5798,70 @@ func (ws *WebServer) handleRawSpots(w http.ResponseWriter, r *http.Request) {
 	startTimeStr := query.Get("start_time")
 	endTimeStr := query.Get("end_time")
 
-	var startTime, endTime time.Time
-	if startTimeStr != "" {
-		if t, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
-			startTime = t
-		}
+	startTime, err := parseOptionalTime(startTimeStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid start_time: %v", err))
+		return
 	}
-	if endTimeStr != "" {
-		if t, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
-			endTime = t
-		}
+	endTime, err := parseOptionalTime(endTimeStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid end_time: %v", err))
+		return
 	}
 
 	spots := ws.spotWriter.GetRawSpots(instance, band, startTime, endTime)
-	_ = json.NewEncoder(w).Encode(spots)
+	writeJSON(w, http.StatusOK, spots)
+}
+
+// handleRawSpotsDownload streams one instance's raw spots from the last 24
+// hours as JSONL, in the format of its instance_<name>.jsonl file, for offline
+// analysis of the data before deduplication
+func (ws *WebServer) handleRawSpotsDownload(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	instance := r.URL.Query().Get("instance")
+	if instance == "" {
+		writeJSONError(w, http.StatusBadRequest, "instance is required")
+		return
+	}
+	spots, ok := ws.spotWriter.RawSpotsSnapshot(instance)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No raw spots for instance %q", instance))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "instance_"+instance+".jsonl"))
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := range spots {
+		if spots[i].Timestamp.Before(cutoff) {
+			continue
+		}
+		if err := enc.Encode(&spots[i]); err != nil {
+			return // Client went away
+		}
+	}
+	bw.Flush()
 }
 
 // handleDedupedSpots returns deduped spots with optional filters
 func (ws *WebServer) handleDedupedSpots(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	if ws.spotWriter == nil {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Spot writer not initialized",
 			"spots": []interface{}{},
 		})
@@ -4611,50 +5874,384 @@ func (ws *WebServer) handleDedupedSpots(w http.ResponseWriter, r *http.Request)
 	startTimeStr := query.Get("start_time")
 	endTimeStr := query.Get("end_time")
 	submittedStr := query.Get("submitted")
+	graylineStr := query.Get("grayline")
 
-	var startTime, endTime time.Time
-	if startTimeStr != "" {
-		if t, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
-			startTime = t
-		}
+	startTime, err := parseOptionalTime(startTimeStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid start_time: %v", err))
+		return
 	}
-	if endTimeStr != "" {
-		if t, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
-			endTime = t
-		}
+	endTime, err := parseOptionalTime(endTimeStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid end_time: %v", err))
+		return
 	}
 
 	var submittedOnly *bool
 	if submittedStr != "" {
-		val := submittedStr == "true"
+		val, err := strconv.ParseBool(submittedStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid submitted value: %q", submittedStr))
+			return
+		}
 		submittedOnly = &val
 	}
 
 	spots := ws.spotWriter.GetDedupedSpots(band, startTime, endTime, submittedOnly)
-	_ = json.NewEncoder(w).Encode(spots)
+
+	// Spots without a grayline flag match neither value
+	if graylineStr != "" {
+		grayline, err := strconv.ParseBool(graylineStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid grayline value: %q", graylineStr))
+			return
+		}
+		filtered := make([]StoredSpot, 0, len(spots))
+		for _, spot := range spots {
+			if spot.Grayline != nil && *spot.Grayline == grayline {
+				filtered = append(filtered, spot)
+			}
+		}
+		spots = filtered
+	}
+
+	writeJSON(w, http.StatusOK, spots)
+}
+
+// formatOptionalBool formats a flag for CSV, leaving it empty when unknown
+func formatOptionalBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// spotsExportFlushRows is how many CSV rows are written between flushes to the client
+const spotsExportFlushRows = 500
+
+// handleSpotsExportCSV streams deduped spots as CSV for offline analysis, with
+// optional band, instance, start_time and end_time filters
+func (ws *WebServer) handleSpotsExportCSV(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	query := r.URL.Query()
+	band := query.Get("band")
+	instance := query.Get("instance")
+
+	startTime, err := parseOptionalTime(query.Get("start_time"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid start_time: %v", err))
+		return
+	}
+	endTime, err := parseOptionalTime(query.Get("end_time"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid end_time: %v", err))
+		return
+	}
+
+	spots := ws.spotWriter.GetDedupedSpots(band, startTime, endTime, nil)
+	sort.SliceStable(spots, func(i, j int) bool {
+		return spots[i].Timestamp.Before(spots[j].Timestamp)
+	})
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"wspr_spots_%s.csv\"", time.Now().UTC().Format("20060102_1504")))
+
+	// Rows are encoded straight to the response and flushed in batches rather
+	// than building the whole file in memory
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"timestamp", "callsign", "grid", "band", "freq", "snr", "dbm", "drift", "dt", "instance", "country", "submitted", "confidence", "grayline"})
+
+	rows := 0
+	for _, spot := range spots {
+		if instance != "" && instance != "all" && spot.Instance != instance {
+			continue
+		}
+		cw.Write([]string{
+			spot.Timestamp.UTC().Format(time.RFC3339),
+			spot.Callsign,
+			spot.Locator,
+			spot.Band,
+			strconv.FormatUint(spot.Frequency, 10),
+			strconv.Itoa(spot.SNR),
+			strconv.Itoa(spot.DBm),
+			strconv.Itoa(spot.Drift),
+			strconv.FormatFloat(float64(spot.DT), 'f', 1, 32),
+			spot.Instance,
+			spot.Country,
+			strconv.FormatBool(spot.Submitted),
+			strconv.Itoa(spot.Confidence),
+			formatOptionalBool(spot.Grayline),
+		})
+
+		rows++
+		if rows%spotsExportFlushRows == 0 {
+			cw.Flush()
+			if cw.Error() != nil {
+				return // Client went away
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Warning: CSV export ended early: %v", err)
+	}
+}
+
+// handleSpotReceptions streams, as JSON Lines, every instance's report of each
+// spot with the instance deduplication kept. Optional band, start_time and
+// end_time filters; the default range is the last 24 hours.
+func (ws *WebServer) handleSpotReceptions(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	query := r.URL.Query()
+	band := query.Get("band")
+
+	startTime, err := parseOptionalTime(query.Get("start_time"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid start_time: %v", err))
+		return
+	}
+	endTime, err := parseOptionalTime(query.Get("end_time"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid end_time: %v", err))
+		return
+	}
+	now := time.Now().UTC()
+	if startTime.IsZero() || startTime.Before(now.Add(-24*time.Hour)) {
+		startTime = now.Add(-24 * time.Hour)
+	}
+	if endTime.IsZero() || endTime.After(now) {
+		endTime = now
+	}
+	// Whole WSPR cycles, so no cycle is split between chunks
+	startTime = startTime.Truncate(2 * time.Minute)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"wspr_receptions_%s.jsonl\"", now.Format("20060102_1504")))
+
+	// The history is grouped an hour at a time and each hour is written and
+	// flushed before the next is built
+	flusher, _ := w.(http.Flusher)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for from := startTime; from.Before(endTime); from = from.Add(receptionsChunk) {
+		to := from.Add(receptionsChunk)
+		if to.After(endTime) {
+			to = endTime
+		}
+		for _, record := range ws.spotWriter.GetSpotReceptions(band, from, to) {
+			if err := enc.Encode(record); err != nil {
+				return // Client went away
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleSpotStatus looks up the submission outcome of a callsign in a given WSPR cycle
+func (ws *WebServer) handleSpotStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	query := r.URL.Query()
+	callsign := strings.TrimSpace(query.Get("callsign"))
+	if callsign == "" {
+		writeJSONError(w, http.StatusBadRequest, "callsign is required")
+		return
+	}
+	timeStr := query.Get("time")
+	if timeStr == "" {
+		writeJSONError(w, http.StatusBadRequest, "time is required (RFC3339)")
+		return
+	}
+	spotTime, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid time: %v", err))
+		return
+	}
+
+	// Any time within the 2-minute WSPR cycle matches
+	cycle := time.Unix((spotTime.Unix()/120)*120, 0).UTC()
+	spots := ws.spotWriter.FindDeduped(callsign, cycle)
+	if len(spots) == 0 {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No deduplicated spot for %s in the cycle at %s (only the last 24 hours are kept)",
+			strings.ToUpper(callsign), cycle.Format(time.RFC3339)))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"callsign": strings.ToUpper(callsign),
+		"cycle":    cycle,
+		"spots":    spots,
+	})
+}
+
+// CallsignSpot is a single reception of a callsign by one instance
+type CallsignSpot struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Band       string    `json:"band"`
+	Instance   string    `json:"instance"`
+	SNR        int       `json:"snr"`
+	Frequency  uint64    `json:"frequency"`
+	Locator    string    `json:"locator"`
+	DistanceKm *float64  `json:"distance_km"` // nil when the locator is missing or invalid
+	Bearing    *float64  `json:"bearing"`     // Degrees true from the receiver
+	// Locator characters used for the distance: 6 when the subsquare was used, otherwise 4
+	GridPrecision int `json:"grid_precision,omitempty"`
+}
+
+// CallsignSummary summarises all receptions of a callsign
+type CallsignSummary struct {
+	TotalSpots    int       `json:"total_spots"`
+	Bands         []string  `json:"bands"`
+	Instances     []string  `json:"instances"`
+	BestSNR       int       `json:"best_snr"`
+	WorstSNR      int       `json:"worst_snr"`
+	FirstHeard    time.Time `json:"first_heard"`
+	LastHeard     time.Time `json:"last_heard"`
+	MaxDistanceKm *float64  `json:"max_distance_km"`
+}
+
+// handleCallsign returns all raw spots for one callsign over the retention window
+// along with summary statistics. The callsign is the last path element.
+func (ws *WebServer) handleCallsign(w http.ResponseWriter, r *http.Request) {
+	if !requireGET(w, r) {
+		return
+	}
+
+	if ws.spotWriter == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Spot writer not initialized")
+		return
+	}
+
+	callsign := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/callsign/")))
+	if callsign == "" {
+		writeJSONError(w, http.StatusBadRequest, "callsign is required: /api/callsign/{call}")
+		return
+	}
+
+	stored := ws.spotWriter.GetCallsignSpots(callsign)
+	if len(stored) == 0 {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No spots for %s in the last 24 hours", callsign))
+		return
+	}
+
+	spots := make([]CallsignSpot, 0, len(stored))
+	summary := CallsignSummary{
+		TotalSpots: len(stored),
+		BestSNR:    stored[0].SNR,
+		WorstSNR:   stored[0].SNR,
+		FirstHeard: stored[0].Timestamp,
+		LastHeard:  stored[len(stored)-1].Timestamp,
+	}
+	bands := make(map[string]bool)
+	instances := make(map[string]bool)
+
+	for _, spot := range stored {
+		entry := CallsignSpot{
+			Timestamp: spot.Timestamp,
+			Band:      spot.Band,
+			Instance:  spot.Instance,
+			SNR:       spot.SNR,
+			Frequency: spot.Frequency,
+			Locator:   spot.Locator,
+		}
+		if path, ok := ws.stats.DistanceTo(spot.Locator); ok {
+			entry.DistanceKm = &path.Km
+			entry.Bearing = &path.Bearing
+			entry.GridPrecision = path.Precision
+			if summary.MaxDistanceKm == nil || path.Km > *summary.MaxDistanceKm {
+				summary.MaxDistanceKm = &path.Km
+			}
+		}
+		spots = append(spots, entry)
+
+		if spot.SNR > summary.BestSNR {
+			summary.BestSNR = spot.SNR
+		}
+		if spot.SNR < summary.WorstSNR {
+			summary.WorstSNR = spot.SNR
+		}
+		bands[spot.Band] = true
+		instances[spot.Instance] = true
+	}
+
+	for band := range bands {
+		summary.Bands = append(summary.Bands, band)
+	}
+	sortBands(summary.Bands)
+	for instance := range instances {
+		summary.Instances = append(summary.Instances, instance)
+	}
+	sort.Strings(summary.Instances)
+
+	// The live map entry, with first and last heard times, or null
+	var mapSpot *SpotLocation
+	if spot, ok := ws.stats.GetSpotLocation(callsign); ok {
+		mapSpot = spot
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"callsign": callsign,
+		"summary":  summary,
+		"map_spot": mapSpot,
+		"spots":    spots,
+	})
 }
 
 // handleSpotInstances returns list of instance names that have spots
 func (ws *WebServer) handleSpotInstances(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	if ws.spotWriter == nil {
-		_ = json.NewEncoder(w).Encode([]string{})
+		writeJSON(w, http.StatusOK, []string{})
 		return
 	}
 
 	instances := ws.spotWriter.GetInstanceNames()
-	_ = json.NewEncoder(w).Encode(instances)
+	writeJSON(w, http.StatusOK, instances)
 }
 
 // handleSpotGaps returns gap analysis showing missing WSPR cycles
 func (ws *WebServer) handleSpotGaps(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if !requireGET(w, r) {
+		return
+	}
 
 	if ws.spotWriter == nil {
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Spot writer not initialized",
 			"gaps":  map[string]interface{}{},
 		})
@@ -4666,11 +6263,57 @@ func (ws *WebServer) handleSpotGaps(w http.ResponseWriter, r *http.Request) {
 	hoursBackStr := query.Get("hours")
 	hoursBack := 24 // default to 24 hours
 	if hoursBackStr != "" {
-		if h, err := time.ParseDuration(hoursBackStr + "h"); err == nil {
-			hoursBack = int(h.Hours())
+		h, err := strconv.Atoi(hoursBackStr)
+		if err != nil || h <= 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid hours value: %q", hoursBackStr))
+			return
 		}
+		hoursBack = h
 	}
 
 	gaps := ws.spotWriter.AnalyzeGaps(hoursBack)
-	_ = json.NewEncoder(w).Encode(gaps)
+	writeJSON(w, http.StatusOK, gaps)
+}
+
+// writeJSON encodes v and writes it with the given status code. The body is
+// marshalled before any header is sent so an encoding failure can still be
+// reported as a 500 instead of a truncated 200.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// writeJSONError writes a JSON error body of the form {"error": "..."}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// requireGET rejects anything other than GET/HEAD with 405 and reports
+// whether the handler should continue
+func requireGET(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+// parseOptionalTime parses an RFC3339 query parameter, returning the zero
+// time when the parameter is empty
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
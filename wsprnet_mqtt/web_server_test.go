@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestWebServer returns a web server with empty statistics and a spot
+// writer in a temporary directory, without starting it
+func newTestWebServer(t *testing.T) *WebServer {
+	t.Helper()
+
+	config := &Config{DistanceUnit: "km", AllowedOrigins: []string{allowAllOrigins}}
+	stats := NewStatisticsTracker()
+	t.Cleanup(stats.Close)
+	spotWriter, err := NewSpotWriter(t.TempDir(), SpotStorageJSONL, DefaultSpotRetentionDays, 1)
+	if err != nil {
+		t.Fatalf("NewSpotWriter: %v", err)
+	}
+	t.Cleanup(spotWriter.Stop)
+
+	return NewWebServer(stats, nil, nil, NewSharedConfig(config), 0, "", nil, spotWriter)
+}
+
+// decodeJSONError checks that rec holds a JSON error body and returns its message
+func decodeJSONError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	message, ok := body["error"]
+	if !ok || len(body) != 1 {
+		t.Errorf("error body = %v, want a single \"error\" field", body)
+	}
+	return message
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSONError(rec, http.StatusTeapot, `bad "input"`)
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+	if message := decodeJSONError(t, rec); message != `bad "input"` {
+		t.Errorf("error = %q, want %q", message, `bad "input"`)
+	}
+}
+
+func TestRequireGET(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		if !requireGET(rec, httptest.NewRequest(method, "/api/summary", nil)) {
+			t.Errorf("requireGET rejected %s", method)
+		}
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Errorf("requireGET wrote a response for %s: %d %q", method, rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		rec := httptest.NewRecorder()
+		if requireGET(rec, httptest.NewRequest(method, "/api/summary", nil)) {
+			t.Errorf("requireGET accepted %s", method)
+		}
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status = %d, want %d", method, rec.Code, http.StatusMethodNotAllowed)
+		}
+		if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Errorf("%s: Allow = %q, want %q", method, allow, "GET, HEAD")
+		}
+		if message := decodeJSONError(t, rec); message != "Method not allowed" {
+			t.Errorf("%s: error = %q, want %q", method, message, "Method not allowed")
+		}
+	}
+}
+
+func TestHandlerErrorStatus(t *testing.T) {
+	ws := newTestWebServer(t)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		status  int
+		error   string // Substring of the error message
+	}{
+		{"instances POST", ws.handleInstances, http.MethodPost, "/api/instances", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"instance DELETE", ws.handleInstance, http.MethodDelete, "/api/instances/kiwi1", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"instance without name", ws.handleInstance, http.MethodGet, "/api/instances/", http.StatusBadRequest, "instance name is required"},
+		{"unknown instance", ws.handleInstance, http.MethodGet, "/api/instances/kiwi_2", http.StatusNotFound, `Unknown instance "kiwi_2"`},
+		{"activity hours not a number", ws.handleActivity, http.MethodGet, "/api/activity?hours=abc", http.StatusBadRequest, "hours must be a whole number"},
+		{"activity hours zero", ws.handleActivity, http.MethodGet, "/api/activity?hours=0", http.StatusBadRequest, "hours must be a whole number"},
+		{"raw spots bad start_time", ws.handleRawSpots, http.MethodGet, "/api/spots/raw?start_time=yesterday", http.StatusBadRequest, "Invalid start_time"},
+		{"raw spots bad end_time", ws.handleRawSpots, http.MethodGet, "/api/spots/raw?end_time=2024-13-01", http.StatusBadRequest, "Invalid end_time"},
+		{"raw spots download without instance", ws.handleRawSpotsDownload, http.MethodGet, "/api/raw-spots", http.StatusBadRequest, "instance is required"},
+		{"raw spots download unknown instance", ws.handleRawSpotsDownload, http.MethodGet, "/api/raw-spots?instance=kiwi1", http.StatusNotFound, `No raw spots for instance "kiwi1"`},
+		{"spot status without callsign", ws.handleSpotStatus, http.MethodGet, "/api/spots/status?time=2024-01-15T12:34:00Z", http.StatusBadRequest, "callsign is required"},
+		{"spot status without time", ws.handleSpotStatus, http.MethodGet, "/api/spots/status?callsign=K1ABC", http.StatusBadRequest, "time is required"},
+		{"spot status bad time", ws.handleSpotStatus, http.MethodGet, "/api/spots/status?callsign=K1ABC&time=noon", http.StatusBadRequest, "Invalid time"},
+		{"spot status not found", ws.handleSpotStatus, http.MethodGet, "/api/spots/status?callsign=K1ABC&time=2024-01-15T12:34:00Z", http.StatusNotFound, "No deduplicated spot for K1ABC"},
+		{"callsign without call", ws.handleCallsign, http.MethodGet, "/api/callsign/", http.StatusBadRequest, "callsign is required"},
+		{"callsign not heard", ws.handleCallsign, http.MethodGet, "/api/callsign/k1abc", http.StatusNotFound, "No spots for K1ABC"},
+		{"callsign POST", ws.handleCallsign, http.MethodPost, "/api/callsign/K1ABC", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.status, rec.Body.String())
+			}
+			if message := decodeJSONError(t, rec); !strings.Contains(message, tt.error) {
+				t.Errorf("error = %q, want it to contain %q", message, tt.error)
+			}
+		})
+	}
+}
+
+func TestHandlerSuccessStatus(t *testing.T) {
+	ws := newTestWebServer(t)
+
+	tests := []struct {
+		handler http.HandlerFunc
+		target  string
+	}{
+		{ws.handleBands, "/api/bands"},
+		{ws.handleInstances, "/api/instances"},
+		{ws.handleActivity, "/api/activity?hours=6"},
+		{ws.handleRawSpots, "/api/spots/raw?start_time=2024-01-15T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d (body %q)", tt.target, rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tt.target, ct)
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%s: body is not JSON: %q", tt.target, rec.Body.String())
+		}
+	}
+}
+
+func TestApplyBrandingMissingFiles(t *testing.T) {
+	ws := newTestWebServer(t)
+	logo := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(logo, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := *ws.config.Load()
+	config.Dashboard.FaviconPath = filepath.Join(t.TempDir(), "missing.ico")
+	config.Dashboard.LogoPath = logo
+	ws.config.Store(&config)
+
+	page := ws.applyBranding("{{FAVICON}}|{{LOGO}}")
+	favicon, header, _ := strings.Cut(page, "|")
+	if favicon != "" {
+		t.Errorf("favicon = %q, want none for a missing file", favicon)
+	}
+	if !strings.Contains(header, "/branding/logo") {
+		t.Errorf("logo = %q, want the configured logo", header)
+	}
+
+	// A logo that goes missing falls back to the default
+	if err := os.Remove(logo); err != nil {
+		t.Fatal(err)
+	}
+	if page := ws.applyBranding("{{LOGO}}"); strings.Contains(page, "/branding/logo") {
+		t.Errorf("logo = %q, want the default for a missing file", page)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWindowHookTimeout is how long (seconds) a window hook may run before it is killed
+const DefaultWindowHookTimeout = 30
+
+// windowHookMaxRunning limits how many hook processes may run at once. A window
+// finalized while the limit is reached is skipped rather than queued.
+const windowHookMaxRunning = 4
+
+// windowHookMaxOutput is how much of a failed hook's output is logged
+const windowHookMaxOutput = 500
+
+// WindowHookConfig runs an external command each time a window is finalized
+type WindowHookConfig struct {
+	Command        string   `yaml:"command,omitempty" json:"command,omitempty"`                 // Executable to run; empty disables the hook
+	Args           []string `yaml:"args,omitempty" json:"args,omitempty"`                       // Extra arguments passed to the command
+	TimeoutSeconds int      `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"` // Kill the command after this long (default 30)
+}
+
+// WindowHook runs the configured command for each finalized window, with the
+// window summary as JSON on stdin. Runs are asynchronous so a slow command
+// never holds up aggregation.
+type WindowHook struct {
+	command string
+	args    []string
+	timeout time.Duration
+	running int32
+}
+
+// NewWindowHook creates a hook for the given config
+func NewWindowHook(config WindowHookConfig) *WindowHook {
+	log.Printf("Window hook: running %s after each window (timeout %ds)", config.Command, config.TimeoutSeconds)
+	return &WindowHook{
+		command: config.Command,
+		args:    config.Args,
+		timeout: time.Duration(config.TimeoutSeconds) * time.Second,
+	}
+}
+
+// Run starts the command for a finalized window. The window must not be
+// modified afterwards; pass a copy.
+func (h *WindowHook) Run(window *WindowStats) {
+	if atomic.AddInt32(&h.running, 1) > windowHookMaxRunning {
+		atomic.AddInt32(&h.running, -1)
+		log.Printf("Window hook: Skipping window %s, %d runs still in progress",
+			window.WindowTime.Format("15:04 UTC"), windowHookMaxRunning)
+		return
+	}
+
+	go func() {
+		defer atomic.AddInt32(&h.running, -1)
+		h.run(window)
+	}()
+}
+
+// run executes the command and logs its exit status
+func (h *WindowHook) run(window *WindowStats) {
+	label := window.WindowTime.Format("15:04 UTC")
+
+	payload, err := json.Marshal(newWindowStatsResponse(window))
+	if err != nil {
+		log.Printf("Window hook: Failed to marshal window %s: %v", label, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command, h.args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait forever on output pipes held open by a child of the command
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("Window hook: Killed after %s for window %s", h.timeout, label)
+		return
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		log.Printf("Window hook: Exited with status %d after %s for window %s: %s",
+			exitErr.ExitCode(), elapsed, label, truncateOutput(output.String()))
+		return
+	}
+	if err != nil {
+		log.Printf("Window hook: Failed to run %s: %v", h.command, err)
+		return
+	}
+	log.Printf("Window hook: Exited with status 0 after %s for window %s", elapsed, label)
+}
+
+// truncateOutput trims command output for logging
+func truncateOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > windowHookMaxOutput {
+		output = output[:windowHookMaxOutput] + "..."
+	}
+	if output == "" {
+		return "(no output)"
+	}
+	return output
+}
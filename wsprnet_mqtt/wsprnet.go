@@ -1,23 +1,22 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"mime/multipart"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
-	"regexp"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // WSPRNet constants
 const (
-	WSPRServerHostname  = "wsprnet.org"
-	WSPRServerPort      = 80
+	WSPRServerURL       = "http://wsprnet.org" // Default for wsprnet.url
 	WSPRMaxQueueSize    = 10000
 	WSPRMaxRetries      = 3
 	WSPRWorkerThreads   = 1   // Reduced to 1 for MEPT bulk uploads
@@ -26,6 +25,31 @@ const (
 	WSPRBatchWaitMillis = 500 // Wait time to accumulate spots for batching
 )
 
+// Default retry policy for failed uploads. Each retry waits
+// WSPRBackoffMultiplier times longer than the last, with up to
+// WSPRBackoffJitter either side so many clients don't retry in step.
+const (
+	WSPRInitialBackoff    = 60 * time.Second
+	WSPRBackoffMultiplier = 2.0
+	WSPRMaxBackoff        = 30 * time.Minute
+	WSPRBackoffJitter     = 0.2
+)
+
+// WSPRRetryPolicy sets how failed uploads are retried
+type WSPRRetryPolicy struct {
+	MaxRetries        int
+	InitialBackoff    time.Duration
+	BackoffMultiplier float64
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based)
+func (p WSPRRetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff) * math.Pow(p.BackoffMultiplier, float64(attempt-1))
+	delay = math.Min(delay, float64(WSPRMaxBackoff))
+	delay *= 1 + WSPRBackoffJitter*(2*rand.Float64()-1)
+	return time.Duration(delay).Round(time.Second)
+}
+
 // WSPR mode codes from http://www.wsprnet.org/drupal/node/8983
 const (
 	WSPRModeWSPR      = 2
@@ -35,11 +59,32 @@ const (
 	WSPRModeFST4W1800 = 30
 )
 
+// Categories of failed upload attempts. Responses with an HTTP status are
+// counted by status class ("4xx", "5xx", and "2xx" for a 200 response that
+// didn't report any spots added).
+const (
+	UploadFailureTimeout = "timeout" // No response within WSPRTimeoutSeconds
+	UploadFailureNetwork = "network" // Connection refused, DNS failure, reset, ...
+	UploadFailureOther   = "other"   // The request could not be built
+
+	// Not a failure: WSPRNet was stopped while the upload waited for the rate limit
+	uploadStopped = "stopped"
+)
+
+// UploadFailure describes the most recent failed upload attempt
+type UploadFailure struct {
+	Time     time.Time `json:"time"`
+	Category string    `json:"category"`
+	Status   int       `json:"status,omitempty"` // HTTP status, if there was a response
+	Detail   string    `json:"detail"`
+}
+
 // WSPRReport represents a single WSPR spot report
 type WSPRReport struct {
 	Callsign      string
 	Locator       string
 	SNR           int
+	HasSNR        bool   // False when the decode carried no SNR value
 	Frequency     uint64 // Transmitter frequency in Hz
 	ReceiverFreq  uint64 // Receiver frequency in Hz
 	DT            float32
@@ -49,6 +94,18 @@ type WSPRReport struct {
 	Mode          string
 	RetryCount    int
 	NextRetryTime time.Time
+
+	// Callsign as decoded, when normalize_callsigns changed Callsign. This is
+	// what is uploaded; Callsign is used for deduplication and statistics.
+	DecodedCallsign string
+}
+
+// UploadCallsign returns the callsign to send to WSPRNet and PSKReporter
+func (r *WSPRReport) UploadCallsign() string {
+	if r.DecodedCallsign != "" {
+		return r.DecodedCallsign
+	}
+	return r.Callsign
 }
 
 // WSPRBatch represents a batch of reports to be uploaded together
@@ -58,6 +115,11 @@ type WSPRBatch struct {
 	NextRetryTime time.Time
 }
 
+// SubmissionResultFunc is called once the final WSPRNet outcome of a set of
+// reports is known: after upload, after retries are exhausted, or when a
+// report is filtered or dropped without being sent
+type SubmissionResultFunc func(reports []WSPRReport, submitted bool, errorMsg string)
+
 // WSPRNet handles WSPRNet spot reporting using MEPT bulk upload
 type WSPRNet struct {
 	// Configuration
@@ -65,7 +127,19 @@ type WSPRNet struct {
 	receiverLocator  string
 	programName      string
 	programVersion   string
-	dryRun           bool
+	serverURL        string       // Base URL uploads are sent to, without a trailing slash
+	httpClient       *http.Client // Shared by all uploads and the probe, so connections are reused
+	dryRun           atomic.Bool  // Changed in place on a config reload
+	quietHours       []QuietHoursWindow
+	submitHashed     bool // Upload "<...>" hashed callsigns instead of filtering them
+	resultCallback   SubmissionResultFunc
+	submittedKeys    *SubmittedKeys // Spots already accepted, kept across restarts (nil = disabled)
+	pendingFile      string         // Spots waiting to be uploaded are saved here at shutdown ("" = not saved)
+	contactEmail     string         // Included in the User-Agent so WSPRNet can reach the operator
+	rateLimit        *tokenBucket   // Uploads allowed a minute (nil = no limit)
+
+	// Guards receiverCallsign and receiverLocator, which a config reload can change
+	receiverMu sync.RWMutex
 
 	// Report queues - now batched
 	reportQueue []WSPRReport
@@ -78,7 +152,35 @@ type WSPRNet struct {
 	countSendsOK      int
 	countSendsErrored int
 	countRetries      int
-	statsMutex        sync.Mutex
+	countHeld         int
+	countAlreadySent  int // Spots skipped because WSPRNet accepted them before a restart
+	// Spots and uploads that waited for the rate limit
+	countRateLimited   int
+	rateLimitedUploads int
+	statsMutex         sync.Mutex
+
+	// Failed upload attempts (including ones that are retried) by category
+	failuresByCategory map[string]int
+	lastFailure        *UploadFailure
+
+	// Retry policy, and the backoff state since the last successful upload
+	retryPolicy         WSPRRetryPolicy
+	consecutiveFailures int
+	currentBackoff      time.Duration
+
+	// Outcome of the most recent batch whose upload finished, for /health.
+	// lastUploadError is empty if it was accepted.
+	lastUploadAt    time.Time
+	lastUploadError string
+
+	// Submission method (SubmitMethodMEPT, SubmitMethodPost or SubmitMethodGet)
+	// and the result of the startup probe. In auto mode the method moves on to
+	// the next after a failure another method might avoid. autoMethod is set
+	// before Connect and only read after; methodMu guards the rest.
+	method      string
+	autoMethod  bool
+	probeResult string
+	methodMu    sync.Mutex
 
 	// Threading
 	running bool
@@ -86,28 +188,45 @@ type WSPRNet struct {
 	wg      sync.WaitGroup
 }
 
-// NewWSPRNet creates a new WSPRNet instance
-func NewWSPRNet(callsign, locator, programName, programVersion string, dryRun bool) (*WSPRNet, error) {
+// NewWSPRNet creates a new WSPRNet instance uploading to serverURL, or to
+// WSPRServerURL if it is empty
+func NewWSPRNet(serverURL, callsign, locator, programName, programVersion string, dryRun bool) (*WSPRNet, error) {
 	if callsign == "" || locator == "" || programName == "" {
 		return nil, fmt.Errorf("callsign, locator, and program name are required")
 	}
+	if serverURL == "" {
+		serverURL = WSPRServerURL
+	}
 
 	wspr := &WSPRNet{
 		receiverCallsign: callsign,
 		receiverLocator:  locator,
 		programName:      programName,
 		programVersion:   programVersion,
-		dryRun:           dryRun,
+		serverURL:        strings.TrimRight(serverURL, "/"),
+		httpClient:       newUploadClient(),
 		reportQueue:      make([]WSPRReport, 0, WSPRMaxQueueSize),
 		retryQueue:       make([]WSPRBatch, 0, WSPRMaxQueueSize),
 		stopCh:           make(chan struct{}),
+
+		failuresByCategory: make(map[string]int),
+		method:             SubmitMethodMEPT,
+		retryPolicy: WSPRRetryPolicy{
+			MaxRetries:        WSPRMaxRetries,
+			InitialBackoff:    WSPRInitialBackoff,
+			BackoffMultiplier: WSPRBackoffMultiplier,
+		},
 	}
+	wspr.dryRun.Store(dryRun)
 
 	return wspr, nil
 }
 
 // Connect starts the WSPRNet processing threads
 func (w *WSPRNet) Connect() error {
+	if err := w.loadPending(); err != nil {
+		log.Printf("WSPRNet: %v", err)
+	}
 	w.running = true
 
 	// Start worker threads for parallel HTTP requests
@@ -121,6 +240,109 @@ func (w *WSPRNet) Connect() error {
 	return nil
 }
 
+// SetQuietHours configures scheduled windows during which uploads are held.
+// Windows are validated by Config.Validate; invalid entries are ignored.
+func (w *WSPRNet) SetQuietHours(windows []QuietHoursWindow) {
+	w.quietHours = windows
+	for _, q := range windows {
+		log.Printf("WSPRNet: Quiet hours %s-%s UTC (uploads held until window ends)", q.Start, q.End)
+	}
+}
+
+// SetSubmitHashed controls whether "<...>" hashed callsigns are uploaded (hashed_callsigns: submit)
+func (w *WSPRNet) SetSubmitHashed(submit bool) {
+	w.submitHashed = submit
+}
+
+// SetSubmittedKeys enables skipping spots that WSPRNet has already accepted,
+// as recorded in a persistent key store. It must be called before Connect.
+func (w *WSPRNet) SetSubmittedKeys(keys *SubmittedKeys) {
+	w.submittedKeys = keys
+}
+
+// SetReceiver changes the receiver callsign and locator sent with uploads
+func (w *WSPRNet) SetReceiver(callsign, locator string) {
+	w.receiverMu.Lock()
+	defer w.receiverMu.Unlock()
+	w.receiverCallsign = callsign
+	w.receiverLocator = locator
+	log.Printf("WSPRNet: Receiver changed to %s at %s", callsign, locator)
+}
+
+// receiver returns the receiver callsign and locator sent with uploads
+func (w *WSPRNet) receiver() (string, string) {
+	w.receiverMu.RLock()
+	defer w.receiverMu.RUnlock()
+	return w.receiverCallsign, w.receiverLocator
+}
+
+// SetDryRun turns dry run on or off. Batches already being uploaded are not affected.
+func (w *WSPRNet) SetDryRun(dryRun bool) {
+	w.dryRun.Store(dryRun)
+	log.Printf("WSPRNet: Dry run %v", dryRun)
+}
+
+// SetRetryPolicy sets how failed uploads are retried. It must be called
+// before Connect.
+func (w *WSPRNet) SetRetryPolicy(policy WSPRRetryPolicy) {
+	w.retryPolicy = policy
+	log.Printf("WSPRNet: Retrying failed uploads up to %d time(s), backoff %s x%g",
+		policy.MaxRetries, policy.InitialBackoff, policy.BackoffMultiplier)
+}
+
+// SetContactEmail sets an address included in the User-Agent of every upload.
+// It must be called before Connect.
+func (w *WSPRNet) SetContactEmail(email string) {
+	w.contactEmail = email
+}
+
+// userAgent identifies this client to WSPRNet, with the operator's contact if set
+func (w *WSPRNet) userAgent() string {
+	if w.contactEmail == "" {
+		return "wsprnet_mqtt/" + Version
+	}
+	return fmt.Sprintf("wsprnet_mqtt/%s (+mailto:%s)", Version, w.contactEmail)
+}
+
+// SetResultCallback registers a function to receive submission outcomes.
+// It must be called before any reports are submitted.
+func (w *WSPRNet) SetResultCallback(fn SubmissionResultFunc) {
+	w.resultCallback = fn
+}
+
+// reportResult passes a submission outcome to the registered callback, if any
+func (w *WSPRNet) reportResult(reports []WSPRReport, submitted bool, errorMsg string) {
+	if w.resultCallback != nil {
+		w.resultCallback(reports, submitted, errorMsg)
+	}
+}
+
+// quietUntil reports whether t falls inside a quiet hours window and, if so,
+// when that window ends
+func (w *WSPRNet) quietUntil(t time.Time) (time.Time, bool) {
+	t = t.UTC()
+	now := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	for _, q := range w.quietHours {
+		start, end, err := q.minutes()
+		if err != nil || start == end {
+			continue
+		}
+		if start < end {
+			if now >= start && now < end {
+				return midnight.Add(time.Duration(end) * time.Minute), true
+			}
+		} else if now >= start {
+			// Wraps past midnight - ends tomorrow
+			return midnight.Add(24*time.Hour + time.Duration(end)*time.Minute), true
+		} else if now < end {
+			return midnight.Add(time.Duration(end) * time.Minute), true
+		}
+	}
+	return time.Time{}, false
+}
+
 // Submit adds a WSPR report to the queue
 func (w *WSPRNet) Submit(report *WSPRReport) error {
 	if !w.running {
@@ -129,15 +351,29 @@ func (w *WSPRNet) Submit(report *WSPRReport) error {
 
 	// Only accept WSPR reports
 	if report.Mode != "WSPR" {
+		w.reportResult([]WSPRReport{*report}, false, fmt.Sprintf("not submitted: mode %s is not uploaded to WSPRNet", report.Mode))
 		return nil
 	}
 
 	if report.Callsign == "" || report.Locator == "" {
+		w.reportResult([]WSPRReport{*report}, false, "not submitted: missing callsign or locator")
 		return nil
 	}
 
-	// Filter out hashed callsigns
-	if report.Callsign == "<...>" {
+	// Filter out hashed callsigns unless configured to attempt them
+	if report.Callsign == "<...>" && !w.submitHashed {
+		w.reportResult([]WSPRReport{*report}, false, "not submitted: hashed callsign")
+		return nil
+	}
+
+	// Skip spots WSPRNet accepted before a crash or restart
+	if w.submittedKeys != nil && w.submittedKeys.Contains(spotIdempotencyKey(report)) {
+		w.statsMutex.Lock()
+		w.countAlreadySent++
+		w.statsMutex.Unlock()
+		log.Printf("WSPRNet: Skipping %s on %s at %s, already accepted by WSPRNet",
+			report.Callsign, frequencyToBand(report.Frequency), report.EpochTime.UTC().Format("15:04"))
+		w.reportResult([]WSPRReport{*report}, true, "already accepted by WSPRNet before a restart, not uploaded again")
 		return nil
 	}
 
@@ -162,14 +398,7 @@ func (w *WSPRNet) workerThread() {
 		haveBatch := false
 
 		// First check retry queue
-		currentTime := time.Now()
-		w.retryMutex.Lock()
-		if len(w.retryQueue) > 0 && w.retryQueue[0].NextRetryTime.Before(currentTime) {
-			batch = w.retryQueue[0]
-			w.retryQueue = w.retryQueue[1:]
-			haveBatch = true
-		}
-		w.retryMutex.Unlock()
+		batch, haveBatch = w.nextRetry(time.Now())
 
 		// If no retry batch, try to build a new batch from main queue
 		// IMPORTANT: Only batch spots from the same 2-minute WSPR window
@@ -207,50 +436,124 @@ func (w *WSPRNet) workerThread() {
 			w.queueMutex.Unlock()
 		}
 
+		// During quiet hours, park the batch on the retry queue until the window ends.
+		// Held batches keep their retry count so they still get the full set of attempts.
+		if haveBatch {
+			if until, quiet := w.quietUntil(time.Now()); quiet {
+				batch.NextRetryTime = until
+				w.retryMutex.Lock()
+				held := len(w.retryQueue) < WSPRMaxQueueSize
+				if held {
+					w.retryQueue = append(w.retryQueue, batch)
+				}
+				w.retryMutex.Unlock()
+
+				w.statsMutex.Lock()
+				if held {
+					w.countHeld += len(batch.Reports)
+					log.Printf("WSPRNet: Quiet hours - holding batch of %d spots until %s UTC",
+						len(batch.Reports), until.Format("15:04"))
+				} else {
+					w.countSendsErrored += len(batch.Reports)
+					log.Printf("WSPRNet: Quiet hours - retry queue full, dropping batch of %d spots", len(batch.Reports))
+				}
+				w.statsMutex.Unlock()
+
+				if !held {
+					w.reportResult(batch.Reports, false, "dropped during quiet hours: retry queue full")
+				}
+				continue
+			}
+		}
+
 		// If we have a batch, send it
 		if haveBatch {
 			wasRetry := batch.RetryCount > 0
 			spotsAccepted, spotsOffered, success := w.sendBatch(&batch)
+			if !success && w.stopping() {
+				// Stopped while waiting for the rate limit, or while a
+				// failed upload would be retried. Put the batch back for
+				// Stop to save.
+				w.retryMutex.Lock()
+				w.retryQueue = append(w.retryQueue, batch)
+				w.retryMutex.Unlock()
+				return
+			}
+
+			// Record accepted spots before anything else so a crash from here on
+			// cannot lead to them being uploaded again
+			if success && w.submittedKeys != nil && !w.dryRun.Load() {
+				keys := make([]string, len(batch.Reports))
+				for i := range batch.Reports {
+					keys[i] = spotIdempotencyKey(&batch.Reports[i])
+				}
+				w.submittedKeys.Add(keys)
+			}
 
 			w.statsMutex.Lock()
+			var resultSubmitted, resultFinal bool
+			var resultError string
 			if success {
 				w.countSendsOK += spotsAccepted
+				w.consecutiveFailures = 0
+				w.currentBackoff = 0
+				resultSubmitted, resultFinal = true, true
 				if spotsAccepted < spotsOffered {
 					log.Printf("WSPRNet: Partial success - %d of %d spots accepted", spotsAccepted, spotsOffered)
+					// WSPRNet does not say which spots it rejected, so note it on every spot in the batch
+					resultError = fmt.Sprintf("WSPRNet accepted %d of %d spots in this batch", spotsAccepted, spotsOffered)
 				}
 				if wasRetry {
 					log.Printf("WSPRNet: Successfully sent batch of %d spots (after %d retry/retries)",
 						spotsAccepted, batch.RetryCount)
 				}
 			} else {
+				w.consecutiveFailures++
+
 				// Check if we should retry
-				if batch.RetryCount < WSPRMaxRetries {
-					// Retry delays to avoid overwhelming the server
-					retryDelays := []int{60, 120, 180} // 1, 2, 3 minutes
-					delayIndex := batch.RetryCount
-					if delayIndex >= len(retryDelays) {
-						delayIndex = len(retryDelays) - 1
-					}
-					delay := retryDelays[delayIndex]
+				if batch.RetryCount < w.retryPolicy.MaxRetries {
+					// Back off exponentially to avoid overwhelming the server
 					batch.RetryCount++
-					batch.NextRetryTime = time.Now().Add(time.Duration(delay) * time.Second)
+					delay := w.retryPolicy.backoff(batch.RetryCount)
+					w.currentBackoff = delay
+					batch.NextRetryTime = time.Now().Add(delay)
 
 					w.retryMutex.Lock()
-					if len(w.retryQueue) < WSPRMaxQueueSize {
+					queued := len(w.retryQueue) < WSPRMaxQueueSize
+					if queued {
 						w.retryQueue = append(w.retryQueue, batch)
 						w.countRetries++
 					}
 					w.retryMutex.Unlock()
 
-					log.Printf("WSPRNet: Failed to send batch of %d spots, will retry in %d seconds (attempt %d/%d)",
-						len(batch.Reports), delay, batch.RetryCount, WSPRMaxRetries)
+					if queued {
+						log.Printf("WSPRNet: Failed to send batch of %d spots, will retry in %s (attempt %d/%d)",
+							len(batch.Reports), delay, batch.RetryCount, w.retryPolicy.MaxRetries)
+					} else {
+						w.countSendsErrored += len(batch.Reports)
+						resultFinal, resultError = true, "upload failed and retry queue full"
+						log.Printf("WSPRNet: Failed to send batch of %d spots, retry queue full, giving up", len(batch.Reports))
+					}
 				} else {
 					w.countSendsErrored += len(batch.Reports)
+					resultFinal = true
+					resultError = fmt.Sprintf("upload failed after %d retries", batch.RetryCount)
 					log.Printf("WSPRNet: Failed to send batch of %d spots after %d attempts, giving up",
-						len(batch.Reports), WSPRMaxRetries)
+						len(batch.Reports), batch.RetryCount+1)
+				}
+			}
+			if resultFinal {
+				w.lastUploadAt = time.Now()
+				w.lastUploadError = ""
+				if !resultSubmitted {
+					w.lastUploadError = resultError
 				}
 			}
 			w.statsMutex.Unlock()
+
+			if resultFinal {
+				w.reportResult(batch.Reports, resultSubmitted, resultError)
+			}
 		} else {
 			// No batches available, sleep briefly
 			select {
@@ -262,157 +565,97 @@ func (w *WSPRNet) workerThread() {
 	}
 }
 
-// sendBatch sends a batch of reports to WSPRNet using MEPT bulk upload
+// nextRetry removes and returns the retry queue batch that has been due the
+// longest, if any is due. The queue is not in due order: batches held for
+// quiet hours and ones backing off after a failure are mixed in it.
+func (w *WSPRNet) nextRetry(now time.Time) (WSPRBatch, bool) {
+	w.retryMutex.Lock()
+	defer w.retryMutex.Unlock()
+
+	due := -1
+	for i := range w.retryQueue {
+		t := w.retryQueue[i].NextRetryTime
+		if t.Before(now) && (due < 0 || t.Before(w.retryQueue[due].NextRetryTime)) {
+			due = i
+		}
+	}
+	if due < 0 {
+		return WSPRBatch{}, false
+	}
+	batch := w.retryQueue[due]
+	w.retryQueue = append(w.retryQueue[:due], w.retryQueue[due+1:]...)
+	return batch, true
+}
+
+// sendBatch sends a batch of reports to WSPRNet using the configured method
 // Returns (spotsAccepted, spotsOffered, success)
 func (w *WSPRNet) sendBatch(batch *WSPRBatch) (int, int, bool) {
 	spotsOffered := len(batch.Reports)
-	startTime := time.Now()
 
 	// If dry run mode, just return success (logging is done by aggregator)
-	if w.dryRun {
+	if w.dryRun.Load() {
 		log.Printf("WSPRNet: [DRY RUN] Would upload batch of %d spots", spotsOffered)
 		return spotsOffered, spotsOffered, true
 	}
 
-	log.Printf("WSPRNet: Starting MEPT upload of %d spots to %s/meptspots.php", spotsOffered, WSPRServerHostname)
-	log.Printf("WSPRNet: Receiver: %s at %s", w.receiverCallsign, w.receiverLocator)
+	method := w.activeMethod()
+	if method != SubmitMethodMEPT {
+		return w.sendLegacy(method, batch)
+	}
 
-	// Build MEPT format data
-	meptData := w.buildMEPTData(batch.Reports)
+	log.Printf("WSPRNet: Starting MEPT upload of %d spots to %s/meptspots.php", spotsOffered, w.serverURL)
+	callsign, locator := w.receiver()
+	log.Printf("WSPRNet: Receiver: %s at %s", callsign, locator)
 
 	// Log all spots being submitted
 	log.Println("WSPRNet: MEPT data being submitted:")
-	log.Println(meptData)
-
-	// Create multipart form data
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	// Add version field
-	versionStr := w.programName
-	if w.programVersion != "" {
-		versionStr = fmt.Sprintf("%s_%s", w.programName, w.programVersion)
-	}
-	if err := writer.WriteField("version", versionStr); err != nil {
-		log.Printf("WSPRNet: Failed to write version field: %v", err)
-		return 0, spotsOffered, false
-	}
-
-	// Add call field
-	if err := writer.WriteField("call", w.receiverCallsign); err != nil {
-		log.Printf("WSPRNet: Failed to write call field: %v", err)
-		return 0, spotsOffered, false
-	}
+	log.Println(w.buildMEPTData(batch.Reports))
 
-	// Add grid field (can be 4 or 6 characters)
-	if err := writer.WriteField("grid", w.receiverLocator); err != nil {
-		log.Printf("WSPRNet: Failed to write grid field: %v", err)
-		return 0, spotsOffered, false
-	}
-
-	// Add allmept field with spot data
-	part, err := writer.CreateFormFile("allmept", "spots.txt")
-	if err != nil {
-		log.Printf("WSPRNet: Failed to create allmept field: %v", err)
-		return 0, spotsOffered, false
-	}
-	if _, err := part.Write([]byte(meptData)); err != nil {
-		log.Printf("WSPRNet: Failed to write allmept data: %v", err)
-		return 0, spotsOffered, false
-	}
-
-	if err := writer.Close(); err != nil {
-		log.Printf("WSPRNet: Failed to close multipart writer: %v", err)
-		return 0, spotsOffered, false
-	}
-
-	// Create HTTP client with timeout and compression enabled
-	client := &http.Client{
-		Timeout: WSPRTimeoutSeconds * time.Second,
-		Transport: &http.Transport{
-			DisableCompression: false, // Enable gzip compression
-		},
-	}
-
-	// Build request to MEPT endpoint
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/meptspots.php", WSPRServerHostname), &requestBody)
+	req, err := w.newMEPTRequest(batch.Reports)
 	if err != nil {
 		log.Printf("WSPRNet: Failed to create request: %v", err)
+		w.recordFailure(UploadFailureOther, 0, err.Error())
 		return 0, spotsOffered, false
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Connection", "Keep-Alive")
-	req.Header.Set("Host", WSPRServerHostname)
-	// Don't set Accept-Encoding manually - let Go's HTTP client handle compression automatically
-
-	// Send request and measure time
-	resp, err := client.Do(req)
-	elapsed := time.Since(startTime)
-
-	if err != nil {
-		log.Printf("WSPRNet: Failed to send request after %.2f seconds: %v", elapsed.Seconds(), err)
+	spotsAccepted, category := w.send(req, spotsOffered)
+	if category != "" {
+		w.fallBack(method, category)
 		return 0, spotsOffered, false
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
-		}
-	}()
-
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("WSPRNet: Failed to read response body after %.2f seconds: %v", elapsed.Seconds(), err)
-		return 0, spotsOffered, false
-	}
-	bodyStr := string(bodyBytes)
+	return spotsAccepted, spotsOffered, true
+}
 
-	// Check for upload limit reached
-	if strings.Contains(bodyStr, "Upload limit") && strings.Contains(bodyStr, "reached") {
-		log.Printf("WSPRNet: SUCCESS - Upload limit reached after %.2f seconds, treating as success to avoid retrying", elapsed.Seconds())
-		return spotsOffered, spotsOffered, true
+// recordFailure counts a failed upload attempt and remembers it as the latest
+func (w *WSPRNet) recordFailure(category string, status int, detail string) {
+	if len(detail) > 200 {
+		detail = detail[:200] + "..."
 	}
 
-	// Parse response for "X spot(s) added" or "X out of Y spot(s) added"
-	// wsprdaemon checks for this pattern at line 309-310
-	re := regexp.MustCompile(`(\d+)\s+(?:out of|spot.*added.*out of)\s+(\d+)`)
-	matches := re.FindStringSubmatch(bodyStr)
-
-	if len(matches) == 3 {
-		spotsAccepted, err1 := strconv.Atoi(matches[1])
-		spotsInResponse, err2 := strconv.Atoi(matches[2])
+	w.statsMutex.Lock()
+	defer w.statsMutex.Unlock()
 
-		if err1 == nil && err2 == nil {
-			if spotsInResponse != spotsOffered {
-				log.Printf("WSPRNet: Warning - response mentions %d spots but we offered %d", spotsInResponse, spotsOffered)
-			}
-			if spotsAccepted == 0 {
-				log.Printf("WSPRNet: Server accepted 0 of %d spots in %.2f seconds (valid response, not retrying). Response: %s", spotsOffered, elapsed.Seconds(), bodyStr)
-			} else if spotsAccepted < spotsOffered {
-				log.Printf("WSPRNet: Partial success - %d of %d spots accepted in %.2f seconds", spotsAccepted, spotsOffered, elapsed.Seconds())
-			} else {
-				log.Printf("WSPRNet: SUCCESS - Uploaded %d of %d spots in %.2f seconds", spotsAccepted, spotsOffered, elapsed.Seconds())
-			}
-			return spotsAccepted, spotsOffered, true
-		}
+	w.failuresByCategory[category]++
+	w.lastFailure = &UploadFailure{
+		Time:     time.Now().UTC(),
+		Category: category,
+		Status:   status,
+		Detail:   strings.TrimSpace(detail),
 	}
+}
 
-	// If we got a 200 response but couldn't parse the spot count, this is likely an error
-	// The response should always include "X out of Y spot(s) added" if successful
-	if resp.StatusCode == 200 {
-		// Check if response indicates no spots were processed (just "Processing took X milliseconds")
-		if strings.Contains(bodyStr, "Processing took") && !strings.Contains(bodyStr, "spot") {
-			log.Printf("WSPRNet: FAILED - Server processed request but added no spots in %.2f seconds. Response: %s", elapsed.Seconds(), bodyStr)
-			return 0, spotsOffered, false
-		}
-		log.Printf("WSPRNet: WARNING - Got 200 response in %.2f seconds but couldn't parse spot count. Response: %s", elapsed.Seconds(), bodyStr)
-		// Don't assume success - return failure to trigger retry
-		return 0, spotsOffered, false
+// requestErrorCategory tells a timeout apart from other network errors
+func requestErrorCategory(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return UploadFailureTimeout
 	}
+	return UploadFailureNetwork
+}
 
-	log.Printf("WSPRNet: FAILED - Unexpected response after %.2f seconds: %d %s, body: %s", elapsed.Seconds(), resp.StatusCode, resp.Status, bodyStr)
-	return 0, spotsOffered, false
+// statusClass returns the class of an HTTP status code, e.g. "5xx"
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
 }
 
 // buildMEPTData builds the MEPT format data for bulk upload
@@ -445,24 +688,34 @@ func (w *WSPRNet) buildMEPTData(reports []WSPRReport) string {
 		// Date Time Sync SNR DT Freq Call Grid Power Drift DecCycles Jitter BlocksCorrected AudioPeak Decode
 		// Example: 170711 2234   1 -28  1.26  14.0970558  VE7XT CN88 20           0   190    0
 		line := fmt.Sprintf("%s %s %3d %3d %5.2f %12s  %s %s %2d %11d %5d %4d",
-			date,            // Date (YYMMDD)
-			timeStr,         // Time (HHMM)
-			1,               // Sync quality (placeholder)
-			report.SNR,      // SNR in dB
-			dt,              // DT (time offset in seconds)
-			freqMHz,         // Frequency in MHz (7 decimals)
-			report.Callsign, // Transmitter callsign
-			grid,            // Transmitter grid (4 chars)
-			report.DBm,      // Power in dBm
-			report.Drift,    // Drift in Hz/minute
-			0,               // DecCycles (placeholder)
-			0)               // Jitter (placeholder)
+			date,                    // Date (YYMMDD)
+			timeStr,                 // Time (HHMM)
+			1,                       // Sync quality (placeholder)
+			report.SNR,              // SNR in dB
+			dt,                      // DT (time offset in seconds)
+			freqMHz,                 // Frequency in MHz (7 decimals)
+			report.UploadCallsign(), // Transmitter callsign
+			grid,                    // Transmitter grid (4 chars)
+			report.DBm,              // Power in dBm
+			report.Drift,            // Drift in Hz/minute
+			0,                       // DecCycles (placeholder)
+			0)                       // Jitter (placeholder)
 		lines = append(lines, line)
 	}
 
 	return strings.Join(lines, "\n")
 }
 
+// stopping reports whether Stop has been called
+func (w *WSPRNet) stopping() bool {
+	select {
+	case <-w.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // Stop stops the WSPRNet processing
 func (w *WSPRNet) Stop() {
 	if !w.running {
@@ -477,6 +730,15 @@ func (w *WSPRNet) Stop() {
 	// Wait for all worker threads to finish
 	w.wg.Wait()
 
+	// Keep the spots still waiting for the next start, or record that they
+	// were not uploaded so they don't stay pending in the deduped log
+	if w.pendingFile == "" {
+		w.failPending("not uploaded before shutdown")
+	} else if err := w.savePending(); err != nil {
+		log.Printf("WSPRNet: %v", err)
+		w.failPending("not uploaded before shutdown: " + err.Error())
+	}
+
 	// Print statistics
 	w.statsMutex.Lock()
 	log.Printf("WSPRNet: Successful reports: %d, Failed reports: %d, Retries: %d",
@@ -491,13 +753,77 @@ func (w *WSPRNet) GetStats() map[string]interface{} {
 	w.statsMutex.Lock()
 	defer w.statsMutex.Unlock()
 
+	failures := make(map[string]int, len(w.failuresByCategory))
+	for category, count := range w.failuresByCategory {
+		failures[category] = count
+	}
+
+	w.methodMu.Lock()
+	method, probeResult := w.method, w.probeResult
+	w.methodMu.Unlock()
+
+	// Batches waiting to be retried, and when the next one is due. Batches
+	// held for quiet hours wait on the same queue.
+	w.retryMutex.Lock()
+	retryBatches, retrySpots := len(w.retryQueue), 0
+	var nextRetry *time.Time
+	for i := range w.retryQueue {
+		retrySpots += len(w.retryQueue[i].Reports)
+		if t := w.retryQueue[i].NextRetryTime; nextRetry == nil || t.Before(*nextRetry) {
+			nextRetry = &t
+		}
+	}
+	w.retryMutex.Unlock()
+
+	rateLimit := map[string]interface{}{
+		"max_per_minute":  0,
+		"delayed_spots":   w.countRateLimited,
+		"delayed_uploads": w.rateLimitedUploads,
+	}
+	if w.rateLimit != nil {
+		rateLimit["max_per_minute"] = w.rateLimit.perMinute
+	}
+
 	return map[string]interface{}{
-		"successful": w.countSendsOK,
-		"failed":     w.countSendsErrored,
-		"retries":    w.countRetries,
+		"submit_method":      method,
+		"submit_auto":        w.autoMethod,
+		"submit_probe":       probeResult,
+		"successful":         w.countSendsOK,
+		"failed":             w.countSendsErrored,
+		"retries":            w.countRetries,
+		"held":               w.countHeld,
+		"quiet":              w.isQuiet(),
+		"already_submitted":  w.countAlreadySent,
+		"failures_by_status": failures,
+		"last_failure":       w.lastFailure,
+		"rate_limit":         rateLimit,
+		"retry": map[string]interface{}{
+			"max_retries":             w.retryPolicy.MaxRetries,
+			"initial_backoff_seconds": w.retryPolicy.InitialBackoff.Seconds(),
+			"backoff_multiplier":      w.retryPolicy.BackoffMultiplier,
+			"consecutive_failures":    w.consecutiveFailures,
+			"current_backoff_seconds": w.currentBackoff.Seconds(),
+			"queued_batches":          retryBatches,
+			"queued_spots":            retrySpots,
+			"next_retry_at":           nextRetry,
+		},
 	}
 }
 
+// LastUpload returns when the most recent upload finished and, if it failed
+// for good (after every retry), why
+func (w *WSPRNet) LastUpload() (time.Time, string) {
+	w.statsMutex.Lock()
+	defer w.statsMutex.Unlock()
+	return w.lastUploadAt, w.lastUploadError
+}
+
+// isQuiet reports whether uploads are currently being held for quiet hours
+func (w *WSPRNet) isQuiet() bool {
+	_, quiet := w.quietUntil(time.Now())
+	return quiet
+}
+
 // SetStats restores statistics from persistence
 func (w *WSPRNet) SetStats(successful, failed, retries int) {
 	w.statsMutex.Lock()
@@ -516,6 +842,10 @@ func (w *WSPRNet) ResetStats() {
 	w.countSendsOK = 0
 	w.countSendsErrored = 0
 	w.countRetries = 0
+	w.failuresByCategory = make(map[string]int)
+	w.lastFailure = nil
+	w.consecutiveFailures = 0
+	w.currentBackoff = 0
 
 	log.Println("WSPRNet: Statistics reset to zero")
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spot submission methods (wsprnet.submit_method)
+const (
+	SubmitMethodMEPT = "mept" // Bulk multipart POST to /meptspots.php (default)
+	SubmitMethodPost = "post" // Legacy form POST to /post/, one spot per request
+	SubmitMethodGet  = "get"  // Legacy GET query to /post/, one spot per request
+	SubmitMethodAuto = "auto" // Probe at startup and use the first method that works
+)
+
+// submitMethodOrder is the order methods are tried in auto mode
+var submitMethodOrder = []string{SubmitMethodMEPT, SubmitMethodPost, SubmitMethodGet}
+
+// submitProbeTimeout bounds each startup probe request
+const submitProbeTimeout = 15 * time.Second
+
+// spotsAddedPattern matches "X out of Y spot(s) added" in a WSPRNet response
+var spotsAddedPattern = regexp.MustCompile(`(\d+)\s+(?:out of|spot.*added.*out of)\s+(\d+)`)
+
+// SetSubmitMethod selects how spots are uploaded. It must be called before Connect.
+func (w *WSPRNet) SetSubmitMethod(method string) {
+	w.autoMethod = method == SubmitMethodAuto
+	if w.autoMethod {
+		method = submitMethodOrder[0]
+	}
+	w.methodMu.Lock()
+	w.method = method
+	w.methodMu.Unlock()
+}
+
+// activeMethod returns the method used for the next upload
+func (w *WSPRNet) activeMethod() string {
+	w.methodMu.Lock()
+	defer w.methodMu.Unlock()
+	return w.method
+}
+
+// fallBack moves to the next method in auto mode after an upload that failed
+// in a way another method might avoid: no connection, or a 4xx response from
+// a proxy or a path that is no longer served
+func (w *WSPRNet) fallBack(failed, category string) {
+	if !w.autoMethod || (category != UploadFailureNetwork && category != "4xx") {
+		return
+	}
+	w.methodMu.Lock()
+	defer w.methodMu.Unlock()
+	if w.method != failed {
+		return
+	}
+	for i, method := range submitMethodOrder {
+		if method == failed {
+			w.method = submitMethodOrder[(i+1)%len(submitMethodOrder)]
+			break
+		}
+	}
+	log.Printf("WSPRNet: Upload with %s failed (%s), trying %s next", failed, category, w.method)
+}
+
+// ProbeSubmitMethod checks at startup that WSPRNet can be reached with the
+// configured method by sending a request that carries no spots. In auto mode
+// each method is tried in turn and the first that gets a response is used.
+// In dry run the request is built but not sent. A failed probe is logged but
+// does not stop uploads, which retry as usual.
+func (w *WSPRNet) ProbeSubmitMethod() {
+	candidates := []string{w.activeMethod()}
+	if w.autoMethod {
+		candidates = submitMethodOrder
+	}
+
+	for _, method := range candidates {
+		err := w.probe(method)
+		w.methodMu.Lock()
+		if err == nil {
+			w.method = method
+			w.probeResult = "ok"
+		} else {
+			w.probeResult = fmt.Sprintf("%s: %v", method, err)
+		}
+		w.methodMu.Unlock()
+
+		if err == nil {
+			if w.dryRun.Load() {
+				log.Printf("WSPRNet: [DRY RUN] Submission method %s verified (test request built, not sent)", method)
+			} else {
+				log.Printf("WSPRNet: Submission method %s verified (test request without spots)", method)
+			}
+			return
+		}
+		log.Printf("WSPRNet: Warning - submission method %s failed its test request: %v", method, err)
+	}
+	if w.autoMethod {
+		w.methodMu.Lock()
+		w.method = submitMethodOrder[0]
+		w.methodMu.Unlock()
+		log.Printf("WSPRNet: No submission method could reach WSPRNet, starting with %s", submitMethodOrder[0])
+	}
+}
+
+// probe sends a request without spots using method and checks that WSPRNet
+// answers. In dry run it only checks that the request can be built.
+func (w *WSPRNet) probe(method string) error {
+	var req *http.Request
+	var err error
+	if method == SubmitMethodMEPT {
+		req, err = w.newMEPTRequest(nil)
+	} else {
+		req, err = w.newLegacyRequest(method, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if w.dryRun.Load() {
+		return nil
+	}
+
+	req.Header.Set("User-Agent", w.userAgent())
+	client := *w.httpClient
+	client.Timeout = submitProbeTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// newUploadClient returns the HTTP client used for uploads. One is made per
+// WSPRNet, after proxy_url is set, so connections are kept alive between uploads.
+func newUploadClient() *http.Client {
+	return &http.Client{
+		Timeout: WSPRTimeoutSeconds * time.Second,
+		Transport: &http.Transport{
+			Proxy:              proxyFunc(), // proxy_url, if set
+			DisableCompression: false,       // Enable gzip compression
+		},
+	}
+}
+
+// versionString is the program name and version sent with each upload
+func (w *WSPRNet) versionString() string {
+	if w.programVersion != "" {
+		return fmt.Sprintf("%s_%s", w.programName, w.programVersion)
+	}
+	return w.programName
+}
+
+// newMEPTRequest builds a bulk MEPT upload of reports
+func (w *WSPRNet) newMEPTRequest(reports []WSPRReport) (*http.Request, error) {
+	meptData := w.buildMEPTData(reports)
+
+	// Create multipart form data
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	if err := writer.WriteField("version", w.versionString()); err != nil {
+		return nil, fmt.Errorf("failed to write version field: %w", err)
+	}
+	callsign, locator := w.receiver()
+	if err := writer.WriteField("call", callsign); err != nil {
+		return nil, fmt.Errorf("failed to write call field: %w", err)
+	}
+	// Grid can be 4 or 6 characters
+	if err := writer.WriteField("grid", locator); err != nil {
+		return nil, fmt.Errorf("failed to write grid field: %w", err)
+	}
+
+	// Add allmept field with spot data
+	part, err := writer.CreateFormFile("allmept", "spots.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create allmept field: %w", err)
+	}
+	if _, err := part.Write([]byte(meptData)); err != nil {
+		return nil, fmt.Errorf("failed to write allmept data: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", w.serverURL+"/meptspots.php", &requestBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Connection", "Keep-Alive")
+	// Don't set Accept-Encoding manually - let Go's HTTP client handle compression automatically
+	return req, nil
+}
+
+// newLegacyRequest builds a single-spot upload in the format older WSJT-X
+// versions use. A nil report builds a request with the receiver fields only.
+func (w *WSPRNet) newLegacyRequest(method string, report *WSPRReport) (*http.Request, error) {
+	query := url.Values{}
+	query.Set("function", "wspr")
+	callsign, locator := w.receiver()
+	query.Set("rcall", callsign)
+	query.Set("rgrid", locator)
+	query.Set("version", w.versionString())
+	query.Set("mode", strconv.Itoa(WSPRModeWSPR))
+	if report != nil {
+		tm := report.EpochTime.UTC()
+		rqrg := report.ReceiverFreq
+		if rqrg == 0 {
+			rqrg = report.Frequency
+		}
+		query.Set("rqrg", fmt.Sprintf("%.6f", float64(rqrg)/1000000.0))
+		query.Set("date", tm.Format("060102"))
+		query.Set("time", tm.Format("1504"))
+		query.Set("sig", strconv.Itoa(report.SNR))
+		query.Set("dt", fmt.Sprintf("%.1f", report.DT))
+		query.Set("drift", strconv.Itoa(report.Drift))
+		query.Set("tqrg", fmt.Sprintf("%.6f", float64(report.Frequency)/1000000.0))
+		query.Set("tcall", report.UploadCallsign())
+		query.Set("tgrid", report.Locator)
+		query.Set("dbm", strconv.Itoa(report.DBm))
+	}
+
+	endpoint := w.serverURL + "/post/"
+	if method == SubmitMethodGet {
+		return http.NewRequest("GET", endpoint+"?"+query.Encode(), nil)
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// sendLegacy uploads a batch one spot at a time. If an upload fails part way
+// through, the spots already accepted are recorded as submitted and removed
+// from the batch so only the rest are retried.
+func (w *WSPRNet) sendLegacy(method string, batch *WSPRBatch) (int, int, bool) {
+	spotsOffered := len(batch.Reports)
+	startTime := time.Now()
+	log.Printf("WSPRNet: Starting %s upload of %d spots to %s/post/", strings.ToUpper(method), spotsOffered, w.serverURL)
+
+	accepted := 0
+	for i := range batch.Reports {
+		req, err := w.newLegacyRequest(method, &batch.Reports[i])
+		if err != nil {
+			log.Printf("WSPRNet: Failed to create request: %v", err)
+			w.recordFailure(UploadFailureOther, 0, err.Error())
+			w.settleLegacy(batch, i)
+			return 0, len(batch.Reports), false
+		}
+		spotAccepted, category := w.send(req, 1)
+		if category != "" {
+			w.fallBack(method, category)
+			w.settleLegacy(batch, i)
+			return 0, len(batch.Reports), false
+		}
+		accepted += spotAccepted
+	}
+
+	log.Printf("WSPRNet: %d of %d spots accepted in %.2f seconds", accepted, spotsOffered, time.Since(startTime).Seconds())
+	return accepted, spotsOffered, true
+}
+
+// settleLegacy records the first sent spots of a batch, all uploaded before a
+// later one failed, as submitted and leaves the rest in the batch for retry
+func (w *WSPRNet) settleLegacy(batch *WSPRBatch, sent int) {
+	if sent == 0 {
+		return
+	}
+	done := batch.Reports[:sent]
+	batch.Reports = batch.Reports[sent:]
+
+	if w.submittedKeys != nil {
+		keys := make([]string, len(done))
+		for i := range done {
+			keys[i] = spotIdempotencyKey(&done[i])
+		}
+		w.submittedKeys.Add(keys)
+	}
+	w.statsMutex.Lock()
+	w.countSendsOK += len(done)
+	w.statsMutex.Unlock()
+	w.reportResult(done, true, "")
+	log.Printf("WSPRNet: %d spots were uploaded before the failure, %d left to retry", len(done), len(batch.Reports))
+}
+
+// send performs an upload request offering the given number of spots. It
+// returns the number accepted, or the failure category if the upload failed
+// and should be retried.
+func (w *WSPRNet) send(req *http.Request, spotsOffered int) (int, string) {
+	if !w.waitForRateLimit(spotsOffered) {
+		return 0, uploadStopped
+	}
+
+	req.Header.Set("User-Agent", w.userAgent())
+	startTime := time.Now()
+	resp, err := w.httpClient.Do(req)
+	elapsed := time.Since(startTime)
+
+	if err != nil {
+		log.Printf("WSPRNet: Failed to send request after %.2f seconds: %v", elapsed.Seconds(), err)
+		return w.failed(requestErrorCategory(err), 0, err.Error())
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	// Read response body
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("WSPRNet: Failed to read response body after %.2f seconds: %v", elapsed.Seconds(), err)
+		return w.failed(requestErrorCategory(err), resp.StatusCode, err.Error())
+	}
+	bodyStr := string(bodyBytes)
+
+	// Check for upload limit reached
+	if strings.Contains(bodyStr, "Upload limit") && strings.Contains(bodyStr, "reached") {
+		log.Printf("WSPRNet: SUCCESS - Upload limit reached after %.2f seconds, treating as success to avoid retrying", elapsed.Seconds())
+		return spotsOffered, ""
+	}
+
+	// Parse response for "X spot(s) added" or "X out of Y spot(s) added"
+	// wsprdaemon checks for this pattern at line 309-310
+	matches := spotsAddedPattern.FindStringSubmatch(bodyStr)
+
+	if len(matches) == 3 {
+		spotsAccepted, err1 := strconv.Atoi(matches[1])
+		spotsInResponse, err2 := strconv.Atoi(matches[2])
+
+		if err1 == nil && err2 == nil {
+			if spotsInResponse != spotsOffered {
+				log.Printf("WSPRNet: Warning - response mentions %d spots but we offered %d", spotsInResponse, spotsOffered)
+			}
+			if spotsAccepted == 0 {
+				log.Printf("WSPRNet: Server accepted 0 of %d spots in %.2f seconds (valid response, not retrying). Response: %s", spotsOffered, elapsed.Seconds(), bodyStr)
+			} else if spotsAccepted < spotsOffered {
+				log.Printf("WSPRNet: Partial success - %d of %d spots accepted in %.2f seconds", spotsAccepted, spotsOffered, elapsed.Seconds())
+			} else if spotsOffered > 1 {
+				log.Printf("WSPRNet: SUCCESS - Uploaded %d of %d spots in %.2f seconds", spotsAccepted, spotsOffered, elapsed.Seconds())
+			}
+			return spotsAccepted, ""
+		}
+	}
+
+	// If we got a 200 response but couldn't parse the spot count, this is likely an error
+	// The response should always include "X out of Y spot(s) added" if successful
+	if resp.StatusCode == 200 {
+		// The legacy single-spot path may just say the spot was added
+		if spotsOffered == 1 && strings.Contains(bodyStr, "added") {
+			return 1, ""
+		}
+		// Check if response indicates no spots were processed (just "Processing took X milliseconds")
+		if strings.Contains(bodyStr, "Processing took") && !strings.Contains(bodyStr, "spot") {
+			log.Printf("WSPRNet: FAILED - Server processed request but added no spots in %.2f seconds. Response: %s", elapsed.Seconds(), bodyStr)
+			return w.failed(statusClass(resp.StatusCode), resp.StatusCode, "no spots added: "+bodyStr)
+		}
+		log.Printf("WSPRNet: WARNING - Got 200 response in %.2f seconds but couldn't parse spot count. Response: %s", elapsed.Seconds(), bodyStr)
+		// Don't assume success - return failure to trigger retry
+		return w.failed(statusClass(resp.StatusCode), resp.StatusCode, "unrecognised response: "+bodyStr)
+	}
+
+	log.Printf("WSPRNet: FAILED - Unexpected response after %.2f seconds: %d %s, body: %s", elapsed.Seconds(), resp.StatusCode, resp.Status, bodyStr)
+	return w.failed(statusClass(resp.StatusCode), resp.StatusCode, resp.Status)
+}
+
+// failed records a failed upload attempt and returns send's failure result
+func (w *WSPRNet) failed(category string, status int, detail string) (int, string) {
+	w.recordFailure(category, status, detail)
+	return 0, category
+}
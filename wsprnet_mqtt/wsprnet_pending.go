@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultPendingFile is where spots still waiting to be uploaded are saved at shutdown
+const DefaultPendingFile = "wsprnet_pending.json"
+
+// pendingUploads is the pending file: the batches on the retry queue (held for
+// quiet hours or backing off after a failure) and the reports not yet batched
+type pendingUploads struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Batches []WSPRBatch  `json:"batches,omitempty"`
+	Reports []WSPRReport `json:"reports,omitempty"`
+}
+
+// SetPendingFile sets the file spots still waiting to be uploaded are saved to
+// by Stop and reloaded from by Connect. Must be called before Connect.
+func (w *WSPRNet) SetPendingFile(path string) {
+	w.pendingFile = path
+}
+
+// loadPending puts the spots saved by the last Stop back on the queues and
+// removes the file, so they are uploaded once and only once. Held batches keep
+// their retry count and due time; a quiet hours window that has since ended
+// makes them due at once.
+func (w *WSPRNet) loadPending() error {
+	if w.pendingFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(w.pendingFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read pending uploads: %w", err)
+	}
+
+	var pending pendingUploads
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("failed to parse pending uploads: %w", err)
+	}
+
+	spots := len(pending.Reports)
+	w.retryMutex.Lock()
+	for _, batch := range pending.Batches {
+		w.retryQueue = append(w.retryQueue, batch)
+		spots += len(batch.Reports)
+	}
+	w.retryMutex.Unlock()
+	w.queueMutex.Lock()
+	w.reportQueue = append(w.reportQueue, pending.Reports...)
+	w.queueMutex.Unlock()
+
+	if err := os.Remove(w.pendingFile); err != nil {
+		return fmt.Errorf("failed to remove pending uploads: %w", err)
+	}
+	log.Printf("WSPRNet: Restored %d spots waiting to be uploaded (saved %s ago)",
+		spots, time.Since(pending.SavedAt).Round(time.Second))
+	return nil
+}
+
+// savePending writes the spots still on the queues to the pending file. Called
+// by Stop once the workers have finished. The file replaces any old one
+// atomically.
+func (w *WSPRNet) savePending() error {
+	w.retryMutex.Lock()
+	pending := pendingUploads{SavedAt: time.Now(), Batches: append([]WSPRBatch(nil), w.retryQueue...)}
+	w.retryMutex.Unlock()
+	w.queueMutex.Lock()
+	pending.Reports = append([]WSPRReport(nil), w.reportQueue...)
+	w.queueMutex.Unlock()
+
+	spots := len(pending.Reports)
+	for _, batch := range pending.Batches {
+		spots += len(batch.Reports)
+	}
+	if spots == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to encode pending uploads: %w", err)
+	}
+	tmpPath := w.pendingFile + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pending uploads: %w", err)
+	}
+	if err := os.Rename(tmpPath, w.pendingFile); err != nil {
+		return fmt.Errorf("failed to replace pending uploads: %w", err)
+	}
+	log.Printf("WSPRNet: Saved %d spots waiting to be uploaded to %s", spots, w.pendingFile)
+	return nil
+}
+
+// failPending empties the queues, counting their spots as failed with reason
+func (w *WSPRNet) failPending(reason string) {
+	w.retryMutex.Lock()
+	batches := w.retryQueue
+	w.retryQueue = nil
+	w.retryMutex.Unlock()
+	w.queueMutex.Lock()
+	reports := w.reportQueue
+	w.reportQueue = nil
+	w.queueMutex.Unlock()
+
+	for _, batch := range batches {
+		reports = append(reports, batch.Reports...)
+	}
+	if len(reports) == 0 {
+		return
+	}
+
+	w.statsMutex.Lock()
+	w.countSendsErrored += len(reports)
+	w.statsMutex.Unlock()
+	log.Printf("WSPRNet: %d spots %s", len(reports), reason)
+	w.reportResult(reports, false, reason)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestWSPRNet returns a client uploading to serverURL, not connected
+func newTestWSPRNet(t *testing.T, serverURL string, dryRun bool) *WSPRNet {
+	t.Helper()
+
+	w, err := NewWSPRNet(serverURL, "N0CALL", "IO91wm", "test", "", dryRun)
+	if err != nil {
+		t.Fatalf("NewWSPRNet: %v", err)
+	}
+	return w
+}
+
+func TestProbeSubmitMethod(t *testing.T) {
+	// WSPRNet behind a proxy that only lets the legacy POST interface through
+	var requests sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Store(r.Method+" "+r.URL.Path, true)
+		if r.Method != http.MethodPost || r.URL.Path != "/post/" {
+			http.Error(rw, "blocked", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		configured string
+		request    string // Request the probe sends
+		method     string // Method used afterwards
+		probe      string // submit_probe result, up to the first space
+	}{
+		{SubmitMethodMEPT, "POST /meptspots.php", SubmitMethodMEPT, "mept:"},
+		{SubmitMethodPost, "POST /post/", SubmitMethodPost, "ok"},
+		{SubmitMethodGet, "GET /post/", SubmitMethodGet, "get:"},
+		{SubmitMethodAuto, "POST /post/", SubmitMethodPost, "ok"},
+	}
+	for _, tt := range tests {
+		requests.Range(func(k, _ any) bool { requests.Delete(k); return true })
+		w := newTestWSPRNet(t, server.URL, false)
+		w.SetSubmitMethod(tt.configured)
+		w.ProbeSubmitMethod()
+
+		if _, ok := requests.Load(tt.request); !ok {
+			t.Errorf("%s: probe did not send %s", tt.configured, tt.request)
+		}
+		stats := w.GetStats()
+		if stats["submit_method"] != tt.method {
+			t.Errorf("%s: submit_method = %v, want %s", tt.configured, stats["submit_method"], tt.method)
+		}
+		if probe, _ := stats["submit_probe"].(string); len(probe) < len(tt.probe) || probe[:len(tt.probe)] != tt.probe {
+			t.Errorf("%s: submit_probe = %q, want it to start %q", tt.configured, probe, tt.probe)
+		}
+	}
+}
+
+func TestProbeSubmitMethodDryRun(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	for _, method := range []string{SubmitMethodMEPT, SubmitMethodPost, SubmitMethodGet, SubmitMethodAuto} {
+		w := newTestWSPRNet(t, server.URL, true)
+		w.SetSubmitMethod(method)
+		w.ProbeSubmitMethod()
+
+		want := method
+		if method == SubmitMethodAuto {
+			want = submitMethodOrder[0]
+		}
+		stats := w.GetStats()
+		if stats["submit_method"] != want || stats["submit_probe"] != "ok" {
+			t.Errorf("%s: submit_method %v, submit_probe %v, want %s, ok", method, stats["submit_method"], stats["submit_probe"], want)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("dry run probes sent %d requests, want none", n)
+	}
+
+	// A request that can't be built fails the probe without sending anything
+	w := newTestWSPRNet(t, "http://[::1", true)
+	w.SetSubmitMethod(SubmitMethodPost)
+	w.ProbeSubmitMethod()
+	if probe := w.GetStats()["submit_probe"]; probe == "ok" {
+		t.Errorf("probe with a bad URL = %v, want an error", probe)
+	}
+}
+
+// TestProbeWhileFallingBack has uploads fall back to the next method while
+// every method fails the startup probe. Run with -race: the probe must not
+// change the auto mode setting uploads read.
+func TestProbeWhileFallingBack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Error(rw, "gone", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	w := newTestWSPRNet(t, server.URL, false)
+	w.SetSubmitMethod(SubmitMethodAuto)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// A late failure of a method no longer in use changes nothing
+			w.fallBack(SubmitMethodGet, "4xx")
+		}
+	}()
+	// Several probes, so uploads overlap the end of one where it gives up
+	for i := 0; i < 5; i++ {
+		w.ProbeSubmitMethod()
+	}
+	close(done)
+	wg.Wait()
+
+	if method := w.activeMethod(); method != submitMethodOrder[0] {
+		t.Errorf("active method = %q after every probe failed, want %s", method, submitMethodOrder[0])
+	}
+	if !w.autoMethod {
+		t.Error("auto mode was turned off by the probe")
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	w := newTestWSPRNet(t, "", false)
+	now := time.Now()
+
+	// A batch held for quiet hours ahead of ones whose backoff has ended
+	w.retryQueue = []WSPRBatch{
+		{RetryCount: 0, NextRetryTime: now.Add(time.Hour)},
+		{RetryCount: 1, NextRetryTime: now.Add(-time.Minute)},
+		{RetryCount: 2, NextRetryTime: now.Add(-5 * time.Minute)},
+		{RetryCount: 3, NextRetryTime: now.Add(time.Second)},
+		{RetryCount: 4, NextRetryTime: now.Add(-5 * time.Minute)},
+	}
+
+	// Due batches come out earliest first, in queue order when due together
+	for _, want := range []int{2, 4, 1} {
+		batch, ok := w.nextRetry(now)
+		if !ok {
+			t.Fatalf("nextRetry found nothing, want batch %d", want)
+		}
+		if batch.RetryCount != want {
+			t.Errorf("nextRetry = batch %d, want %d", batch.RetryCount, want)
+		}
+	}
+	if batch, ok := w.nextRetry(now); ok {
+		t.Errorf("nextRetry = batch %d, want none due", batch.RetryCount)
+	}
+
+	// The batches not yet due are left in order
+	if len(w.retryQueue) != 2 || w.retryQueue[0].RetryCount != 0 || w.retryQueue[1].RetryCount != 3 {
+		t.Errorf("retry queue left with %+v, want batches 0 and 3", w.retryQueue)
+	}
+	if batch, ok := w.nextRetry(now.Add(2 * time.Second)); !ok || batch.RetryCount != 3 {
+		t.Errorf("nextRetry once batch 3 is due = %d, %v, want 3", batch.RetryCount, ok)
+	}
+}
+
+// TestPendingUploadsAtStop saves the spots still waiting at Stop and puts them
+// back on the queues at the next start, or fails them without a pending file
+func TestPendingUploadsAtStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultPendingFile)
+	now := time.Now().Truncate(2 * time.Minute)
+	heldUntil := now.Add(time.Hour).UTC()
+	queued := func(w *WSPRNet) {
+		// Stopped with a batch held for quiet hours and a report not yet batched
+		w.running = true
+		w.retryQueue = append(w.retryQueue, WSPRBatch{
+			Reports:       []WSPRReport{{Callsign: "K1ABC", Locator: "FN31", Frequency: 14097100, ReceiverFreq: 14097100, EpochTime: now}},
+			RetryCount:    1,
+			NextRetryTime: heldUntil,
+		})
+		w.reportQueue = append(w.reportQueue, WSPRReport{Callsign: "K1XYZ", Locator: "FN42", Frequency: 7040100, ReceiverFreq: 7040100, EpochTime: now})
+	}
+
+	w := newTestWSPRNet(t, "", false)
+	w.SetPendingFile(path)
+	queued(w)
+	w.Stop()
+
+	restarted := newTestWSPRNet(t, "", false)
+	restarted.SetPendingFile(path)
+	if err := restarted.loadPending(); err != nil {
+		t.Fatalf("loadPending: %v", err)
+	}
+	if len(restarted.retryQueue) != 1 {
+		t.Fatalf("retry queue after restart = %+v, want the held batch", restarted.retryQueue)
+	}
+	if batch := restarted.retryQueue[0]; batch.RetryCount != 1 || !batch.NextRetryTime.Equal(heldUntil) ||
+		len(batch.Reports) != 1 || batch.Reports[0].Callsign != "K1ABC" || !batch.Reports[0].EpochTime.Equal(now) {
+		t.Errorf("held batch after restart = %+v, want K1ABC held until %s", batch, heldUntil)
+	}
+	if len(restarted.reportQueue) != 1 || restarted.reportQueue[0].Callsign != "K1XYZ" {
+		t.Errorf("report queue after restart = %+v, want K1XYZ", restarted.reportQueue)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pending file still there after loading: %v", err)
+	}
+
+	// Without a pending file the spots are failed rather than left pending
+	var failed []string
+	w = newTestWSPRNet(t, "", false)
+	w.SetResultCallback(func(reports []WSPRReport, submitted bool, errorMsg string) {
+		for _, r := range reports {
+			if !submitted && errorMsg != "" {
+				failed = append(failed, r.Callsign)
+			}
+		}
+	})
+	queued(w)
+	w.Stop()
+	if len(failed) != 2 {
+		t.Errorf("spots failed at Stop = %v, want K1ABC and K1XYZ", failed)
+	}
+	if errored := w.GetStats()["failed"]; errored != 2 {
+		t.Errorf("failed count = %v, want 2", errored)
+	}
+}